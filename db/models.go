@@ -9,13 +9,32 @@ import (
 	"time"
 )
 
+type AiAttachment struct {
+	ID             int64         `json:"id"`
+	MessageID      int64         `json:"message_id"`
+	ConversationID int64         `json:"conversation_id"`
+	UserID         int64         `json:"user_id"`
+	FileName       string        `json:"file_name"`
+	FileType       string        `json:"file_type"`
+	Size           int64         `json:"size"`
+	ContentHash    string        `json:"content_hash"`
+	Data           []byte        `json:"data"`
+	ExtractedText  string        `json:"extracted_text"`
+	TextLength     sql.NullInt64 `json:"text_length"`
+	Truncated      sql.NullInt64 `json:"truncated"`
+	Pages          sql.NullInt64 `json:"pages"`
+	CreatedAt      sql.NullTime  `json:"created_at"`
+}
+
 type AiConversation struct {
-	ID        int64          `json:"id"`
-	UserID    int64          `json:"user_id"`
-	Title     sql.NullString `json:"title"`
-	Model     sql.NullString `json:"model"`
-	CreatedAt sql.NullTime   `json:"created_at"`
-	UpdatedAt sql.NullTime   `json:"updated_at"`
+	ID               int64          `json:"id"`
+	UserID           int64          `json:"user_id"`
+	Title            sql.NullString `json:"title"`
+	Model            sql.NullString `json:"model"`
+	CreatedAt        sql.NullTime   `json:"created_at"`
+	UpdatedAt        sql.NullTime   `json:"updated_at"`
+	Summary          sql.NullString `json:"summary"`
+	SummaryMessageID sql.NullInt64  `json:"summary_message_id"`
 }
 
 type AiMessage struct {
@@ -26,6 +45,75 @@ type AiMessage struct {
 	Filtered       sql.NullInt64  `json:"filtered"`
 	FilterReason   sql.NullString `json:"filter_reason"`
 	CreatedAt      sql.NullTime   `json:"created_at"`
+	Sources        sql.NullString `json:"sources"`
+	ContextDropped sql.NullInt64  `json:"context_dropped"`
+	FilterHits     sql.NullString `json:"filter_hits"`
+	Computed       sql.NullString `json:"computed"`
+	Reasoning      sql.NullString `json:"reasoning"`
+	Status         sql.NullString `json:"status"`
+}
+
+type AiTable struct {
+	ID             int64        `json:"id"`
+	AttachmentID   int64        `json:"attachment_id"`
+	ConversationID int64        `json:"conversation_id"`
+	Name           string       `json:"name"`
+	ColumnNames    string       `json:"column_names"`
+	RowCount       int64        `json:"row_count"`
+	RowData        string       `json:"row_data"`
+	CreatedAt      sql.NullTime `json:"created_at"`
+}
+
+type ChatEvent struct {
+	ID        int64          `json:"id"`
+	Kind      string         `json:"kind"`
+	RoomID    sql.NullInt64  `json:"room_id"`
+	UserIds   sql.NullString `json:"user_ids"`
+	Payload   string         `json:"payload"`
+	CreatedAt sql.NullTime   `json:"created_at"`
+}
+
+type ChatRoom struct {
+	ID           int64          `json:"id"`
+	Slug         string         `json:"slug"`
+	Name         string         `json:"name"`
+	Description  sql.NullString `json:"description"`
+	RoomType     string         `json:"room_type"`
+	Departamento sql.NullString `json:"departamento"`
+	IsPrivate    sql.NullInt64  `json:"is_private"`
+	CreatedBy    sql.NullInt64  `json:"created_by"`
+	CreatedAt    sql.NullTime   `json:"created_at"`
+}
+
+type ChatRoomMember struct {
+	RoomID   int64          `json:"room_id"`
+	UserID   int64          `json:"user_id"`
+	Role     sql.NullString `json:"role"`
+	JoinedAt sql.NullTime   `json:"joined_at"`
+}
+
+type DirectMessage struct {
+	ID        int64        `json:"id"`
+	ThreadID  int64        `json:"thread_id"`
+	UserID    int64        `json:"user_id"`
+	Content   string       `json:"content"`
+	CreatedAt sql.NullTime `json:"created_at"`
+}
+
+type DmParticipant struct {
+	ThreadID          int64         `json:"thread_id"`
+	UserID            int64         `json:"user_id"`
+	LastReadMessageID sql.NullInt64 `json:"last_read_message_id"`
+	JoinedAt          sql.NullTime  `json:"joined_at"`
+}
+
+type DmThread struct {
+	ID        int64          `json:"id"`
+	Title     sql.NullString `json:"title"`
+	IsGroup   sql.NullInt64  `json:"is_group"`
+	CreatedBy sql.NullInt64  `json:"created_by"`
+	CreatedAt sql.NullTime   `json:"created_at"`
+	UpdatedAt sql.NullTime   `json:"updated_at"`
 }
 
 type FilterCategory struct {
@@ -37,10 +125,12 @@ type FilterCategory struct {
 }
 
 type GroupMessage struct {
-	ID        int64        `json:"id"`
-	UserID    int64        `json:"user_id"`
-	Content   string       `json:"content"`
-	CreatedAt sql.NullTime `json:"created_at"`
+	ID         int64          `json:"id"`
+	UserID     int64          `json:"user_id"`
+	Content    string         `json:"content"`
+	CreatedAt  sql.NullTime   `json:"created_at"`
+	RoomID     sql.NullInt64  `json:"room_id"`
+	FilterHits sql.NullString `json:"filter_hits"`
 }
 
 type KnowledgeBase struct {
@@ -55,6 +145,15 @@ type KnowledgeBase struct {
 	ApprovedAt  sql.NullTime   `json:"approved_at"`
 }
 
+type KnowledgeChunk struct {
+	ID          int64          `json:"id"`
+	KnowledgeID int64          `json:"knowledge_id"`
+	ChunkIndex  int64          `json:"chunk_index"`
+	Content     string         `json:"content"`
+	Embedding   sql.NullString `json:"embedding"`
+	CreatedAt   sql.NullTime   `json:"created_at"`
+}
+
 type KnowledgeSubmission struct {
 	ID          int64          `json:"id"`
 	Title       string         `json:"title"`
@@ -78,6 +177,17 @@ type Notification struct {
 	CreatedAt sql.NullTime  `json:"created_at"`
 }
 
+type ScrapedPage struct {
+	ID          int64          `json:"id"`
+	Url         string         `json:"url"`
+	Title       sql.NullString `json:"title"`
+	Content     string         `json:"content"`
+	ContentHash string         `json:"content_hash"`
+	Method      sql.NullString `json:"method"`
+	ScrapedAt   sql.NullTime   `json:"scraped_at"`
+	ExpiresAt   time.Time      `json:"expires_at"`
+}
+
 type SecurityFilter struct {
 	ID          int64          `json:"id"`
 	Name        string         `json:"name"`
@@ -133,6 +243,16 @@ type UnansweredQuestion struct {
 	AnsweredAt     sql.NullTime   `json:"answered_at"`
 }
 
+type UrlFetch struct {
+	ID          int64          `json:"id"`
+	UserID      sql.NullInt64  `json:"user_id"`
+	Url         string         `json:"url"`
+	Status      string         `json:"status"`
+	ContentHash sql.NullString `json:"content_hash"`
+	Error       sql.NullString `json:"error"`
+	CreatedAt   sql.NullTime   `json:"created_at"`
+}
+
 type User struct {
 	ID           int64          `json:"id"`
 	Nomina       string         `json:"nomina"`
@@ -144,3 +264,20 @@ type User struct {
 	CreatedAt    sql.NullTime   `json:"created_at"`
 	UpdatedAt    sql.NullTime   `json:"updated_at"`
 }
+
+type WebSource struct {
+	ID              int64          `json:"id"`
+	Url             string         `json:"url"`
+	Title           string         `json:"title"`
+	Category        sql.NullString `json:"category"`
+	IntervalMinutes int64          `json:"interval_minutes"`
+	AutoUpdate      sql.NullInt64  `json:"auto_update"`
+	KnowledgeID     sql.NullInt64  `json:"knowledge_id"`
+	LastHash        sql.NullString `json:"last_hash"`
+	LastError       sql.NullString `json:"last_error"`
+	LastCheckedAt   sql.NullTime   `json:"last_checked_at"`
+	LastChangedAt   sql.NullTime   `json:"last_changed_at"`
+	IsActive        sql.NullInt64  `json:"is_active"`
+	CreatedBy       int64          `json:"created_by"`
+	CreatedAt       sql.NullTime   `json:"created_at"`
+}
@@ -10,58 +10,85 @@ import (
 )
 
 type Querier interface {
+	AddChatRoomMember(ctx context.Context, arg AddChatRoomMemberParams) (sql.Result, error)
+	AddDMParticipant(ctx context.Context, arg AddDMParticipantParams) (sql.Result, error)
 	AnswerQuestion(ctx context.Context, arg AnswerQuestionParams) (sql.Result, error)
 	ApproveSubmission(ctx context.Context, arg ApproveSubmissionParams) (sql.Result, error)
 	ApproveUser(ctx context.Context, id int64) (sql.Result, error)
+	ClaimWebSource(ctx context.Context, id int64) (sql.Result, error)
 	CountActiveFilters(ctx context.Context) (int64, error)
 	CountActiveKnowledge(ctx context.Context) (int64, error)
 	CountActiveSessions(ctx context.Context) (int64, error)
 	CountConversationMessages(ctx context.Context, conversationID int64) (int64, error)
+	CountConversationMessagesAfter(ctx context.Context, arg CountConversationMessagesAfterParams) (int64, error)
 	CountGroupMessages(ctx context.Context) (int64, error)
 	CountPendingQuestions(ctx context.Context) (int64, error)
+	CountPendingQuestionsByText(ctx context.Context, question string) (int64, error)
 	CountPendingSubmissions(ctx context.Context) (int64, error)
 	CountSecurityLogsByUser(ctx context.Context, userID int64) (int64, error)
 	CountSecurityLogsToday(ctx context.Context) (int64, error)
+	CountUnreadDirectMessages(ctx context.Context, userID int64) (int64, error)
 	CountUnreadNotifications(ctx context.Context, userID int64) (int64, error)
 	CountUserConversations(ctx context.Context, userID int64) (int64, error)
+	CreateAIAttachment(ctx context.Context, arg CreateAIAttachmentParams) (int64, error)
 	// ============ AI CONVERSATIONS ============
 	CreateAIConversation(ctx context.Context, arg CreateAIConversationParams) (AiConversation, error)
 	// ============ AI MESSAGES ============
 	CreateAIMessage(ctx context.Context, arg CreateAIMessageParams) (AiMessage, error)
+	CreateAITable(ctx context.Context, arg CreateAITableParams) error
+	CreateChatEvent(ctx context.Context, arg CreateChatEventParams) (int64, error)
+	CreateChatRoom(ctx context.Context, arg CreateChatRoomParams) (ChatRoom, error)
+	CreateDMThread(ctx context.Context, arg CreateDMThreadParams) (DmThread, error)
+	CreateDirectMessage(ctx context.Context, arg CreateDirectMessageParams) (DirectMessage, error)
 	CreateFilterCategory(ctx context.Context, arg CreateFilterCategoryParams) (FilterCategory, error)
 	// ============ GROUP CHAT ============
 	CreateGroupMessage(ctx context.Context, arg CreateGroupMessageParams) (GroupMessage, error)
 	// ============ KNOWLEDGE BASE ============
 	CreateKnowledge(ctx context.Context, arg CreateKnowledgeParams) (KnowledgeBase, error)
+	// ============ KNOWLEDGE CHUNKS ============
+	CreateKnowledgeChunk(ctx context.Context, arg CreateKnowledgeChunkParams) (KnowledgeChunk, error)
 	// ============ KNOWLEDGE SUBMISSIONS ============
 	CreateKnowledgeSubmission(ctx context.Context, arg CreateKnowledgeSubmissionParams) (KnowledgeSubmission, error)
 	// ============ NOTIFICATIONS ============
 	CreateNotification(ctx context.Context, arg CreateNotificationParams) (Notification, error)
+	CreatePendingAIMessage(ctx context.Context, conversationID int64) (int64, error)
 	// ============ SECURITY FILTERS ============
 	CreateSecurityFilter(ctx context.Context, arg CreateSecurityFilterParams) (SecurityFilter, error)
 	// ============ SECURITY LOGS ============
 	CreateSecurityLog(ctx context.Context, arg CreateSecurityLogParams) (SecurityLog, error)
 	// ============ SESSIONS ============
 	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	CreateURLFetch(ctx context.Context, arg CreateURLFetchParams) error
 	// ============ UNANSWERED QUESTIONS ============
 	CreateUnansweredQuestion(ctx context.Context, arg CreateUnansweredQuestionParams) (UnansweredQuestion, error)
 	// ============ USERS ============
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateWebSource(ctx context.Context, arg CreateWebSourceParams) (WebSource, error)
+	DeleteAIMessage(ctx context.Context, id int64) (sql.Result, error)
+	DeleteAllScrapedPages(ctx context.Context) (sql.Result, error)
+	DeleteChatRoom(ctx context.Context, id int64) (sql.Result, error)
 	DeleteConfig(ctx context.Context, key string) (sql.Result, error)
 	DeleteConversation(ctx context.Context, arg DeleteConversationParams) (sql.Result, error)
 	DeleteExpiredSessions(ctx context.Context) (sql.Result, error)
 	DeleteFilterCategory(ctx context.Context, id int64) (sql.Result, error)
 	DeleteKnowledge(ctx context.Context, id int64) (sql.Result, error)
+	DeleteKnowledgeChunks(ctx context.Context, knowledgeID int64) (sql.Result, error)
+	DeleteOldChatEvents(ctx context.Context) (sql.Result, error)
 	DeleteOldNotifications(ctx context.Context) (sql.Result, error)
+	DeleteScrapedPage(ctx context.Context, id int64) (sql.Result, error)
 	DeleteSecurityFilter(ctx context.Context, id int64) (sql.Result, error)
 	DeleteSession(ctx context.Context, token string) (sql.Result, error)
 	DeleteUser(ctx context.Context, id int64) (sql.Result, error)
 	DeleteUserSessions(ctx context.Context, userID int64) (sql.Result, error)
-	SetUserAdmin(ctx context.Context, arg SetUserAdminParams) (sql.Result, error)
+	DeleteWebSource(ctx context.Context, id int64) (sql.Result, error)
+	FinishAIMessage(ctx context.Context, arg FinishAIMessageParams) (sql.Result, error)
+	GetAIAttachmentForOwner(ctx context.Context, arg GetAIAttachmentForOwnerParams) (GetAIAttachmentForOwnerRow, error)
 	GetActiveFilterCategories(ctx context.Context) ([]FilterCategory, error)
 	GetActiveKnowledge(ctx context.Context) ([]GetActiveKnowledgeRow, error)
+	GetActiveKnowledgeChunks(ctx context.Context) ([]GetActiveKnowledgeChunksRow, error)
 	GetActiveSecurityFilters(ctx context.Context) ([]SecurityFilter, error)
 	GetAdminUserIDs(ctx context.Context) ([]int64, error)
+	GetAllChatRooms(ctx context.Context) ([]GetAllChatRoomsRow, error)
 	GetAllConfig(ctx context.Context) ([]SystemConfig, error)
 	GetAllKnowledge(ctx context.Context) ([]GetAllKnowledgeRow, error)
 	GetAllQuestions(ctx context.Context) ([]GetAllQuestionsRow, error)
@@ -69,27 +96,47 @@ type Querier interface {
 	GetAllSubmissions(ctx context.Context) ([]GetAllSubmissionsRow, error)
 	GetAllUsers(ctx context.Context) ([]GetAllUsersRow, error)
 	GetApprovedUsers(ctx context.Context) ([]GetApprovedUsersRow, error)
+	GetChatEventsAfter(ctx context.Context, arg GetChatEventsAfterParams) ([]GetChatEventsAfterRow, error)
+	GetChatRoomByID(ctx context.Context, id int64) (ChatRoom, error)
+	GetChatRoomBySlug(ctx context.Context, slug string) (ChatRoom, error)
+	GetChatRoomMember(ctx context.Context, arg GetChatRoomMemberParams) (ChatRoomMember, error)
+	GetChatRoomMembers(ctx context.Context, roomID int64) ([]GetChatRoomMembersRow, error)
 	// ============ SYSTEM CONFIG ============
 	GetConfig(ctx context.Context, key string) (string, error)
 	GetConversation(ctx context.Context, arg GetConversationParams) (AiConversation, error)
+	GetConversationAttachments(ctx context.Context, conversationID int64) ([]GetConversationAttachmentsRow, error)
 	GetConversationByID(ctx context.Context, id int64) (AiConversation, error)
 	GetConversationMessages(ctx context.Context, conversationID int64) ([]GetConversationMessagesRow, error)
+	GetConversationMessagesAfter(ctx context.Context, arg GetConversationMessagesAfterParams) ([]GetConversationMessagesAfterRow, error)
+	GetConversationTables(ctx context.Context, conversationID int64) ([]GetConversationTablesRow, error)
+	GetDMParticipant(ctx context.Context, arg GetDMParticipantParams) (DmParticipant, error)
+	GetDMParticipantIDs(ctx context.Context, threadID int64) ([]int64, error)
+	GetDMThreadByID(ctx context.Context, id int64) (DmThread, error)
 	// ============ STATISTICS ============
 	GetDashboardStats(ctx context.Context) (GetDashboardStatsRow, error)
+	GetDirectThreadBetween(ctx context.Context, arg GetDirectThreadBetweenParams) (int64, error)
+	GetDueWebSources(ctx context.Context) ([]WebSource, error)
 	// ============ FILTER CATEGORIES ============
 	GetFilterCategories(ctx context.Context) ([]FilterCategory, error)
 	GetFilteredMessages(ctx context.Context, limit int64) ([]GetFilteredMessagesRow, error)
-	GetGroupMessagesSince(ctx context.Context, id int64) ([]GetGroupMessagesSinceRow, error)
+	GetFreshScrapedPage(ctx context.Context, url string) (ScrapedPage, error)
+	GetGroupMessagesSince(ctx context.Context, arg GetGroupMessagesSinceParams) ([]GetGroupMessagesSinceRow, error)
+	GetJoinableChatRooms(ctx context.Context, userID int64) ([]GetJoinableChatRoomsRow, error)
 	GetKnowledgeByCategory(ctx context.Context, category sql.NullString) ([]GetKnowledgeByCategoryRow, error)
 	GetKnowledgeByID(ctx context.Context, id int64) (KnowledgeBase, error)
 	GetKnowledgeContext(ctx context.Context) ([]GetKnowledgeContextRow, error)
+	GetLatestChatEventID(ctx context.Context) (int64, error)
 	GetPendingQuestions(ctx context.Context) ([]GetPendingQuestionsRow, error)
 	GetPendingSubmissions(ctx context.Context) ([]GetPendingSubmissionsRow, error)
 	GetPendingUsers(ctx context.Context) ([]GetPendingUsersRow, error)
 	GetQuestionByID(ctx context.Context, id int64) (UnansweredQuestion, error)
 	GetRecentConversationMessages(ctx context.Context, arg GetRecentConversationMessagesParams) ([]GetRecentConversationMessagesRow, error)
-	GetRecentGroupMessages(ctx context.Context, limit int64) ([]GetRecentGroupMessagesRow, error)
+	GetRecentDirectMessages(ctx context.Context, arg GetRecentDirectMessagesParams) ([]GetRecentDirectMessagesRow, error)
+	GetRecentGroupMessages(ctx context.Context, arg GetRecentGroupMessagesParams) ([]GetRecentGroupMessagesRow, error)
 	GetRecentSecurityLogs(ctx context.Context, limit int64) ([]GetRecentSecurityLogsRow, error)
+	GetRecentURLFetches(ctx context.Context, limit int64) ([]GetRecentURLFetchesRow, error)
+	GetScrapedPageByID(ctx context.Context, id int64) (ScrapedPage, error)
+	GetScrapedPages(ctx context.Context, limit int64) ([]GetScrapedPagesRow, error)
 	GetSecurityFilterByID(ctx context.Context, id int64) (SecurityFilter, error)
 	GetSecurityFiltersByAppliesTo(ctx context.Context, appliesTo sql.NullString) ([]SecurityFilter, error)
 	GetSecurityFiltersByType(ctx context.Context, filterType string) ([]SecurityFilter, error)
@@ -99,19 +146,37 @@ type Querier interface {
 	GetSessionByToken(ctx context.Context, token string) (GetSessionByTokenRow, error)
 	GetSubmissionByID(ctx context.Context, id int64) (GetSubmissionByIDRow, error)
 	GetSubmissionsByUser(ctx context.Context, submittedBy int64) ([]KnowledgeSubmission, error)
+	GetUnindexedKnowledgeIDs(ctx context.Context) ([]int64, error)
 	GetUnreadNotifications(ctx context.Context, userID int64) ([]Notification, error)
 	GetUserByID(ctx context.Context, id int64) (User, error)
 	GetUserByNomina(ctx context.Context, nomina string) (User, error)
+	GetUserChatRooms(ctx context.Context, userID int64) ([]GetUserChatRoomsRow, error)
 	GetUserConversations(ctx context.Context, userID int64) ([]GetUserConversationsRow, error)
+	GetUserDMThreads(ctx context.Context, userID int64) ([]GetUserDMThreadsRow, error)
 	GetUserNotifications(ctx context.Context, arg GetUserNotificationsParams) ([]Notification, error)
+	GetWebSourceByID(ctx context.Context, id int64) (WebSource, error)
+	GetWebSources(ctx context.Context) ([]WebSource, error)
 	IgnoreQuestion(ctx context.Context, arg IgnoreQuestionParams) (sql.Result, error)
 	MarkAllNotificationsRead(ctx context.Context, userID int64) (sql.Result, error)
+	MarkDMThreadRead(ctx context.Context, arg MarkDMThreadReadParams) (sql.Result, error)
 	MarkNotificationRead(ctx context.Context, arg MarkNotificationReadParams) (sql.Result, error)
 	RejectSubmission(ctx context.Context, arg RejectSubmissionParams) (sql.Result, error)
 	RejectUser(ctx context.Context, id int64) (sql.Result, error)
+	RemoveChatRoomMember(ctx context.Context, arg RemoveChatRoomMemberParams) (sql.Result, error)
+	SaveConversationSummary(ctx context.Context, arg SaveConversationSummaryParams) (sql.Result, error)
+	SetAIMessageComputed(ctx context.Context, arg SetAIMessageComputedParams) (sql.Result, error)
+	SetAIMessageReasoning(ctx context.Context, arg SetAIMessageReasoningParams) (sql.Result, error)
+	SetAIMessageContextDropped(ctx context.Context, arg SetAIMessageContextDroppedParams) (sql.Result, error)
+	SetAIMessageSources(ctx context.Context, arg SetAIMessageSourcesParams) (sql.Result, error)
 	SetConfig(ctx context.Context, arg SetConfigParams) (sql.Result, error)
+	SetUserAdmin(ctx context.Context, arg SetUserAdminParams) (sql.Result, error)
 	ToggleSecurityFilter(ctx context.Context, arg ToggleSecurityFilterParams) (sql.Result, error)
+	ToggleWebSource(ctx context.Context, arg ToggleWebSourceParams) (sql.Result, error)
 	TouchConversation(ctx context.Context, id int64) (sql.Result, error)
+	TouchDMThread(ctx context.Context, id int64) (sql.Result, error)
+	UpdateAIMessageProgress(ctx context.Context, arg UpdateAIMessageProgressParams) (sql.Result, error)
+	UpdateChatRoomPrivacy(ctx context.Context, arg UpdateChatRoomPrivacyParams) (sql.Result, error)
+	UpdateConversationSummary(ctx context.Context, arg UpdateConversationSummaryParams) (sql.Result, error)
 	UpdateConversationTitle(ctx context.Context, arg UpdateConversationTitleParams) (sql.Result, error)
 	UpdateFilterCategory(ctx context.Context, arg UpdateFilterCategoryParams) (sql.Result, error)
 	UpdateKnowledge(ctx context.Context, arg UpdateKnowledgeParams) (sql.Result, error)
@@ -119,6 +184,9 @@ type Querier interface {
 	UpdateUserDepartamento(ctx context.Context, arg UpdateUserDepartamentoParams) (sql.Result, error)
 	// ============ PASSWORD CHANGE ============
 	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (sql.Result, error)
+	UpdateWebSourceChanged(ctx context.Context, arg UpdateWebSourceChangedParams) error
+	UpdateWebSourceChecked(ctx context.Context, arg UpdateWebSourceCheckedParams) error
+	UpsertScrapedPage(ctx context.Context, arg UpsertScrapedPageParams) (ScrapedPage, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,6 +11,35 @@ import (
 	"time"
 )
 
+const addChatRoomMember = `-- name: AddChatRoomMember :execresult
+INSERT OR IGNORE INTO chat_room_members (room_id, user_id, role)
+VALUES (?, ?, ?)
+`
+
+type AddChatRoomMemberParams struct {
+	RoomID int64          `json:"room_id"`
+	UserID int64          `json:"user_id"`
+	Role   sql.NullString `json:"role"`
+}
+
+func (q *Queries) AddChatRoomMember(ctx context.Context, arg AddChatRoomMemberParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, addChatRoomMember, arg.RoomID, arg.UserID, arg.Role)
+}
+
+const addDMParticipant = `-- name: AddDMParticipant :execresult
+INSERT OR IGNORE INTO dm_participants (thread_id, user_id)
+VALUES (?, ?)
+`
+
+type AddDMParticipantParams struct {
+	ThreadID int64 `json:"thread_id"`
+	UserID   int64 `json:"user_id"`
+}
+
+func (q *Queries) AddDMParticipant(ctx context.Context, arg AddDMParticipantParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, addDMParticipant, arg.ThreadID, arg.UserID)
+}
+
 const answerQuestion = `-- name: AnswerQuestion :execresult
 UPDATE unanswered_questions
 SET answer = ?, answered_by = ?, status = 'answered', answered_at = datetime('now'), add_to_knowledge = ?
@@ -58,6 +87,16 @@ func (q *Queries) ApproveUser(ctx context.Context, id int64) (sql.Result, error)
 	return q.db.ExecContext(ctx, approveUser, id)
 }
 
+const claimWebSource = `-- name: ClaimWebSource :execresult
+UPDATE web_sources SET last_checked_at = datetime('now')
+WHERE id = ?
+  AND (last_checked_at IS NULL OR last_checked_at <= datetime('now', '-' || interval_minutes || ' minutes'))
+`
+
+func (q *Queries) ClaimWebSource(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, claimWebSource, id)
+}
+
 const countActiveFilters = `-- name: CountActiveFilters :one
 SELECT COUNT(*) as count FROM security_filters WHERE is_active = 1
 `
@@ -102,6 +141,22 @@ func (q *Queries) CountConversationMessages(ctx context.Context, conversationID
 	return count, err
 }
 
+const countConversationMessagesAfter = `-- name: CountConversationMessagesAfter :one
+SELECT COUNT(*) as count FROM ai_messages WHERE conversation_id = ? AND id > ? AND status != 'generating'
+`
+
+type CountConversationMessagesAfterParams struct {
+	ConversationID int64 `json:"conversation_id"`
+	ID             int64 `json:"id"`
+}
+
+func (q *Queries) CountConversationMessagesAfter(ctx context.Context, arg CountConversationMessagesAfterParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countConversationMessagesAfter, arg.ConversationID, arg.ID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countGroupMessages = `-- name: CountGroupMessages :one
 SELECT COUNT(*) as count FROM group_messages
 `
@@ -124,6 +179,17 @@ func (q *Queries) CountPendingQuestions(ctx context.Context) (int64, error) {
 	return count, err
 }
 
+const countPendingQuestionsByText = `-- name: CountPendingQuestionsByText :one
+SELECT COUNT(*) as count FROM unanswered_questions WHERE status = 'pending' AND question = ?
+`
+
+func (q *Queries) CountPendingQuestionsByText(ctx context.Context, question string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPendingQuestionsByText, question)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countPendingSubmissions = `-- name: CountPendingSubmissions :one
 SELECT COUNT(*) as count FROM knowledge_submissions WHERE status = 'pending'
 `
@@ -158,6 +224,20 @@ func (q *Queries) CountSecurityLogsToday(ctx context.Context) (int64, error) {
 	return count, err
 }
 
+const countUnreadDirectMessages = `-- name: CountUnreadDirectMessages :one
+SELECT COUNT(*) as count
+FROM direct_messages m
+JOIN dm_participants p ON p.thread_id = m.thread_id
+WHERE p.user_id = ? AND m.id > p.last_read_message_id AND m.user_id != p.user_id
+`
+
+func (q *Queries) CountUnreadDirectMessages(ctx context.Context, userID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUnreadDirectMessages, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countUnreadNotifications = `-- name: CountUnreadNotifications :one
 SELECT COUNT(*) as count FROM notifications
 WHERE user_id = ? AND read = 0
@@ -181,11 +261,53 @@ func (q *Queries) CountUserConversations(ctx context.Context, userID int64) (int
 	return count, err
 }
 
+const createAIAttachment = `-- name: CreateAIAttachment :one
+INSERT INTO ai_attachments (message_id, conversation_id, user_id, file_name, file_type, size, content_hash, data, extracted_text, text_length, truncated, pages)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id
+`
+
+type CreateAIAttachmentParams struct {
+	MessageID      int64         `json:"message_id"`
+	ConversationID int64         `json:"conversation_id"`
+	UserID         int64         `json:"user_id"`
+	FileName       string        `json:"file_name"`
+	FileType       string        `json:"file_type"`
+	Size           int64         `json:"size"`
+	ContentHash    string        `json:"content_hash"`
+	Data           []byte        `json:"data"`
+	ExtractedText  string        `json:"extracted_text"`
+	TextLength     sql.NullInt64 `json:"text_length"`
+	Truncated      sql.NullInt64 `json:"truncated"`
+	Pages          sql.NullInt64 `json:"pages"`
+}
+
+// ============ AI ATTACHMENTS ============
+func (q *Queries) CreateAIAttachment(ctx context.Context, arg CreateAIAttachmentParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, createAIAttachment,
+		arg.MessageID,
+		arg.ConversationID,
+		arg.UserID,
+		arg.FileName,
+		arg.FileType,
+		arg.Size,
+		arg.ContentHash,
+		arg.Data,
+		arg.ExtractedText,
+		arg.TextLength,
+		arg.Truncated,
+		arg.Pages,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
 const createAIConversation = `-- name: CreateAIConversation :one
 
 INSERT INTO ai_conversations (user_id, title, model)
 VALUES (?, ?, ?)
-RETURNING id, user_id, title, model, created_at, updated_at
+RETURNING id, user_id, title, model, created_at, updated_at, summary, summary_message_id
 `
 
 type CreateAIConversationParams struct {
@@ -205,15 +327,17 @@ func (q *Queries) CreateAIConversation(ctx context.Context, arg CreateAIConversa
 		&i.Model,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Summary,
+		&i.SummaryMessageID,
 	)
 	return i, err
 }
 
 const createAIMessage = `-- name: CreateAIMessage :one
 
-INSERT INTO ai_messages (conversation_id, role, content, filtered, filter_reason)
-VALUES (?, ?, ?, ?, ?)
-RETURNING id, conversation_id, role, content, filtered, filter_reason, created_at
+INSERT INTO ai_messages (conversation_id, role, content, filtered, filter_reason, filter_hits)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, conversation_id, role, content, filtered, filter_reason, created_at, sources, context_dropped, filter_hits, computed, reasoning, status
 `
 
 type CreateAIMessageParams struct {
@@ -222,6 +346,7 @@ type CreateAIMessageParams struct {
 	Content        string         `json:"content"`
 	Filtered       sql.NullInt64  `json:"filtered"`
 	FilterReason   sql.NullString `json:"filter_reason"`
+	FilterHits     sql.NullString `json:"filter_hits"`
 }
 
 // ============ AI MESSAGES ============
@@ -232,6 +357,7 @@ func (q *Queries) CreateAIMessage(ctx context.Context, arg CreateAIMessageParams
 		arg.Content,
 		arg.Filtered,
 		arg.FilterReason,
+		arg.FilterHits,
 	)
 	var i AiMessage
 	err := row.Scan(
@@ -242,6 +368,152 @@ func (q *Queries) CreateAIMessage(ctx context.Context, arg CreateAIMessageParams
 		&i.Filtered,
 		&i.FilterReason,
 		&i.CreatedAt,
+		&i.Sources,
+		&i.ContextDropped,
+		&i.FilterHits,
+		&i.Computed,
+		&i.Reasoning,
+		&i.Status,
+	)
+	return i, err
+}
+
+const createAITable = `-- name: CreateAITable :exec
+INSERT INTO ai_tables (attachment_id, conversation_id, name, column_names, row_count, row_data)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+
+type CreateAITableParams struct {
+	AttachmentID   int64  `json:"attachment_id"`
+	ConversationID int64  `json:"conversation_id"`
+	Name           string `json:"name"`
+	ColumnNames    string `json:"column_names"`
+	RowCount       int64  `json:"row_count"`
+	RowData        string `json:"row_data"`
+}
+
+// ============ AI TABLES ============
+func (q *Queries) CreateAITable(ctx context.Context, arg CreateAITableParams) error {
+	_, err := q.db.ExecContext(ctx, createAITable,
+		arg.AttachmentID,
+		arg.ConversationID,
+		arg.Name,
+		arg.ColumnNames,
+		arg.RowCount,
+		arg.RowData,
+	)
+	return err
+}
+
+const createChatEvent = `-- name: CreateChatEvent :one
+INSERT INTO chat_events (kind, room_id, user_ids, payload)
+VALUES (?, ?, ?, ?)
+RETURNING id
+`
+
+type CreateChatEventParams struct {
+	Kind    string         `json:"kind"`
+	RoomID  sql.NullInt64  `json:"room_id"`
+	UserIds sql.NullString `json:"user_ids"`
+	Payload string         `json:"payload"`
+}
+
+func (q *Queries) CreateChatEvent(ctx context.Context, arg CreateChatEventParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, createChatEvent,
+		arg.Kind,
+		arg.RoomID,
+		arg.UserIds,
+		arg.Payload,
+	)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createChatRoom = `-- name: CreateChatRoom :one
+
+INSERT INTO chat_rooms (slug, name, description, room_type, departamento, is_private, created_by)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING id, slug, name, description, room_type, departamento, is_private, created_by, created_at
+`
+
+type CreateChatRoomParams struct {
+	Slug         string         `json:"slug"`
+	Name         string         `json:"name"`
+	Description  sql.NullString `json:"description"`
+	RoomType     string         `json:"room_type"`
+	Departamento sql.NullString `json:"departamento"`
+	IsPrivate    sql.NullInt64  `json:"is_private"`
+	CreatedBy    sql.NullInt64  `json:"created_by"`
+}
+
+// ============ CHAT ROOMS ============
+func (q *Queries) CreateChatRoom(ctx context.Context, arg CreateChatRoomParams) (ChatRoom, error) {
+	row := q.db.QueryRowContext(ctx, createChatRoom, arg.Slug, arg.Name, arg.Description, arg.RoomType, arg.Departamento, arg.IsPrivate, arg.CreatedBy)
+	var i ChatRoom
+	err := row.Scan(
+		&i.ID,
+		&i.Slug,
+		&i.Name,
+		&i.Description,
+		&i.RoomType,
+		&i.Departamento,
+		&i.IsPrivate,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createDMThread = `-- name: CreateDMThread :one
+
+INSERT INTO dm_threads (title, is_group, created_by)
+VALUES (?, ?, ?)
+RETURNING id, title, is_group, created_by, created_at, updated_at
+`
+
+type CreateDMThreadParams struct {
+	Title     sql.NullString `json:"title"`
+	IsGroup   sql.NullInt64  `json:"is_group"`
+	CreatedBy sql.NullInt64  `json:"created_by"`
+}
+
+// ============ DIRECT MESSAGES ============
+func (q *Queries) CreateDMThread(ctx context.Context, arg CreateDMThreadParams) (DmThread, error) {
+	row := q.db.QueryRowContext(ctx, createDMThread, arg.Title, arg.IsGroup, arg.CreatedBy)
+	var i DmThread
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.IsGroup,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createDirectMessage = `-- name: CreateDirectMessage :one
+INSERT INTO direct_messages (thread_id, user_id, content)
+VALUES (?, ?, ?)
+RETURNING id, thread_id, user_id, content, created_at
+`
+
+type CreateDirectMessageParams struct {
+	ThreadID int64  `json:"thread_id"`
+	UserID   int64  `json:"user_id"`
+	Content  string `json:"content"`
+}
+
+func (q *Queries) CreateDirectMessage(ctx context.Context, arg CreateDirectMessageParams) (DirectMessage, error) {
+	row := q.db.QueryRowContext(ctx, createDirectMessage, arg.ThreadID, arg.UserID, arg.Content)
+	var i DirectMessage
+	err := row.Scan(
+		&i.ID,
+		&i.ThreadID,
+		&i.UserID,
+		&i.Content,
+		&i.CreatedAt,
 	)
 	return i, err
 }
@@ -272,25 +544,34 @@ func (q *Queries) CreateFilterCategory(ctx context.Context, arg CreateFilterCate
 
 const createGroupMessage = `-- name: CreateGroupMessage :one
 
-INSERT INTO group_messages (user_id, content)
-VALUES (?, ?)
-RETURNING id, user_id, content, created_at
+INSERT INTO group_messages (user_id, content, room_id, filter_hits)
+VALUES (?, ?, ?, ?)
+RETURNING id, user_id, content, created_at, room_id, filter_hits
 `
 
 type CreateGroupMessageParams struct {
-	UserID  int64  `json:"user_id"`
-	Content string `json:"content"`
+	UserID     int64          `json:"user_id"`
+	Content    string         `json:"content"`
+	RoomID     sql.NullInt64  `json:"room_id"`
+	FilterHits sql.NullString `json:"filter_hits"`
 }
 
 // ============ GROUP CHAT ============
 func (q *Queries) CreateGroupMessage(ctx context.Context, arg CreateGroupMessageParams) (GroupMessage, error) {
-	row := q.db.QueryRowContext(ctx, createGroupMessage, arg.UserID, arg.Content)
+	row := q.db.QueryRowContext(ctx, createGroupMessage,
+		arg.UserID,
+		arg.Content,
+		arg.RoomID,
+		arg.FilterHits,
+	)
 	var i GroupMessage
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
 		&i.Content,
 		&i.CreatedAt,
+		&i.RoomID,
+		&i.FilterHits,
 	)
 	return i, err
 }
@@ -334,6 +615,40 @@ func (q *Queries) CreateKnowledge(ctx context.Context, arg CreateKnowledgeParams
 	return i, err
 }
 
+const createKnowledgeChunk = `-- name: CreateKnowledgeChunk :one
+
+INSERT INTO knowledge_chunks (knowledge_id, chunk_index, content, embedding)
+VALUES (?, ?, ?, ?)
+RETURNING id, knowledge_id, chunk_index, content, embedding, created_at
+`
+
+type CreateKnowledgeChunkParams struct {
+	KnowledgeID int64          `json:"knowledge_id"`
+	ChunkIndex  int64          `json:"chunk_index"`
+	Content     string         `json:"content"`
+	Embedding   sql.NullString `json:"embedding"`
+}
+
+// ============ KNOWLEDGE CHUNKS ============
+func (q *Queries) CreateKnowledgeChunk(ctx context.Context, arg CreateKnowledgeChunkParams) (KnowledgeChunk, error) {
+	row := q.db.QueryRowContext(ctx, createKnowledgeChunk,
+		arg.KnowledgeID,
+		arg.ChunkIndex,
+		arg.Content,
+		arg.Embedding,
+	)
+	var i KnowledgeChunk
+	err := row.Scan(
+		&i.ID,
+		&i.KnowledgeID,
+		&i.ChunkIndex,
+		&i.Content,
+		&i.Embedding,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const createKnowledgeSubmission = `-- name: CreateKnowledgeSubmission :one
 
 INSERT INTO knowledge_submissions (title, content, category, submitted_by)
@@ -407,6 +722,19 @@ func (q *Queries) CreateNotification(ctx context.Context, arg CreateNotification
 	return i, err
 }
 
+const createPendingAIMessage = `-- name: CreatePendingAIMessage :one
+INSERT INTO ai_messages (conversation_id, role, content, status)
+VALUES (?, 'assistant', '', 'generating')
+RETURNING id
+`
+
+func (q *Queries) CreatePendingAIMessage(ctx context.Context, conversationID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, createPendingAIMessage, conversationID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
 const createSecurityFilter = `-- name: CreateSecurityFilter :one
 
 INSERT INTO security_filters (name, description, filter_type, pattern, action, applies_to, severity, created_by)
@@ -522,6 +850,30 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 	return i, err
 }
 
+const createURLFetch = `-- name: CreateURLFetch :exec
+INSERT INTO url_fetches (user_id, url, status, content_hash, error)
+VALUES (?, ?, ?, ?, ?)
+`
+
+type CreateURLFetchParams struct {
+	UserID      sql.NullInt64  `json:"user_id"`
+	Url         string         `json:"url"`
+	Status      string         `json:"status"`
+	ContentHash sql.NullString `json:"content_hash"`
+	Error       sql.NullString `json:"error"`
+}
+
+func (q *Queries) CreateURLFetch(ctx context.Context, arg CreateURLFetchParams) error {
+	_, err := q.db.ExecContext(ctx, createURLFetch,
+		arg.UserID,
+		arg.Url,
+		arg.Status,
+		arg.ContentHash,
+		arg.Error,
+	)
+	return err
+}
+
 const createUnansweredQuestion = `-- name: CreateUnansweredQuestion :one
 
 INSERT INTO unanswered_questions (question, asked_by, conversation_id)
@@ -591,6 +943,76 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 	return i, err
 }
 
+const createWebSource = `-- name: CreateWebSource :one
+
+INSERT INTO web_sources (url, title, category, interval_minutes, auto_update, created_by)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, url, title, category, interval_minutes, auto_update, knowledge_id, last_hash, last_error, last_checked_at, last_changed_at, is_active, created_by, created_at
+`
+
+type CreateWebSourceParams struct {
+	Url             string         `json:"url"`
+	Title           string         `json:"title"`
+	Category        sql.NullString `json:"category"`
+	IntervalMinutes int64          `json:"interval_minutes"`
+	AutoUpdate      sql.NullInt64  `json:"auto_update"`
+	CreatedBy       int64          `json:"created_by"`
+}
+
+// ============ FUENTES WEB DE CONOCIMIENTO ============
+func (q *Queries) CreateWebSource(ctx context.Context, arg CreateWebSourceParams) (WebSource, error) {
+	row := q.db.QueryRowContext(ctx, createWebSource,
+		arg.Url,
+		arg.Title,
+		arg.Category,
+		arg.IntervalMinutes,
+		arg.AutoUpdate,
+		arg.CreatedBy,
+	)
+	var i WebSource
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Title,
+		&i.Category,
+		&i.IntervalMinutes,
+		&i.AutoUpdate,
+		&i.KnowledgeID,
+		&i.LastHash,
+		&i.LastError,
+		&i.LastCheckedAt,
+		&i.LastChangedAt,
+		&i.IsActive,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteAIMessage = `-- name: DeleteAIMessage :execresult
+DELETE FROM ai_messages WHERE id = ?
+`
+
+func (q *Queries) DeleteAIMessage(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteAIMessage, id)
+}
+
+const deleteAllScrapedPages = `-- name: DeleteAllScrapedPages :execresult
+DELETE FROM scraped_pages
+`
+
+func (q *Queries) DeleteAllScrapedPages(ctx context.Context) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteAllScrapedPages)
+}
+
+const deleteChatRoom = `-- name: DeleteChatRoom :execresult
+DELETE FROM chat_rooms WHERE id = ? AND room_type != 'general'
+`
+
+func (q *Queries) DeleteChatRoom(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteChatRoom, id)
+}
+
 const deleteConfig = `-- name: DeleteConfig :execresult
 DELETE FROM system_config WHERE key = ?
 `
@@ -599,73 +1021,1109 @@ func (q *Queries) DeleteConfig(ctx context.Context, key string) (sql.Result, err
 	return q.db.ExecContext(ctx, deleteConfig, key)
 }
 
-const deleteConversation = `-- name: DeleteConversation :execresult
-DELETE FROM ai_conversations WHERE id = ? AND user_id = ?
+const deleteConversation = `-- name: DeleteConversation :execresult
+DELETE FROM ai_conversations WHERE id = ? AND user_id = ?
+`
+
+type DeleteConversationParams struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (q *Queries) DeleteConversation(ctx context.Context, arg DeleteConversationParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteConversation, arg.ID, arg.UserID)
+}
+
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :execresult
+DELETE FROM sessions WHERE expires_at <= datetime('now')
+`
+
+func (q *Queries) DeleteExpiredSessions(ctx context.Context) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteExpiredSessions)
+}
+
+const deleteFilterCategory = `-- name: DeleteFilterCategory :execresult
+DELETE FROM filter_categories WHERE id = ?
+`
+
+func (q *Queries) DeleteFilterCategory(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteFilterCategory, id)
+}
+
+const deleteKnowledge = `-- name: DeleteKnowledge :execresult
+DELETE FROM knowledge_base WHERE id = ?
+`
+
+func (q *Queries) DeleteKnowledge(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteKnowledge, id)
+}
+
+const deleteKnowledgeChunks = `-- name: DeleteKnowledgeChunks :execresult
+DELETE FROM knowledge_chunks WHERE knowledge_id = ?
+`
+
+func (q *Queries) DeleteKnowledgeChunks(ctx context.Context, knowledgeID int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteKnowledgeChunks, knowledgeID)
+}
+
+const deleteOldChatEvents = `-- name: DeleteOldChatEvents :execresult
+DELETE FROM chat_events WHERE created_at < datetime('now', '-10 minutes')
+`
+
+func (q *Queries) DeleteOldChatEvents(ctx context.Context) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteOldChatEvents)
+}
+
+const deleteOldNotifications = `-- name: DeleteOldNotifications :execresult
+DELETE FROM notifications WHERE created_at < datetime('now', '-30 days')
+`
+
+func (q *Queries) DeleteOldNotifications(ctx context.Context) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteOldNotifications)
+}
+
+const deleteScrapedPage = `-- name: DeleteScrapedPage :execresult
+DELETE FROM scraped_pages WHERE id = ?
+`
+
+func (q *Queries) DeleteScrapedPage(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteScrapedPage, id)
+}
+
+const deleteSecurityFilter = `-- name: DeleteSecurityFilter :execresult
+DELETE FROM security_filters WHERE id = ?
+`
+
+func (q *Queries) DeleteSecurityFilter(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteSecurityFilter, id)
+}
+
+const deleteSession = `-- name: DeleteSession :execresult
+DELETE FROM sessions WHERE token = ?
+`
+
+func (q *Queries) DeleteSession(ctx context.Context, token string) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteSession, token)
+}
+
+const deleteUser = `-- name: DeleteUser :execresult
+DELETE FROM users WHERE id = ? AND nomina != 'admin'
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteUser, id)
+}
+
+const deleteWebSource = `-- name: DeleteWebSource :execresult
+DELETE FROM web_sources WHERE id = ?
+`
+
+func (q *Queries) DeleteWebSource(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteWebSource, id)
+}
+
+const finishAIMessage = `-- name: FinishAIMessage :execresult
+UPDATE ai_messages
+SET content = ?, reasoning = ?, filtered = ?, filter_reason = ?, filter_hits = ?, status = ?
+WHERE id = ?
+`
+
+type FinishAIMessageParams struct {
+	Content      string         `json:"content"`
+	Reasoning    sql.NullString `json:"reasoning"`
+	Filtered     sql.NullInt64  `json:"filtered"`
+	FilterReason sql.NullString `json:"filter_reason"`
+	FilterHits   sql.NullString `json:"filter_hits"`
+	Status       sql.NullString `json:"status"`
+	ID           int64          `json:"id"`
+}
+
+func (q *Queries) FinishAIMessage(ctx context.Context, arg FinishAIMessageParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, finishAIMessage,
+		arg.Content,
+		arg.Reasoning,
+		arg.Filtered,
+		arg.FilterReason,
+		arg.FilterHits,
+		arg.Status,
+		arg.ID,
+	)
+}
+
+const getAIAttachmentForOwner = `-- name: GetAIAttachmentForOwner :one
+SELECT a.id, a.file_name, a.file_type, a.size, a.content_hash, a.data
+FROM ai_attachments a
+JOIN ai_conversations c ON c.id = a.conversation_id
+WHERE a.id = ? AND c.user_id = ?
+`
+
+type GetAIAttachmentForOwnerParams struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+}
+
+type GetAIAttachmentForOwnerRow struct {
+	ID          int64  `json:"id"`
+	FileName    string `json:"file_name"`
+	FileType    string `json:"file_type"`
+	Size        int64  `json:"size"`
+	ContentHash string `json:"content_hash"`
+	Data        []byte `json:"data"`
+}
+
+func (q *Queries) GetAIAttachmentForOwner(ctx context.Context, arg GetAIAttachmentForOwnerParams) (GetAIAttachmentForOwnerRow, error) {
+	row := q.db.QueryRowContext(ctx, getAIAttachmentForOwner, arg.ID, arg.UserID)
+	var i GetAIAttachmentForOwnerRow
+	err := row.Scan(
+		&i.ID,
+		&i.FileName,
+		&i.FileType,
+		&i.Size,
+		&i.ContentHash,
+		&i.Data,
+	)
+	return i, err
+}
+
+const getAllChatRooms = `-- name: GetAllChatRooms :many
+SELECT
+    r.id, r.slug, r.name, r.description, r.room_type, r.departamento, r.is_private, r.created_at,
+    (SELECT COUNT(*) FROM chat_room_members m WHERE m.room_id = r.id) as member_count
+FROM chat_rooms r
+ORDER BY CASE r.room_type WHEN 'general' THEN 0 WHEN 'department' THEN 1 WHEN 'project' THEN 2 ELSE 3 END, r.name
+`
+
+type GetAllChatRoomsRow struct {
+	ID           int64          `json:"id"`
+	Slug         string         `json:"slug"`
+	Name         string         `json:"name"`
+	Description  sql.NullString `json:"description"`
+	RoomType     string         `json:"room_type"`
+	Departamento sql.NullString `json:"departamento"`
+	IsPrivate    sql.NullInt64  `json:"is_private"`
+	CreatedAt    sql.NullTime   `json:"created_at"`
+	MemberCount  int64          `json:"member_count"`
+}
+
+func (q *Queries) GetAllChatRooms(ctx context.Context) ([]GetAllChatRoomsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChatRooms)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllChatRoomsRow
+	for rows.Next() {
+		var i GetAllChatRoomsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Slug,
+			&i.Name,
+			&i.Description,
+			&i.RoomType,
+			&i.Departamento,
+			&i.IsPrivate,
+			&i.CreatedAt,
+			&i.MemberCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChatEventsAfter = `-- name: GetChatEventsAfter :many
+SELECT id, kind, room_id, user_ids, payload FROM chat_events
+WHERE id > ?
+ORDER BY id ASC
+LIMIT ?
+`
+
+type GetChatEventsAfterParams struct {
+	ID    int64 `json:"id"`
+	Limit int64 `json:"limit"`
+}
+
+type GetChatEventsAfterRow struct {
+	ID      int64          `json:"id"`
+	Kind    string         `json:"kind"`
+	RoomID  sql.NullInt64  `json:"room_id"`
+	UserIds sql.NullString `json:"user_ids"`
+	Payload string         `json:"payload"`
+}
+
+func (q *Queries) GetChatEventsAfter(ctx context.Context, arg GetChatEventsAfterParams) ([]GetChatEventsAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChatEventsAfter, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChatEventsAfterRow
+	for rows.Next() {
+		var i GetChatEventsAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Kind,
+			&i.RoomID,
+			&i.UserIds,
+			&i.Payload,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChatRoomByID = `-- name: GetChatRoomByID :one
+SELECT id, slug, name, description, room_type, departamento, is_private, created_by, created_at FROM chat_rooms WHERE id = ?
+`
+
+func (q *Queries) GetChatRoomByID(ctx context.Context, id int64) (ChatRoom, error) {
+	row := q.db.QueryRowContext(ctx, getChatRoomByID, id)
+	var i ChatRoom
+	err := row.Scan(
+		&i.ID,
+		&i.Slug,
+		&i.Name,
+		&i.Description,
+		&i.RoomType,
+		&i.Departamento,
+		&i.IsPrivate,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getChatRoomBySlug = `-- name: GetChatRoomBySlug :one
+SELECT id, slug, name, description, room_type, departamento, is_private, created_by, created_at FROM chat_rooms WHERE slug = ?
+`
+
+func (q *Queries) GetChatRoomBySlug(ctx context.Context, slug string) (ChatRoom, error) {
+	row := q.db.QueryRowContext(ctx, getChatRoomBySlug, slug)
+	var i ChatRoom
+	err := row.Scan(
+		&i.ID,
+		&i.Slug,
+		&i.Name,
+		&i.Description,
+		&i.RoomType,
+		&i.Departamento,
+		&i.IsPrivate,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getChatRoomMember = `-- name: GetChatRoomMember :one
+SELECT room_id, user_id, role, joined_at
+FROM chat_room_members
+WHERE room_id = ? AND user_id = ?
+`
+
+type GetChatRoomMemberParams struct {
+	RoomID int64 `json:"room_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (q *Queries) GetChatRoomMember(ctx context.Context, arg GetChatRoomMemberParams) (ChatRoomMember, error) {
+	row := q.db.QueryRowContext(ctx, getChatRoomMember, arg.RoomID, arg.UserID)
+	var i ChatRoomMember
+	err := row.Scan(
+		&i.RoomID,
+		&i.UserID,
+		&i.Role,
+		&i.JoinedAt,
+	)
+	return i, err
+}
+
+const getChatRoomMembers = `-- name: GetChatRoomMembers :many
+SELECT u.id, u.nomina, u.nombre, u.departamento, m.role, m.joined_at
+FROM chat_room_members m
+JOIN users u ON m.user_id = u.id
+WHERE m.room_id = ?
+ORDER BY u.nombre
+`
+
+type GetChatRoomMembersRow struct {
+	ID           int64          `json:"id"`
+	Nomina       string         `json:"nomina"`
+	Nombre       string         `json:"nombre"`
+	Departamento sql.NullString `json:"departamento"`
+	Role         sql.NullString `json:"role"`
+	JoinedAt     sql.NullTime   `json:"joined_at"`
+}
+
+func (q *Queries) GetChatRoomMembers(ctx context.Context, roomID int64) ([]GetChatRoomMembersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChatRoomMembers, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChatRoomMembersRow
+	for rows.Next() {
+		var i GetChatRoomMembersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Nomina,
+			&i.Nombre,
+			&i.Departamento,
+			&i.Role,
+			&i.JoinedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConversationAttachments = `-- name: GetConversationAttachments :many
+SELECT id, message_id, file_name, file_type, size, content_hash, extracted_text, text_length, truncated, pages, created_at
+FROM ai_attachments
+WHERE conversation_id = ?
+ORDER BY id ASC
+`
+
+type GetConversationAttachmentsRow struct {
+	ID            int64         `json:"id"`
+	MessageID     int64         `json:"message_id"`
+	FileName      string        `json:"file_name"`
+	FileType      string        `json:"file_type"`
+	Size          int64         `json:"size"`
+	ContentHash   string        `json:"content_hash"`
+	ExtractedText string        `json:"extracted_text"`
+	TextLength    sql.NullInt64 `json:"text_length"`
+	Truncated     sql.NullInt64 `json:"truncated"`
+	Pages         sql.NullInt64 `json:"pages"`
+	CreatedAt     sql.NullTime  `json:"created_at"`
+}
+
+func (q *Queries) GetConversationAttachments(ctx context.Context, conversationID int64) ([]GetConversationAttachmentsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getConversationAttachments, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetConversationAttachmentsRow
+	for rows.Next() {
+		var i GetConversationAttachmentsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.FileName,
+			&i.FileType,
+			&i.Size,
+			&i.ContentHash,
+			&i.ExtractedText,
+			&i.TextLength,
+			&i.Truncated,
+			&i.Pages,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConversationTables = `-- name: GetConversationTables :many
+SELECT t.id, a.file_name, t.name, t.column_names, t.row_data
+FROM ai_tables t
+JOIN ai_attachments a ON a.id = t.attachment_id
+WHERE t.conversation_id = ?
+ORDER BY t.id ASC
+`
+
+type GetConversationTablesRow struct {
+	ID          int64  `json:"id"`
+	FileName    string `json:"file_name"`
+	Name        string `json:"name"`
+	ColumnNames string `json:"column_names"`
+	RowData     string `json:"row_data"`
+}
+
+func (q *Queries) GetConversationTables(ctx context.Context, conversationID int64) ([]GetConversationTablesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getConversationTables, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetConversationTablesRow
+	for rows.Next() {
+		var i GetConversationTablesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FileName,
+			&i.Name,
+			&i.ColumnNames,
+			&i.RowData,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDMParticipant = `-- name: GetDMParticipant :one
+SELECT thread_id, user_id, last_read_message_id, joined_at
+FROM dm_participants
+WHERE thread_id = ? AND user_id = ?
+`
+
+type GetDMParticipantParams struct {
+	ThreadID int64 `json:"thread_id"`
+	UserID   int64 `json:"user_id"`
+}
+
+func (q *Queries) GetDMParticipant(ctx context.Context, arg GetDMParticipantParams) (DmParticipant, error) {
+	row := q.db.QueryRowContext(ctx, getDMParticipant, arg.ThreadID, arg.UserID)
+	var i DmParticipant
+	err := row.Scan(
+		&i.ThreadID,
+		&i.UserID,
+		&i.LastReadMessageID,
+		&i.JoinedAt,
+	)
+	return i, err
+}
+
+const getDMParticipantIDs = `-- name: GetDMParticipantIDs :many
+SELECT user_id FROM dm_participants WHERE thread_id = ?
+`
+
+func (q *Queries) GetDMParticipantIDs(ctx context.Context, threadID int64) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getDMParticipantIDs, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var user_id int64
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDMThreadByID = `-- name: GetDMThreadByID :one
+SELECT id, title, is_group, created_by, created_at, updated_at FROM dm_threads WHERE id = ?
+`
+
+func (q *Queries) GetDMThreadByID(ctx context.Context, id int64) (DmThread, error) {
+	row := q.db.QueryRowContext(ctx, getDMThreadByID, id)
+	var i DmThread
+	err := row.Scan(
+		&i.ID,
+		&i.Title,
+		&i.IsGroup,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getDirectThreadBetween = `-- name: GetDirectThreadBetween :one
+SELECT t.id FROM dm_threads t
+JOIN dm_participants a ON a.thread_id = t.id AND a.user_id = ?
+JOIN dm_participants b ON b.thread_id = t.id AND b.user_id = ?
+WHERE t.is_group = 0
+LIMIT 1
+`
+
+type GetDirectThreadBetweenParams struct {
+	UserID   int64 `json:"user_id"`
+	UserID_2 int64 `json:"user_id_2"`
+}
+
+func (q *Queries) GetDirectThreadBetween(ctx context.Context, arg GetDirectThreadBetweenParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getDirectThreadBetween, arg.UserID, arg.UserID_2)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getDueWebSources = `-- name: GetDueWebSources :many
+SELECT id, url, title, category, interval_minutes, auto_update, knowledge_id, last_hash, last_error, last_checked_at, last_changed_at, is_active, created_by, created_at FROM web_sources
+WHERE is_active = 1
+  AND (last_checked_at IS NULL OR last_checked_at <= datetime('now', '-' || interval_minutes || ' minutes'))
+ORDER BY last_checked_at ASC
+`
+
+func (q *Queries) GetDueWebSources(ctx context.Context) ([]WebSource, error) {
+	rows, err := q.db.QueryContext(ctx, getDueWebSources)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebSource
+	for rows.Next() {
+		var i WebSource
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Category,
+			&i.IntervalMinutes,
+			&i.AutoUpdate,
+			&i.KnowledgeID,
+			&i.LastHash,
+			&i.LastError,
+			&i.LastCheckedAt,
+			&i.LastChangedAt,
+			&i.IsActive,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFreshScrapedPage = `-- name: GetFreshScrapedPage :one
+SELECT id, url, title, content, content_hash, method, scraped_at, expires_at FROM scraped_pages
+WHERE url = ? AND expires_at > datetime('now')
+`
+
+func (q *Queries) GetFreshScrapedPage(ctx context.Context, url string) (ScrapedPage, error) {
+	row := q.db.QueryRowContext(ctx, getFreshScrapedPage, url)
+	var i ScrapedPage
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Title,
+		&i.Content,
+		&i.ContentHash,
+		&i.Method,
+		&i.ScrapedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getJoinableChatRooms = `-- name: GetJoinableChatRooms :many
+SELECT id, slug, name, description, room_type
+FROM chat_rooms
+WHERE is_private = 0
+  AND id NOT IN (SELECT room_id FROM chat_room_members WHERE user_id = ?)
+ORDER BY name
+`
+
+type GetJoinableChatRoomsRow struct {
+	ID          int64          `json:"id"`
+	Slug        string         `json:"slug"`
+	Name        string         `json:"name"`
+	Description sql.NullString `json:"description"`
+	RoomType    string         `json:"room_type"`
+}
+
+func (q *Queries) GetJoinableChatRooms(ctx context.Context, userID int64) ([]GetJoinableChatRoomsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getJoinableChatRooms, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetJoinableChatRoomsRow
+	for rows.Next() {
+		var i GetJoinableChatRoomsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Slug,
+			&i.Name,
+			&i.Description,
+			&i.RoomType,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestChatEventID = `-- name: GetLatestChatEventID :one
+SELECT CAST(COALESCE(MAX(id), 0) AS INTEGER) as id FROM chat_events
+`
+
+func (q *Queries) GetLatestChatEventID(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getLatestChatEventID)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getRecentDirectMessages = `-- name: GetRecentDirectMessages :many
+SELECT
+    dm.id, dm.content, dm.created_at,
+    u.id as user_id, u.nombre, u.nomina
+FROM direct_messages dm
+JOIN users u ON dm.user_id = u.id
+WHERE dm.thread_id = ?
+ORDER BY dm.id DESC
+LIMIT ?
+`
+
+type GetRecentDirectMessagesParams struct {
+	ThreadID int64 `json:"thread_id"`
+	Limit    int64 `json:"limit"`
+}
+
+type GetRecentDirectMessagesRow struct {
+	ID        int64        `json:"id"`
+	Content   string       `json:"content"`
+	CreatedAt sql.NullTime `json:"created_at"`
+	UserID    int64        `json:"user_id"`
+	Nombre    string       `json:"nombre"`
+	Nomina    string       `json:"nomina"`
+}
+
+func (q *Queries) GetRecentDirectMessages(ctx context.Context, arg GetRecentDirectMessagesParams) ([]GetRecentDirectMessagesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentDirectMessages, arg.ThreadID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentDirectMessagesRow
+	for rows.Next() {
+		var i GetRecentDirectMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Content,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Nombre,
+			&i.Nomina,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentURLFetches = `-- name: GetRecentURLFetches :many
+SELECT
+    f.id, f.user_id, f.url, f.status, f.content_hash, f.error, f.created_at,
+    u.nombre, u.nomina,
+    p.id AS page_id
+FROM url_fetches f
+LEFT JOIN users u ON f.user_id = u.id
+LEFT JOIN scraped_pages p ON p.url = f.url
+ORDER BY f.created_at DESC, f.id DESC
+LIMIT ?
+`
+
+type GetRecentURLFetchesRow struct {
+	ID          int64          `json:"id"`
+	UserID      sql.NullInt64  `json:"user_id"`
+	Url         string         `json:"url"`
+	Status      string         `json:"status"`
+	ContentHash sql.NullString `json:"content_hash"`
+	Error       sql.NullString `json:"error"`
+	CreatedAt   sql.NullTime   `json:"created_at"`
+	Nombre      sql.NullString `json:"nombre"`
+	Nomina      sql.NullString `json:"nomina"`
+	PageID      sql.NullInt64  `json:"page_id"`
+}
+
+func (q *Queries) GetRecentURLFetches(ctx context.Context, limit int64) ([]GetRecentURLFetchesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentURLFetches, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRecentURLFetchesRow
+	for rows.Next() {
+		var i GetRecentURLFetchesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Url,
+			&i.Status,
+			&i.ContentHash,
+			&i.Error,
+			&i.CreatedAt,
+			&i.Nombre,
+			&i.Nomina,
+			&i.PageID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getScrapedPageByID = `-- name: GetScrapedPageByID :one
+SELECT id, url, title, content, content_hash, method, scraped_at, expires_at FROM scraped_pages WHERE id = ?
+`
+
+func (q *Queries) GetScrapedPageByID(ctx context.Context, id int64) (ScrapedPage, error) {
+	row := q.db.QueryRowContext(ctx, getScrapedPageByID, id)
+	var i ScrapedPage
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Title,
+		&i.Content,
+		&i.ContentHash,
+		&i.Method,
+		&i.ScrapedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getScrapedPages = `-- name: GetScrapedPages :many
+SELECT
+    p.id, p.url, p.title, p.content_hash, p.method, p.scraped_at, p.expires_at,
+    length(p.content) AS content_length,
+    CAST(p.expires_at > datetime('now') AS INTEGER) AS fresh,
+    (SELECT COUNT(*) FROM url_fetches f WHERE f.url = p.url) AS fetch_count
+FROM scraped_pages p
+ORDER BY p.scraped_at DESC
+LIMIT ?
+`
+
+type GetScrapedPagesRow struct {
+	ID            int64          `json:"id"`
+	Url           string         `json:"url"`
+	Title         sql.NullString `json:"title"`
+	ContentHash   string         `json:"content_hash"`
+	Method        sql.NullString `json:"method"`
+	ScrapedAt     sql.NullTime   `json:"scraped_at"`
+	ExpiresAt     time.Time      `json:"expires_at"`
+	ContentLength int64          `json:"content_length"`
+	Fresh         int64          `json:"fresh"`
+	FetchCount    int64          `json:"fetch_count"`
+}
+
+func (q *Queries) GetScrapedPages(ctx context.Context, limit int64) ([]GetScrapedPagesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getScrapedPages, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetScrapedPagesRow
+	for rows.Next() {
+		var i GetScrapedPagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.ContentHash,
+			&i.Method,
+			&i.ScrapedAt,
+			&i.ExpiresAt,
+			&i.ContentLength,
+			&i.Fresh,
+			&i.FetchCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserChatRooms = `-- name: GetUserChatRooms :many
+SELECT r.id, r.slug, r.name, r.description, r.room_type, r.is_private, m.role
+FROM chat_rooms r
+JOIN chat_room_members m ON m.room_id = r.id
+WHERE m.user_id = ?
+ORDER BY CASE r.room_type WHEN 'general' THEN 0 WHEN 'department' THEN 1 WHEN 'project' THEN 2 ELSE 3 END, r.name
+`
+
+type GetUserChatRoomsRow struct {
+	ID          int64          `json:"id"`
+	Slug        string         `json:"slug"`
+	Name        string         `json:"name"`
+	Description sql.NullString `json:"description"`
+	RoomType    string         `json:"room_type"`
+	IsPrivate   sql.NullInt64  `json:"is_private"`
+	Role        sql.NullString `json:"role"`
+}
+
+func (q *Queries) GetUserChatRooms(ctx context.Context, userID int64) ([]GetUserChatRoomsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserChatRooms, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserChatRoomsRow
+	for rows.Next() {
+		var i GetUserChatRoomsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Slug,
+			&i.Name,
+			&i.Description,
+			&i.RoomType,
+			&i.IsPrivate,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserDMThreads = `-- name: GetUserDMThreads :many
+SELECT
+    t.id, t.title, t.is_group, t.updated_at,
+    (SELECT GROUP_CONCAT(u.nombre, ', ') FROM dm_participants p2 JOIN users u ON p2.user_id = u.id
+     WHERE p2.thread_id = t.id AND p2.user_id != p.user_id) as participant_names,
+    (SELECT COUNT(*) FROM direct_messages m
+     WHERE m.thread_id = t.id AND m.id > p.last_read_message_id AND m.user_id != p.user_id) as unread_count
+FROM dm_threads t
+JOIN dm_participants p ON p.thread_id = t.id
+WHERE p.user_id = ?
+ORDER BY t.updated_at DESC
+LIMIT 50
+`
+
+type GetUserDMThreadsRow struct {
+	ID               int64          `json:"id"`
+	Title            sql.NullString `json:"title"`
+	IsGroup          sql.NullInt64  `json:"is_group"`
+	UpdatedAt        sql.NullTime   `json:"updated_at"`
+	ParticipantNames sql.NullString `json:"participant_names"`
+	UnreadCount      int64          `json:"unread_count"`
+}
+
+func (q *Queries) GetUserDMThreads(ctx context.Context, userID int64) ([]GetUserDMThreadsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUserDMThreads, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUserDMThreadsRow
+	for rows.Next() {
+		var i GetUserDMThreadsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.IsGroup,
+			&i.UpdatedAt,
+			&i.ParticipantNames,
+			&i.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWebSourceByID = `-- name: GetWebSourceByID :one
+SELECT id, url, title, category, interval_minutes, auto_update, knowledge_id, last_hash, last_error, last_checked_at, last_changed_at, is_active, created_by, created_at FROM web_sources WHERE id = ?
+`
+
+func (q *Queries) GetWebSourceByID(ctx context.Context, id int64) (WebSource, error) {
+	row := q.db.QueryRowContext(ctx, getWebSourceByID, id)
+	var i WebSource
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Title,
+		&i.Category,
+		&i.IntervalMinutes,
+		&i.AutoUpdate,
+		&i.KnowledgeID,
+		&i.LastHash,
+		&i.LastError,
+		&i.LastCheckedAt,
+		&i.LastChangedAt,
+		&i.IsActive,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getWebSources = `-- name: GetWebSources :many
+SELECT id, url, title, category, interval_minutes, auto_update, knowledge_id, last_hash, last_error, last_checked_at, last_changed_at, is_active, created_by, created_at FROM web_sources ORDER BY created_at DESC
+`
+
+func (q *Queries) GetWebSources(ctx context.Context) ([]WebSource, error) {
+	rows, err := q.db.QueryContext(ctx, getWebSources)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebSource
+	for rows.Next() {
+		var i WebSource
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Category,
+			&i.IntervalMinutes,
+			&i.AutoUpdate,
+			&i.KnowledgeID,
+			&i.LastHash,
+			&i.LastError,
+			&i.LastCheckedAt,
+			&i.LastChangedAt,
+			&i.IsActive,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markDMThreadRead = `-- name: MarkDMThreadRead :execresult
+UPDATE dm_participants
+SET last_read_message_id = (SELECT COALESCE(MAX(id), 0) FROM direct_messages WHERE direct_messages.thread_id = dm_participants.thread_id)
+WHERE thread_id = ? AND user_id = ?
 `
 
-type DeleteConversationParams struct {
-	ID     int64 `json:"id"`
-	UserID int64 `json:"user_id"`
-}
-
-func (q *Queries) DeleteConversation(ctx context.Context, arg DeleteConversationParams) (sql.Result, error) {
-	return q.db.ExecContext(ctx, deleteConversation, arg.ID, arg.UserID)
+type MarkDMThreadReadParams struct {
+	ThreadID int64 `json:"thread_id"`
+	UserID   int64 `json:"user_id"`
 }
 
-const deleteExpiredSessions = `-- name: DeleteExpiredSessions :execresult
-DELETE FROM sessions WHERE expires_at <= datetime('now')
-`
-
-func (q *Queries) DeleteExpiredSessions(ctx context.Context) (sql.Result, error) {
-	return q.db.ExecContext(ctx, deleteExpiredSessions)
+func (q *Queries) MarkDMThreadRead(ctx context.Context, arg MarkDMThreadReadParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, markDMThreadRead, arg.ThreadID, arg.UserID)
 }
 
-const deleteFilterCategory = `-- name: DeleteFilterCategory :execresult
-DELETE FROM filter_categories WHERE id = ?
+const removeChatRoomMember = `-- name: RemoveChatRoomMember :execresult
+DELETE FROM chat_room_members WHERE room_id = ? AND user_id = ?
 `
 
-func (q *Queries) DeleteFilterCategory(ctx context.Context, id int64) (sql.Result, error) {
-	return q.db.ExecContext(ctx, deleteFilterCategory, id)
+type RemoveChatRoomMemberParams struct {
+	RoomID int64 `json:"room_id"`
+	UserID int64 `json:"user_id"`
 }
 
-const deleteKnowledge = `-- name: DeleteKnowledge :execresult
-DELETE FROM knowledge_base WHERE id = ?
-`
-
-func (q *Queries) DeleteKnowledge(ctx context.Context, id int64) (sql.Result, error) {
-	return q.db.ExecContext(ctx, deleteKnowledge, id)
+func (q *Queries) RemoveChatRoomMember(ctx context.Context, arg RemoveChatRoomMemberParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, removeChatRoomMember, arg.RoomID, arg.UserID)
 }
 
-const deleteOldNotifications = `-- name: DeleteOldNotifications :execresult
-DELETE FROM notifications WHERE created_at < datetime('now', '-30 days')
+const setAIMessageComputed = `-- name: SetAIMessageComputed :execresult
+UPDATE ai_messages SET computed = ? WHERE id = ?
 `
 
-func (q *Queries) DeleteOldNotifications(ctx context.Context) (sql.Result, error) {
-	return q.db.ExecContext(ctx, deleteOldNotifications)
+type SetAIMessageComputedParams struct {
+	Computed sql.NullString `json:"computed"`
+	ID       int64          `json:"id"`
 }
 
-const deleteSecurityFilter = `-- name: DeleteSecurityFilter :execresult
-DELETE FROM security_filters WHERE id = ?
-`
-
-func (q *Queries) DeleteSecurityFilter(ctx context.Context, id int64) (sql.Result, error) {
-	return q.db.ExecContext(ctx, deleteSecurityFilter, id)
+func (q *Queries) SetAIMessageComputed(ctx context.Context, arg SetAIMessageComputedParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, setAIMessageComputed, arg.Computed, arg.ID)
 }
 
-const deleteSession = `-- name: DeleteSession :execresult
-DELETE FROM sessions WHERE token = ?
+const setAIMessageReasoning = `-- name: SetAIMessageReasoning :execresult
+UPDATE ai_messages SET reasoning = ? WHERE id = ?
 `
 
-func (q *Queries) DeleteSession(ctx context.Context, token string) (sql.Result, error) {
-	return q.db.ExecContext(ctx, deleteSession, token)
+type SetAIMessageReasoningParams struct {
+	Reasoning sql.NullString `json:"reasoning"`
+	ID        int64          `json:"id"`
 }
 
-const deleteUser = `-- name: DeleteUser :execresult
-DELETE FROM users WHERE id = ? AND nomina != 'admin'
-`
-
-func (q *Queries) DeleteUser(ctx context.Context, id int64) (sql.Result, error) {
-	return q.db.ExecContext(ctx, deleteUser, id)
+func (q *Queries) SetAIMessageReasoning(ctx context.Context, arg SetAIMessageReasoningParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, setAIMessageReasoning, arg.Reasoning, arg.ID)
 }
 
 const setUserAdmin = `-- name: SetUserAdmin :execresult
@@ -783,6 +2241,57 @@ func (q *Queries) GetActiveKnowledge(ctx context.Context) ([]GetActiveKnowledgeR
 	return items, nil
 }
 
+const getActiveKnowledgeChunks = `-- name: GetActiveKnowledgeChunks :many
+SELECT
+    kc.id, kc.knowledge_id, kc.chunk_index, kc.content, kc.embedding,
+    kb.title, kb.category
+FROM knowledge_chunks kc
+JOIN knowledge_base kb ON kc.knowledge_id = kb.id
+WHERE kb.is_active = 1
+ORDER BY kc.knowledge_id, kc.chunk_index
+`
+
+type GetActiveKnowledgeChunksRow struct {
+	ID          int64          `json:"id"`
+	KnowledgeID int64          `json:"knowledge_id"`
+	ChunkIndex  int64          `json:"chunk_index"`
+	Content     string         `json:"content"`
+	Embedding   sql.NullString `json:"embedding"`
+	Title       string         `json:"title"`
+	Category    sql.NullString `json:"category"`
+}
+
+func (q *Queries) GetActiveKnowledgeChunks(ctx context.Context) ([]GetActiveKnowledgeChunksRow, error) {
+	rows, err := q.db.QueryContext(ctx, getActiveKnowledgeChunks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetActiveKnowledgeChunksRow
+	for rows.Next() {
+		var i GetActiveKnowledgeChunksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.KnowledgeID,
+			&i.ChunkIndex,
+			&i.Content,
+			&i.Embedding,
+			&i.Title,
+			&i.Category,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getActiveSecurityFilters = `-- name: GetActiveSecurityFilters :many
 SELECT id, name, description, filter_type, pattern, "action", is_active, applies_to, severity, created_by, created_at, updated_at FROM security_filters
 WHERE is_active = 1
@@ -1239,7 +2748,7 @@ func (q *Queries) GetConfig(ctx context.Context, key string) (string, error) {
 }
 
 const getConversation = `-- name: GetConversation :one
-SELECT id, user_id, title, model, created_at, updated_at FROM ai_conversations
+SELECT id, user_id, title, model, created_at, updated_at, summary, summary_message_id FROM ai_conversations
 WHERE id = ? AND user_id = ?
 `
 
@@ -1258,12 +2767,14 @@ func (q *Queries) GetConversation(ctx context.Context, arg GetConversationParams
 		&i.Model,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Summary,
+		&i.SummaryMessageID,
 	)
 	return i, err
 }
 
 const getConversationByID = `-- name: GetConversationByID :one
-SELECT id, user_id, title, model, created_at, updated_at FROM ai_conversations WHERE id = ?
+SELECT id, user_id, title, model, created_at, updated_at, summary, summary_message_id FROM ai_conversations WHERE id = ?
 `
 
 func (q *Queries) GetConversationByID(ctx context.Context, id int64) (AiConversation, error) {
@@ -1276,24 +2787,31 @@ func (q *Queries) GetConversationByID(ctx context.Context, id int64) (AiConversa
 		&i.Model,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Summary,
+		&i.SummaryMessageID,
 	)
 	return i, err
 }
 
 const getConversationMessages = `-- name: GetConversationMessages :many
-SELECT id, role, content, filtered, filter_reason, created_at
+SELECT id, role, content, filtered, filter_reason, created_at, sources, context_dropped, computed, reasoning, status
 FROM ai_messages
 WHERE conversation_id = ?
 ORDER BY created_at ASC
 `
 
 type GetConversationMessagesRow struct {
-	ID           int64          `json:"id"`
-	Role         string         `json:"role"`
-	Content      string         `json:"content"`
-	Filtered     sql.NullInt64  `json:"filtered"`
-	FilterReason sql.NullString `json:"filter_reason"`
-	CreatedAt    sql.NullTime   `json:"created_at"`
+	ID             int64          `json:"id"`
+	Role           string         `json:"role"`
+	Content        string         `json:"content"`
+	Filtered       sql.NullInt64  `json:"filtered"`
+	FilterReason   sql.NullString `json:"filter_reason"`
+	CreatedAt      sql.NullTime   `json:"created_at"`
+	Sources        sql.NullString `json:"sources"`
+	ContextDropped sql.NullInt64  `json:"context_dropped"`
+	Computed       sql.NullString `json:"computed"`
+	Reasoning      sql.NullString `json:"reasoning"`
+	Status         sql.NullString `json:"status"`
 }
 
 func (q *Queries) GetConversationMessages(ctx context.Context, conversationID int64) ([]GetConversationMessagesRow, error) {
@@ -1312,6 +2830,58 @@ func (q *Queries) GetConversationMessages(ctx context.Context, conversationID in
 			&i.Filtered,
 			&i.FilterReason,
 			&i.CreatedAt,
+			&i.Sources,
+			&i.ContextDropped,
+			&i.Computed,
+			&i.Reasoning,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getConversationMessagesAfter = `-- name: GetConversationMessagesAfter :many
+SELECT id, role, content, filtered
+FROM ai_messages
+WHERE conversation_id = ? AND id > ? AND status != 'generating'
+ORDER BY id ASC
+`
+
+type GetConversationMessagesAfterParams struct {
+	ConversationID int64 `json:"conversation_id"`
+	ID             int64 `json:"id"`
+}
+
+type GetConversationMessagesAfterRow struct {
+	ID       int64         `json:"id"`
+	Role     string        `json:"role"`
+	Content  string        `json:"content"`
+	Filtered sql.NullInt64 `json:"filtered"`
+}
+
+func (q *Queries) GetConversationMessagesAfter(ctx context.Context, arg GetConversationMessagesAfterParams) ([]GetConversationMessagesAfterRow, error) {
+	rows, err := q.db.QueryContext(ctx, getConversationMessagesAfter, arg.ConversationID, arg.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetConversationMessagesAfterRow
+	for rows.Next() {
+		var i GetConversationMessagesAfterRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Role,
+			&i.Content,
+			&i.Filtered,
 		); err != nil {
 			return nil, err
 		}
@@ -1457,10 +3027,15 @@ SELECT
     u.id as user_id, u.nombre, u.nomina
 FROM group_messages gm
 JOIN users u ON gm.user_id = u.id
-WHERE gm.id > ?
-ORDER BY gm.created_at ASC
+WHERE gm.room_id = ? AND gm.id > ?
+ORDER BY gm.id ASC
 `
 
+type GetGroupMessagesSinceParams struct {
+	RoomID sql.NullInt64 `json:"room_id"`
+	ID     int64         `json:"id"`
+}
+
 type GetGroupMessagesSinceRow struct {
 	ID        int64        `json:"id"`
 	Content   string       `json:"content"`
@@ -1470,8 +3045,8 @@ type GetGroupMessagesSinceRow struct {
 	Nomina    string       `json:"nomina"`
 }
 
-func (q *Queries) GetGroupMessagesSince(ctx context.Context, id int64) ([]GetGroupMessagesSinceRow, error) {
-	rows, err := q.db.QueryContext(ctx, getGroupMessagesSince, id)
+func (q *Queries) GetGroupMessagesSince(ctx context.Context, arg GetGroupMessagesSinceParams) ([]GetGroupMessagesSinceRow, error) {
+	rows, err := q.db.QueryContext(ctx, getGroupMessagesSince, arg.RoomID, arg.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -1806,13 +3381,14 @@ func (q *Queries) GetQuestionByID(ctx context.Context, id int64) (UnansweredQues
 const getRecentConversationMessages = `-- name: GetRecentConversationMessages :many
 SELECT id, role, content, filtered, filter_reason, created_at
 FROM ai_messages
-WHERE conversation_id = ?
-ORDER BY created_at DESC
+WHERE conversation_id = ? AND id > ? AND status != 'generating'
+ORDER BY created_at DESC, id DESC
 LIMIT ?
 `
 
 type GetRecentConversationMessagesParams struct {
 	ConversationID int64 `json:"conversation_id"`
+	ID             int64 `json:"id"`
 	Limit          int64 `json:"limit"`
 }
 
@@ -1826,7 +3402,7 @@ type GetRecentConversationMessagesRow struct {
 }
 
 func (q *Queries) GetRecentConversationMessages(ctx context.Context, arg GetRecentConversationMessagesParams) ([]GetRecentConversationMessagesRow, error) {
-	rows, err := q.db.QueryContext(ctx, getRecentConversationMessages, arg.ConversationID, arg.Limit)
+	rows, err := q.db.QueryContext(ctx, getRecentConversationMessages, arg.ConversationID, arg.ID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -1861,10 +3437,16 @@ SELECT
     u.id as user_id, u.nombre, u.nomina
 FROM group_messages gm
 JOIN users u ON gm.user_id = u.id
-ORDER BY gm.created_at DESC
+WHERE gm.room_id = ?
+ORDER BY gm.created_at DESC, gm.id DESC
 LIMIT ?
 `
 
+type GetRecentGroupMessagesParams struct {
+	RoomID sql.NullInt64 `json:"room_id"`
+	Limit  int64         `json:"limit"`
+}
+
 type GetRecentGroupMessagesRow struct {
 	ID        int64        `json:"id"`
 	Content   string       `json:"content"`
@@ -1874,8 +3456,8 @@ type GetRecentGroupMessagesRow struct {
 	Nomina    string       `json:"nomina"`
 }
 
-func (q *Queries) GetRecentGroupMessages(ctx context.Context, limit int64) ([]GetRecentGroupMessagesRow, error) {
-	rows, err := q.db.QueryContext(ctx, getRecentGroupMessages, limit)
+func (q *Queries) GetRecentGroupMessages(ctx context.Context, arg GetRecentGroupMessagesParams) ([]GetRecentGroupMessagesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentGroupMessages, arg.RoomID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -2358,6 +3940,35 @@ func (q *Queries) GetSubmissionsByUser(ctx context.Context, submittedBy int64) (
 	return items, nil
 }
 
+const getUnindexedKnowledgeIDs = `-- name: GetUnindexedKnowledgeIDs :many
+SELECT kb.id FROM knowledge_base kb
+WHERE kb.is_active = 1
+  AND NOT EXISTS (SELECT 1 FROM knowledge_chunks kc WHERE kc.knowledge_id = kb.id)
+`
+
+func (q *Queries) GetUnindexedKnowledgeIDs(ctx context.Context) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getUnindexedKnowledgeIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getUnreadNotifications = `-- name: GetUnreadNotifications :many
 SELECT id, user_id, type, title, message, read, created_at FROM notifications
 WHERE user_id = ? AND read = 0
@@ -2585,6 +4196,54 @@ func (q *Queries) RejectUser(ctx context.Context, id int64) (sql.Result, error)
 	return q.db.ExecContext(ctx, rejectUser, id)
 }
 
+const saveConversationSummary = `-- name: SaveConversationSummary :execresult
+UPDATE ai_conversations
+SET summary = ?, summary_message_id = ?
+WHERE id = ? AND summary = ?
+`
+
+type SaveConversationSummaryParams struct {
+	Summary          sql.NullString `json:"summary"`
+	SummaryMessageID sql.NullInt64  `json:"summary_message_id"`
+	ID               int64          `json:"id"`
+	PreviousSummary  sql.NullString `json:"previous_summary"`
+}
+
+func (q *Queries) SaveConversationSummary(ctx context.Context, arg SaveConversationSummaryParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, saveConversationSummary,
+		arg.Summary,
+		arg.SummaryMessageID,
+		arg.ID,
+		arg.PreviousSummary,
+	)
+}
+
+const setAIMessageContextDropped = `-- name: SetAIMessageContextDropped :execresult
+UPDATE ai_messages SET context_dropped = ? WHERE id = ?
+`
+
+type SetAIMessageContextDroppedParams struct {
+	ContextDropped sql.NullInt64 `json:"context_dropped"`
+	ID             int64         `json:"id"`
+}
+
+func (q *Queries) SetAIMessageContextDropped(ctx context.Context, arg SetAIMessageContextDroppedParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, setAIMessageContextDropped, arg.ContextDropped, arg.ID)
+}
+
+const setAIMessageSources = `-- name: SetAIMessageSources :execresult
+UPDATE ai_messages SET sources = ? WHERE id = ?
+`
+
+type SetAIMessageSourcesParams struct {
+	Sources sql.NullString `json:"sources"`
+	ID      int64          `json:"id"`
+}
+
+func (q *Queries) SetAIMessageSources(ctx context.Context, arg SetAIMessageSourcesParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, setAIMessageSources, arg.Sources, arg.ID)
+}
+
 const setConfig = `-- name: SetConfig :execresult
 INSERT INTO system_config (key, value, description)
 VALUES (?, ?, ?)
@@ -2616,6 +4275,19 @@ func (q *Queries) ToggleSecurityFilter(ctx context.Context, arg ToggleSecurityFi
 	return q.db.ExecContext(ctx, toggleSecurityFilter, arg.IsActive, arg.ID)
 }
 
+const toggleWebSource = `-- name: ToggleWebSource :execresult
+UPDATE web_sources SET is_active = ? WHERE id = ?
+`
+
+type ToggleWebSourceParams struct {
+	IsActive sql.NullInt64 `json:"is_active"`
+	ID       int64         `json:"id"`
+}
+
+func (q *Queries) ToggleWebSource(ctx context.Context, arg ToggleWebSourceParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, toggleWebSource, arg.IsActive, arg.ID)
+}
+
 const touchConversation = `-- name: TouchConversation :execresult
 UPDATE ai_conversations
 SET updated_at = datetime('now')
@@ -2626,6 +4298,57 @@ func (q *Queries) TouchConversation(ctx context.Context, id int64) (sql.Result,
 	return q.db.ExecContext(ctx, touchConversation, id)
 }
 
+const touchDMThread = `-- name: TouchDMThread :execresult
+UPDATE dm_threads SET updated_at = datetime('now') WHERE id = ?
+`
+
+func (q *Queries) TouchDMThread(ctx context.Context, id int64) (sql.Result, error) {
+	return q.db.ExecContext(ctx, touchDMThread, id)
+}
+
+const updateAIMessageProgress = `-- name: UpdateAIMessageProgress :execresult
+UPDATE ai_messages SET content = ?, reasoning = ? WHERE id = ? AND status = 'generating'
+`
+
+type UpdateAIMessageProgressParams struct {
+	Content   string         `json:"content"`
+	Reasoning sql.NullString `json:"reasoning"`
+	ID        int64          `json:"id"`
+}
+
+func (q *Queries) UpdateAIMessageProgress(ctx context.Context, arg UpdateAIMessageProgressParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, updateAIMessageProgress, arg.Content, arg.Reasoning, arg.ID)
+}
+
+const updateChatRoomPrivacy = `-- name: UpdateChatRoomPrivacy :execresult
+UPDATE chat_rooms SET is_private = ? WHERE id = ?
+`
+
+type UpdateChatRoomPrivacyParams struct {
+	IsPrivate sql.NullInt64 `json:"is_private"`
+	ID        int64         `json:"id"`
+}
+
+func (q *Queries) UpdateChatRoomPrivacy(ctx context.Context, arg UpdateChatRoomPrivacyParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, updateChatRoomPrivacy, arg.IsPrivate, arg.ID)
+}
+
+const updateConversationSummary = `-- name: UpdateConversationSummary :execresult
+UPDATE ai_conversations
+SET summary = ?
+WHERE id = ? AND user_id = ?
+`
+
+type UpdateConversationSummaryParams struct {
+	Summary sql.NullString `json:"summary"`
+	ID      int64          `json:"id"`
+	UserID  int64          `json:"user_id"`
+}
+
+func (q *Queries) UpdateConversationSummary(ctx context.Context, arg UpdateConversationSummaryParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, updateConversationSummary, arg.Summary, arg.ID, arg.UserID)
+}
+
 const updateConversationTitle = `-- name: UpdateConversationTitle :execresult
 UPDATE ai_conversations
 SET title = ?, updated_at = datetime('now')
@@ -2753,3 +4476,82 @@ type UpdateUserPasswordParams struct {
 func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (sql.Result, error) {
 	return q.db.ExecContext(ctx, updateUserPassword, arg.PasswordHash, arg.ID)
 }
+
+const updateWebSourceChanged = `-- name: UpdateWebSourceChanged :exec
+UPDATE web_sources
+SET last_hash = ?, knowledge_id = ?, last_error = '', last_checked_at = datetime('now'), last_changed_at = datetime('now')
+WHERE id = ?
+`
+
+type UpdateWebSourceChangedParams struct {
+	LastHash    sql.NullString `json:"last_hash"`
+	KnowledgeID sql.NullInt64  `json:"knowledge_id"`
+	ID          int64          `json:"id"`
+}
+
+func (q *Queries) UpdateWebSourceChanged(ctx context.Context, arg UpdateWebSourceChangedParams) error {
+	_, err := q.db.ExecContext(ctx, updateWebSourceChanged, arg.LastHash, arg.KnowledgeID, arg.ID)
+	return err
+}
+
+const updateWebSourceChecked = `-- name: UpdateWebSourceChecked :exec
+UPDATE web_sources SET last_checked_at = datetime('now'), last_error = ?
+WHERE id = ?
+`
+
+type UpdateWebSourceCheckedParams struct {
+	LastError sql.NullString `json:"last_error"`
+	ID        int64          `json:"id"`
+}
+
+func (q *Queries) UpdateWebSourceChecked(ctx context.Context, arg UpdateWebSourceCheckedParams) error {
+	_, err := q.db.ExecContext(ctx, updateWebSourceChecked, arg.LastError, arg.ID)
+	return err
+}
+
+const upsertScrapedPage = `-- name: UpsertScrapedPage :one
+
+INSERT INTO scraped_pages (url, title, content, content_hash, method, scraped_at, expires_at)
+VALUES (?, ?, ?, ?, ?, datetime('now'), datetime('now', ?))
+ON CONFLICT(url) DO UPDATE SET
+    title = excluded.title,
+    content = excluded.content,
+    content_hash = excluded.content_hash,
+    method = excluded.method,
+    scraped_at = excluded.scraped_at,
+    expires_at = excluded.expires_at
+RETURNING id, url, title, content, content_hash, method, scraped_at, expires_at
+`
+
+type UpsertScrapedPageParams struct {
+	Url         string         `json:"url"`
+	Title       sql.NullString `json:"title"`
+	Content     string         `json:"content"`
+	ContentHash string         `json:"content_hash"`
+	Method      sql.NullString `json:"method"`
+	Ttl         string         `json:"ttl"`
+}
+
+// ============ PAGINAS WEB EXTRAIDAS ============
+func (q *Queries) UpsertScrapedPage(ctx context.Context, arg UpsertScrapedPageParams) (ScrapedPage, error) {
+	row := q.db.QueryRowContext(ctx, upsertScrapedPage,
+		arg.Url,
+		arg.Title,
+		arg.Content,
+		arg.ContentHash,
+		arg.Method,
+		arg.Ttl,
+	)
+	var i ScrapedPage
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Title,
+		&i.Content,
+		&i.ContentHash,
+		&i.Method,
+		&i.ScrapedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
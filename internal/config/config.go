@@ -1,8 +1,14 @@
 package config
 
 import (
+	"fmt"
+	"log"
+	"net/url"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,8 +26,48 @@ type Config struct {
 	ForceSecureCookie bool
 	OllamaTimeout     time.Duration
 	OllamaRetries     int
+	OllamaEmbedModel  string
+	KnowledgeTopK     int
+	KnowledgeChunkLen int
+	OllamaNumCtx      int
+	ModelContextSizes map[string]int
+	SummaryThreshold  int
+	ChatBroadcaster   string
+	URLFetchEnabled   bool
+	URLAllowedDomains []string
+	URLBlockedDomains []string
+	URLInternalHosts  []string
+	FileSecurityMode  string
+	LLMProviders      []LLMProviderConfig
+	LLMModelRoutes    map[string]string
+	LLMAPIKeys        map[string]string
+	OllamaPool        []PoolEndpoint
+	OllamaMaxParallel int
+	AIMaxConcurrent   int
+	AIMaxPerUser      int
+	AIQueueSize       int
+	ShowReasoning     bool
 }
 
+// PoolEndpoint servidor Ollama adicional que comparte la carga con ollama_url
+type PoolEndpoint struct {
+	URL         string
+	MaxParallel int // 0 = usar ollama_max_parallel
+}
+
+// LLMProviderConfig servidor de inferencia adicional al Ollama principal (ollama_url)
+type LLMProviderConfig struct {
+	Name string
+	Kind string // ollama u openai (API /v1/chat/completions: llama.cpp server, vLLM, LocalAI)
+	URL  string
+}
+
+// LLMProviderKinds tipos de servidor de inferencia soportados
+var LLMProviderKinds = []string{"ollama", "openai"}
+
+// DefaultLLMProvider nombre del servidor Ollama principal; atiende los modelos sin ruta
+const DefaultLLMProvider = "ollama"
+
 func Load() *Config {
 	return &Config{
 		Port:              getEnv("PORT", "9999"),
@@ -36,6 +82,27 @@ func Load() *Config {
 		ForceSecureCookie: getBoolEnv("FORCE_SECURE_COOKIE", false),
 		OllamaTimeout:     getDurationEnv("OLLAMA_TIMEOUT", 5*time.Minute),
 		OllamaRetries:     getIntEnv("OLLAMA_RETRIES", 3),
+		OllamaEmbedModel:  getEnv("OLLAMA_EMBED_MODEL", ""),
+		KnowledgeTopK:     getIntEnv("KNOWLEDGE_TOP_K", 4),
+		KnowledgeChunkLen: getIntEnv("KNOWLEDGE_CHUNK_LENGTH", 800),
+		OllamaNumCtx:      getIntEnv("OLLAMA_NUM_CTX", 4096),
+		ModelContextSizes: getIntMapEnv("OLLAMA_MODEL_CONTEXT"),
+		SummaryThreshold:  getIntEnv("SUMMARY_THRESHOLD", 20),
+		ChatBroadcaster:   getEnv("CHAT_BROADCASTER", "memory"),
+		URLFetchEnabled:   getBoolEnv("URL_FETCH_ENABLED", true),
+		URLAllowedDomains: getListEnv("URL_ALLOWED_DOMAINS"),
+		URLBlockedDomains: getListEnv("URL_BLOCKED_DOMAINS"),
+		URLInternalHosts:  getListEnv("URL_INTERNAL_HOSTS"),
+		FileSecurityMode:  getEnv("FILE_SECURITY_MODE", "redact"),
+		LLMProviders:      getProvidersEnv("LLM_PROVIDERS"),
+		LLMModelRoutes:    getPairsEnv("LLM_MODEL_ROUTES"),
+		LLMAPIKeys:        getPairsEnv("LLM_API_KEYS"),
+		OllamaPool:        getPoolEnv("OLLAMA_POOL"),
+		OllamaMaxParallel: getIntEnv("OLLAMA_MAX_PARALLEL", 4),
+		AIMaxConcurrent:   getIntEnv("AI_MAX_CONCURRENT", 4),
+		AIMaxPerUser:      getIntEnv("AI_MAX_PER_USER", 1),
+		AIQueueSize:       getIntEnv("AI_QUEUE_SIZE", 50),
+		ShowReasoning:     getBoolEnv("SHOW_REASONING", false),
 		SystemPrompt: getEnv("SYSTEM_PROMPT", `# AQUILA - IRIS AI Assistant
 
 ## IDENTITY
@@ -151,3 +218,196 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+// getIntMapEnv lee pares "clave=numero" separados por coma, ej. "llama3=8192,qwen2.5=32768"
+func getIntMapEnv(key string) map[string]int {
+	result := make(map[string]int)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if intVal, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && intVal > 0 {
+			result[strings.TrimSpace(name)] = intVal
+		}
+	}
+	return result
+}
+
+// getProvidersEnv lee servidores de inferencia "nombre=tipo:url", ej.
+// "vllm=openai:http://gpu01:8000,llamacpp=openai:http://10.0.0.7:8080"
+func getProvidersEnv(key string) []LLMProviderConfig {
+	providers, err := ParseProviders(os.Getenv(key))
+	if err != nil {
+		log.Printf("[WARN] %s invalido, se ignora: %v", key, err)
+		return nil
+	}
+	return providers
+}
+
+// getPoolEnv lee servidores Ollama "url" o "url=limite", ej.
+// "http://gpu01:11434=4,http://gpu02:11434"
+func getPoolEnv(key string) []PoolEndpoint {
+	pool, err := ParsePool(os.Getenv(key))
+	if err != nil {
+		log.Printf("[WARN] %s invalido, se ignora: %v", key, err)
+		return nil
+	}
+	return pool
+}
+
+// getPairsEnv lee pares "clave=valor" separados por coma, ej. "qwen2.5:32b=vllm"
+func getPairsEnv(key string) map[string]string {
+	pairs, err := ParsePairs(os.Getenv(key))
+	if err != nil {
+		log.Printf("[WARN] %s invalido, se ignora: %v", key, err)
+		return map[string]string{}
+	}
+	return pairs
+}
+
+// getListEnv lee una lista separada por comas, ej. "impro.com,intranet.local"
+func getListEnv(key string) []string {
+	return ParseList(os.Getenv(key))
+}
+
+// ParsePairs separa pares "clave=valor" por comas, quitando espacios; el valor puede
+// contener "=" pero ni la clave ni el valor pueden quedar vacios
+func ParsePairs(value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(pair, "=")
+		name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+		if !ok || name == "" || val == "" {
+			return nil, fmt.Errorf("se esperaba clave=valor: %s", pair)
+		}
+		result[name] = val
+	}
+	return result, nil
+}
+
+// FormatPairs une los pares en el formato de ParsePairs, ordenados por clave
+func FormatPairs(pairs map[string]string) string {
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := make([]string, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, key+"="+pairs[key])
+	}
+	return strings.Join(items, ",")
+}
+
+// ParseProviders separa servidores de inferencia "nombre=tipo:url" por comas y los valida
+func ParseProviders(value string) ([]LLMProviderConfig, error) {
+	result := []LLMProviderConfig{}
+	seen := map[string]bool{DefaultLLMProvider: true}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, spec, _ := strings.Cut(item, "=")
+		kind, rawURL, _ := strings.Cut(strings.TrimSpace(spec), ":")
+		provider := LLMProviderConfig{
+			Name: strings.TrimSpace(name),
+			Kind: strings.ToLower(strings.TrimSpace(kind)),
+			URL:  strings.TrimRight(strings.TrimSpace(rawURL), "/"),
+		}
+
+		if provider.Name == "" || strings.ContainsAny(provider.Name, " :=") {
+			return nil, fmt.Errorf("nombre de servidor invalido en %q (formato nombre=tipo:url)", item)
+		}
+		if seen[provider.Name] {
+			return nil, fmt.Errorf("nombre de servidor repetido o reservado: %s", provider.Name)
+		}
+		if !slices.Contains(LLMProviderKinds, provider.Kind) {
+			return nil, fmt.Errorf("tipo de servidor %q invalido en %s (tipos: %s)", provider.Kind, provider.Name, strings.Join(LLMProviderKinds, ", "))
+		}
+		u, err := url.Parse(provider.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("URL invalida para %s: %s", provider.Name, provider.URL)
+		}
+
+		seen[provider.Name] = true
+		result = append(result, provider)
+	}
+	return result, nil
+}
+
+// FormatProviders une los servidores en el formato de ParseProviders
+func FormatProviders(providers []LLMProviderConfig) string {
+	items := make([]string, 0, len(providers))
+	for _, p := range providers {
+		items = append(items, p.Name+"="+p.Kind+":"+p.URL)
+	}
+	return strings.Join(items, ",")
+}
+
+// ParsePool separa servidores "url" o "url=limite" por comas y los valida
+func ParsePool(value string) ([]PoolEndpoint, error) {
+	result := []PoolEndpoint{}
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		endpoint := PoolEndpoint{URL: item}
+		if i := strings.LastIndex(item, "="); i >= 0 {
+			limit, err := strconv.Atoi(strings.TrimSpace(item[i+1:]))
+			if err != nil || limit < 1 || limit > 64 {
+				return nil, fmt.Errorf("limite invalido en %s (entre 1 y 64)", item)
+			}
+			endpoint.URL, endpoint.MaxParallel = strings.TrimSpace(item[:i]), limit
+		}
+		endpoint.URL = strings.TrimRight(endpoint.URL, "/")
+
+		u, err := url.Parse(endpoint.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("URL invalida: %s", endpoint.URL)
+		}
+		if seen[endpoint.URL] {
+			return nil, fmt.Errorf("URL repetida: %s", endpoint.URL)
+		}
+		seen[endpoint.URL] = true
+		result = append(result, endpoint)
+	}
+	return result, nil
+}
+
+// FormatPool une los servidores en el formato de ParsePool
+func FormatPool(pool []PoolEndpoint) string {
+	items := make([]string, 0, len(pool))
+	for _, endpoint := range pool {
+		if endpoint.MaxParallel > 0 {
+			items = append(items, endpoint.URL+"="+strconv.Itoa(endpoint.MaxParallel))
+		} else {
+			items = append(items, endpoint.URL)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// ParseList separa una lista por comas, quitando espacios, vacios y duplicados (en minusculas)
+func ParseList(value string) []string {
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		result = append(result, item)
+	}
+	return result
+}
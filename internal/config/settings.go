@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Setting describe una clave de configuracion editable en tiempo de ejecucion
+// (tabla system_config). Los valores de entorno actuan como defaults.
+type Setting struct {
+	Key         string
+	Description string
+	Type        string // string, text, int, bool, url, list, choice, pairs, providers, pool
+	Min         int
+	Max         int
+	Options     []string // valores permitidos para choice
+}
+
+// Settings claves editables desde /admin/config, en el orden en que se muestran
+var Settings = []Setting{
+	{Key: "ollama_url", Description: "URL del servidor Ollama", Type: "url"},
+	{Key: "ollama_pool", Description: "Servidores Ollama adicionales que comparten la carga con ollama_url, separados por coma: url o url=limite de peticiones simultaneas", Type: "pool"},
+	{Key: "ollama_max_parallel", Description: "Peticiones simultaneas por servidor de IA cuando no se indica otro limite; las demas esperan un lugar libre", Type: "int", Min: 1, Max: 64},
+	{Key: "ai_max_concurrent", Description: "Respuestas de IA que se generan a la vez en todo el sistema; las demas esperan en cola", Type: "int", Min: 1, Max: 256},
+	{Key: "ai_max_per_user", Description: "Respuestas de IA que un mismo usuario puede generar a la vez", Type: "int", Min: 1, Max: 16},
+	{Key: "ai_queue_size", Description: "Solicitudes de IA que pueden esperar en cola; las siguientes se rechazan (0 = sin cola)", Type: "int", Min: 0, Max: 1000},
+	{Key: "show_reasoning", Description: "Mostrar a los empleados el razonamiento (<think>) de modelos como DeepSeek R1; los administradores siempre lo ven", Type: "bool"},
+	{Key: "ollama_model", Description: "Modelo de IA a usar", Type: "string"},
+	{Key: "system_prompt", Description: "Prompt del sistema para la IA", Type: "text"},
+	{Key: "max_context_messages", Description: "Maximo de mensajes de contexto para IA", Type: "int", Min: 1, Max: 200},
+	{Key: "max_message_length", Description: "Longitud maxima de mensaje", Type: "int", Min: 100, Max: 100000},
+	{Key: "summary_threshold", Description: "Mensajes sin resumir antes de actualizar el resumen de la conversacion (0 lo desactiva)", Type: "int", Min: 0, Max: 500},
+	{Key: "knowledge_top_k", Description: "Fragmentos de conocimiento por pregunta", Type: "int", Min: 1, Max: 20},
+	{Key: "session_duration_hours", Description: "Duracion de sesion en horas", Type: "int", Min: 1, Max: 720},
+	{Key: "enable_security_filters", Description: "Habilitar filtros de seguridad", Type: "bool"},
+	{Key: "log_all_messages", Description: "Registrar todos los mensajes", Type: "bool"},
+	{Key: "url_fetch_enabled", Description: "Extraer el contenido de los enlaces que se envian a la IA", Type: "bool"},
+	{Key: "url_allowed_domains", Description: "Dominios permitidos para extraer enlaces, separados por coma (vacio = cualquier dominio publico; incluye subdominios)", Type: "list"},
+	{Key: "url_blocked_domains", Description: "Dominios bloqueados para extraer enlaces, separados por coma (incluye subdominios)", Type: "list"},
+	{Key: "url_internal_hosts", Description: "Hosts de la intranet que si pueden resolver a direcciones privadas, separados por coma (localhost y link-local siempre se bloquean)", Type: "list"},
+	{Key: "llm_providers", Description: "Servidores de inferencia adicionales a Ollama, separados por coma: nombre=tipo:url, con tipo ollama u openai (llama.cpp server, vLLM, LocalAI). Las claves de API van en la variable de entorno LLM_API_KEYS", Type: "providers"},
+	{Key: "llm_model_routes", Description: "Modelos que atiende un servidor adicional, separados por coma: modelo=servidor (el resto va a Ollama; vale el nombre de familia, ej. qwen2.5)", Type: "pairs"},
+	{Key: "file_security_mode", Description: "Que hacer con un archivo adjunto que activa un filtro de seguridad: block lo rechaza, redact aplica la accion de cada filtro y warn lo acepta sin cambios con una advertencia", Type: "choice", Options: []string{"block", "redact", "warn"}},
+}
+
+// FindSetting busca la definicion de una clave
+func FindSetting(key string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// Clone devuelve una copia independiente de la configuracion
+func (c *Config) Clone() *Config {
+	clone := *c
+	return &clone
+}
+
+// Get devuelve el valor actual de una clave editable como texto
+func (c *Config) Get(key string) string {
+	switch key {
+	case "ollama_url":
+		return c.OllamaURL
+	case "ollama_model":
+		return c.OllamaModel
+	case "system_prompt":
+		return c.SystemPrompt
+	case "max_context_messages":
+		return strconv.Itoa(c.MaxContextMsgs)
+	case "max_message_length":
+		return strconv.Itoa(c.MaxMessageLength)
+	case "summary_threshold":
+		return strconv.Itoa(c.SummaryThreshold)
+	case "knowledge_top_k":
+		return strconv.Itoa(c.KnowledgeTopK)
+	case "session_duration_hours":
+		return strconv.Itoa(int(c.SessionDuration / time.Hour))
+	case "enable_security_filters":
+		return strconv.FormatBool(c.EnableFilters)
+	case "log_all_messages":
+		return strconv.FormatBool(c.LogAllMessages)
+	case "url_fetch_enabled":
+		return strconv.FormatBool(c.URLFetchEnabled)
+	case "show_reasoning":
+		return strconv.FormatBool(c.ShowReasoning)
+	case "url_allowed_domains":
+		return strings.Join(c.URLAllowedDomains, ",")
+	case "url_blocked_domains":
+		return strings.Join(c.URLBlockedDomains, ",")
+	case "url_internal_hosts":
+		return strings.Join(c.URLInternalHosts, ",")
+	case "file_security_mode":
+		return c.FileSecurityMode
+	case "ollama_pool":
+		return FormatPool(c.OllamaPool)
+	case "ollama_max_parallel":
+		return strconv.Itoa(c.OllamaMaxParallel)
+	case "ai_max_concurrent":
+		return strconv.Itoa(c.AIMaxConcurrent)
+	case "ai_max_per_user":
+		return strconv.Itoa(c.AIMaxPerUser)
+	case "ai_queue_size":
+		return strconv.Itoa(c.AIQueueSize)
+	case "llm_providers":
+		return FormatProviders(c.LLMProviders)
+	case "llm_model_routes":
+		return FormatPairs(c.LLMModelRoutes)
+	}
+	return ""
+}
+
+// Set valida y aplica el valor de una clave editable
+func (c *Config) Set(key, value string) error {
+	setting, ok := FindSetting(key)
+	if !ok {
+		return fmt.Errorf("clave de configuracion desconocida: %s", key)
+	}
+
+	value = strings.TrimSpace(value)
+
+	var intVal int
+	var boolVal bool
+	var listVal []string
+	var pairsVal map[string]string
+	var providersVal []LLMProviderConfig
+	var poolVal []PoolEndpoint
+	switch setting.Type {
+	case "int":
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s debe ser un numero entero", key)
+		}
+		if v < setting.Min || v > setting.Max {
+			return fmt.Errorf("%s debe estar entre %d y %d", key, setting.Min, setting.Max)
+		}
+		intVal = v
+	case "bool":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s debe ser true o false", key)
+		}
+		boolVal = v
+	case "url":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s debe ser una URL http(s) valida", key)
+		}
+		value = strings.TrimRight(value, "/")
+	case "list":
+		// Una lista vacia es valida (desactiva la restriccion)
+		listVal = ParseList(value)
+		for _, item := range listVal {
+			if strings.ContainsAny(item, "/: ") {
+				return fmt.Errorf("%s debe contener solo dominios, sin esquema ni puerto: %s", key, item)
+			}
+		}
+	case "pairs":
+		v, err := ParsePairs(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		pairsVal = v
+	case "providers":
+		v, err := ParseProviders(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		providersVal = v
+	case "pool":
+		v, err := ParsePool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		poolVal = v
+	case "choice":
+		if !slices.Contains(setting.Options, value) {
+			return fmt.Errorf("%s debe ser uno de: %s", key, strings.Join(setting.Options, ", "))
+		}
+	default:
+		if value == "" {
+			return fmt.Errorf("%s no puede estar vacio", key)
+		}
+	}
+
+	switch key {
+	case "ollama_url":
+		c.OllamaURL = value
+	case "ollama_model":
+		c.OllamaModel = value
+	case "system_prompt":
+		c.SystemPrompt = value
+	case "max_context_messages":
+		c.MaxContextMsgs = intVal
+	case "max_message_length":
+		c.MaxMessageLength = intVal
+	case "summary_threshold":
+		c.SummaryThreshold = intVal
+	case "knowledge_top_k":
+		c.KnowledgeTopK = intVal
+	case "session_duration_hours":
+		c.SessionDuration = time.Duration(intVal) * time.Hour
+	case "enable_security_filters":
+		c.EnableFilters = boolVal
+	case "log_all_messages":
+		c.LogAllMessages = boolVal
+	case "url_fetch_enabled":
+		c.URLFetchEnabled = boolVal
+	case "show_reasoning":
+		c.ShowReasoning = boolVal
+	case "url_allowed_domains":
+		c.URLAllowedDomains = listVal
+	case "url_blocked_domains":
+		c.URLBlockedDomains = listVal
+	case "url_internal_hosts":
+		c.URLInternalHosts = listVal
+	case "file_security_mode":
+		c.FileSecurityMode = value
+	case "ollama_pool":
+		c.OllamaPool = poolVal
+	case "ollama_max_parallel":
+		c.OllamaMaxParallel = intVal
+	case "ai_max_concurrent":
+		c.AIMaxConcurrent = intVal
+	case "ai_max_per_user":
+		c.AIMaxPerUser = intVal
+	case "ai_queue_size":
+		c.AIQueueSize = intVal
+	case "llm_providers":
+		probe := *c
+		probe.LLMProviders = providersVal
+		for model, provider := range c.LLMModelRoutes {
+			if !probe.hasLLMProvider(provider) {
+				return fmt.Errorf("%s: el servidor %s atiende el modelo %s; quita antes la ruta en llm_model_routes", key, provider, model)
+			}
+		}
+		c.LLMProviders = providersVal
+	case "llm_model_routes":
+		for model, provider := range pairsVal {
+			if !c.hasLLMProvider(provider) {
+				return fmt.Errorf("%s: el modelo %s apunta a un servidor que no esta en llm_providers: %s", key, model, provider)
+			}
+		}
+		c.LLMModelRoutes = pairsVal
+	}
+	return nil
+}
+
+// hasLLMProvider indica si existe un servidor de inferencia con ese nombre
+func (c *Config) hasLLMProvider(name string) bool {
+	if name == DefaultLLMProvider {
+		return true
+	}
+	for _, p := range c.LLMProviders {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestConfigSet(t *testing.T) {
+	tests := []struct {
+		key     string
+		value   string
+		want    string // valor de Get despues de aplicarlo; vacio si debe fallar
+		wantErr bool
+	}{
+		{key: "max_context_messages", value: " 50 ", want: "50"},
+		{key: "max_context_messages", value: "1", want: "1"},
+		{key: "max_context_messages", value: "200", want: "200"},
+		{key: "max_context_messages", value: "0", wantErr: true},
+		{key: "max_context_messages", value: "201", wantErr: true},
+		{key: "max_context_messages", value: "diez", wantErr: true},
+		{key: "ai_queue_size", value: "0", want: "0"},
+		{key: "session_duration_hours", value: "12", want: "12"},
+		{key: "enable_security_filters", value: "false", want: "false"},
+		{key: "log_all_messages", value: "1", want: "true"},
+		{key: "show_reasoning", value: "si", wantErr: true},
+		{key: "ollama_url", value: "http://ia.planta.local:11434/", want: "http://ia.planta.local:11434"},
+		{key: "ollama_url", value: "ftp://ia.planta.local", wantErr: true},
+		{key: "ollama_url", value: "ia.planta.local", wantErr: true},
+		{key: "ollama_model", value: "", wantErr: true},
+		{key: "url_blocked_domains", value: "Example.com, foo.org", want: "example.com,foo.org"},
+		{key: "url_blocked_domains", value: "", want: ""},
+		{key: "url_allowed_domains", value: "http://example.com", wantErr: true},
+		{key: "file_security_mode", value: "warn", want: "warn"},
+		{key: "file_security_mode", value: "ignore", wantErr: true},
+		{key: "llm_model_routes", value: "qwen2.5=no-existe", wantErr: true},
+		{key: "clave_inventada", value: "1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			c := &Config{MaxContextMsgs: 20, OllamaModel: "llama3", FileSecurityMode: "block"}
+			before := c.Get(tt.key)
+
+			err := c.Set(tt.key, tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("se esperaba un error")
+				}
+				if got := c.Get(tt.key); got != before {
+					t.Errorf("un valor invalido cambio la configuracion: %q -> %q", before, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if got := c.Get(tt.key); got != tt.want {
+				t.Errorf("Get(%s) = %q, se esperaba %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
+	"mime"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -21,35 +23,73 @@ import (
 type AIHandler struct {
 	queries       *db.Queries
 	templates     *template.Template
-	ollama        *services.OllamaService
+	llm           *services.LLMService
 	security      *services.SecurityService
 	scraper       *services.Scraper
 	fileProcessor *services.FileProcessor
+	retriever     *services.KnowledgeRetriever
+	notifications *services.NotificationService
+	runtime       *services.RuntimeConfig
+	summarizer    *services.ConversationSummarizer
+	tables        *services.TableAnalyst
+	queue         *services.GenerationQueue
+	generations   *services.GenerationManager
 }
 
-func NewAIHandler(queries *db.Queries, templates *template.Template, ollama *services.OllamaService, security *services.SecurityService) *AIHandler {
-	// Config de scraper sin browser (más rápido y confiable)
-	scraperConfig := &services.ScraperConfig{
-		HTTPTimeout:       15 * time.Second,
-		MaxRetries:        2,
-		MaxContentSize:    5 * 1024 * 1024, // 5MB
-		UserAgent:         "AQUILA-Bot/1.0 (Enterprise Assistant)",
-		AllowedDomains:    []string{},
-		BlockedDomains:    []string{},
-		RequestsPerSecond: 2.0,
-		BurstSize:         5,
-		CacheTTL:          15 * time.Minute,
-		EnableCache:       true,
-		EnableBrowser:     false, // Deshabilitado para mayor velocidad
-	}
-
+func NewAIHandler(queries *db.Queries, templates *template.Template, llm *services.LLMService, security *services.SecurityService, scraper *services.Scraper, retriever *services.KnowledgeRetriever, notifications *services.NotificationService, runtime *services.RuntimeConfig, summarizer *services.ConversationSummarizer, tables *services.TableAnalyst, queue *services.GenerationQueue, generations *services.GenerationManager) *AIHandler {
 	return &AIHandler{
 		queries:       queries,
 		templates:     templates,
-		ollama:        ollama,
+		llm:           llm,
 		security:      security,
-		scraper:       services.NewScraper(scraperConfig),
+		scraper:       scraper,
 		fileProcessor: services.NewFileProcessor(),
+		retriever:     retriever,
+		notifications: notifications,
+		runtime:       runtime,
+		summarizer:    summarizer,
+		tables:        tables,
+		queue:         queue,
+		generations:   generations,
+	}
+}
+
+// queueFullMessage se muestra cuando la cola de generacion no admite mas solicitudes
+const queueFullMessage = "La IA esta atendiendo demasiadas solicitudes. Intenta de nuevo en unos minutos."
+
+// queueTimeoutMessage se muestra cuando la respuesta vencio esperando su turno en la cola
+const queueTimeoutMessage = "La IA tardo demasiado en atender tu solicitud. Intenta de nuevo en unos minutos."
+
+// generationRunningMessage se muestra al enviar otro mensaje mientras la conversacion
+// tiene una respuesta en curso
+const generationRunningMessage = "Espera a que termine la respuesta en curso o detenla antes de enviar otro mensaje."
+
+// generationSaveInterval cada cuanto se guarda en el mensaje lo generado hasta el momento
+const generationSaveInterval = 2 * time.Second
+
+// Estados de las respuestas del asistente (ai_messages.status)
+const (
+	messageStatusComplete = "complete"
+	messageStatusStopped  = "stopped"
+)
+
+// waitTurn espera el turno de la respuesta en la cola de generacion y publica su posicion
+// como evento "queue" cada vez que cambia. Devuelve false si la respuesta se detuvo o
+// vencio antes de llegar su turno.
+func (h *AIHandler) waitTurn(job *services.GenerationJob, ticket *services.GenerationTicket) bool {
+	for {
+		select {
+		case <-ticket.Ready():
+			if job.QueuePosition() > 0 {
+				// Posicion 0: el cliente deja de mostrar la espera
+				job.SetQueuePosition(0)
+			}
+			return true
+		case position := <-ticket.Positions():
+			job.SetQueuePosition(position)
+		case <-job.Context().Done():
+			return false
+		}
 	}
 }
 
@@ -67,32 +107,511 @@ func extractURLs(text string) []string {
 	return matches
 }
 
-// getKnowledgeContext obtiene el conocimiento empresarial como contexto para la IA
-func (h *AIHandler) getKnowledgeContext(ctx context.Context) string {
-	knowledge, err := h.queries.GetKnowledgeContext(ctx)
-	if err != nil || len(knowledge) == 0 {
+// getKnowledgeContext recupera solo los fragmentos de conocimiento relevantes para la pregunta
+func (h *AIHandler) getKnowledgeContext(ctx context.Context, query string) (string, []services.KnowledgeSource) {
+	chunks, err := h.retriever.Search(ctx, query, h.runtime.Current().KnowledgeTopK)
+	if err != nil {
+		log.Printf("[WARN] Error buscando conocimiento relevante: %v", err)
+		return "", nil
+	}
+	if len(chunks) == 0 {
+		return "", nil
+	}
+
+	return services.FormatKnowledgeContext(chunks), services.UniqueSources(chunks)
+}
+
+// buildChatMessages arma el historial a enviar al modelo: el resumen de la
+// conversacion reemplaza a los mensajes ya resumidos, y de los posteriores se toman
+// los ultimos max_context_messages ajustados a la ventana de contexto del modelo
+func (h *AIHandler) buildChatMessages(ctx context.Context, convID int64, model, knowledgeContext, tableContext, fileContext, lastUserContent string) ([]services.Message, services.ContextStats, error) {
+	cfg := h.runtime.Current()
+
+	conv, err := h.queries.GetConversationByID(ctx, convID)
+	if err != nil {
+		return nil, services.ContextStats{}, err
+	}
+	summarizedUntil := conv.SummaryMessageID.Int64
+
+	recent, err := h.queries.GetRecentConversationMessages(ctx, db.GetRecentConversationMessagesParams{
+		ConversationID: convID,
+		ID:             summarizedUntil,
+		Limit:          int64(cfg.MaxContextMsgs),
+	})
+	if err != nil {
+		return nil, services.ContextStats{}, err
+	}
+
+	// La consulta devuelve del mas reciente al mas antiguo
+	history := make([]services.Message, 0, len(recent))
+	for i := len(recent) - 1; i >= 0; i-- {
+		content := recent[i].Content
+		if recent[i].Role == "assistant" {
+			// El razonamiento no vuelve al modelo; las respuestas se guardan sin el, pero
+			// un modelo puede escribir <think> fuera de lugar
+			_, content = services.SplitReasoning(content)
+		}
+		history = append(history, services.Message{
+			Role:    recent[i].Role,
+			Content: content,
+		})
+	}
+	if n := len(history); n > 0 && history[n-1].Role == "user" && lastUserContent != "" {
+		history[n-1].Content = lastUserContent
+	}
+
+	pinned := make([]services.Message, 0, 5)
+	if summary := strings.TrimSpace(conv.Summary.String); summary != "" {
+		pinned = append(pinned, services.Message{
+			Role:    "system",
+			Content: services.SummaryContextPrefix + summary,
+		})
+	}
+
+	// Los archivos de turnos anteriores se fijan en el contexto porque el mensaje que los
+	// trajo puede estar ya resumido o fuera de la ventana. Los del turno actual llegan en
+	// fileContext, ya revisados por los filtros de archivos.
+	var currentMessageID int64
+	if len(recent) > 0 && recent[0].Role == "user" {
+		currentMessageID = recent[0].ID
+	}
+	if attachments := h.attachmentsContext(ctx, convID, currentMessageID, h.llm.ContextWindow(model)/3); attachments != "" {
+		pinned = append(pinned, services.Message{
+			Role:    "system",
+			Content: attachments,
+		})
+	}
+	if fileContext != "" {
+		pinned = append(pinned, services.Message{
+			Role:    "system",
+			Content: fileContext,
+		})
+	}
+	if knowledgeContext != "" {
+		pinned = append(pinned, services.Message{
+			Role:    "system",
+			Content: knowledgeContext,
+		})
+	}
+	if tableContext != "" {
+		pinned = append(pinned, services.Message{
+			Role:    "system",
+			Content: tableContext,
+		})
+	}
+	pinned = append(pinned, services.Message{
+		Role:    "system",
+		Content: services.UnansweredInstruction,
+	})
+
+	messages, stats := services.BuildChatContext(h.llm.ContextWindow(model), cfg.SystemPrompt, pinned, history)
+
+	count, err := h.queries.CountConversationMessagesAfter(ctx, db.CountConversationMessagesAfterParams{
+		ConversationID: convID,
+		ID:             summarizedUntil,
+	})
+	if err == nil && count > int64(len(recent)) {
+		// Mensajes que ni siquiera se leyeron por el limite max_context_messages
+		stats.Dropped += int(count) - len(recent)
+		stats.Truncated = true
+	}
+
+	if stats.Truncated {
+		log.Printf("[INFO] Contexto recortado en conversacion %d: %d mensajes omitidos, ~%d/%d tokens",
+			convID, stats.Dropped, stats.EstimatedTokens, stats.Window)
+	}
+
+	return messages, stats, nil
+}
+
+// reviewUploads aplica los filtros de seguridad al texto extraido de los archivos segun
+// file_security_mode: block rechaza el archivo ante cualquier filtro que no sea solo de
+// registro, redact aplica la accion de cada filtro (un filtro de bloqueo rechaza el archivo)
+// y warn lo acepta sin cambios con una advertencia. Cada coincidencia queda en security_logs.
+func (h *AIHandler) reviewUploads(r *http.Request, user *middleware.AuthUser, files []*services.ProcessedFile, rejected []services.FileStatus) ([]*services.ProcessedFile, []services.FileStatus, []services.FilterHit) {
+	mode := h.runtime.Current().FileSecurityMode
+	accepted := files[:0]
+	var hits []services.FilterHit
+
+	for _, file := range files {
+		review := h.security.ReviewFile(r.Context(), file.Content)
+		tables := h.reviewTables(r.Context(), file.Tables, review)
+		if len(review.Hits) == 0 {
+			accepted = append(accepted, file)
+			continue
+		}
+
+		switch {
+		case mode == "warn":
+			log.Printf("[SECURITY] Archivo %s de %s aceptado con advertencia: %s", file.FileName, user.Nomina, hitNames(review.Hits))
+			h.logFileHits(r, user, file.FileName, review.Hits, "file_warning")
+			file.Warning = "Coincide con filtros de seguridad: " + hitNames(review.Hits)
+			hits = append(hits, review.Hits...)
+			accepted = append(accepted, file)
+
+		case review.Blocked != nil || (mode == "block" && hasEnforcedHit(review.Hits)):
+			reason := "Contenido sensible detectado por politica de seguridad: " + hitNames(review.Hits)
+			filterName := hitNames(review.Hits)
+			if review.Blocked != nil {
+				reason = review.Blocked.Reason
+				filterName = review.Blocked.FilterName
+			}
+			log.Printf("[SECURITY] Archivo %s de %s bloqueado por filtro %s", file.FileName, user.Nomina, filterName)
+			h.logFileHits(r, user, file.FileName, review.Hits, "file_blocked")
+			go h.notifications.NotifySecurityAlert(context.Background(), user.Nombre, filterName)
+			rejected = append(rejected, services.FileStatus{
+				Name:   file.FileName,
+				Status: services.FileStatusRejected,
+				Error:  reason,
+			})
+
+		default:
+			h.logFileHits(r, user, file.FileName, review.Hits, "")
+			file.Content = review.Content
+			file.Tables = tables
+			file.Redacted = review.Redactions()
+			hits = append(hits, review.Hits...)
+			accepted = append(accepted, file)
+		}
+	}
+
+	for _, status := range rejected {
+		log.Printf("[WARN] Archivo %s rechazado: %s", status.Name, status.Error)
+	}
+	return accepted, rejected, hits
+}
+
+// reviewTables aplica los filtros de archivos a cada encabezado y celda de las hojas: se
+// guardan completas aunque el texto extraido se recorte y sus valores llegan al modelo en
+// los calculos. Las coincidencias se agregan a review (por filtro, con la mayor cuenta entre
+// el texto y las celdas, que suelen ser los mismos datos) y las hojas redactadas se
+// devuelven en copias para usarlas solo si el archivo se acepta en modo redact.
+func (h *AIHandler) reviewTables(ctx context.Context, tables []*services.Table, review *services.ContentReview) []*services.Table {
+	if len(tables) == 0 {
+		return tables
+	}
+
+	counts := make(map[int64]int)
+	var blocked *services.FilterResult
+	cell := func(value string) string {
+		if strings.TrimSpace(value) == "" {
+			return value
+		}
+		cellReview := h.security.ReviewFile(ctx, value)
+		for _, hit := range cellReview.Hits {
+			if counts[hit.FilterID] == 0 {
+				review.Hits = mergeHit(review.Hits, hit)
+			}
+			counts[hit.FilterID] += hit.Count
+		}
+		if blocked == nil {
+			blocked = cellReview.Blocked
+		}
+		return cellReview.Content
+	}
+
+	redacted := make([]*services.Table, len(tables))
+	for i, table := range tables {
+		copied := &services.Table{
+			File:    table.File,
+			Name:    table.Name,
+			Columns: make([]string, len(table.Columns)),
+			Rows:    make([][]string, len(table.Rows)),
+		}
+		for j, column := range table.Columns {
+			copied.Columns[j] = cell(column)
+		}
+		for j, row := range table.Rows {
+			copied.Rows[j] = make([]string, len(row))
+			for k, value := range row {
+				copied.Rows[j][k] = cell(value)
+			}
+		}
+		redacted[i] = copied
+	}
+
+	for i, hit := range review.Hits {
+		review.Hits[i].Count = max(hit.Count, counts[hit.FilterID])
+	}
+	if review.Blocked == nil {
+		review.Blocked = blocked
+	}
+	return redacted
+}
+
+// mergeHit agrega hit a la lista si su filtro no esta ya en ella
+func mergeHit(hits []services.FilterHit, hit services.FilterHit) []services.FilterHit {
+	for _, existing := range hits {
+		if existing.FilterID == hit.FilterID {
+			return hits
+		}
+	}
+	return append(hits, hit)
+}
+
+// logFileHits registra en security_logs cada filtro que coincidio con un archivo, con la
+// accion indicada o, si esta vacia, la del filtro. Se guarda el nombre del archivo y el del
+// filtro, no el texto encontrado: puede ser justo el dato sensible.
+func (h *AIHandler) logFileHits(r *http.Request, user *middleware.AuthUser, fileName string, hits []services.FilterHit, action string) {
+	for _, hit := range hits {
+		taken := action
+		if taken == "" {
+			taken = hit.Action
+		}
+		err := h.security.LogViolation(
+			r.Context(),
+			user.ID,
+			sql.NullInt64{Int64: hit.FilterID, Valid: true},
+			fmt.Sprintf("%s: %s (%d coincidencias, accion %s)", fileName, hit.FilterName, hit.Count, hit.Action),
+			taken,
+			r.RemoteAddr,
+			r.UserAgent(),
+		)
+		if err != nil {
+			log.Printf("[ERROR] Error registrando filtro %s en archivo %s: %v", hit.FilterName, fileName, err)
+		}
+	}
+}
+
+// hasEnforcedHit indica si coincidio algun filtro que hace algo mas que registrar
+func hasEnforcedHit(hits []services.FilterHit) bool {
+	for _, hit := range hits {
+		if hit.Action != "log" {
+			return true
+		}
+	}
+	return false
+}
+
+// hitNames lista los nombres de los filtros que coincidieron
+func hitNames(hits []services.FilterHit) string {
+	names := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		names = append(names, hit.FilterName)
+	}
+	return strings.Join(names, ", ")
+}
+
+// rejectedFilesMessage explica por que no se pudo usar ninguno de los archivos enviados
+func rejectedFilesMessage(rejected []services.FileStatus) string {
+	reasons := make([]string, 0, len(rejected))
+	for _, status := range rejected {
+		reasons = append(reasons, status.Name+": "+status.Error)
+	}
+	return "No se pudo usar ningun archivo. " + strings.Join(reasons, "; ")
+}
+
+// attachmentsContext arma el mensaje con el texto de los archivos adjuntos de la conversacion,
+// sin los del mensaje indicado, dentro del presupuesto de tokens
+func (h *AIHandler) attachmentsContext(ctx context.Context, convID, excludeMessageID int64, maxTokens int) string {
+	rows, err := h.queries.GetConversationAttachments(ctx, convID)
+	if err != nil {
+		log.Printf("[WARN] Error obteniendo archivos adjuntos de conversacion %d: %v", convID, err)
 		return ""
 	}
 
-	var contextBuilder strings.Builder
-	contextBuilder.WriteString("\n\n--- CONOCIMIENTO EMPRESARIAL ---\n")
-	contextBuilder.WriteString("Usa la siguiente informacion para responder preguntas sobre la empresa:\n\n")
+	files := make([]*services.ProcessedFile, 0, len(rows))
+	for _, row := range rows {
+		if row.MessageID == excludeMessageID {
+			continue
+		}
+		files = append(files, &services.ProcessedFile{
+			FileName:    row.FileName,
+			FileType:    row.FileType,
+			Content:     row.ExtractedText,
+			Truncated:   row.Truncated.Int64 == 1,
+			OriginalLen: int(row.TextLength.Int64),
+			Pages:       int(row.Pages.Int64),
+		})
+	}
+	return h.fileProcessor.FormatAttachmentsContext(files, maxTokens)
+}
 
-	for _, k := range knowledge {
-		contextBuilder.WriteString(fmt.Sprintf("## %s [%s]\n%s\n\n", k.Title, k.Category.String, k.Content))
+// saveAttachment guarda el archivo original y su texto extraido junto al mensaje del usuario
+func (h *AIHandler) saveAttachment(ctx context.Context, messageID, convID, userID int64, file *services.ProcessedFile) {
+	truncated := int64(0)
+	if file.Truncated {
+		truncated = 1
 	}
 
-	contextBuilder.WriteString("--- FIN CONOCIMIENTO ---\n")
-	return contextBuilder.String()
+	attachmentID, err := h.queries.CreateAIAttachment(ctx, db.CreateAIAttachmentParams{
+		MessageID:      messageID,
+		ConversationID: convID,
+		UserID:         userID,
+		FileName:       file.FileName,
+		FileType:       file.FileType,
+		Size:           int64(len(file.Data)),
+		ContentHash:    file.ContentHash,
+		Data:           file.Data,
+		ExtractedText:  file.Content,
+		TextLength:     sql.NullInt64{Int64: int64(file.OriginalLen), Valid: true},
+		Truncated:      sql.NullInt64{Int64: truncated, Valid: true},
+		Pages:          sql.NullInt64{Int64: int64(file.Pages), Valid: true},
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error guardando archivo adjunto %s: %v", file.FileName, err)
+		return
+	}
+
+	h.tables.SaveTables(ctx, attachmentID, convID, file.Tables)
 }
 
-// enrichMessageWithURLContent extrae contenido de URLs y lo agrega al mensaje
-func (h *AIHandler) enrichMessageWithURLContent(ctx context.Context, content string) string {
+// conversationAttachments agrupa los adjuntos de la conversacion por mensaje para mostrarlos
+func (h *AIHandler) conversationAttachments(ctx context.Context, convID int64) map[int64][]db.GetConversationAttachmentsRow {
+	rows, err := h.queries.GetConversationAttachments(ctx, convID)
+	if err != nil {
+		log.Printf("[WARN] Error obteniendo archivos adjuntos de conversacion %d: %v", convID, err)
+		return nil
+	}
+
+	byMessage := make(map[int64][]db.GetConversationAttachmentsRow)
+	for _, row := range rows {
+		byMessage[row.MessageID] = append(byMessage[row.MessageID], row)
+	}
+	return byMessage
+}
+
+// saveContextStats registra en la respuesta cuantos mensajes antiguos se omitieron del contexto
+func (h *AIHandler) saveContextStats(ctx context.Context, messageID int64, stats services.ContextStats) {
+	if stats.Dropped == 0 {
+		return
+	}
+
+	_, err := h.queries.SetAIMessageContextDropped(ctx, db.SetAIMessageContextDroppedParams{
+		ContextDropped: sql.NullInt64{Int64: int64(stats.Dropped), Valid: true},
+		ID:             messageID,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error guardando estadisticas de contexto: %v", err)
+	}
+}
+
+// tableResults calcula sobre las hojas adjuntas de la conversacion lo que pide la pregunta.
+// Las hojas ya pasaron por los filtros de archivos al subirse (reviewUploads).
+func (h *AIHandler) tableResults(ctx context.Context, convID int64, model, question string) []services.TableResult {
+	results := h.tables.Analyze(ctx, convID, model, question)
+	if len(results) > 0 {
+		log.Printf("[INFO] %d calculos sobre hojas adjuntas en conversacion %d", len(results), convID)
+	}
+	return results
+}
+
+// saveMessageComputed guarda los calculos sobre hojas que acompanan una respuesta
+func (h *AIHandler) saveMessageComputed(ctx context.Context, messageID int64, computed []services.TableResult) {
+	if len(computed) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(computed)
+	if err != nil {
+		return
+	}
+	_, err = h.queries.SetAIMessageComputed(ctx, db.SetAIMessageComputedParams{
+		Computed: sql.NullString{String: string(data), Valid: true},
+		ID:       messageID,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error guardando calculos del mensaje %d: %v", messageID, err)
+	}
+}
+
+// saveMessageReasoning guarda el razonamiento del modelo aparte de la respuesta
+func (h *AIHandler) saveMessageReasoning(ctx context.Context, messageID int64, reasoning string) {
+	reasoning = strings.TrimSpace(reasoning)
+	if reasoning == "" {
+		return
+	}
+
+	_, err := h.queries.SetAIMessageReasoning(ctx, db.SetAIMessageReasoningParams{
+		Reasoning: sql.NullString{String: reasoning, Valid: true},
+		ID:        messageID,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error guardando razonamiento del mensaje %d: %v", messageID, err)
+	}
+}
+
+// showReasoning indica si el usuario puede ver el razonamiento del modelo: los
+// administradores siempre, los empleados segun show_reasoning
+func (h *AIHandler) showReasoning(user *middleware.AuthUser) bool {
+	return user.IsAdmin || h.runtime.Current().ShowReasoning
+}
+
+// saveMessageSources registra las fuentes de conocimiento usadas en una respuesta
+func (h *AIHandler) saveMessageSources(ctx context.Context, messageID int64, sources []services.KnowledgeSource) {
+	if len(sources) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(sources)
+	if err != nil {
+		return
+	}
+
+	_, err = h.queries.SetAIMessageSources(ctx, db.SetAIMessageSourcesParams{
+		Sources: sql.NullString{String: string(data), Valid: true},
+		ID:      messageID,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error guardando fuentes de la respuesta: %v", err)
+	}
+}
+
+// captureUnanswered registra la pregunta para que un admin la responda y la agregue al conocimiento
+func (h *AIHandler) captureUnanswered(ctx context.Context, user *middleware.AuthUser, convID int64, question, reason string) {
+	if question == "" {
+		return
+	}
+
+	pending, err := h.queries.CountPendingQuestionsByText(ctx, question)
+	if err != nil {
+		log.Printf("[ERROR] Error verificando preguntas pendientes: %v", err)
+		return
+	}
+	if pending > 0 {
+		return
+	}
+
+	_, err = h.queries.CreateUnansweredQuestion(ctx, db.CreateUnansweredQuestionParams{
+		Question:       question,
+		AskedBy:        user.ID,
+		ConversationID: sql.NullInt64{Int64: convID, Valid: true},
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error registrando pregunta sin respuesta: %v", err)
+		return
+	}
+
+	log.Printf("[INFO] Pregunta sin respuesta registrada de %s en conversacion %d (%s)", user.Nomina, convID, reason)
+
+	if err := h.notifications.NotifyAdminsUnansweredQuestion(ctx, user.Nombre, question); err != nil {
+		log.Printf("[ERROR] Error notificando pregunta sin respuesta: %v", err)
+	}
+}
+
+// logMessage registra el mensaje en el log si log_all_messages esta habilitado
+func (h *AIHandler) logMessage(user *middleware.AuthUser, convID int64, role, content string) {
+	if !h.runtime.Current().LogAllMessages {
+		return
+	}
+	log.Printf("[INFO] Mensaje IA [%s] de %s en conversacion %d: %s", role, user.Nomina, convID, content)
+}
+
+// enrichMessageWithURLContent extrae contenido de URLs y lo agrega al mensaje.
+// Cada descarga (exitosa, fallida o bloqueada por la politica) queda en security_logs
+// y en url_fetches.
+func (h *AIHandler) enrichMessageWithURLContent(r *http.Request, user *middleware.AuthUser, content string) string {
+	if !h.runtime.Current().URLFetchEnabled {
+		return content
+	}
+
 	urls := extractURLs(content)
 	if len(urls) == 0 {
 		return content
 	}
 
+	ctx := r.Context()
+
 	var enrichedContent strings.Builder
 	enrichedContent.WriteString(content)
 	enrichedContent.WriteString("\n\n--- CONTENIDO EXTRAIDO DE URLs ---\n")
@@ -100,14 +619,28 @@ func (h *AIHandler) enrichMessageWithURLContent(ctx context.Context, content str
 	for _, url := range urls {
 		log.Printf("[INFO] Extrayendo contenido de URL: %s", url)
 
-		scraped, err := h.scraper.ScrapeForAI(ctx, url, 8000) // Max 8000 chars por URL
+		scraped, err := h.scraper.Scrape(ctx, url)
+		h.scraper.RecordFetch(ctx, user.ID, url, scraped, err)
+		if err == nil && !scraped.Success {
+			err = fmt.Errorf("scraping falló: %s", scraped.Error)
+		}
+		if errors.Is(err, services.ErrFetchBlocked) {
+			log.Printf("[SECURITY] URL bloqueada para %s: %v", user.Nomina, err)
+			h.security.LogViolation(ctx, user.ID, sql.NullInt64{}, url+" ("+err.Error()+")", "url_blocked", r.RemoteAddr, r.UserAgent())
+			// Sin detalles: el motivo incluye las IPs a las que resuelve el host
+			enrichedContent.WriteString(fmt.Sprintf("\n[No se extrajo %s: enlace no permitido por politicas de seguridad]\n", url))
+			continue
+		}
 		if err != nil {
 			log.Printf("[WARN] Error scrapeando %s: %v", url, err)
+			h.security.LogViolation(ctx, user.ID, sql.NullInt64{}, url+" ("+err.Error()+")", "url_error", r.RemoteAddr, r.UserAgent())
 			enrichedContent.WriteString(fmt.Sprintf("\n[Error extrayendo %s: %v]\n", url, err))
 			continue
 		}
 
-		enrichedContent.WriteString(scraped)
+		h.security.LogViolation(ctx, user.ID, sql.NullInt64{}, url, "url_fetch", r.RemoteAddr, r.UserAgent())
+
+		enrichedContent.WriteString(services.FormatForAI(scraped, 8000)) // Max 8000 chars por URL
 		enrichedContent.WriteString("\n")
 	}
 
@@ -125,6 +658,7 @@ func (h *AIHandler) AIPage(w http.ResponseWriter, r *http.Request) {
 
 	var currentConv *db.AiConversation
 	var messages []db.GetConversationMessagesRow
+	var attachments map[int64][]db.GetConversationAttachmentsRow
 	var currentModel string
 
 	convIDStr := r.URL.Query().Get("conv")
@@ -138,24 +672,25 @@ func (h *AIHandler) AIPage(w http.ResponseWriter, r *http.Request) {
 			if err == nil {
 				currentConv = &conv
 				messages, _ = h.queries.GetConversationMessages(r.Context(), convID)
+				attachments = h.conversationAttachments(r.Context(), convID)
 				// Usar modelo de la conversacion o fallback al global
 				if conv.Model.Valid && conv.Model.String != "" {
 					currentModel = conv.Model.String
 				} else {
-					currentModel = h.ollama.GetModel()
+					currentModel = h.llm.GetModel()
 				}
 			}
 		}
 	}
 
 	if currentModel == "" {
-		currentModel = h.ollama.GetModel()
+		currentModel = h.llm.GetModel()
 	}
 
-	ollamaAvailable := h.ollama.IsAvailable(r.Context())
+	ollamaAvailable := h.llm.IsAvailable(r.Context())
 
 	// Obtener lista de modelos disponibles
-	models, _ := h.ollama.ListModels(r.Context())
+	models, _ := h.llm.ListModels(r.Context())
 
 	data := TemplateData(r, map[string]interface{}{
 		"Title":            Tr(r, "ai_chat"),
@@ -163,10 +698,13 @@ func (h *AIHandler) AIPage(w http.ResponseWriter, r *http.Request) {
 		"Conversations":    conversations,
 		"CurrentConv":      currentConv,
 		"Messages":         messages,
+		"Attachments":      attachments,
 		"OllamaAvailable":  ollamaAvailable,
 		"Model":            currentModel,
 		"Models":           models,
-		"GlobalModel":      h.ollama.GetModel(),
+		"GlobalModel":      h.llm.GetModel(),
+		"MaxMessageLength": h.runtime.Current().MaxMessageLength,
+		"ShowReasoning":    h.showReasoning(user),
 	})
 	h.templates.ExecuteTemplate(w, "ai", data)
 }
@@ -177,7 +715,7 @@ func (h *AIHandler) NewConversation(w http.ResponseWriter, r *http.Request) {
 	// Obtener modelo del query param o usar el global
 	model := r.URL.Query().Get("model")
 	if model == "" {
-		model = h.ollama.GetModel()
+		model = h.llm.GetModel()
 	}
 
 	conv, err := h.queries.CreateAIConversation(r.Context(), db.CreateAIConversationParams{
@@ -210,21 +748,80 @@ func (h *AIHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(content) > 4000 {
+	if len(content) > h.runtime.Current().MaxMessageLength {
 		sendAIError(w, "El mensaje es demasiado largo")
 		return
 	}
 
 	content = h.security.SanitizeForDisplay(content)
 
+	// Los datos sensibles se redactan antes de guardar el mensaje o enviarlo al modelo
+	inputReview := h.security.ReviewInput(r.Context(), content)
+	content = inputReview.Content
+
 	var convID int64
 	var err error
 	model := r.FormValue("model")
 
-	if convIDStr == "" || convIDStr == "0" {
-		// Usar modelo del form o el global
+	// El lugar en la cola se pide antes de guardar nada: si esta llena no queda una
+	// conversacion o un mensaje sin respuesta
+	ticket, err := h.queue.Enqueue(user.ID, user.Nombre)
+	if err != nil {
+		log.Printf("[WARN] Cola de IA llena, solicitud de usuario %d rechazada", user.ID)
+		sendAIError(w, queueFullMessage)
+		return
+	}
+	defer ticket.Release()
+
+	newConversation := convIDStr == "" || convIDStr == "0"
+	if !newConversation {
+		convID, err = strconv.ParseInt(convIDStr, 10, 64)
+		if err != nil {
+			sendAIError(w, "ID de conversacion invalido")
+			return
+		}
+
+		hasAccess, err := h.security.ValidateConversationAccess(r.Context(), convID, user.ID)
+		if err != nil || !hasAccess {
+			log.Printf("[SECURITY] Usuario %s intento acceder a conversacion %d sin permiso", user.Nomina, convID)
+			sendAIError(w, "No tienes acceso a esta conversacion")
+			return
+		}
+
+		// La conversacion queda reservada hasta guardar la respuesta, tambien mientras se
+		// espera en la cola: /ai/stream no puede generar otra respuesta a la vez
+		release, err := h.generations.Claim(convID)
+		if err != nil {
+			sendAIError(w, generationRunningMessage)
+			return
+		}
+		defer release()
+
+		// Responder con el modelo de la conversacion, como /ai/stream
+		conv, err := h.queries.GetConversationByID(r.Context(), convID)
+		if err == nil && conv.Model.Valid && conv.Model.String != "" {
+			model = conv.Model.String
+		} else {
+			model = h.llm.GetModel()
+		}
+	}
+
+	// Agregar contexto de conocimiento empresarial relevante a la pregunta
+	knowledgeContext, sources := h.getKnowledgeContext(r.Context(), content)
+
+	// Nada se guarda hasta tener turno: si el cliente se desconecta en la cola no queda una
+	// conversacion o un mensaje sin respuesta
+	select {
+	case <-ticket.Ready():
+	case <-r.Context().Done():
+		return
+	}
+
+	if newConversation {
+		// Usar modelo del form o el global. Nadie mas conoce todavia la conversacion, asi
+		// que no hace falta reservarla.
 		if model == "" {
-			model = h.ollama.GetModel()
+			model = h.llm.GetModel()
 		}
 		conv, err := h.queries.CreateAIConversation(r.Context(), db.CreateAIConversationParams{
 			UserID: user.ID,
@@ -237,19 +834,6 @@ func (h *AIHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		convID = conv.ID
-	} else {
-		convID, err = strconv.ParseInt(convIDStr, 10, 64)
-		if err != nil {
-			sendAIError(w, "ID de conversacion invalido")
-			return
-		}
-
-		hasAccess, err := h.security.ValidateConversationAccess(r.Context(), convID, user.ID)
-		if err != nil || !hasAccess {
-			log.Printf("[SECURITY] Usuario %s intento acceder a conversacion %d sin permiso", user.Nomina, convID)
-			sendAIError(w, "No tienes acceso a esta conversacion")
-			return
-		}
 	}
 
 	_, err = h.queries.CreateAIMessage(r.Context(), db.CreateAIMessageParams{
@@ -258,51 +842,36 @@ func (h *AIHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 		Content:        content,
 		Filtered:       sql.NullInt64{Int64: 0, Valid: true},
 		FilterReason:   sql.NullString{String: "", Valid: true},
+		FilterHits:     inputReview.HitsJSON(),
 	})
 	if err != nil {
 		log.Printf("[ERROR] Error guardando mensaje usuario: %v", err)
 		sendAIError(w, "Error guardando mensaje")
 		return
 	}
+	h.logMessage(user, convID, "user", content)
 
-	history, err := h.queries.GetConversationMessages(r.Context(), convID)
+	// Calculos exactos si la pregunta es sobre hojas adjuntas en turnos anteriores; el plan
+	// lo pide el modelo, por eso se calcula ya con turno en la cola
+	computed := h.tableResults(r.Context(), convID, model, content)
+
+	// Enriquecer el ultimo mensaje del usuario con contenido de URLs
+	messages, contextStats, err := h.buildChatMessages(r.Context(), convID, model, knowledgeContext, services.FormatTableResults(computed), "", h.enrichMessageWithURLContent(r, user, content))
 	if err != nil {
 		log.Printf("[ERROR] Error obteniendo historial: %v", err)
 		sendAIError(w, "Error obteniendo historial")
 		return
 	}
 
-	messages := make([]services.Message, 0, len(history)+1)
-
-	// Agregar contexto de conocimiento empresarial
-	knowledgeContext := h.getKnowledgeContext(r.Context())
-	if knowledgeContext != "" {
-		messages = append(messages, services.Message{
-			Role:    "system",
-			Content: knowledgeContext,
-		})
-	}
-
-	for i, msg := range history {
-		msgContent := msg.Content
-		// Enriquecer el ultimo mensaje del usuario con contenido de URLs
-		if i == len(history)-1 && msg.Role == "user" {
-			msgContent = h.enrichMessageWithURLContent(r.Context(), msgContent)
-		}
-		messages = append(messages, services.Message{
-			Role:    msg.Role,
-			Content: msgContent,
-		})
-	}
-
-	response, filterResult, err := h.ollama.Chat(r.Context(), messages, user.ID)
+	response, reasoning, review, err := h.llm.Chat(r.Context(), messages, user.ID, model)
+	ticket.Release()
 	if err != nil {
 		log.Printf("[ERROR] Error llamando a Ollama: %v", err)
 		sendAIError(w, "Error comunicando con la IA. Verifica que Ollama este ejecutandose.")
 		return
 	}
 
-	if filterResult != nil && filterResult.Blocked {
+	if filterResult := review.Blocked; filterResult != nil {
 		_, err = h.queries.CreateAIMessage(r.Context(), db.CreateAIMessageParams{
 			ConversationID: convID,
 			Role:           "assistant",
@@ -324,22 +893,40 @@ func (h *AIHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 			r.UserAgent(),
 		)
 
+		go h.notifications.NotifySecurityAlert(context.Background(), user.Nombre, filterResult.FilterName)
+
 		sendAIResponse(w, convID, "Lo siento, no puedo procesar esa solicitud por politicas de seguridad.", true, filterResult.Reason)
 		return
 	}
 
-	_, err = h.queries.CreateAIMessage(r.Context(), db.CreateAIMessageParams{
+	unanswered := services.DetectUnanswered(response, len(sources) > 0)
+	response = unanswered.Response
+
+	assistantMsg, err := h.queries.CreateAIMessage(r.Context(), db.CreateAIMessageParams{
 		ConversationID: convID,
 		Role:           "assistant",
 		Content:        response,
 		Filtered:       sql.NullInt64{Int64: 0, Valid: true},
 		FilterReason:   sql.NullString{String: "", Valid: true},
+		FilterHits:     review.HitsJSON(),
 	})
 	if err != nil {
 		log.Printf("[ERROR] Error guardando respuesta IA: %v", err)
+	} else {
+		h.saveMessageSources(r.Context(), assistantMsg.ID, sources)
+		h.saveMessageComputed(r.Context(), assistantMsg.ID, computed)
+		h.saveContextStats(r.Context(), assistantMsg.ID, contextStats)
+		h.saveMessageReasoning(r.Context(), assistantMsg.ID, reasoning)
+	}
+
+	h.logMessage(user, convID, "assistant", response)
+
+	if unanswered.Unanswered {
+		h.captureUnanswered(r.Context(), user, convID, content, unanswered.Reason)
 	}
 
 	h.queries.TouchConversation(r.Context(), convID)
+	h.summarizer.Schedule(convID, model)
 
 	sendAIResponse(w, convID, response, false, "")
 }
@@ -396,10 +983,93 @@ func (h *AIHandler) GetConversationMessages(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	h.templates.ExecuteTemplate(w, "ai_messages", map[string]interface{}{
-		"Messages": messages,
-		"ConvID":   convID,
+	h.templates.ExecuteTemplate(w, "ai_messages", TemplateData(r, map[string]interface{}{
+		"Messages":      messages,
+		"Attachments":   h.conversationAttachments(r.Context(), convID),
+		"ConvID":        convID,
+		"ShowReasoning": h.showReasoning(user),
+	}))
+}
+
+// DownloadAttachment entrega el archivo original adjunto a un mensaje, solo al dueno de la conversacion
+func (h *AIHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	attachmentID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return
+	}
+
+	attachment, err := h.queries.GetAIAttachmentForOwner(r.Context(), db.GetAIAttachmentForOwnerParams{
+		ID:     attachmentID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		http.Error(w, "Archivo no encontrado", http.StatusNotFound)
+		return
+	}
+
+	// Siempre como descarga: el tipo lo declaro el usuario y no debe interpretarse en el navegador
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(attachment.Data)))
+	w.Write(attachment.Data)
+}
+
+// UpdateSummary permite al dueno corregir el resumen que se envia al modelo
+// en lugar de los mensajes antiguos de la conversacion
+func (h *AIHandler) UpdateSummary(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	convID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return
+	}
+
+	hasAccess, err := h.security.ValidateConversationAccess(r.Context(), convID, user.ID)
+	if err != nil || !hasAccess {
+		http.Error(w, "No autorizado", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	summary := strings.TrimSpace(r.FormValue("summary"))
+	if len(summary) > h.runtime.Current().MaxMessageLength {
+		http.Error(w, "Resumen demasiado largo", http.StatusBadRequest)
+		return
+	}
+
+	// El resumen llega al modelo igual que un mensaje del usuario
+	if filterResult := h.security.CheckInput(r.Context(), summary); filterResult != nil && filterResult.Blocked {
+		log.Printf("[SECURITY] Resumen de conversacion %d bloqueado por filtro '%s'", convID, filterResult.FilterName)
+		http.Error(w, "El resumen contiene contenido no permitido", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.queries.UpdateConversationSummary(r.Context(), db.UpdateConversationSummaryParams{
+		Summary: sql.NullString{String: summary, Valid: true},
+		ID:      convID,
+		UserID:  user.ID,
 	})
+	if err != nil {
+		log.Printf("[ERROR] Error actualizando resumen: %v", err)
+		http.Error(w, "Error actualizando resumen", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/ai?conv=%d", convID))
+	w.WriteHeader(http.StatusOK)
 }
 
 type AIResponseData struct {
@@ -443,6 +1113,7 @@ func (h *AIHandler) SendMessageStream(w http.ResponseWriter, r *http.Request) {
 	// Soportar tanto application/x-www-form-urlencoded como multipart/form-data
 	contentType := r.Header.Get("Content-Type")
 	if strings.Contains(contentType, "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, services.MaxFilesPerMessage*services.MaxFileSize+1<<20)
 		if err := r.ParseMultipartForm(32 << 20); err != nil {
 			http.Error(w, "Error procesando formulario", http.StatusBadRequest)
 			return
@@ -458,53 +1129,60 @@ func (h *AIHandler) SendMessageStream(w http.ResponseWriter, r *http.Request) {
 	convIDStr := r.FormValue("conversation_id")
 	selectedModel := r.FormValue("model")
 
-	// Process uploaded file if present
-	var fileContext string
+	// Process uploaded files if present
+	var uploads []*services.ProcessedFile
+	var rejectedFiles []services.FileStatus
+	var fileHits []services.FilterHit
 	if r.MultipartForm != nil {
-		files := r.MultipartForm.File["file"]
-		if len(files) > 0 {
-			fileHeader := files[0]
-			file, err := fileHeader.Open()
-			if err == nil {
-				defer file.Close()
-				processed, err := h.fileProcessor.ProcessFile(file, fileHeader)
-				if err != nil {
-					log.Printf("[WARN] Error processing file %s: %v", fileHeader.Filename, err)
-				} else {
-					fileContext = h.fileProcessor.FormatFileContext(processed)
-					log.Printf("[INFO] File processed: %s (%d chars)", processed.FileName, len(processed.Content))
-				}
-			}
-		}
+		uploads, rejectedFiles = h.fileProcessor.ProcessFiles(r.MultipartForm.File["file"])
+		uploads, rejectedFiles, fileHits = h.reviewUploads(r, user, uploads, rejectedFiles)
 	}
 
-	// Allow empty content if file is attached
-	if content == "" && fileContext == "" {
+	// Allow empty content if a file is attached
+	if content == "" && len(uploads) == 0 {
+		if len(rejectedFiles) > 0 {
+			http.Error(w, rejectedFilesMessage(rejectedFiles), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "El mensaje no puede estar vacio", http.StatusBadRequest)
 		return
 	}
 
-	if len(content) > 4000 {
+	if len(content) > h.runtime.Current().MaxMessageLength {
 		http.Error(w, "El mensaje es demasiado largo", http.StatusBadRequest)
 		return
 	}
 
 	content = h.security.SanitizeForDisplay(content)
 
-	// Append file context to the message for AI processing
-	contentForAI := content
-	if fileContext != "" {
-		contentForAI = content + fileContext
+	// Los datos sensibles se redactan antes de guardar el mensaje o enviarlo al modelo
+	inputReview := h.security.ReviewInput(r.Context(), content)
+	content = inputReview.Content
+	inputReview.Hits = append(inputReview.Hits, fileHits...)
+
+	// El lugar en la cola se pide antes de guardar nada: si esta llena no queda una
+	// conversacion o un mensaje sin respuesta. Desde que empieza la respuesta lo libera
+	// runGeneration; antes, cualquier salida por error lo devuelve.
+	ticket, err := h.queue.Enqueue(user.ID, user.Nombre)
+	if err != nil {
+		log.Printf("[WARN] Cola de IA llena, solicitud de usuario %d rechazada", user.ID)
+		http.Error(w, queueFullMessage, http.StatusServiceUnavailable)
+		return
 	}
+	generating := false
+	defer func() {
+		if !generating {
+			ticket.Release()
+		}
+	}()
 
 	var convID int64
-	var err error
 	var convModel string
 
 	if convIDStr == "" || convIDStr == "0" {
 		// Nueva conversacion - usar modelo seleccionado o global
 		if selectedModel == "" {
-			selectedModel = h.ollama.GetModel()
+			selectedModel = h.llm.GetModel()
 		}
 		convModel = selectedModel
 		conv, err := h.queries.CreateAIConversation(r.Context(), db.CreateAIConversationParams{
@@ -532,189 +1210,461 @@ func (h *AIHandler) SendMessageStream(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if h.generations.Running(convID) {
+			http.Error(w, generationRunningMessage, http.StatusConflict)
+			return
+		}
+
 		// Obtener modelo de la conversacion existente
 		conv, err := h.queries.GetConversationByID(r.Context(), convID)
 		if err == nil && conv.Model.Valid && conv.Model.String != "" {
 			convModel = conv.Model.String
 		} else {
-			convModel = h.ollama.GetModel() // Fallback al modelo global
+			convModel = h.llm.GetModel() // Fallback al modelo global
 		}
 	}
 
+	// Los archivos comparten un presupuesto de texto: como maximo un tercio de la ventana del
+	// modelo (~4 caracteres por token), para dejar lugar al prompt, el historial y la respuesta
+	h.fileProcessor.ApplyTextBudget(uploads, min(services.MaxTextLength, h.llm.ContextWindow(convModel)*4/3))
+
+	fileStatuses := make([]services.FileStatus, 0, len(uploads)+len(rejectedFiles))
+	for _, file := range uploads {
+		fileStatuses = append(fileStatuses, file.Status())
+		log.Printf("[INFO] File processed: %s (%d de %d chars)", file.FileName, len(file.Content), file.OriginalLen)
+	}
+	fileStatuses = append(fileStatuses, rejectedFiles...)
+
 	// Guardar mensaje del usuario
-	_, err = h.queries.CreateAIMessage(r.Context(), db.CreateAIMessageParams{
+	userMsg, err := h.queries.CreateAIMessage(r.Context(), db.CreateAIMessageParams{
 		ConversationID: convID,
 		Role:           "user",
 		Content:        content,
 		Filtered:       sql.NullInt64{Int64: 0, Valid: true},
 		FilterReason:   sql.NullString{String: "", Valid: true},
+		FilterHits:     inputReview.HitsJSON(),
 	})
 	if err != nil {
 		log.Printf("[ERROR] Error guardando mensaje usuario: %v", err)
 		http.Error(w, "Error guardando mensaje", http.StatusInternalServerError)
 		return
 	}
+	h.logMessage(user, convID, "user", content)
+
+	for _, file := range uploads {
+		h.saveAttachment(r.Context(), userMsg.ID, convID, user.ID, file)
+	}
+
+	// Agregar contexto de conocimiento empresarial relevante a la pregunta
+	knowledgeContext, sources := h.getKnowledgeContext(r.Context(), content)
+
+	// El texto de los archivos va en su propio mensaje: ya paso por reviewUploads y los
+	// filtros de entrada del servicio de IA solo revisan lo que escribio el usuario
+	contentForAI := content
+	if contentForAI == "" {
+		contentForAI = "Revisa los archivos adjuntos."
+	}
+
+	log.Printf("[DEBUG] Iniciando streaming para usuario %d, modelo: %s", user.ID, convModel)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming no soportado", http.StatusInternalServerError)
+		return
+	}
 
-	// Obtener historial
-	history, err := h.queries.GetConversationMessages(r.Context(), convID)
+	// La respuesta se genera en el servidor con su propio mensaje: si el navegador se
+	// desconecta sigue generandose y el cliente la retoma desde /ai/conversation/{id}/stream
+	messageID, err := h.queries.CreatePendingAIMessage(r.Context(), convID)
 	if err != nil {
-		log.Printf("[ERROR] Error obteniendo historial: %v", err)
-		http.Error(w, "Error obteniendo historial", http.StatusInternalServerError)
+		log.Printf("[ERROR] Error creando mensaje de respuesta: %v", err)
+		http.Error(w, "Error guardando mensaje", http.StatusInternalServerError)
+		return
+	}
+	job, err := h.generations.Start(messageID, convID, user.ID)
+	if err != nil {
+		// Otra solicitud de la conversacion empezo a generar mientras se preparaba esta: se
+		// borra tambien el mensaje del usuario (con sus adjuntos y hojas) para no dejarlo sin respuesta
+		h.queries.DeleteAIMessage(context.Background(), messageID)
+		h.queries.DeleteAIMessage(context.Background(), userMsg.ID)
+		http.Error(w, generationRunningMessage, http.StatusConflict)
 		return
 	}
+	generating = true
 
-	messages := make([]services.Message, 0, len(history)+1)
+	// Evento inicial con ID de conversación, modelo y mensaje de la respuesta
+	log.Printf("[DEBUG] Enviando evento start con convID=%d, modelo=%s, mensaje=%d", convID, convModel, messageID)
+	job.Emit("", map[string]interface{}{"conversation_id": convID, "model": convModel, "message_id": messageID})
 
-	// Agregar contexto de conocimiento empresarial
-	knowledgeContext := h.getKnowledgeContext(r.Context())
-	if knowledgeContext != "" {
-		messages = append(messages, services.Message{
-			Role:    "system",
-			Content: knowledgeContext,
-		})
+	if len(fileStatuses) > 0 {
+		job.Emit("files", map[string]interface{}{"files": fileStatuses})
 	}
 
-	for i, msg := range history {
-		msgContent := msg.Content
-		// For the last user message, use contentForAI which includes file context
-		if i == len(history)-1 && msg.Role == "user" && fileContext != "" {
-			msgContent = contentForAI
-		}
-		messages = append(messages, services.Message{
-			Role:    msg.Role,
-			Content: msgContent,
-		})
-	}
+	go h.runGeneration(job, ticket, generationRequest{
+		user:             user,
+		userMessageID:    userMsg.ID,
+		model:            convModel,
+		question:         content,
+		prompt:           contentForAI,
+		knowledgeContext: knowledgeContext,
+		fileContext:      h.fileProcessor.FormatMessageFilesContext(uploads),
+		sources:          sources,
+		remoteAddr:       r.RemoteAddr,
+		userAgent:        r.UserAgent(),
+	})
 
-	log.Printf("[DEBUG] Iniciando streaming con %d mensajes para usuario %d, modelo: %s", len(messages), user.ID, convModel)
+	h.followGeneration(w, r, flusher, job, 0)
+}
 
-	// Configurar SSE
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no") // Nginx
+// generationRequest lo que la respuesta en segundo plano necesita del mensaje que la origino
+type generationRequest struct {
+	user             *middleware.AuthUser
+	userMessageID    int64 // pregunta que origino la respuesta
+	model            string
+	question         string
+	prompt           string // ultimo mensaje del usuario tal como se envia al modelo
+	knowledgeContext string
+	fileContext      string
+	sources          []services.KnowledgeSource
+	remoteAddr       string
+	userAgent        string
+}
 
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming no soportado", http.StatusInternalServerError)
+// runGeneration genera la respuesta sin depender de la conexion del cliente: espera turno
+// en la cola con el ticket recibido (y lo libera al terminar), publica los fragmentos como
+// eventos del job y guarda el avance en el mensaje cada generationSaveInterval. Si se
+// detiene o falla, lo generado hasta ahi se conserva.
+func (h *AIHandler) runGeneration(job *services.GenerationJob, ticket *services.GenerationTicket, req generationRequest) {
+	defer job.Finish()
+	defer ticket.Release()
+
+	user := req.user
+	convID := job.ConversationID
+	// Las operaciones de BD usan su propio contexto: deben completarse aunque el job se cancele
+	dbCtx := context.Background()
+
+	if !h.waitTurn(job, ticket) {
+		// Sin turno no hay respuesta: se borra tambien la pregunta (con sus adjuntos y hojas),
+		// igual que cuando otra solicitud gana la conversacion
+		h.queries.DeleteAIMessage(dbCtx, job.MessageID)
+		h.queries.DeleteAIMessage(dbCtx, req.userMessageID)
+		if job.Stopped() {
+			log.Printf("[DEBUG] Respuesta %d detenida mientras esperaba en la cola", job.MessageID)
+			job.Emit("stopped", map[string]int64{"message_id": job.MessageID})
+		} else {
+			log.Printf("[WARN] Respuesta %d vencio mientras esperaba en la cola", job.MessageID)
+			job.Emit("", map[string]string{"error": queueTimeoutMessage})
+		}
+		job.Emit("done", map[string]int64{"conversation_id": convID})
 		return
 	}
 
-	// Enviar evento inicial con ID de conversación y modelo
-	log.Printf("[DEBUG] Enviando evento start con convID=%d, modelo=%s", convID, convModel)
-	fmt.Fprintf(w, "data: {\"conversation_id\": %d, \"model\": \"%s\"}\n\n", convID, convModel)
-	flusher.Flush()
+	// Las preguntas sobre hojas adjuntas se responden con calculos exactos sobre todas las
+	// filas; el plan lo pide el modelo, por eso se calcula ya con turno en la cola
+	computed := h.tableResults(job.Context(), convID, req.model, req.question)
+	if len(computed) > 0 {
+		job.Emit("computed", map[string]interface{}{"computed": computed})
+	}
 
-	var fullResponse strings.Builder
-	var streamErr error
-	var filterResult *services.FilterResult
-	streamDone := make(chan struct{})
-	gotFirstChunk := false
-
-	// Usar contexto con timeout largo (10 minutos) para modelos lentos como DeepSeek R1
-	streamCtx, cancelStream := context.WithTimeout(context.Background(), 10*time.Minute)
-	defer cancelStream()
-
-	log.Printf("[DEBUG] Llamando a ChatStreamWithModel con modelo: %s", convModel)
-
-	// Iniciar streaming en goroutine
-	go func() {
-		defer close(streamDone)
-		filterResult, streamErr = h.ollama.ChatStreamWithModel(streamCtx, messages, user.ID, convModel, func(chunk string) error {
-			gotFirstChunk = true
-			fullResponse.WriteString(chunk)
-
-			// Enviar chunk como evento SSE
-			data := map[string]string{"content": chunk}
-			jsonData, _ := json.Marshal(data)
-			fmt.Fprintf(w, "data: %s\n\n", jsonData)
-			flusher.Flush()
-			return nil
-		})
-	}()
+	messages, contextStats, err := h.buildChatMessages(dbCtx, convID, req.model, req.knowledgeContext, services.FormatTableResults(computed), req.fileContext, req.prompt)
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo historial: %v", err)
+		h.queries.DeleteAIMessage(dbCtx, job.MessageID)
+		job.Emit("", map[string]string{"error": "Error obteniendo historial"})
+		job.Emit("done", map[string]int64{"conversation_id": convID})
+		return
+	}
 
-	// Enviar heartbeats mientras esperamos respuesta del modelo
-	heartbeatTicker := time.NewTicker(15 * time.Second)
-	defer heartbeatTicker.Stop()
+	if contextStats.Truncated {
+		job.Emit("context", map[string]interface{}{
+			"context_truncated": true,
+			"dropped":           contextStats.Dropped,
+			"estimated_tokens":  contextStats.EstimatedTokens,
+			"window":            contextStats.Window,
+		})
+	}
 
-	for {
-		select {
-		case <-streamDone:
-			// Streaming completado
-			goto streamComplete
-		case <-heartbeatTicker.C:
-			// Enviar heartbeat solo si aun no hemos recibido chunks
-			if !gotFirstChunk {
-				fmt.Fprintf(w, ": heartbeat\n\n")
-				flusher.Flush()
-				log.Printf("[DEBUG] Heartbeat enviado, esperando respuesta de modelo...")
-			}
-		case <-r.Context().Done():
-			// Cliente desconectado
-			log.Printf("[DEBUG] Cliente desconectado durante streaming")
-			cancelStream()
+	var fullResponse, fullReasoning strings.Builder
+	showReasoning := h.showReasoning(user)
+	lastSave := time.Now()
+	saveProgress := func() {
+		if time.Since(lastSave) < generationSaveInterval {
 			return
 		}
+		lastSave = time.Now()
+		_, err := h.queries.UpdateAIMessageProgress(dbCtx, db.UpdateAIMessageProgressParams{
+			Content:   fullResponse.String(),
+			Reasoning: sql.NullString{String: fullReasoning.String(), Valid: true},
+			ID:        job.MessageID,
+		})
+		if err != nil {
+			log.Printf("[ERROR] Error guardando avance de la respuesta %d: %v", job.MessageID, err)
+		}
 	}
 
-streamComplete:
+	log.Printf("[DEBUG] Llamando a ChatStreamWithModel con modelo: %s", req.model)
+	review, streamErr := h.llm.ChatStreamWithModel(job.Context(), messages, user.ID, req.model, func(chunk string) error {
+		fullResponse.WriteString(chunk)
+		job.Emit("", map[string]string{"content": chunk})
+		saveProgress()
+		return nil
+	}, func(reasoning string) error {
+		// El razonamiento se guarda siempre; se envia solo a quien puede verlo
+		fullReasoning.WriteString(reasoning)
+		if showReasoning {
+			job.Emit("reasoning", map[string]string{"reasoning": reasoning})
+		}
+		saveProgress()
+		return nil
+	})
 	log.Printf("[DEBUG] ChatStream terminado, err=%v", streamErr)
+	ticket.Release()
 
-	if streamErr != nil {
-		log.Printf("[ERROR] Error en streaming Ollama: %v", streamErr)
-		fmt.Fprintf(w, "data: {\"error\": \"Error comunicando con la IA\"}\n\n")
-		flusher.Flush()
-		return
+	response := fullResponse.String()
+	// Se guarda la revision de la respuesta completa: un dato sensible mas largo que la
+	// ventana del filtro pudo salir sin redactar, y el cliente cambia lo recibido por ella
+	if review != nil && review.Blocked == nil && review.Content != response {
+		response = review.Content
+		job.Emit("redacted", map[string]string{"content": response})
+	}
+	// El razonamiento completo pasa de nuevo por los filtros de salida; si uno de bloqueo
+	// coincide no se guarda, como en LLMService.Chat
+	reasoningReview := h.security.ReviewOutput(dbCtx, strings.TrimSpace(fullReasoning.String()))
+	reasoning := sql.NullString{String: reasoningReview.Content, Valid: true}
+	if reasoningReview.Blocked != nil {
+		log.Printf("[SECURITY] Razonamiento IA de la respuesta %d descartado por filtro '%s'", job.MessageID, reasoningReview.Blocked.FilterName)
+		reasoning.String = ""
 	}
 
-	response := fullResponse.String()
+	if streamErr != nil && (review == nil || review.Blocked == nil) {
+		stopped := job.Stopped()
+		if !stopped {
+			log.Printf("[ERROR] Error en streaming Ollama: %v", streamErr)
+			job.Emit("", map[string]string{"error": "Error comunicando con la IA"})
+		}
 
-	// Usar contexto de background para operaciones de BD (no depender del cliente)
-	dbCtx := context.Background()
+		if strings.TrimSpace(response) == "" {
+			h.queries.DeleteAIMessage(dbCtx, job.MessageID)
+		} else {
+			// Lo que alcanzo a generarse queda guardado como respuesta detenida
+			_, err := h.queries.FinishAIMessage(dbCtx, db.FinishAIMessageParams{
+				Content:      response,
+				Reasoning:    reasoning,
+				Filtered:     sql.NullInt64{Int64: 0, Valid: true},
+				FilterReason: sql.NullString{String: "", Valid: true},
+				Status:       sql.NullString{String: messageStatusStopped, Valid: true},
+				ID:           job.MessageID,
+			})
+			if err != nil {
+				log.Printf("[ERROR] Error guardando respuesta detenida %d: %v", job.MessageID, err)
+			}
+			h.logMessage(user, convID, "assistant", response)
+			h.queries.TouchConversation(dbCtx, convID)
+			h.summarizer.Schedule(convID, req.model)
+		}
+
+		if stopped {
+			job.Emit("stopped", map[string]int64{"message_id": job.MessageID})
+		}
+		job.Emit("done", map[string]int64{"conversation_id": convID})
+		return
+	}
 
 	// Verificar si fue filtrado
-	if filterResult != nil && filterResult.Blocked {
+	if filterResult := review.Blocked; filterResult != nil {
 		response = "Lo siento, no puedo procesar esa solicitud por politicas de seguridad."
 
-		_, err = h.queries.CreateAIMessage(dbCtx, db.CreateAIMessageParams{
-			ConversationID: convID,
-			Role:           "assistant",
-			Content:        response,
-			Filtered:       sql.NullInt64{Int64: 1, Valid: true},
-			FilterReason:   sql.NullString{String: filterResult.FilterName, Valid: true},
+		_, err = h.queries.FinishAIMessage(dbCtx, db.FinishAIMessageParams{
+			Content:      response,
+			Reasoning:    sql.NullString{String: "", Valid: true},
+			Filtered:     sql.NullInt64{Int64: 1, Valid: true},
+			FilterReason: sql.NullString{String: filterResult.FilterName, Valid: true},
+			Status:       sql.NullString{String: messageStatusComplete, Valid: true},
+			ID:           job.MessageID,
 		})
+		if err != nil {
+			log.Printf("[ERROR] Error guardando respuesta filtrada %d: %v", job.MessageID, err)
+		}
 
 		h.security.LogViolation(
 			dbCtx,
 			user.ID,
 			sql.NullInt64{Int64: filterResult.FilterID, Valid: true},
-			content,
+			req.question,
 			filterResult.Action,
-			r.RemoteAddr,
-			r.UserAgent(),
+			req.remoteAddr,
+			req.userAgent,
 		)
 
-		fmt.Fprintf(w, "event: filtered\ndata: {\"reason\": \"%s\"}\n\n", filterResult.Reason)
-		flusher.Flush()
+		go h.notifications.NotifySecurityAlert(context.Background(), user.Nombre, filterResult.FilterName)
+
+		// El cliente reemplaza lo recibido hasta ahora por el mensaje de rechazo
+		job.Emit("filtered", map[string]string{"reason": filterResult.Reason, "message": response})
 	} else {
+		unanswered := services.DetectUnanswered(response, len(req.sources) > 0)
+		response = unanswered.Response
+
 		// Guardar respuesta normal
-		_, err = h.queries.CreateAIMessage(dbCtx, db.CreateAIMessageParams{
-			ConversationID: convID,
-			Role:           "assistant",
-			Content:        response,
-			Filtered:       sql.NullInt64{Int64: 0, Valid: true},
-			FilterReason:   sql.NullString{String: "", Valid: true},
+		_, err := h.queries.FinishAIMessage(dbCtx, db.FinishAIMessageParams{
+			Content:      response,
+			Reasoning:    reasoning,
+			Filtered:     sql.NullInt64{Int64: 0, Valid: true},
+			FilterReason: sql.NullString{String: "", Valid: true},
+			FilterHits:   review.HitsJSON(),
+			Status:       sql.NullString{String: messageStatusComplete, Valid: true},
+			ID:           job.MessageID,
 		})
 		if err != nil {
 			log.Printf("[ERROR] Error guardando respuesta IA: %v", err)
+		} else {
+			h.saveMessageSources(dbCtx, job.MessageID, req.sources)
+			h.saveMessageComputed(dbCtx, job.MessageID, computed)
+			h.saveContextStats(dbCtx, job.MessageID, contextStats)
+		}
+
+		h.logMessage(user, convID, "assistant", response)
+
+		if unanswered.Unanswered {
+			h.captureUnanswered(dbCtx, user, convID, req.question, unanswered.Reason)
+			job.Emit("unanswered", map[string]interface{}{"unanswered": true, "marker": services.UnansweredMarker})
+		}
+
+		if len(req.sources) > 0 {
+			job.Emit("sources", map[string]interface{}{"sources": req.sources})
 		}
 	}
 
 	h.queries.TouchConversation(dbCtx, convID)
+	h.summarizer.Schedule(convID, req.model)
 
 	// Enviar evento de finalización
-	fmt.Fprintf(w, "event: done\ndata: {\"conversation_id\": %d}\n\n", convID)
+	job.Emit("done", map[string]int64{"conversation_id": convID})
+}
+
+// followGeneration envia al cliente los eventos de la respuesta posteriores a after y los
+// que vayan llegando, hasta que termine. Cada evento lleva su numero en "id:" para retomar
+// desde ahi; si el cliente se desconecta, la respuesta sigue generandose.
+func (h *AIHandler) followGeneration(w http.ResponseWriter, r *http.Request, flusher http.Flusher, job *services.GenerationJob, after int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Nginx
+	w.WriteHeader(http.StatusOK)
 	flusher.Flush()
+
+	// Tras 15 segundos sin eventos se reenvia la posicion en la cola, si aun espera, o un
+	// heartbeat, para que la conexion no quede inactiva
+	heartbeatTicker := time.NewTicker(15 * time.Second)
+	defer heartbeatTicker.Stop()
+	idle := true
+
+	for {
+		events, changed, done := job.Events(after)
+		for _, event := range events {
+			if event.Name != "" {
+				fmt.Fprintf(w, "event: %s\n", event.Name)
+			}
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.Seq, event.Data)
+			after = event.Seq
+		}
+		if len(events) > 0 {
+			flusher.Flush()
+			idle = false
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-heartbeatTicker.C:
+			if !idle {
+				idle = true
+				continue
+			}
+			if position := job.QueuePosition(); position > 0 {
+				fmt.Fprintf(w, "event: queue\ndata: {\"queue_position\": %d}\n\n", position)
+			} else {
+				fmt.Fprintf(w, ": heartbeat\n\n")
+				log.Printf("[DEBUG] Heartbeat enviado, esperando respuesta de modelo...")
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			log.Printf("[DEBUG] Cliente desconectado, la respuesta %d sigue generandose", job.MessageID)
+			return
+		}
+	}
+}
+
+// ResumeGeneration retoma la respuesta en curso (o recien terminada) de la conversacion:
+// envia por SSE los eventos posteriores a "after" (o al encabezado Last-Event-ID) y los que
+// sigan llegando. Responde 204 si la conversacion no tiene una respuesta en memoria.
+func (h *AIHandler) ResumeGeneration(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	convID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return
+	}
+
+	hasAccess, err := h.security.ValidateConversationAccess(r.Context(), convID, user.ID)
+	if err != nil || !hasAccess {
+		http.Error(w, "No autorizado", http.StatusForbidden)
+		return
+	}
+
+	after := r.URL.Query().Get("after")
+	if after == "" {
+		after = r.Header.Get("Last-Event-ID")
+	}
+	afterSeq, _ := strconv.Atoi(after)
+
+	job := h.generations.ForConversation(convID)
+	if job == nil || job.UserID != user.ID {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming no soportado", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[DEBUG] Usuario %d retoma la respuesta %d desde el evento %d", user.ID, job.MessageID, afterSeq)
+	h.followGeneration(w, r, flusher, job, afterSeq)
+}
+
+// StopGeneration detiene la respuesta en curso de la conversacion; lo generado hasta
+// ahora queda guardado
+func (h *AIHandler) StopGeneration(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	convID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return
+	}
+
+	hasAccess, err := h.security.ValidateConversationAccess(r.Context(), convID, user.ID)
+	if err != nil || !hasAccess {
+		http.Error(w, "No autorizado", http.StatusForbidden)
+		return
+	}
+
+	job := h.generations.ForConversation(convID)
+	if job == nil || job.UserID != user.ID || !job.Stop() {
+		http.Error(w, "No hay una respuesta en curso", http.StatusNotFound)
+		return
+	}
+	log.Printf("[INFO] Usuario %s detuvo la respuesta %d", user.Nomina, job.MessageID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stopped":    true,
+		"message_id": job.MessageID,
+	})
 }
 
 // HealthCheck endpoint para verificar estado del servicio de IA
@@ -723,8 +1673,8 @@ func (h *AIHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	status := map[string]interface{}{
-		"ollama_available": h.ollama.IsAvailable(ctx),
-		"model":            h.ollama.GetModel(),
+		"ollama_available": h.llm.IsAvailable(ctx),
+		"model":            h.llm.GetModel(),
 		"timestamp":        time.Now().Format(time.RFC3339),
 	}
 
@@ -732,12 +1682,26 @@ func (h *AIHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
-// ListModels devuelve la lista de modelos disponibles en Ollama
+// Backends devuelve el estado, la carga y los modelos de cada servidor de IA
+func (h *AIHandler) Backends(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"backends": h.llm.BackendStatus(),
+	})
+}
+
+// QueueStatus devuelve la ocupacion de la cola de generacion
+func (h *AIHandler) QueueStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.queue.Status())
+}
+
+// ListModels devuelve la lista de modelos disponibles en todos los servidores de IA
 func (h *AIHandler) ListModels(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	models, err := h.ollama.ListModels(ctx)
+	models, err := h.llm.ListModels(ctx)
 	if err != nil {
 		log.Printf("[ERROR] Error listando modelos: %v", err)
 		http.Error(w, "Error obteniendo modelos", http.StatusInternalServerError)
@@ -746,7 +1710,7 @@ func (h *AIHandler) ListModels(w http.ResponseWriter, r *http.Request) {
 
 	response := map[string]interface{}{
 		"models":        models,
-		"current_model": h.ollama.GetModel(),
+		"current_model": h.llm.GetModel(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -766,7 +1730,11 @@ func (h *AIHandler) SetModel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.ollama.SetModel(model)
+	if err := h.runtime.Set(r.Context(), "ollama_model", model); err != nil {
+		log.Printf("[ERROR] Error guardando modelo: %v", err)
+		http.Error(w, "Error guardando modelo", http.StatusInternalServerError)
+		return
+	}
 
 	user := middleware.GetUserFromContext(r.Context())
 	log.Printf("[INFO] Usuario %s cambió el modelo a: %s", user.Nomina, model)
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"chat-empleados/db"
+	"chat-empleados/internal/config"
+	"chat-empleados/internal/services"
+)
+
+func TestBuildChatMessagesLimitsHistory(t *testing.T) {
+	queries, database := newTestQueries(t)
+	ctx := context.Background()
+
+	cfg := &config.Config{OllamaURL: "http://127.0.0.1:1", OllamaNumCtx: 8192, MaxContextMsgs: 4}
+	h := &AIHandler{
+		queries: queries,
+		llm:     services.NewLLMService(cfg, nil),
+		runtime: services.NewRuntimeConfig(queries, cfg),
+	}
+
+	database.Exec("INSERT INTO users (nomina, password_hash, nombre) VALUES ('1', 'x', 'Ana')")
+	conv, err := queries.CreateAIConversation(ctx, db.CreateAIConversationParams{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 10; i++ {
+		role := "user"
+		if i%2 == 0 {
+			role = "assistant"
+		}
+		if _, err := queries.CreateAIMessage(ctx, db.CreateAIMessageParams{ConversationID: conv.ID, Role: role, Content: fmt.Sprintf("mensaje %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// La respuesta en curso no es parte del historial
+	if _, err := queries.CreatePendingAIMessage(ctx, conv.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, stats, err := h.buildChatMessages(ctx, conv.ID, "llama3", "Conocimiento: vacaciones", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var history []string
+	knowledge := false
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			knowledge = knowledge || msg.Content == "Conocimiento: vacaciones"
+			continue
+		}
+		history = append(history, msg.Content)
+	}
+	// max_context_messages = 4 deja solo los ultimos cuatro
+	want := []string{"mensaje 7", "mensaje 8", "mensaje 9", "mensaje 10"}
+	if fmt.Sprint(history) != fmt.Sprint(want) {
+		t.Errorf("historial = %q, se esperaba %q", history, want)
+	}
+	if !knowledge {
+		t.Error("falta el mensaje de conocimiento")
+	}
+	if stats.Dropped != 6 || !stats.Truncated {
+		t.Errorf("stats = %+v, se esperaban 6 mensajes omitidos", stats)
+	}
+}
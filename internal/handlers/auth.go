@@ -14,7 +14,6 @@ import (
 	"time"
 
 	"chat-empleados/db"
-	"chat-empleados/internal/config"
 	"chat-empleados/internal/middleware"
 	"chat-empleados/internal/services"
 
@@ -33,15 +32,15 @@ func sanitizeInput(input string) string {
 
 type AuthHandler struct {
 	queries       *db.Queries
-	cfg           *config.Config
+	runtime       *services.RuntimeConfig
 	templates     *template.Template
 	notifications *services.NotificationService
 }
 
-func NewAuthHandler(queries *db.Queries, cfg *config.Config, templates *template.Template, notifications *services.NotificationService) *AuthHandler {
+func NewAuthHandler(queries *db.Queries, runtime *services.RuntimeConfig, templates *template.Template, notifications *services.NotificationService) *AuthHandler {
 	return &AuthHandler{
 		queries:       queries,
-		cfg:           cfg,
+		runtime:       runtime,
 		templates:     templates,
 		notifications: notifications,
 	}
@@ -104,7 +103,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expiresAt := time.Now().Add(h.cfg.SessionDuration)
+	expiresAt := time.Now().Add(h.runtime.Current().SessionDuration)
 
 	_, err = h.queries.CreateSession(r.Context(), db.CreateSessionParams{
 		UserID:    user.ID,
@@ -126,7 +125,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		Path:     "/",
 		Expires:  expiresAt,
 		HttpOnly: true,
-		Secure:   r.TLS != nil || h.cfg.ForceSecureCookie,
+		Secure:   r.TLS != nil || h.runtime.Current().ForceSecureCookie,
 		SameSite: http.SameSiteStrictMode,
 	})
 
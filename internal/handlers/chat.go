@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -20,10 +25,12 @@ type ChatHandler struct {
 	templates *template.Template
 	hub       *Hub
 	security  *services.SecurityService
+	rooms     *services.ChatRoomService
+	dms       *services.DirectMessageService
 }
 
-func NewChatHandler(queries *db.Queries, templates *template.Template, security *services.SecurityService) *ChatHandler {
-	hub := NewHub()
+func NewChatHandler(queries *db.Queries, templates *template.Template, security *services.SecurityService, rooms *services.ChatRoomService, dms *services.DirectMessageService, broadcaster services.Broadcaster) *ChatHandler {
+	hub := NewHub(queries, broadcaster)
 	go hub.Run()
 
 	return &ChatHandler{
@@ -31,13 +38,45 @@ func NewChatHandler(queries *db.Queries, templates *template.Template, security
 		templates: templates,
 		hub:       hub,
 		security:  security,
+		rooms:     rooms,
+		dms:       dms,
 	}
 }
 
+// ChatPage muestra la sala indicada en ?room=<slug> (por defecto la general) con su historial,
+// o el hilo de mensajes directos indicado en ?dm=<id>
 func (h *ChatHandler) ChatPage(w http.ResponseWriter, r *http.Request) {
 	user := middleware.GetUserFromContext(r.Context())
 
-	messages, err := h.queries.GetRecentGroupMessages(r.Context(), 50)
+	if err := h.rooms.EnsureDefaultMemberships(r.Context(), user.ID, user.Departamento); err != nil {
+		log.Printf("[ERROR] Error asignando salas a %s: %v", user.Nomina, err)
+	}
+
+	if r.URL.Query().Has("dm") {
+		h.directMessagePage(w, r)
+		return
+	}
+
+	slug := r.URL.Query().Get("room")
+	if slug == "" {
+		slug = services.GeneralRoomSlug
+	}
+
+	room, err := h.queries.GetChatRoomBySlug(r.Context(), slug)
+	if err != nil || !h.rooms.IsMember(r.Context(), room.ID, user.ID) {
+		if slug != services.GeneralRoomSlug {
+			http.Redirect(w, r, "/chat", http.StatusSeeOther)
+			return
+		}
+		log.Printf("[ERROR] Sala general no disponible para %s: %v", user.Nomina, err)
+		http.Error(w, "Sala no disponible", http.StatusInternalServerError)
+		return
+	}
+
+	messages, err := h.queries.GetRecentGroupMessages(r.Context(), db.GetRecentGroupMessagesParams{
+		RoomID: sql.NullInt64{Int64: room.ID, Valid: true},
+		Limit:  50,
+	})
 	if err != nil {
 		log.Printf("[ERROR] Error obteniendo mensajes: %v", err)
 	}
@@ -46,14 +85,39 @@ func (h *ChatHandler) ChatPage(w http.ResponseWriter, r *http.Request) {
 		messages[i], messages[j] = messages[j], messages[i]
 	}
 
-	data := TemplateData(r, map[string]interface{}{
-		"Title":    Tr(r, "group_chat"),
-		"User":     user,
-		"Messages": messages,
-	})
+	data := h.sidebarData(r, user)
+	data["Room"] = room
+	data["Messages"] = messages
+	data["OnlineCount"] = h.hub.RoomOnlineCount(room.ID)
 	h.templates.ExecuteTemplate(w, "chat", data)
 }
 
+// sidebarData arma los datos comunes de la pagina de chat: salas y mensajes directos del usuario
+func (h *ChatHandler) sidebarData(r *http.Request, user *middleware.AuthUser) map[string]interface{} {
+	rooms, err := h.queries.GetUserChatRooms(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo salas: %v", err)
+	}
+
+	joinable, err := h.queries.GetJoinableChatRooms(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo salas disponibles: %v", err)
+	}
+
+	threads, err := h.queries.GetUserDMThreads(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo mensajes directos: %v", err)
+	}
+
+	return TemplateData(r, map[string]interface{}{
+		"Title":         Tr(r, "group_chat"),
+		"User":          user,
+		"Rooms":         rooms,
+		"JoinableRooms": joinable,
+		"Threads":       threads,
+	})
+}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -88,6 +152,30 @@ func (h *ChatHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Sin sala la conexion solo recibe mensajes directos
+	var roomID int64
+	if roomParam := r.URL.Query().Get("room"); roomParam != "" {
+		id, err := strconv.ParseInt(roomParam, 10, 64)
+		if err != nil {
+			http.Error(w, "Sala invalida", http.StatusBadRequest)
+			return
+		}
+		if !h.rooms.IsMember(r.Context(), id, user.ID) {
+			http.Error(w, "No perteneces a esta sala", http.StatusForbidden)
+			return
+		}
+		roomID = id
+	}
+
+	// since=<id> reanuda la sala desde el ultimo mensaje visto: el hub reenvia lo que se
+	// perdio (entre la carga de la pagina y la conexion, o durante una desconexion)
+	since := int64(-1)
+	if sinceParam := r.URL.Query().Get("since"); sinceParam != "" {
+		if id, err := strconv.ParseInt(sinceParam, 10, 64); err == nil && id >= 0 {
+			since = id
+		}
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("[ERROR] Error upgrading websocket: %v", err)
@@ -98,6 +186,8 @@ func (h *ChatHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
 		hub:    h.hub,
 		conn:   conn,
 		send:   make(chan []byte, 256),
+		roomID: roomID,
+		since:  since,
 		userID: user.ID,
 		nombre: user.Nombre,
 		nomina: user.Nomina,
@@ -105,34 +195,93 @@ func (h *ChatHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
 	h.hub.register <- client
 
 	go client.writePump()
-	go client.readPump(h.queries, h.security)
+	go client.readPump(h.queries, h.security, h.dms)
+}
+
+// maxReplayMessages limita cuantos mensajes perdidos se reenvian al reconectar; debe
+// caber en el buffer de envio del cliente. Si faltan mas, el cliente recarga la pagina.
+const maxReplayMessages = 200
+
+const (
+	// presenceInterval cada cuanto una instancia vuelve a publicar sus conexiones por sala
+	presenceInterval = 30 * time.Second
+	// presenceTTL tras este tiempo sin noticias, las conexiones de otra instancia dejan de
+	// contarse (ej: se detuvo sin avisar)
+	presenceTTL = 3 * presenceInterval
+)
+
+// presenceSnapshot conexiones por sala de una instancia; Seq descarta las fotos que
+// lleguen desordenadas
+type presenceSnapshot struct {
+	Instance string        `json:"instance"`
+	Seq      int64         `json:"seq"`
+	Rooms    map[int64]int `json:"rooms"`
+	seen     time.Time
 }
 
+// Hub mantiene las conexiones activas de esta instancia agrupadas por sala; cada mensaje
+// solo llega a los clientes de su sala. Los mensajes, la presencia y los cierres se publican
+// en el broadcaster y se aplican al recibirlos de vuelta, asi llegan a todas las instancias.
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
-	mutex      sync.RWMutex
+	queries     *db.Queries
+	broadcaster services.Broadcaster
+	rooms       map[int64]map[*Client]bool
+	register    chan *Client
+	unregister  chan *Client
+	mutex       sync.RWMutex
+
+	instanceID  string                       // identifica las fotos de presencia propias
+	presenceSeq int64                        // ultima foto de presencia publicada
+	remote      map[string]*presenceSnapshot // conexiones de las demas instancias
 }
 
-func NewHub() *Hub {
+func NewHub(queries *db.Queries, broadcaster services.Broadcaster) *Hub {
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
+		queries:     queries,
+		broadcaster: broadcaster,
+		rooms:       make(map[int64]map[*Client]bool),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		instanceID:  newInstanceID(),
+		remote:      make(map[string]*presenceSnapshot),
+	}
+}
+
+// newInstanceID genera un identificador aleatorio para esta instancia del servidor
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
 	}
+	return hex.EncodeToString(b)
 }
 
 func (h *Hub) Run() {
+	heartbeat := time.NewTicker(presenceInterval)
+	defer heartbeat.Stop()
+
 	for {
 		select {
+		case <-heartbeat.C:
+			go h.publishPresence()
+
 		case client := <-h.register:
 			h.mutex.Lock()
-			h.clients[client] = true
+			if h.rooms[client.roomID] == nil {
+				h.rooms[client.roomID] = make(map[*Client]bool)
+			}
+			h.rooms[client.roomID][client] = true
 			h.mutex.Unlock()
-			log.Printf("[INFO] Cliente conectado: %s", client.nombre)
+			log.Printf("[INFO] Cliente conectado: %s (sala %d)", client.nombre, client.roomID)
+			if client.roomID == 0 {
+				continue
+			}
+
+			// La reproduccion ocurre en este mismo ciclo, antes de procesar cualquier evento
+			// posterior, para que no queden huecos entre lo perdido y lo que llega en vivo
+			if client.since >= 0 {
+				h.replay(client)
+			}
 
 			msg := ChatMessage{
 				Type:      "system",
@@ -140,16 +289,20 @@ func (h *Hub) Run() {
 				Timestamp: time.Now().Format("15:04"),
 			}
 			data, _ := json.Marshal(msg)
-			h.broadcastToAll(data)
+			// En otra goroutine: este ciclo es el que consume los eventos publicados
+			go h.Broadcast(client.roomID, data)
+			go h.publishPresence()
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+			if _, ok := h.rooms[client.roomID][client]; ok {
+				h.removeClient(client)
 			}
 			h.mutex.Unlock()
-			log.Printf("[INFO] Cliente desconectado: %s", client.nombre)
+			log.Printf("[INFO] Cliente desconectado: %s (sala %d)", client.nombre, client.roomID)
+			if client.roomID == 0 {
+				continue
+			}
 
 			msg := ChatMessage{
 				Type:      "system",
@@ -157,38 +310,255 @@ func (h *Hub) Run() {
 				Timestamp: time.Now().Format("15:04"),
 			}
 			data, _ := json.Marshal(msg)
-			h.broadcastToAll(data)
+			go h.Broadcast(client.roomID, data)
+			go h.publishPresence()
 
-		case message := <-h.broadcast:
-			h.broadcastToAll(message)
+		case event := <-h.broadcaster.Events():
+			h.apply(event)
 		}
 	}
 }
 
-func (h *Hub) broadcastToAll(message []byte) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+// apply ejecuta sobre las conexiones de esta instancia un evento recibido del broadcaster
+func (h *Hub) apply(event services.ChatEvent) {
+	switch event.Kind {
+	case services.ChatEventRoom:
+		h.broadcastToRoom(event.RoomID, event.Data)
+	case services.ChatEventUsers:
+		h.sendToUsers(event.UserIDs, event.Data)
+	case services.ChatEventDisconnectUser:
+		for _, userID := range event.UserIDs {
+			h.disconnectUser(event.RoomID, userID)
+		}
+	case services.ChatEventCloseRoom:
+		h.closeRoom(event.RoomID)
+	case services.ChatEventPresence:
+		h.applyPresence(event.Data)
+	default:
+		log.Printf("[WARN] Evento de chat desconocido: %s", event.Kind)
+	}
+}
+
+// publish envia el evento a todas las instancias, incluida esta
+func (h *Hub) publish(event services.ChatEvent) {
+	if err := h.broadcaster.Publish(context.Background(), event); err != nil {
+		log.Printf("[ERROR] Error publicando evento %s del chat: %v", event.Kind, err)
+	}
+}
+
+// publishPresence publica cuantas conexiones tiene cada sala en esta instancia
+func (h *Hub) publishPresence() {
+	h.mutex.Lock()
+	h.presenceSeq++
+	snapshot := presenceSnapshot{
+		Instance: h.instanceID,
+		Seq:      h.presenceSeq,
+		Rooms:    make(map[int64]int, len(h.rooms)),
+	}
+	for roomID, clients := range h.rooms {
+		if roomID != 0 {
+			snapshot.Rooms[roomID] = len(clients)
+		}
+	}
+	h.mutex.Unlock()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return
+	}
+	h.publish(services.ChatEvent{Kind: services.ChatEventPresence, Data: data})
+}
+
+// applyPresence guarda la foto de presencia de otra instancia
+func (h *Hub) applyPresence(data []byte) {
+	var snapshot presenceSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		log.Printf("[WARN] Evento de presencia invalido: %v", err)
+		return
+	}
+	if snapshot.Instance == h.instanceID {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for instance, previous := range h.remote {
+		if time.Since(previous.seen) >= presenceTTL {
+			delete(h.remote, instance)
+		}
+	}
+	if previous, ok := h.remote[snapshot.Instance]; ok && previous.Seq >= snapshot.Seq {
+		return
+	}
+	snapshot.seen = time.Now()
+	h.remote[snapshot.Instance] = &snapshot
+}
+
+// Broadcast difunde el mensaje a los clientes de la sala en todas las instancias
+func (h *Hub) Broadcast(roomID int64, message []byte) {
+	h.publish(services.ChatEvent{Kind: services.ChatEventRoom, RoomID: roomID, Data: message})
+}
 
-	for client := range h.clients {
+// SendToUsers entrega el mensaje a todas las conexiones de los usuarios indicados, en cualquier sala e instancia
+func (h *Hub) SendToUsers(userIDs []int64, message []byte) {
+	h.publish(services.ChatEvent{Kind: services.ChatEventUsers, UserIDs: userIDs, Data: message})
+}
+
+// DisconnectUser cierra las conexiones del usuario en la sala (ej: al quitarlo como miembro)
+func (h *Hub) DisconnectUser(roomID, userID int64) {
+	h.publish(services.ChatEvent{Kind: services.ChatEventDisconnectUser, RoomID: roomID, UserIDs: []int64{userID}})
+}
+
+// CloseRoom cierra todas las conexiones de una sala eliminada
+func (h *Hub) CloseRoom(roomID int64) {
+	h.publish(services.ChatEvent{Kind: services.ChatEventCloseRoom, RoomID: roomID})
+}
+
+// replay envia al cliente los mensajes de su sala posteriores a client.since
+func (h *Hub) replay(client *Client) {
+	missed, err := h.queries.GetGroupMessagesSince(context.Background(), db.GetGroupMessagesSinceParams{
+		RoomID: sql.NullInt64{Int64: client.roomID, Valid: true},
+		ID:     client.since,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo mensajes perdidos de sala %d: %v", client.roomID, err)
+		return
+	}
+
+	messages := make([][]byte, 0, len(missed)+1)
+	if len(missed) > maxReplayMessages {
+		data, _ := json.Marshal(ChatMessage{Type: "resync", Timestamp: time.Now().Format("15:04")})
+		messages = append(messages, data)
+	} else {
+		for _, m := range missed {
+			data, _ := json.Marshal(ChatMessage{
+				Type:      "message",
+				ID:        m.ID,
+				Content:   m.Content,
+				UserID:    m.UserID,
+				Nombre:    m.Nombre,
+				Nomina:    m.Nomina,
+				Timestamp: m.CreatedAt.Time.Local().Format("15:04"),
+			})
+			messages = append(messages, data)
+		}
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, data := range messages {
+		if _, ok := h.rooms[client.roomID][client]; !ok {
+			return
+		}
+		select {
+		case client.send <- data:
+		default:
+			h.removeClient(client)
+			return
+		}
+	}
+	if len(missed) > 0 {
+		log.Printf("[INFO] %d mensajes reenviados a %s (sala %d)", len(missed), client.nombre, client.roomID)
+	}
+}
+
+// removeClient quita al cliente de su sala y cierra su canal; requiere el mutex tomado
+func (h *Hub) removeClient(client *Client) {
+	delete(h.rooms[client.roomID], client)
+	if len(h.rooms[client.roomID]) == 0 {
+		delete(h.rooms, client.roomID)
+	}
+	close(client.send)
+}
+
+func (h *Hub) broadcastToRoom(roomID int64, message []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for client := range h.rooms[roomID] {
 		select {
 		case client.send <- message:
 		default:
-			close(client.send)
-			delete(h.clients, client)
+			h.removeClient(client)
+		}
+	}
+}
+
+func (h *Hub) sendToUsers(userIDs []int64, message []byte) {
+	targets := make(map[int64]bool, len(userIDs))
+	for _, id := range userIDs {
+		targets[id] = true
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, clients := range h.rooms {
+		for client := range clients {
+			if !targets[client.userID] {
+				continue
+			}
+			select {
+			case client.send <- message:
+			default:
+				h.removeClient(client)
+			}
 		}
 	}
 }
 
+func (h *Hub) disconnectUser(roomID, userID int64) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for client := range h.rooms[roomID] {
+		if client.userID == userID {
+			client.conn.Close()
+		}
+	}
+}
+
+func (h *Hub) closeRoom(roomID int64) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	for client := range h.rooms[roomID] {
+		client.conn.Close()
+	}
+}
+
 func (h *Hub) GetOnlineCount() int {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
-	return len(h.clients)
+
+	count := 0
+	for _, clients := range h.rooms {
+		count += len(clients)
+	}
+	return count
+}
+
+// RoomOnlineCount devuelve cuantas conexiones activas tiene la sala, sumando las que las
+// demas instancias publicaron en los ultimos presenceTTL
+func (h *Hub) RoomOnlineCount(roomID int64) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	count := len(h.rooms[roomID])
+	for _, snapshot := range h.remote {
+		if time.Since(snapshot.seen) < presenceTTL {
+			count += snapshot.Rooms[roomID]
+		}
+	}
+	return count
 }
 
 type Client struct {
 	hub    *Hub
 	conn   *websocket.Conn
 	send   chan []byte
+	roomID int64
+	since  int64
 	userID int64
 	nombre string
 	nomina string
@@ -196,6 +566,7 @@ type Client struct {
 
 type ChatMessage struct {
 	Type      string `json:"type"`
+	ID        int64  `json:"id,omitempty"`
 	Content   string `json:"content"`
 	UserID    int64  `json:"user_id,omitempty"`
 	Nombre    string `json:"nombre,omitempty"`
@@ -203,13 +574,17 @@ type ChatMessage struct {
 	Timestamp string `json:"timestamp"`
 	Blocked   bool   `json:"blocked,omitempty"`
 	Reason    string `json:"reason,omitempty"`
+	ThreadID  int64  `json:"thread_id,omitempty"`
 }
 
+// IncomingMessage mensaje del cliente; con ThreadID se envia como mensaje directo
+// a ese hilo en lugar de a la sala de la conexion
 type IncomingMessage struct {
-	Content string `json:"content"`
+	Content  string `json:"content"`
+	ThreadID int64  `json:"thread_id,omitempty"`
 }
 
-func (c *Client) readPump(queries *db.Queries, security *services.SecurityService) {
+func (c *Client) readPump(queries *db.Queries, security *services.SecurityService, dms *services.DirectMessageService) {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close()
@@ -243,26 +618,38 @@ func (c *Client) readPump(queries *db.Queries, security *services.SecurityServic
 
 		content = security.SanitizeForDisplay(content)
 
-		if filterResult := security.CheckInput(nil, content); filterResult != nil {
-			if filterResult.Blocked {
-				errorMsg := ChatMessage{
-					Type:      "error",
-					Content:   "Tu mensaje fue bloqueado: " + filterResult.Reason,
-					Timestamp: time.Now().Format("15:04"),
-					Blocked:   true,
-					Reason:    filterResult.FilterName,
-				}
-				data, _ := json.Marshal(errorMsg)
-				c.send <- data
-
-				log.Printf("[SECURITY] Mensaje grupal bloqueado de %s: %s", c.nomina, filterResult.FilterName)
-				continue
+		// Se evaluan todos los filtros: los datos sensibles se redactan antes de guardar y difundir
+		review := security.ReviewInput(context.Background(), content)
+		if filterResult := review.Blocked; filterResult != nil {
+			errorMsg := ChatMessage{
+				Type:      "error",
+				Content:   "Tu mensaje fue bloqueado: " + filterResult.Reason,
+				Timestamp: time.Now().Format("15:04"),
+				Blocked:   true,
+				Reason:    filterResult.FilterName,
 			}
+			data, _ := json.Marshal(errorMsg)
+			c.send <- data
+
+			log.Printf("[SECURITY] Mensaje bloqueado de %s: %s", c.nomina, filterResult.FilterName)
+			continue
+		}
+		content = review.Content
+
+		if incoming.ThreadID > 0 {
+			c.sendDirectMessage(dms, security, incoming.ThreadID, content)
+			continue
 		}
 
-		_, err = queries.CreateGroupMessage(nil, db.CreateGroupMessageParams{
-			UserID:  c.userID,
-			Content: content,
+		if c.roomID == 0 {
+			continue
+		}
+
+		saved, err := queries.CreateGroupMessage(context.Background(), db.CreateGroupMessageParams{
+			UserID:     c.userID,
+			Content:    content,
+			RoomID:     sql.NullInt64{Int64: c.roomID, Valid: true},
+			FilterHits: review.HitsJSON(),
 		})
 		if err != nil {
 			log.Printf("[ERROR] Error guardando mensaje: %v", err)
@@ -271,6 +658,7 @@ func (c *Client) readPump(queries *db.Queries, security *services.SecurityServic
 
 		chatMsg := ChatMessage{
 			Type:      "message",
+			ID:        saved.ID,
 			Content:   content,
 			UserID:    c.userID,
 			Nombre:    c.nombre,
@@ -278,8 +666,38 @@ func (c *Client) readPump(queries *db.Queries, security *services.SecurityServic
 			Timestamp: time.Now().Format("15:04"),
 		}
 		data, _ := json.Marshal(chatMsg)
-		c.hub.broadcast <- data
+		c.hub.Broadcast(c.roomID, data)
+	}
+}
+
+// sendDirectMessage guarda el mensaje en el hilo y lo entrega a los participantes conectados
+func (c *Client) sendDirectMessage(dms *services.DirectMessageService, security *services.SecurityService, threadID int64, content string) {
+	ctx := context.Background()
+
+	allowed, err := security.ValidateDMThreadAccess(ctx, threadID, c.userID)
+	if err != nil || !allowed {
+		log.Printf("[SECURITY] %s intento escribir en el hilo %d sin acceso", c.nomina, threadID)
+		return
+	}
+
+	saved, participants, err := dms.Send(ctx, threadID, c.userID, content)
+	if err != nil {
+		log.Printf("[ERROR] %v", err)
+		return
+	}
+
+	chatMsg := ChatMessage{
+		Type:      "dm",
+		ID:        saved.ID,
+		Content:   content,
+		UserID:    c.userID,
+		Nombre:    c.nombre,
+		Nomina:    c.nomina,
+		Timestamp: time.Now().Format("15:04"),
+		ThreadID:  threadID,
 	}
+	data, _ := json.Marshal(chatMsg)
+	c.hub.SendToUsers(participants, data)
 }
 
 func (c *Client) writePump() {
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"chat-empleados/internal/services"
+)
+
+func TestRoomOnlineCountIncludesOtherInstances(t *testing.T) {
+	local := NewHub(nil, services.NewMemoryBroadcaster())
+	other := NewHub(nil, services.NewMemoryBroadcaster())
+
+	local.rooms[5] = map[*Client]bool{{}: true}
+	other.rooms[5] = map[*Client]bool{{}: true, {}: true}
+	other.rooms[7] = map[*Client]bool{{}: true}
+
+	other.publishPresence()
+	event := <-other.broadcaster.Events()
+	local.apply(event)
+	// La foto propia no se suma dos veces
+	other.apply(event)
+
+	if got := local.RoomOnlineCount(5); got != 3 {
+		t.Errorf("sala 5 en la instancia local = %d, se esperaba 3", got)
+	}
+	if got := local.RoomOnlineCount(7); got != 1 {
+		t.Errorf("sala 7 en la instancia local = %d, se esperaba 1", got)
+	}
+	if got := other.RoomOnlineCount(5); got != 2 {
+		t.Errorf("sala 5 en la otra instancia = %d, se esperaba 2", got)
+	}
+
+	// Una foto vieja que llega tarde no reemplaza a la nueva
+	delete(other.rooms, 7)
+	other.publishPresence()
+	newer := <-other.broadcaster.Events()
+	local.apply(newer)
+	local.apply(event)
+	if got := local.RoomOnlineCount(7); got != 0 {
+		t.Errorf("sala 7 tras la foto nueva = %d, se esperaba 0", got)
+	}
+
+	// Sin noticias de la otra instancia durante presenceTTL deja de contarse
+	local.remote[other.instanceID].seen = time.Now().Add(-presenceTTL)
+	if got := local.RoomOnlineCount(5); got != 1 {
+		t.Errorf("sala 5 con la otra instancia caida = %d, se esperaba 1", got)
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+
+	"chat-empleados/internal/config"
+	"chat-empleados/internal/middleware"
+	"chat-empleados/internal/services"
+)
+
+type ConfigHandler struct {
+	templates *template.Template
+	runtime   *services.RuntimeConfig
+}
+
+func NewConfigHandler(templates *template.Template, runtime *services.RuntimeConfig) *ConfigHandler {
+	return &ConfigHandler{
+		templates: templates,
+		runtime:   runtime,
+	}
+}
+
+// ConfigEntry valor de una clave de configuracion para la vista de admin
+type ConfigEntry struct {
+	Key         string   `json:"key"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Min         int      `json:"min,omitempty"`
+	Max         int      `json:"max,omitempty"`
+	Options     []string `json:"options,omitempty"`
+	Value       string   `json:"value"`
+	Default     string   `json:"default"`
+	Overridden  bool     `json:"overridden"`
+}
+
+func (h *ConfigHandler) entries() []ConfigEntry {
+	current := h.runtime.Current()
+
+	entries := make([]ConfigEntry, 0, len(config.Settings))
+	for _, s := range config.Settings {
+		_, overridden := h.runtime.Override(s.Key)
+		entries = append(entries, ConfigEntry{
+			Key:         s.Key,
+			Description: s.Description,
+			Type:        s.Type,
+			Min:         s.Min,
+			Max:         s.Max,
+			Options:     s.Options,
+			Value:       current.Get(s.Key),
+			Default:     h.runtime.Default(s.Key),
+			Overridden:  overridden,
+		})
+	}
+	return entries
+}
+
+func (h *ConfigHandler) ConfigPage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	data := TemplateData(r, map[string]interface{}{
+		"Title":   "Configuracion",
+		"User":    user,
+		"Entries": h.entries(),
+	})
+	h.templates.ExecuteTemplate(w, "admin_config", data)
+}
+
+// GetConfig devuelve la configuracion vigente en JSON
+func (h *ConfigHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.entries())
+}
+
+func (h *ConfigHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	key := r.FormValue("key")
+	if err := h.runtime.Set(r.Context(), key, r.FormValue("value")); err != nil {
+		log.Printf("[WARN] Configuracion rechazada (%s) de %s: %v", key, user.Nomina, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[INFO] Configuracion %s actualizada por %s", key, user.Nomina)
+
+	w.Header().Set("HX-Redirect", "/admin/config")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ConfigHandler) ResetConfig(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	key := r.FormValue("key")
+	if err := h.runtime.Reset(r.Context(), key); err != nil {
+		log.Printf("[ERROR] Error restableciendo configuracion %s: %v", key, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[INFO] Configuracion %s restablecida por %s", key, user.Nomina)
+
+	w.Header().Set("HX-Redirect", "/admin/config")
+	w.WriteHeader(http.StatusOK)
+}
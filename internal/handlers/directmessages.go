@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chat-empleados/db"
+	"chat-empleados/internal/middleware"
+)
+
+// directMessagePage muestra el hilo de mensajes directos indicado en ?dm=<id>
+func (h *ChatHandler) directMessagePage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	threadID, err := strconv.ParseInt(r.URL.Query().Get("dm"), 10, 64)
+	if err != nil {
+		http.Redirect(w, r, "/chat", http.StatusSeeOther)
+		return
+	}
+
+	allowed, err := h.security.ValidateDMThreadAccess(r.Context(), threadID, user.ID)
+	if err != nil || !allowed {
+		http.Redirect(w, r, "/chat", http.StatusSeeOther)
+		return
+	}
+
+	thread, err := h.queries.GetDMThreadByID(r.Context(), threadID)
+	if err != nil {
+		http.Redirect(w, r, "/chat", http.StatusSeeOther)
+		return
+	}
+
+	messages, err := h.queries.GetRecentDirectMessages(r.Context(), db.GetRecentDirectMessagesParams{
+		ThreadID: threadID,
+		Limit:    50,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo mensajes directos: %v", err)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	if err := h.dms.MarkRead(r.Context(), threadID, user.ID); err != nil {
+		log.Printf("[ERROR] Error marcando hilo %d como leido: %v", threadID, err)
+	}
+
+	// El sidebar se carga despues de marcar como leido para no mostrar este hilo como pendiente
+	data := h.sidebarData(r, user)
+	data["Thread"] = thread
+	data["Messages"] = messages
+	for _, t := range data["Threads"].([]db.GetUserDMThreadsRow) {
+		if t.ID == threadID {
+			data["ThreadName"] = threadDisplayName(t)
+		}
+	}
+	h.templates.ExecuteTemplate(w, "chat", data)
+}
+
+// threadDisplayName usa el titulo del grupo o, si no tiene, los nombres de los participantes
+func threadDisplayName(t db.GetUserDMThreadsRow) string {
+	if t.Title.String != "" {
+		return t.Title.String
+	}
+	return t.ParticipantNames.String
+}
+
+// StartDirectMessage abre (o reutiliza) un hilo con los empleados indicados por nomina
+func (h *ChatHandler) StartDirectMessage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	var participantIDs []int64
+	for _, nomina := range strings.Split(r.FormValue("nominas"), ",") {
+		nomina = strings.TrimSpace(nomina)
+		if nomina == "" {
+			continue
+		}
+		target, err := h.queries.GetUserByNomina(r.Context(), nomina)
+		if err != nil || !target.Approved.Valid || target.Approved.Int64 != 1 {
+			http.Error(w, "Empleado no encontrado: "+nomina, http.StatusNotFound)
+			return
+		}
+		participantIDs = append(participantIDs, target.ID)
+	}
+
+	threadID, err := h.dms.OpenThread(r.Context(), user.ID, participantIDs, r.FormValue("title"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/chat?dm="+strconv.FormatInt(threadID, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// MarkDirectMessagesRead marca el hilo como leido (el cliente lo llama al recibir mensajes en vivo)
+func (h *ChatHandler) MarkDirectMessagesRead(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	threadID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return
+	}
+
+	allowed, err := h.security.ValidateDMThreadAccess(r.Context(), threadID, user.ID)
+	if err != nil || !allowed {
+		http.Error(w, "Hilo no encontrado", http.StatusNotFound)
+		return
+	}
+
+	if err := h.dms.MarkRead(r.Context(), threadID, user.ID); err != nil {
+		log.Printf("[ERROR] Error marcando hilo %d como leido: %v", threadID, err)
+		http.Error(w, "Error actualizando hilo", http.StatusInternalServerError)
+		return
+	}
+
+	h.DirectMessagesUnread(w, r)
+}
+
+// DirectMessagesUnread devuelve en JSON el total de mensajes directos sin leer
+func (h *ChatHandler) DirectMessagesUnread(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	unread, err := h.dms.UnreadCount(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] Error contando mensajes directos: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"unread": unread})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"chat-empleados/db"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestQueries crea una base de datos temporal con el schema completo
+func newTestQueries(t *testing.T) (*db.Queries, *sql.DB) {
+	t.Helper()
+	schema, err := os.ReadFile("../../schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if _, err := database.Exec(string(schema)); err != nil {
+		t.Fatalf("error creando schema: %v", err)
+	}
+	return db.New(database), database
+}
@@ -18,16 +18,27 @@ type KnowledgeHandler struct {
 	queries       *db.Queries
 	templates     *template.Template
 	notifications *services.NotificationService
+	retriever     *services.KnowledgeRetriever
 }
 
-func NewKnowledgeHandler(queries *db.Queries, templates *template.Template, notifications *services.NotificationService) *KnowledgeHandler {
+func NewKnowledgeHandler(queries *db.Queries, templates *template.Template, notifications *services.NotificationService, retriever *services.KnowledgeRetriever) *KnowledgeHandler {
 	return &KnowledgeHandler{
 		queries:       queries,
 		templates:     templates,
 		notifications: notifications,
+		retriever:     retriever,
 	}
 }
 
+// indexKnowledge indexa una entrada nueva en segundo plano (los embeddings pueden tardar)
+func (h *KnowledgeHandler) indexKnowledge(knowledgeID int64) {
+	go func() {
+		if err := h.retriever.IndexKnowledge(context.Background(), knowledgeID); err != nil {
+			log.Printf("[ERROR] Error indexando conocimiento %d: %v", knowledgeID, err)
+		}
+	}()
+}
+
 // KnowledgePage muestra la pagina de base de conocimiento para empleados
 func (h *KnowledgeHandler) KnowledgePage(w http.ResponseWriter, r *http.Request) {
 	user := middleware.GetUserFromContext(r.Context())
@@ -84,7 +95,7 @@ func (h *KnowledgeHandler) SubmitKnowledge(w http.ResponseWriter, r *http.Reques
 
 	// Si es admin, agregar directamente al conocimiento aprobado
 	if user.IsAdmin {
-		_, err := h.queries.CreateKnowledge(r.Context(), db.CreateKnowledgeParams{
+		kb, err := h.queries.CreateKnowledge(r.Context(), db.CreateKnowledgeParams{
 			Title:       title,
 			Content:     content,
 			Category:    sql.NullString{String: category, Valid: true},
@@ -96,6 +107,7 @@ func (h *KnowledgeHandler) SubmitKnowledge(w http.ResponseWriter, r *http.Reques
 			http.Error(w, "Error agregando conocimiento", http.StatusInternalServerError)
 			return
 		}
+		h.indexKnowledge(kb.ID)
 
 		log.Printf("[INFO] Conocimiento agregado por admin %s: %s", user.Nomina, title)
 
@@ -197,7 +209,7 @@ func (h *KnowledgeHandler) ApproveSubmission(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Agregar al conocimiento aprobado
-	_, err = h.queries.CreateKnowledge(r.Context(), db.CreateKnowledgeParams{
+	kb, err := h.queries.CreateKnowledge(r.Context(), db.CreateKnowledgeParams{
 		Title:       submission.Title,
 		Content:     submission.Content,
 		Category:    submission.Category,
@@ -206,6 +218,8 @@ func (h *KnowledgeHandler) ApproveSubmission(w http.ResponseWriter, r *http.Requ
 	})
 	if err != nil {
 		log.Printf("[ERROR] Error creando conocimiento: %v", err)
+	} else {
+		h.indexKnowledge(kb.ID)
 	}
 
 	log.Printf("[INFO] Conocimiento aprobado por %s: %s", adminUser.Nomina, submission.Title)
@@ -296,7 +310,7 @@ func (h *KnowledgeHandler) AnswerQuestion(w http.ResponseWriter, r *http.Request
 
 	// Si se debe agregar al conocimiento, crear entrada
 	if addToKnowledge {
-		_, err = h.queries.CreateKnowledge(r.Context(), db.CreateKnowledgeParams{
+		kb, err := h.queries.CreateKnowledge(r.Context(), db.CreateKnowledgeParams{
 			Title:       "Pregunta: " + truncateString(question.Question, 50),
 			Content:     "Pregunta: " + question.Question + "\n\nRespuesta: " + answer,
 			Category:    sql.NullString{String: "preguntas_frecuentes", Valid: true},
@@ -305,6 +319,8 @@ func (h *KnowledgeHandler) AnswerQuestion(w http.ResponseWriter, r *http.Request
 		})
 		if err != nil {
 			log.Printf("[ERROR] Error agregando pregunta al conocimiento: %v", err)
+		} else {
+			h.indexKnowledge(kb.ID)
 		}
 	}
 
@@ -361,6 +377,9 @@ func (h *KnowledgeHandler) DeleteKnowledge(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Los fragmentos se eliminan en cascada; solo hay que recargar el indice
+	h.retriever.Invalidate()
+
 	log.Printf("[INFO] Conocimiento eliminado por %s: ID %d", adminUser.Nomina, knowledgeID)
 
 	w.Header().Set("HX-Trigger", "knowledgeDeleted")
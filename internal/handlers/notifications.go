@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"chat-empleados/db"
+	"chat-empleados/internal/middleware"
+	"chat-empleados/internal/services"
+)
+
+type NotificationHandler struct {
+	notifications *services.NotificationService
+}
+
+func NewNotificationHandler(notifications *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{
+		notifications: notifications,
+	}
+}
+
+// NotificationData representacion JSON de una notificacion
+type NotificationData struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	Read      bool      `json:"read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toNotificationData(n db.Notification) NotificationData {
+	return NotificationData{
+		ID:        n.ID,
+		Type:      n.Type,
+		Title:     n.Title,
+		Message:   n.Message,
+		Read:      n.Read.Valid && n.Read.Int64 == 1,
+		CreatedAt: n.CreatedAt.Time,
+	}
+}
+
+// List devuelve las notificaciones recientes del usuario y el conteo de no leidas
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	limit := int64(20)
+	if l, err := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	notifications, err := h.notifications.GetUserNotifications(r.Context(), user.ID, limit)
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo notificaciones: %v", err)
+		http.Error(w, "Error obteniendo notificaciones", http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := h.notifications.GetUnreadCount(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] Error contando notificaciones: %v", err)
+	}
+
+	data := make([]NotificationData, 0, len(notifications))
+	for _, n := range notifications {
+		data = append(data, toNotificationData(n))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": data,
+		"unread":        unread,
+	})
+}
+
+// UnreadCount devuelve el numero de notificaciones no leidas
+func (h *NotificationHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	unread, err := h.notifications.GetUnreadCount(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] Error contando notificaciones: %v", err)
+		http.Error(w, "Error obteniendo notificaciones", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"unread": unread})
+}
+
+// MarkRead marca una notificacion del usuario como leida
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.notifications.MarkAsRead(r.Context(), id, user.ID); err != nil {
+		log.Printf("[ERROR] Error marcando notificacion %d como leida: %v", id, err)
+		http.Error(w, "Error actualizando notificacion", http.StatusInternalServerError)
+		return
+	}
+
+	h.UnreadCount(w, r)
+}
+
+// MarkAllRead marca todas las notificaciones del usuario como leidas
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	if err := h.notifications.MarkAllAsRead(r.Context(), user.ID); err != nil {
+		log.Printf("[ERROR] Error marcando notificaciones como leidas: %v", err)
+		http.Error(w, "Error actualizando notificaciones", http.StatusInternalServerError)
+		return
+	}
+
+	h.UnreadCount(w, r)
+}
+
+// Stream envia por SSE las notificaciones nuevas del usuario en cuanto se crean
+func (h *NotificationHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming no soportado", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Nginx
+
+	notifications, unsubscribe := h.notifications.Subscribe(user.ID)
+	defer unsubscribe()
+
+	// Conteo inicial para sincronizar el badge al (re)conectar
+	unread, _ := h.notifications.GetUnreadCount(r.Context(), user.ID)
+	fmt.Fprintf(w, "event: count\ndata: {\"unread\": %d}\n\n", unread)
+	flusher.Flush()
+
+	heartbeatTicker := time.NewTicker(30 * time.Second)
+	defer heartbeatTicker.Stop()
+
+	for {
+		select {
+		case n := <-notifications:
+			jsonData, _ := json.Marshal(toNotificationData(n))
+			fmt.Fprintf(w, "event: notification\ndata: %s\n\n", jsonData)
+			flusher.Flush()
+		case <-heartbeatTicker.C:
+			fmt.Fprintf(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chat-empleados/db"
+	"chat-empleados/internal/middleware"
+	"chat-empleados/internal/services"
+)
+
+// AdminRoom sala con sus miembros para la vista de admin
+type AdminRoom struct {
+	db.GetAllChatRoomsRow
+	Members []db.GetChatRoomMembersRow
+}
+
+// CreateRoom permite a cualquier empleado abrir una sala ad-hoc publica
+func (h *ChatHandler) CreateRoom(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	room, err := h.rooms.CreateRoom(r.Context(), r.FormValue("name"), r.FormValue("description"), services.RoomTypeAdhoc, false, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[INFO] Sala %s creada por %s", room.Slug, user.Nomina)
+
+	w.Header().Set("HX-Redirect", "/chat?room="+room.Slug)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ChatHandler) JoinRoom(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	room, ok := h.roomFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if room.IsPrivate.Valid && room.IsPrivate.Int64 == 1 {
+		http.Error(w, "Sala privada: solo un administrador puede agregarte", http.StatusForbidden)
+		return
+	}
+
+	if err := h.rooms.AddMember(r.Context(), room.ID, user.ID, "member"); err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "Error uniendose a la sala", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/chat?room="+room.Slug)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ChatHandler) LeaveRoom(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	room, ok := h.roomFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if room.RoomType == services.RoomTypeGeneral || room.RoomType == services.RoomTypeDepartment {
+		http.Error(w, "No puedes salir de esta sala", http.StatusForbidden)
+		return
+	}
+
+	if _, err := h.queries.RemoveChatRoomMember(r.Context(), db.RemoveChatRoomMemberParams{
+		RoomID: room.ID,
+		UserID: user.ID,
+	}); err != nil {
+		log.Printf("[ERROR] Error saliendo de sala: %v", err)
+		http.Error(w, "Error saliendo de la sala", http.StatusInternalServerError)
+		return
+	}
+	h.hub.DisconnectUser(room.ID, user.ID)
+
+	w.Header().Set("HX-Redirect", "/chat")
+	w.WriteHeader(http.StatusOK)
+}
+
+// AdminRoomsPage muestra todas las salas con sus miembros
+func (h *ChatHandler) AdminRoomsPage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	rooms, err := h.queries.GetAllChatRooms(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo salas: %v", err)
+	}
+
+	adminRooms := make([]AdminRoom, 0, len(rooms))
+	for _, room := range rooms {
+		members, err := h.queries.GetChatRoomMembers(r.Context(), room.ID)
+		if err != nil {
+			log.Printf("[ERROR] Error obteniendo miembros de sala %d: %v", room.ID, err)
+		}
+		adminRooms = append(adminRooms, AdminRoom{GetAllChatRoomsRow: room, Members: members})
+	}
+
+	data := TemplateData(r, map[string]interface{}{
+		"Title": "Salas de Chat",
+		"User":  user,
+		"Rooms": adminRooms,
+	})
+	h.templates.ExecuteTemplate(w, "admin_rooms", data)
+}
+
+func (h *ChatHandler) AdminCreateRoom(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	room, err := h.rooms.CreateRoom(r.Context(), r.FormValue("name"), r.FormValue("description"),
+		r.FormValue("room_type"), r.FormValue("is_private") == "1", user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[INFO] Sala %s (%s) creada por admin %s", room.Slug, room.RoomType, user.Nomina)
+
+	w.Header().Set("HX-Redirect", "/admin/rooms")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ChatHandler) AdminAddMember(w http.ResponseWriter, r *http.Request) {
+	adminUser := middleware.GetUserFromContext(r.Context())
+
+	room, ok := h.roomFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.queries.GetUserByNomina(r.Context(), strings.TrimSpace(r.FormValue("nomina")))
+	if err != nil {
+		http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		return
+	}
+
+	role := "member"
+	if r.FormValue("role") == "moderator" {
+		role = "moderator"
+	}
+
+	if err := h.rooms.AddMember(r.Context(), room.ID, target.ID, role); err != nil {
+		log.Printf("[ERROR] %v", err)
+		http.Error(w, "Error agregando miembro", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Admin %s agrego a %s a la sala %s", adminUser.Nomina, target.Nomina, room.Slug)
+
+	w.Header().Set("HX-Redirect", "/admin/rooms")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ChatHandler) AdminRemoveMember(w http.ResponseWriter, r *http.Request) {
+	adminUser := middleware.GetUserFromContext(r.Context())
+
+	room, ok := h.roomFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.ParseInt(r.PathValue("userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.queries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		return
+	}
+
+	// La membresia de la sala general y la del propio departamento se reasignan al entrar al chat
+	if room.RoomType == services.RoomTypeGeneral ||
+		(room.RoomType == services.RoomTypeDepartment && target.Departamento.String == room.Departamento.String) {
+		http.Error(w, "La membresia de esta sala es automatica", http.StatusForbidden)
+		return
+	}
+
+	if _, err := h.queries.RemoveChatRoomMember(r.Context(), db.RemoveChatRoomMemberParams{
+		RoomID: room.ID,
+		UserID: userID,
+	}); err != nil {
+		log.Printf("[ERROR] Error quitando miembro: %v", err)
+		http.Error(w, "Error quitando miembro", http.StatusInternalServerError)
+		return
+	}
+	h.hub.DisconnectUser(room.ID, userID)
+
+	log.Printf("[INFO] Admin %s quito a %s de la sala %s", adminUser.Nomina, target.Nomina, room.Slug)
+
+	w.Header().Set("HX-Redirect", "/admin/rooms")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ChatHandler) AdminToggleRoomPrivacy(w http.ResponseWriter, r *http.Request) {
+	room, ok := h.roomFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if room.RoomType == services.RoomTypeGeneral {
+		http.Error(w, "La sala general no puede ser privada", http.StatusForbidden)
+		return
+	}
+
+	newStatus := sql.NullInt64{Int64: 1, Valid: true}
+	if room.IsPrivate.Valid && room.IsPrivate.Int64 == 1 {
+		newStatus = sql.NullInt64{Int64: 0, Valid: true}
+	}
+
+	if _, err := h.queries.UpdateChatRoomPrivacy(r.Context(), db.UpdateChatRoomPrivacyParams{
+		IsPrivate: newStatus,
+		ID:        room.ID,
+	}); err != nil {
+		log.Printf("[ERROR] Error actualizando sala: %v", err)
+		http.Error(w, "Error actualizando sala", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/admin/rooms")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *ChatHandler) AdminDeleteRoom(w http.ResponseWriter, r *http.Request) {
+	adminUser := middleware.GetUserFromContext(r.Context())
+
+	room, ok := h.roomFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.queries.DeleteChatRoom(r.Context(), room.ID)
+	if err != nil {
+		log.Printf("[ERROR] Error eliminando sala: %v", err)
+		http.Error(w, "Error eliminando sala", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "La sala general no puede eliminarse", http.StatusForbidden)
+		return
+	}
+	h.hub.CloseRoom(room.ID)
+
+	log.Printf("[INFO] Admin %s elimino la sala %s", adminUser.Nomina, room.Slug)
+
+	w.Header().Set("HX-Redirect", "/admin/rooms")
+	w.WriteHeader(http.StatusOK)
+}
+
+// roomFromPath obtiene la sala del parametro {id}; escribe el error si no existe
+func (h *ChatHandler) roomFromPath(w http.ResponseWriter, r *http.Request) (db.ChatRoom, bool) {
+	roomID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return db.ChatRoom{}, false
+	}
+
+	room, err := h.queries.GetChatRoomByID(r.Context(), roomID)
+	if err != nil {
+		http.Error(w, "Sala no encontrada", http.StatusNotFound)
+		return db.ChatRoom{}, false
+	}
+	return room, true
+}
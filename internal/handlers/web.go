@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"database/sql"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"chat-empleados/db"
+	"chat-empleados/internal/middleware"
+	"chat-empleados/internal/services"
+)
+
+// WebHandler administra las paginas web extraidas por el scraper, su auditoria
+// y las fuentes web que alimentan la base de conocimiento
+type WebHandler struct {
+	queries   *db.Queries
+	templates *template.Template
+	scraper   *services.Scraper
+	sources   *services.WebSourceService
+}
+
+func NewWebHandler(queries *db.Queries, templates *template.Template, scraper *services.Scraper, sources *services.WebSourceService) *WebHandler {
+	return &WebHandler{
+		queries:   queries,
+		templates: templates,
+		scraper:   scraper,
+		sources:   sources,
+	}
+}
+
+// AdminWebPage muestra las fuentes web, las paginas en cache y las ultimas URLs solicitadas
+func (h *WebHandler) AdminWebPage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	sources, err := h.queries.GetWebSources(r.Context())
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo fuentes web: %v", err)
+	}
+
+	pages, err := h.queries.GetScrapedPages(r.Context(), 200)
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo paginas extraidas: %v", err)
+	}
+
+	fetches, err := h.queries.GetRecentURLFetches(r.Context(), 100)
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo descargas de URLs: %v", err)
+	}
+
+	data := TemplateData(r, map[string]interface{}{
+		"Title":   "Paginas Web",
+		"User":    user,
+		"Sources": sources,
+		"Pages":   pages,
+		"Fetches": fetches,
+	})
+	h.templates.ExecuteTemplate(w, "admin_web", data)
+}
+
+// RefreshPage descarga de nuevo una pagina ignorando el cache
+func (h *WebHandler) RefreshPage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	page, ok := h.pageFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	content, err := h.scraper.Refresh(r.Context(), page.Url)
+	h.scraper.RecordFetch(r.Context(), user.ID, page.Url, content, err)
+	if err != nil {
+		http.Error(w, "Error descargando la pagina: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	log.Printf("[INFO] Admin %s actualizo la pagina %s", user.Nomina, page.Url)
+
+	w.Header().Set("HX-Redirect", "/admin/web")
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeletePage quita una pagina del cache
+func (h *WebHandler) DeletePage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	page, ok := h.pageFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.queries.DeleteScrapedPage(r.Context(), page.ID); err != nil {
+		log.Printf("[ERROR] Error eliminando pagina extraida: %v", err)
+		http.Error(w, "Error eliminando pagina", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Admin %s elimino del cache la pagina %s", user.Nomina, page.Url)
+
+	w.Header().Set("HX-Redirect", "/admin/web")
+	w.WriteHeader(http.StatusOK)
+}
+
+// PurgeCache vacia el cache de paginas (la auditoria se conserva)
+func (h *WebHandler) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	h.scraper.ClearCache()
+	log.Printf("[INFO] Admin %s vacio el cache de paginas web", user.Nomina)
+
+	w.Header().Set("HX-Redirect", "/admin/web")
+	w.WriteHeader(http.StatusOK)
+}
+
+// PromotePage crea un envio de conocimiento pendiente con el contenido de la pagina,
+// para revisarlo y aprobarlo como cualquier otro envio
+func (h *WebHandler) PromotePage(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	page, ok := h.pageFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		title = page.Title.String
+	}
+	if title == "" {
+		title = page.Url
+	}
+
+	category := strings.TrimSpace(r.FormValue("category"))
+	if category == "" {
+		category = "web"
+	}
+
+	submission, err := h.queries.CreateKnowledgeSubmission(r.Context(), db.CreateKnowledgeSubmissionParams{
+		Title:       title,
+		Content:     page.Content + "\n\nFuente: " + page.Url,
+		Category:    sql.NullString{String: category, Valid: true},
+		SubmittedBy: user.ID,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error creando envio desde pagina %d: %v", page.ID, err)
+		http.Error(w, "Error creando envio de conocimiento", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Admin %s envio la pagina %s a conocimiento (envio %d)", user.Nomina, page.Url, submission.ID)
+
+	w.Header().Set("HX-Redirect", "/admin/knowledge")
+	w.WriteHeader(http.StatusOK)
+}
+
+// pageFromPath obtiene la pagina del parametro {id}; escribe el error si no existe
+func (h *WebHandler) pageFromPath(w http.ResponseWriter, r *http.Request) (db.ScrapedPage, bool) {
+	pageID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return db.ScrapedPage{}, false
+	}
+
+	page, err := h.queries.GetScrapedPageByID(r.Context(), pageID)
+	if err != nil {
+		http.Error(w, "Pagina no encontrada", http.StatusNotFound)
+		return db.ScrapedPage{}, false
+	}
+	return page, true
+}
+
+// CreateSource registra una URL como fuente de conocimiento
+func (h *WebHandler) CreateSource(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error procesando formulario", http.StatusBadRequest)
+		return
+	}
+
+	interval, err := strconv.Atoi(r.FormValue("interval_minutes"))
+	if err != nil {
+		http.Error(w, "Intervalo invalido", http.StatusBadRequest)
+		return
+	}
+
+	source, err := h.sources.Create(r.Context(), r.FormValue("url"), r.FormValue("title"),
+		r.FormValue("category"), interval, r.FormValue("auto_update") == "1", user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[INFO] Admin %s registro la fuente web %s", user.Nomina, source.Url)
+
+	w.Header().Set("HX-Redirect", "/admin/web")
+	w.WriteHeader(http.StatusOK)
+}
+
+// CheckSource revisa una fuente en el momento, sin esperar su intervalo ni usar el cache
+func (h *WebHandler) CheckSource(w http.ResponseWriter, r *http.Request) {
+	source, ok := h.sourceFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.sources.Check(r.Context(), source, true); err != nil {
+		http.Error(w, "Error revisando la fuente: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/admin/web")
+	w.WriteHeader(http.StatusOK)
+}
+
+// ToggleSource pausa o reanuda la revision periodica de una fuente
+func (h *WebHandler) ToggleSource(w http.ResponseWriter, r *http.Request) {
+	source, ok := h.sourceFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	newStatus := int64(1)
+	if source.IsActive.Int64 == 1 {
+		newStatus = 0
+	}
+
+	_, err := h.queries.ToggleWebSource(r.Context(), db.ToggleWebSourceParams{
+		IsActive: sql.NullInt64{Int64: newStatus, Valid: true},
+		ID:       source.ID,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error cambiando estado de fuente web: %v", err)
+		http.Error(w, "Error actualizando fuente", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", "/admin/web")
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteSource elimina una fuente; el conocimiento que ya genero se conserva
+func (h *WebHandler) DeleteSource(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUserFromContext(r.Context())
+
+	source, ok := h.sourceFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.queries.DeleteWebSource(r.Context(), source.ID); err != nil {
+		log.Printf("[ERROR] Error eliminando fuente web: %v", err)
+		http.Error(w, "Error eliminando fuente", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Admin %s elimino la fuente web %s", user.Nomina, source.Url)
+
+	w.Header().Set("HX-Redirect", "/admin/web")
+	w.WriteHeader(http.StatusOK)
+}
+
+// sourceFromPath obtiene la fuente del parametro {id}; escribe el error si no existe
+func (h *WebHandler) sourceFromPath(w http.ResponseWriter, r *http.Request) (db.WebSource, bool) {
+	sourceID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "ID invalido", http.StatusBadRequest)
+		return db.WebSource{}, false
+	}
+
+	source, err := h.queries.GetWebSourceByID(r.Context(), sourceID)
+	if err != nil {
+		http.Error(w, "Fuente no encontrada", http.StatusNotFound)
+		return db.WebSource{}, false
+	}
+	return source, true
+}
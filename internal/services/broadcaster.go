@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"chat-empleados/db"
+)
+
+// Tipos de evento del chat que se reparten entre instancias
+const (
+	ChatEventRoom           = "room"            // mensaje para los clientes de una sala
+	ChatEventUsers          = "users"           // mensaje para todas las conexiones de ciertos usuarios (DMs)
+	ChatEventDisconnectUser = "disconnect_user" // cerrar las conexiones de un usuario en una sala
+	ChatEventCloseRoom      = "close_room"      // cerrar todas las conexiones de una sala
+	ChatEventPresence       = "presence"        // conexiones por sala de una instancia
+)
+
+// ChatEvent evento que cada instancia aplica sobre sus propias conexiones
+type ChatEvent struct {
+	Kind    string
+	RoomID  int64
+	UserIDs []int64
+	Data    []byte
+}
+
+// Broadcaster reparte los eventos del chat entre todas las instancias del servidor.
+// Events entrega los eventos de todas las instancias, incluidos los propios, en el mismo orden.
+type Broadcaster interface {
+	Publish(ctx context.Context, event ChatEvent) error
+	Events() <-chan ChatEvent
+}
+
+// NewBroadcaster crea el backend indicado en CHAT_BROADCASTER: "memory" (una sola instancia)
+// o "sqlite" (varias replicas compartiendo la misma base de datos)
+func NewBroadcaster(kind string, queries *db.Queries) (Broadcaster, error) {
+	switch kind {
+	case "", "memory":
+		return NewMemoryBroadcaster(), nil
+	case "sqlite":
+		return NewSQLiteBroadcaster(queries, 250*time.Millisecond)
+	default:
+		return nil, fmt.Errorf("broadcaster de chat desconocido: %s", kind)
+	}
+}
+
+// MemoryBroadcaster entrega los eventos dentro del mismo proceso
+type MemoryBroadcaster struct {
+	events chan ChatEvent
+}
+
+func NewMemoryBroadcaster() *MemoryBroadcaster {
+	return &MemoryBroadcaster{events: make(chan ChatEvent, 256)}
+}
+
+func (b *MemoryBroadcaster) Publish(ctx context.Context, event ChatEvent) error {
+	select {
+	case b.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *MemoryBroadcaster) Events() <-chan ChatEvent {
+	return b.events
+}
+
+// maxEventsPerPoll limita cuantos eventos se leen en cada consulta
+const maxEventsPerPoll = 500
+
+// SQLiteBroadcaster guarda los eventos en la tabla chat_events y cada instancia la consulta
+// periodicamente. El id autoincremental da el mismo orden en todas las instancias.
+type SQLiteBroadcaster struct {
+	queries  *db.Queries
+	interval time.Duration
+	events   chan ChatEvent
+}
+
+// NewSQLiteBroadcaster empieza a leer desde el ultimo evento existente: lo anterior ya
+// esta guardado en los mensajes y se recupera con el historial o el reenvio al reconectar
+func NewSQLiteBroadcaster(queries *db.Queries, interval time.Duration) (*SQLiteBroadcaster, error) {
+	lastID, err := queries.GetLatestChatEventID(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo eventos del chat: %w", err)
+	}
+
+	b := &SQLiteBroadcaster{
+		queries:  queries,
+		interval: interval,
+		events:   make(chan ChatEvent, 256),
+	}
+	go b.poll(lastID)
+	return b, nil
+}
+
+func (b *SQLiteBroadcaster) Publish(ctx context.Context, event ChatEvent) error {
+	var userIDs sql.NullString
+	if len(event.UserIDs) > 0 {
+		encoded, err := json.Marshal(event.UserIDs)
+		if err != nil {
+			return err
+		}
+		userIDs = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	_, err := b.queries.CreateChatEvent(ctx, db.CreateChatEventParams{
+		Kind:    event.Kind,
+		RoomID:  sql.NullInt64{Int64: event.RoomID, Valid: true},
+		UserIds: userIDs,
+		Payload: string(event.Data),
+	})
+	if err != nil {
+		return fmt.Errorf("error guardando evento del chat: %w", err)
+	}
+	return nil
+}
+
+func (b *SQLiteBroadcaster) Events() <-chan ChatEvent {
+	return b.events
+}
+
+// poll lee los eventos nuevos y purga cada minuto los que ya tienen mas de 10 minutos
+func (b *SQLiteBroadcaster) poll(lastID int64) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	lastPurge := time.Now()
+
+	for range ticker.C {
+		ctx := context.Background()
+
+		rows, err := b.queries.GetChatEventsAfter(ctx, db.GetChatEventsAfterParams{
+			ID:    lastID,
+			Limit: maxEventsPerPoll,
+		})
+		if err != nil {
+			log.Printf("[ERROR] Error leyendo eventos del chat: %v", err)
+			continue
+		}
+
+		for _, row := range rows {
+			lastID = row.ID
+			event := ChatEvent{
+				Kind:   row.Kind,
+				RoomID: row.RoomID.Int64,
+				Data:   []byte(row.Payload),
+			}
+			if row.UserIds.String != "" {
+				if err := json.Unmarshal([]byte(row.UserIds.String), &event.UserIDs); err != nil {
+					log.Printf("[WARN] Evento del chat %d con destinatarios invalidos: %v", row.ID, err)
+					continue
+				}
+			}
+			b.events <- event
+		}
+
+		if time.Since(lastPurge) > time.Minute {
+			lastPurge = time.Now()
+			if _, err := b.queries.DeleteOldChatEvents(ctx); err != nil {
+				log.Printf("[WARN] Error purgando eventos del chat: %v", err)
+			}
+		}
+	}
+}
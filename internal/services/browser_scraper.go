@@ -5,7 +5,9 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -15,23 +17,30 @@ import (
 	"github.com/go-rod/rod/lib/proto"
 )
 
-// BrowserScraper scraper basado en browser headless (rod/chromium)
+// BrowserScraper scraper basado en browser headless (rod/chromium). El browser no sale a la
+// red por su cuenta: cada peticion de la pagina (navegacion, redirects, recursos) se
+// intercepta y se descarga con el cliente HTTP del scraper, que aplica la FetchPolicy.
 type BrowserScraper struct {
 	config   *ScraperConfig
+	client   *http.Client
+	policy   *FetchPolicy
 	browser  *rod.Browser
 	launcher *launcher.Launcher
 	mutex    sync.Mutex
 	isReady  bool
 }
 
-// NewBrowserScraper crea un nuevo browser scraper
-func NewBrowserScraper(config *ScraperConfig) (*BrowserScraper, error) {
+// NewBrowserScraper crea un nuevo browser scraper que descarga todo con client, validando
+// cada URL contra policy
+func NewBrowserScraper(config *ScraperConfig, client *http.Client, policy *FetchPolicy) (*BrowserScraper, error) {
 	if config == nil {
 		config = DefaultScraperConfig()
 	}
 
 	bs := &BrowserScraper{
 		config: config,
+		client: client,
+		policy: policy,
 	}
 
 	if err := bs.init(); err != nil {
@@ -62,7 +71,12 @@ func (bs *BrowserScraper) init() error {
 		Set("disable-sync").
 		Set("disable-translate").
 		Set("disable-default-apps").
-		Set("mute-audio")
+		Set("mute-audio").
+		// Lo que no pase por la intercepcion (WebSockets, prefetch de DNS) va a un proxy que
+		// no resuelve, tambien para loopback, en vez de salir directo a la red
+		Set("proxy-server", "http://proxy.invalid:1").
+		Set("proxy-bypass-list", "<-loopback>").
+		Set("host-resolver-rules", "MAP * ~NOTFOUND")
 
 	// Lanzar browser
 	u, err := bs.launcher.Launch()
@@ -114,6 +128,7 @@ func (bs *BrowserScraper) Scrape(ctx context.Context, targetURL string) (*Scrape
 		}, err
 	}
 	defer page.Close()
+	defer bs.guard(ctx, page)()
 
 	// Configurar user agent
 	page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
@@ -194,11 +209,12 @@ func (bs *BrowserScraper) ScrapeWithScreenshot(ctx context.Context, targetURL st
 	}
 
 	// Tomar screenshot
-	page, err := bs.browser.Page(proto.TargetCreateTarget{URL: targetURL})
+	page, err := bs.browser.Page(proto.TargetCreateTarget{URL: "about:blank"})
 	if err != nil {
 		return content, nil, nil // Devolver contenido sin screenshot
 	}
 	defer page.Close()
+	defer bs.guard(ctx, page)()
 
 	page.Navigate(targetURL)
 	page.WaitLoad()
@@ -211,6 +227,50 @@ func (bs *BrowserScraper) ScrapeWithScreenshot(ctx context.Context, targetURL st
 	return content, screenshot, nil
 }
 
+// guard intercepta las peticiones de la pagina y las descarga con el cliente del scraper:
+// la URL se valida contra la politica y las IPs al conectar, tambien en cada redirect.
+// Lo rechazado le llega al browser como peticion bloqueada. Devuelve la funcion que
+// detiene la intercepcion.
+func (bs *BrowserScraper) guard(ctx context.Context, page *rod.Page) func() {
+	router := page.HijackRequests()
+	router.MustAdd("*", func(h *rod.Hijack) {
+		if err := bs.load(ctx, h); err != nil {
+			log.Printf("[SECURITY] Browser: peticion a %s rechazada: %v", h.Request.URL(), err)
+			h.Response.Fail(proto.NetworkErrorReasonBlockedByClient)
+		}
+	})
+	go router.Run()
+	return func() { router.Stop() }
+}
+
+// load descarga una peticion interceptada y la entrega al browser como respuesta
+func (bs *BrowserScraper) load(ctx context.Context, h *rod.Hijack) error {
+	req := h.Request.Req().WithContext(ctx)
+	if err := bs.policy.CheckURL(req.URL); err != nil {
+		return err
+	}
+
+	res, err := bs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, bs.config.MaxContentSize))
+	if err != nil {
+		return err
+	}
+
+	h.Response.Payload().ResponseCode = res.StatusCode
+	for key, values := range res.Header {
+		for _, value := range values {
+			h.Response.SetHeader(key, value)
+		}
+	}
+	h.Response.SetBody(body)
+	return nil
+}
+
 // cleanContent limpia el contenido extraído
 func (bs *BrowserScraper) cleanContent(text string) string {
 	// Remover múltiples espacios en blanco
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"chat-empleados/db"
+)
+
+// Tipos de sala del chat grupal
+const (
+	RoomTypeGeneral    = "general"
+	RoomTypeDepartment = "department"
+	RoomTypeProject    = "project"
+	RoomTypeAdhoc      = "adhoc"
+)
+
+// GeneralRoomSlug identifica la sala a la que pertenecen todos los empleados
+const GeneralRoomSlug = "general"
+
+type ChatRoomService struct {
+	queries *db.Queries
+}
+
+func NewChatRoomService(queries *db.Queries) *ChatRoomService {
+	return &ChatRoomService{queries: queries}
+}
+
+// EnsureDefaultMemberships agrega al usuario a la sala general y a la sala de su departamento,
+// creando esta ultima si aun no existe
+func (s *ChatRoomService) EnsureDefaultMemberships(ctx context.Context, userID int64, departamento string) error {
+	general, err := s.queries.GetChatRoomBySlug(ctx, GeneralRoomSlug)
+	if err != nil {
+		return fmt.Errorf("error obteniendo sala general: %w", err)
+	}
+	if err := s.AddMember(ctx, general.ID, userID, "member"); err != nil {
+		return err
+	}
+
+	departamento = strings.TrimSpace(departamento)
+	if departamento == "" {
+		return nil
+	}
+
+	room, err := s.departmentRoom(ctx, departamento)
+	if err != nil {
+		return err
+	}
+	return s.AddMember(ctx, room.ID, userID, "member")
+}
+
+// departmentRoom devuelve la sala del departamento, creandola (privada) si no existe
+func (s *ChatRoomService) departmentRoom(ctx context.Context, departamento string) (db.ChatRoom, error) {
+	slug := "depto-" + Slugify(departamento)
+	room, err := s.queries.GetChatRoomBySlug(ctx, slug)
+	if err == nil {
+		return room, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return room, fmt.Errorf("error obteniendo sala de departamento: %w", err)
+	}
+
+	room, err = s.queries.CreateChatRoom(ctx, db.CreateChatRoomParams{
+		Slug:         slug,
+		Name:         departamento,
+		Description:  sql.NullString{String: "Departamento de " + departamento, Valid: true},
+		RoomType:     RoomTypeDepartment,
+		Departamento: sql.NullString{String: departamento, Valid: true},
+		IsPrivate:    sql.NullInt64{Int64: 1, Valid: true},
+	})
+	if err != nil {
+		// Otra peticion pudo crearla al mismo tiempo
+		if existing, getErr := s.queries.GetChatRoomBySlug(ctx, slug); getErr == nil {
+			return existing, nil
+		}
+		return room, fmt.Errorf("error creando sala de departamento: %w", err)
+	}
+	return room, nil
+}
+
+// CreateRoom crea una sala de proyecto o ad-hoc; el creador queda como moderador
+func (s *ChatRoomService) CreateRoom(ctx context.Context, name, description, roomType string, private bool, createdBy int64) (db.ChatRoom, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 60 {
+		return db.ChatRoom{}, fmt.Errorf("el nombre debe tener entre 1 y 60 caracteres")
+	}
+	if roomType != RoomTypeProject && roomType != RoomTypeAdhoc {
+		return db.ChatRoom{}, fmt.Errorf("tipo de sala invalido: %s", roomType)
+	}
+
+	slug := Slugify(name)
+	if slug == "" || slug == GeneralRoomSlug || strings.HasPrefix(slug, "depto-") {
+		return db.ChatRoom{}, fmt.Errorf("nombre de sala no permitido")
+	}
+	if _, err := s.queries.GetChatRoomBySlug(ctx, slug); err == nil {
+		return db.ChatRoom{}, fmt.Errorf("ya existe una sala con ese nombre")
+	}
+
+	isPrivate := int64(0)
+	if private {
+		isPrivate = 1
+	}
+
+	room, err := s.queries.CreateChatRoom(ctx, db.CreateChatRoomParams{
+		Slug:        slug,
+		Name:        name,
+		Description: sql.NullString{String: strings.TrimSpace(description), Valid: true},
+		RoomType:    roomType,
+		IsPrivate:   sql.NullInt64{Int64: isPrivate, Valid: true},
+		CreatedBy:   sql.NullInt64{Int64: createdBy, Valid: true},
+	})
+	if err != nil {
+		return room, fmt.Errorf("error creando sala: %w", err)
+	}
+
+	if err := s.AddMember(ctx, room.ID, createdBy, "moderator"); err != nil {
+		return room, err
+	}
+	return room, nil
+}
+
+// AddMember agrega al usuario a la sala; no hace nada si ya es miembro
+func (s *ChatRoomService) AddMember(ctx context.Context, roomID, userID int64, role string) error {
+	_, err := s.queries.AddChatRoomMember(ctx, db.AddChatRoomMemberParams{
+		RoomID: roomID,
+		UserID: userID,
+		Role:   sql.NullString{String: role, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error agregando miembro a sala %d: %w", roomID, err)
+	}
+	return nil
+}
+
+// IsMember indica si el usuario pertenece a la sala
+func (s *ChatRoomService) IsMember(ctx context.Context, roomID, userID int64) bool {
+	_, err := s.queries.GetChatRoomMember(ctx, db.GetChatRoomMemberParams{
+		RoomID: roomID,
+		UserID: userID,
+	})
+	return err == nil
+}
+
+// Slugify convierte un nombre en un identificador para URL (minusculas, sin acentos, con guiones)
+func Slugify(name string) string {
+	normalized := accentReplacer.Replace(strings.ToLower(strings.TrimSpace(name)))
+
+	var b strings.Builder
+	lastDash := true
+	for _, r := range normalized {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+			lastDash = false
+		case !lastDash:
+			b.WriteByte('-')
+			lastDash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// Tokens de formato que agrega el modelo por cada mensaje
+	tokensPerMessage = 4
+	// Reserva minima de tokens para la respuesta del modelo
+	minResponseReserve = 512
+	// Espacio minimo que conserva la pregunta actual aunque no quepa
+	minLastMessageTokens = 256
+)
+
+const truncatedNotice = "\n\n[... contenido truncado para ajustarse al contexto del modelo ...]"
+
+// ContextStats resume como se armo el historial enviado al modelo
+type ContextStats struct {
+	Window          int
+	EstimatedTokens int
+	Messages        int
+	Dropped         int
+	Truncated       bool
+}
+
+// EstimateTokens aproxima los tokens de un texto sin depender del tokenizer del modelo:
+// ~4 caracteres latinos por token, 1 token por caracter CJK.
+func EstimateTokens(text string) int {
+	latin, other := 0, 0
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII:
+			latin++
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			other += 2
+		default:
+			other++
+		}
+	}
+	return (latin+3)/4 + (other+1)/2
+}
+
+func estimateMessageTokens(msg Message) int {
+	return EstimateTokens(msg.Content) + tokensPerMessage
+}
+
+// ContextWindow devuelve la ventana de contexto (num_ctx) configurada para el modelo
+func (s *LLMService) ContextWindow(model string) int {
+	cfg := s.config()
+	if size, ok := cfg.ModelContextSizes[model]; ok {
+		return size
+	}
+	// Coincidencia por familia, ej. "llama3" para "llama3:8b"
+	if family, _, ok := strings.Cut(model, ":"); ok {
+		if size, ok := cfg.ModelContextSizes[family]; ok {
+			return size
+		}
+	}
+	if cfg.OllamaNumCtx > 0 {
+		return cfg.OllamaNumCtx
+	}
+	return 4096
+}
+
+// BuildChatContext arma los mensajes a enviar respetando la ventana de contexto.
+// El prompt del sistema y los mensajes fijos (conocimiento, instrucciones) siempre se
+// conservan; del historial se descartan los turnos mas antiguos y, si aun asi no cabe,
+// se trunca el ultimo mensaje.
+func BuildChatContext(window int, systemPrompt string, pinned, history []Message) ([]Message, ContextStats) {
+	stats := ContextStats{Window: window}
+
+	reserve := window / 4
+	if reserve < minResponseReserve {
+		reserve = minResponseReserve
+	}
+
+	used := EstimateTokens(systemPrompt) + tokensPerMessage
+	for _, msg := range pinned {
+		used += estimateMessageTokens(msg)
+	}
+	budget := window - reserve - used
+
+	// Recorrer del mas reciente al mas antiguo
+	start := len(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		cost := estimateMessageTokens(history[i])
+		if cost > budget {
+			break
+		}
+		budget -= cost
+		used += cost
+		start = i
+	}
+
+	kept := make([]Message, 0, len(history)-start+1)
+	if start == len(history) && len(history) > 0 {
+		// Ni el ultimo mensaje cabe completo: truncarlo al espacio disponible
+		last := history[len(history)-1]
+		last.Content = truncateToTokens(last.Content, max(budget-tokensPerMessage, minLastMessageTokens))
+		used += estimateMessageTokens(last)
+		kept = append(kept, last)
+		start = len(history) - 1
+		stats.Truncated = true
+	} else {
+		kept = append(kept, history[start:]...)
+	}
+
+	// Evitar que el historial empiece con una respuesta huerfana del asistente
+	for len(kept) > 1 && kept[0].Role == "assistant" {
+		used -= estimateMessageTokens(kept[0])
+		kept = kept[1:]
+		start++
+	}
+
+	stats.Dropped = start
+	stats.Messages = len(kept)
+	stats.EstimatedTokens = used
+	if stats.Dropped > 0 {
+		stats.Truncated = true
+	}
+
+	messages := make([]Message, 0, len(pinned)+len(kept))
+	messages = append(messages, pinned...)
+	messages = append(messages, kept...)
+	return messages, stats
+}
+
+// truncateToTokens recorta el texto para que ocupe aproximadamente maxTokens
+func truncateToTokens(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return truncatedNotice
+	}
+	if EstimateTokens(text) <= maxTokens {
+		return text
+	}
+
+	runes := []rune(text)
+	// Busqueda binaria del prefijo mas largo que cabe
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if EstimateTokens(string(runes[:mid]))+EstimateTokens(truncatedNotice) <= maxTokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return string(runes[:lo]) + truncatedNotice
+}
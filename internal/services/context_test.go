@@ -0,0 +1,129 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hola", 1},
+		{"hola mundo", 3},
+		{strings.Repeat("a", 400), 100},
+		{"camión", 3},
+		{"知识库", 3},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, se esperaba %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+// turn mensaje de ~100 tokens (400 caracteres ASCII) marcado con su numero
+func turn(role string, n int) Message {
+	content := strings.Repeat(string(rune('a'+n)), 400)
+	return Message{Role: role, Content: content}
+}
+
+func TestBuildChatContext(t *testing.T) {
+	pinned := []Message{
+		{Role: "system", Content: "Resumen de la conversacion"},
+		{Role: "system", Content: "Conocimiento: politica de vacaciones"},
+	}
+	var history []Message
+	for i := 0; i < 10; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		history = append(history, turn(role, i))
+	}
+
+	t.Run("todo cabe", func(t *testing.T) {
+		messages, stats := BuildChatContext(8192, "prompt", pinned, history)
+		if len(messages) != len(pinned)+len(history) || stats.Dropped != 0 || stats.Truncated {
+			t.Fatalf("mensajes = %d, stats = %+v", len(messages), stats)
+		}
+	})
+
+	t.Run("se descartan los turnos mas antiguos", func(t *testing.T) {
+		// 1200 - 512 de reserva - ~25 del prompt y los fijos: caben 6 mensajes de 104 tokens,
+		// pero el historial no debe empezar con una respuesta del asistente
+		messages, stats := BuildChatContext(1200, "prompt", pinned, history)
+		if messages[0] != pinned[0] || messages[1] != pinned[1] {
+			t.Fatalf("los mensajes fijos deben ir primero: %q", messages[:2])
+		}
+		kept := messages[len(pinned):]
+		if kept[0].Role != "user" {
+			t.Errorf("el historial empieza con %s", kept[0].Role)
+		}
+		if kept[len(kept)-1] != history[len(history)-1] {
+			t.Errorf("falta el ultimo mensaje")
+		}
+		if stats.Dropped != len(history)-len(kept) || !stats.Truncated || stats.Messages != len(kept) {
+			t.Errorf("stats = %+v con %d mensajes conservados", stats, len(kept))
+		}
+		for i, msg := range kept {
+			if msg != history[stats.Dropped+i] {
+				t.Fatalf("mensaje %d fuera de orden", i)
+			}
+		}
+		if stats.EstimatedTokens > 1200-minResponseReserve {
+			t.Errorf("tokens estimados = %d, fuera del presupuesto", stats.EstimatedTokens)
+		}
+	})
+
+	t.Run("el ultimo mensaje se trunca si no cabe", func(t *testing.T) {
+		long := []Message{{Role: "user", Content: strings.Repeat("ñandú ", 2000)}}
+		messages, stats := BuildChatContext(1024, "prompt", pinned, long)
+		last := messages[len(messages)-1]
+		if !stats.Truncated || stats.Dropped != 0 || len(messages) != len(pinned)+1 {
+			t.Fatalf("mensajes = %d, stats = %+v", len(messages), stats)
+		}
+		if !strings.HasSuffix(last.Content, truncatedNotice) || !utf8.ValidString(last.Content) {
+			t.Errorf("mensaje truncado invalido: %q", last.Content[max(0, len(last.Content)-100):])
+		}
+		if EstimateTokens(last.Content) > 1024-minResponseReserve {
+			t.Errorf("el mensaje truncado ocupa %d tokens", EstimateTokens(last.Content))
+		}
+	})
+}
+
+func TestTruncateToTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxTokens int
+	}{
+		{"acentos", strings.Repeat("camión rápido ", 300), 100},
+		{"cjk", strings.Repeat("知识库", 300), 50},
+		{"emoji", strings.Repeat("😀", 300), 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateToTokens(tt.text, tt.maxTokens)
+			if !utf8.ValidString(got) {
+				t.Fatalf("texto cortado a mitad de un caracter: %q", got)
+			}
+			if !strings.HasSuffix(got, truncatedNotice) || !strings.HasPrefix(tt.text, strings.TrimSuffix(got, truncatedNotice)) {
+				t.Errorf("se esperaba un prefijo del texto con el aviso de truncado")
+			}
+			if EstimateTokens(got) > tt.maxTokens {
+				t.Errorf("ocupa %d tokens, maximo %d", EstimateTokens(got), tt.maxTokens)
+			}
+		})
+	}
+
+	if got := truncateToTokens("corto", 100); got != "corto" {
+		t.Errorf("un texto que cabe no se recorta: %q", got)
+	}
+	if got := truncateToTokens("texto", 0); got != truncatedNotice {
+		t.Errorf("sin espacio queda solo el aviso: %q", got)
+	}
+}
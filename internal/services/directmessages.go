@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"chat-empleados/db"
+)
+
+// MaxDMParticipants limita el tamano de los grupos privados (incluye al creador)
+const MaxDMParticipants = 8
+
+type DirectMessageService struct {
+	queries *db.Queries
+}
+
+func NewDirectMessageService(queries *db.Queries) *DirectMessageService {
+	return &DirectMessageService{queries: queries}
+}
+
+// OpenThread devuelve el hilo entre el creador y los participantes indicados.
+// Con un solo destinatario reutiliza el hilo 1:1 existente; con varios crea un grupo nuevo.
+func (s *DirectMessageService) OpenThread(ctx context.Context, creatorID int64, participantIDs []int64, title string) (int64, error) {
+	seen := map[int64]bool{creatorID: true}
+	others := make([]int64, 0, len(participantIDs))
+	for _, id := range participantIDs {
+		if !seen[id] {
+			seen[id] = true
+			others = append(others, id)
+		}
+	}
+
+	if len(others) == 0 {
+		return 0, fmt.Errorf("indica al menos un destinatario distinto de ti")
+	}
+	if len(others)+1 > MaxDMParticipants {
+		return 0, fmt.Errorf("un grupo privado admite como maximo %d participantes", MaxDMParticipants)
+	}
+
+	isGroup := len(others) > 1
+	if !isGroup {
+		threadID, err := s.queries.GetDirectThreadBetween(ctx, db.GetDirectThreadBetweenParams{
+			UserID:   creatorID,
+			UserID_2: others[0],
+		})
+		if err == nil {
+			return threadID, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("error buscando hilo directo: %w", err)
+		}
+		title = ""
+	}
+
+	groupFlag := int64(0)
+	if isGroup {
+		groupFlag = 1
+	}
+
+	thread, err := s.queries.CreateDMThread(ctx, db.CreateDMThreadParams{
+		Title:     sql.NullString{String: strings.TrimSpace(title), Valid: true},
+		IsGroup:   sql.NullInt64{Int64: groupFlag, Valid: true},
+		CreatedBy: sql.NullInt64{Int64: creatorID, Valid: true},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error creando hilo: %w", err)
+	}
+
+	for _, id := range append([]int64{creatorID}, others...) {
+		if _, err := s.queries.AddDMParticipant(ctx, db.AddDMParticipantParams{
+			ThreadID: thread.ID,
+			UserID:   id,
+		}); err != nil {
+			return 0, fmt.Errorf("error agregando participante %d: %w", id, err)
+		}
+	}
+
+	return thread.ID, nil
+}
+
+// Send guarda el mensaje y devuelve los participantes del hilo a los que hay que entregarlo.
+// Los participantes desconectados lo veran como no leido al volver.
+func (s *DirectMessageService) Send(ctx context.Context, threadID, userID int64, content string) (db.DirectMessage, []int64, error) {
+	msg, err := s.queries.CreateDirectMessage(ctx, db.CreateDirectMessageParams{
+		ThreadID: threadID,
+		UserID:   userID,
+		Content:  content,
+	})
+	if err != nil {
+		return msg, nil, fmt.Errorf("error guardando mensaje directo: %w", err)
+	}
+
+	s.queries.TouchDMThread(ctx, threadID)
+
+	// El remitente ya leyo su propio mensaje
+	s.MarkRead(ctx, threadID, userID)
+
+	participants, err := s.queries.GetDMParticipantIDs(ctx, threadID)
+	if err != nil {
+		return msg, nil, fmt.Errorf("error obteniendo participantes: %w", err)
+	}
+	return msg, participants, nil
+}
+
+// MarkRead marca como leidos todos los mensajes del hilo para el usuario
+func (s *DirectMessageService) MarkRead(ctx context.Context, threadID, userID int64) error {
+	_, err := s.queries.MarkDMThreadRead(ctx, db.MarkDMThreadReadParams{
+		ThreadID: threadID,
+		UserID:   userID,
+	})
+	return err
+}
+
+// UnreadCount devuelve el total de mensajes directos sin leer del usuario
+func (s *DirectMessageService) UnreadCount(ctx context.Context, userID int64) (int64, error) {
+	return s.queries.CountUnreadDirectMessages(ctx, userID)
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFetchBlocked indica que la politica de extraccion de URLs rechazo la peticion
+// (esquema, dominio o direccion IP no permitidos). No se reintenta.
+var ErrFetchBlocked = errors.New("URL bloqueada por la politica de extraccion")
+
+// FetchPolicy decide que URLs puede descargar el servidor a peticion de un usuario.
+// Los dominios se comparan exactos o como sufijo ("impro.com" cubre "wiki.impro.com").
+type FetchPolicy struct {
+	mutex          sync.RWMutex
+	allowedDomains []string // vacio = cualquier dominio publico
+	blockedDomains []string
+	internalHosts  []string // pueden resolver a direcciones privadas de la intranet
+}
+
+// NewFetchPolicy crea la politica con las listas iniciales
+func NewFetchPolicy(allowed, blocked, internal []string) *FetchPolicy {
+	p := &FetchPolicy{}
+	p.Set(allowed, blocked, internal)
+	return p
+}
+
+// Set reemplaza las listas de la politica (se llama al cambiar la configuracion)
+func (p *FetchPolicy) Set(allowed, blocked, internal []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.allowedDomains = normalizeDomains(allowed)
+	p.blockedDomains = normalizeDomains(blocked)
+	p.internalHosts = normalizeDomains(internal)
+}
+
+// CheckURL valida el esquema y el dominio de una URL antes de descargarla o seguir un redirect
+func (p *FetchPolicy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: esquema no permitido: %s", ErrFetchBlocked, u.Scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: la URL no puede incluir credenciales", ErrFetchBlocked)
+	}
+	return p.CheckHost(u.Hostname())
+}
+
+// CheckHost valida un nombre de host contra las listas de dominios
+func (p *FetchPolicy) CheckHost(host string) error {
+	host = normalizeHost(host)
+	if host == "" {
+		return fmt.Errorf("%w: host vacio", ErrFetchBlocked)
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if matchesDomain(host, p.blockedDomains) {
+		return fmt.Errorf("%w: dominio bloqueado: %s", ErrFetchBlocked, host)
+	}
+	if len(p.allowedDomains) > 0 && !matchesDomain(host, p.allowedDomains) && !matchesDomain(host, p.internalHosts) {
+		return fmt.Errorf("%w: dominio no permitido: %s", ErrFetchBlocked, host)
+	}
+	return nil
+}
+
+// CheckIP valida la direccion a la que resolvio un host. Loopback, link-local (incluye
+// 169.254.169.254 de metadatos cloud), multicast, no especificadas y los rangos de
+// reservedPrefixes se rechazan siempre; las privadas solo para los hosts de intranet
+// configurados.
+func (p *FetchPolicy) CheckIP(host string, ip netip.Addr) error {
+	ip = ip.Unmap()
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || isReservedAddress(ip) {
+		return fmt.Errorf("%w: %s resuelve a una direccion reservada (%s)", ErrFetchBlocked, host, ip)
+	}
+
+	if ip.IsPrivate() || isSharedAddress(ip) {
+		p.mutex.RLock()
+		internal := matchesDomain(normalizeHost(host), p.internalHosts)
+		p.mutex.RUnlock()
+		if !internal {
+			return fmt.Errorf("%w: %s resuelve a una direccion privada (%s)", ErrFetchBlocked, host, ip)
+		}
+	}
+	return nil
+}
+
+// DialContext resuelve el host, valida todas sus direcciones y se conecta a una de ellas
+// directamente, de modo que el DNS no puede cambiar entre la validacion y la conexion.
+// Se usa en el transporte HTTP, asi que tambien aplica a cada redirect.
+func (p *FetchPolicy) DialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("%s no tiene direcciones", host)
+		}
+
+		for _, ip := range addrs {
+			if err := p.CheckIP(host, ip); err != nil {
+				return nil, err
+			}
+		}
+
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// Resolve valida las direcciones de un host sin conectarse (antes de lanzar el navegador
+// headless)
+func (p *FetchPolicy) Resolve(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range addrs {
+		if err := p.CheckIP(host, ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sharedAddressSpace 100.64.0.0/10 (CGNAT), que netip no considera privada
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func isSharedAddress(ip netip.Addr) bool {
+	return sharedAddressSpace.Contains(ip)
+}
+
+// reservedPrefixes rangos que no son publicos aunque netip no los marque: "esta red",
+// benchmarking, reservados para uso futuro y NAT64, que traduce a una IPv4 cualquiera
+// (incluso privada o de metadatos)
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+}
+
+func isReservedAddress(ip netip.Addr) bool {
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesDomain compara el host con la lista: igual al dominio o subdominio de el
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDomains(domains []string) []string {
+	result := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if domain = normalizeHost(domain); domain != "" {
+			result = append(result, domain)
+		}
+	}
+	return result
+}
+
+// normalizeHost pasa a minusculas y quita el punto final y los puntos iniciales ("*.impro.com")
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(host, "*")
+	host = strings.Trim(host, ".")
+	return host
+}
@@ -3,21 +3,27 @@ package services
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"path/filepath"
+	"sort"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 var (
 	ErrUnsupportedFileType = errors.New("tipo de archivo no soportado")
 	ErrFileTooLarge        = errors.New("archivo demasiado grande (max 10MB)")
 	ErrEmptyFile           = errors.New("archivo vacio")
+	ErrTooManyFiles        = fmt.Errorf("demasiados archivos en un mensaje (max %d)", MaxFilesPerMessage)
 )
 
 // Supported file extensions
@@ -45,13 +51,48 @@ var supportedExtensions = map[string]bool{
 	".log":  true,
 	".docx": true,
 	".xlsx": true,
+	".pdf":  true,
+	".pptx": true,
+	".odt":  true,
+	".ods":  true,
+	".doc":  true,
+	".xls":  true,
+}
+
+// Name of the sections marked in the extracted text ([Pagina N], [Diapositiva N], [Hoja nombre])
+var pageLabels = map[string]string{
+	".pdf":  "Paginas",
+	".odt":  "Paginas",
+	".pptx": "Diapositivas",
+	".ods":  "Hojas",
+	".xls":  "Hojas",
+	".xlsx": "Hojas",
 }
 
 const (
-	MaxFileSize   = 10 * 1024 * 1024 // 10MB
-	MaxTextLength = 50000            // Max characters to send to AI
+	MaxFileSize        = 10 * 1024 * 1024 // 10MB
+	MaxTextLength      = 50000            // Max characters sent to AI per message, shared by all its files
+	MaxFilesPerMessage = 5
 )
 
+// File statuses reported to the UI after an upload
+const (
+	FileStatusProcessed = "processed"
+	FileStatusTruncated = "truncated"
+	FileStatusRejected  = "rejected"
+)
+
+// FileStatus tells the user what happened to each file attached to a message
+type FileStatus struct {
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	Chars         int    `json:"chars,omitempty"`          // characters sent to the AI
+	OriginalChars int    `json:"original_chars,omitempty"` // characters extracted from the file
+	Redacted      int    `json:"redacted,omitempty"`       // sensitive values replaced by the security filters
+	Warning       string `json:"warning,omitempty"`        // security filters that matched a file accepted as is
+}
+
 type FileProcessor struct{}
 
 type ProcessedFile struct {
@@ -60,6 +101,47 @@ type ProcessedFile struct {
 	Content     string
 	Truncated   bool
 	OriginalLen int
+	Pages       int // pages, slides or sheets (0 if the format has none)
+	Data        []byte
+	ContentHash string   // sha256 of the original file
+	Redacted    int      // sensitive values replaced by the security filters
+	Warning     string   // security warning shown to the user when the file is accepted as is
+	Tables      []*Table // sheets of CSV/XLSX files, loaded to compute exact aggregates
+}
+
+// Status summarizes the file for the UI
+func (f *ProcessedFile) Status() FileStatus {
+	status := FileStatus{
+		Name:          f.FileName,
+		Status:        FileStatusProcessed,
+		Chars:         len(f.Content),
+		OriginalChars: f.OriginalLen,
+		Redacted:      f.Redacted,
+		Warning:       f.Warning,
+	}
+	if f.Truncated {
+		status.Status = FileStatusTruncated
+	}
+	return status
+}
+
+// RejectedFile builds the status of a file that could not be used
+func RejectedFile(name string, err error) FileStatus {
+	return FileStatus{Name: name, Status: FileStatusRejected, Error: rejectionReason(err)}
+}
+
+// rejectionReason turns a processing error into a message for the user. Parser errors
+// are not shown as is: they describe the file internals, not what the user can do.
+func rejectionReason(err error) string {
+	if errors.Is(err, ErrUnsupportedFileType) {
+		return err.Error()
+	}
+	for _, known := range []error{ErrFileTooLarge, ErrEmptyFile, ErrTooManyFiles, ErrPDFEncrypted, ErrPDFNoText, ErrOfficeEncrypted} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	return "no se pudo leer el contenido del archivo"
 }
 
 func NewFileProcessor() *FileProcessor {
@@ -89,22 +171,7 @@ func (fp *FileProcessor) ProcessFile(file multipart.File, header *multipart.File
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
 
-	var textContent string
-
-	switch ext {
-	case ".docx":
-		textContent, err = fp.extractDOCX(content)
-	case ".xlsx":
-		textContent, err = fp.extractXLSX(content)
-	case ".csv":
-		textContent, err = fp.extractCSV(content)
-	case ".json":
-		textContent, err = fp.extractJSON(content)
-	default:
-		// Plain text files
-		textContent = string(content)
-	}
-
+	textContent, pages, err := fp.extractText(ext, content)
 	if err != nil {
 		return nil, fmt.Errorf("error processing %s: %w", ext, err)
 	}
@@ -115,21 +182,124 @@ func (fp *FileProcessor) ProcessFile(file multipart.File, header *multipart.File
 		return nil, ErrEmptyFile
 	}
 
-	result := &ProcessedFile{
+	// A spreadsheet that cannot be loaded as tables is still usable as text
+	tables, err := fp.extractTables(header.Filename, ext, content)
+	if err != nil {
+		log.Printf("[WARN] No se pudieron cargar las tablas de %s: %v", header.Filename, err)
+	}
+
+	// The text is cut later by ApplyTextBudget, together with the other files of the message
+	hash := sha256.Sum256(content)
+	return &ProcessedFile{
+		Tables:      tables,
 		FileName:    header.Filename,
 		FileType:    ext,
+		Content:     textContent,
 		OriginalLen: len(textContent),
 		Truncated:   false,
+		Pages:       pages,
+		Data:        content,
+		ContentHash: hex.EncodeToString(hash[:]),
+	}, nil
+}
+
+// ProcessFiles extracts the text of every file attached to a message. Files that cannot be
+// used are returned as rejected statuses instead of being skipped silently.
+func (fp *FileProcessor) ProcessFiles(headers []*multipart.FileHeader) ([]*ProcessedFile, []FileStatus) {
+	var files []*ProcessedFile
+	var rejected []FileStatus
+
+	for i, header := range headers {
+		if i >= MaxFilesPerMessage {
+			rejected = append(rejected, RejectedFile(header.Filename, ErrTooManyFiles))
+			continue
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			rejected = append(rejected, RejectedFile(header.Filename, err))
+			continue
+		}
+		processed, err := fp.ProcessFile(file, header)
+		file.Close()
+		if err != nil {
+			rejected = append(rejected, RejectedFile(header.Filename, err))
+			continue
+		}
+		files = append(files, processed)
 	}
 
-	// Truncate if too long
-	if len(textContent) > MaxTextLength {
-		textContent = textContent[:MaxTextLength] + "\n\n[... contenido truncado ...]"
-		result.Truncated = true
+	return files, rejected
+}
+
+// ApplyTextBudget splits maxChars of extracted text across the files of a message. The
+// smaller files are served first: a file that fits its even share keeps all its text and
+// what it leaves goes to the larger ones, so one big spreadsheet does not push out a
+// short document attached with it.
+func (fp *FileProcessor) ApplyTextBudget(files []*ProcessedFile, maxChars int) {
+	bySize := make([]*ProcessedFile, len(files))
+	copy(bySize, files)
+	sort.SliceStable(bySize, func(i, j int) bool { return len(bySize[i].Content) < len(bySize[j].Content) })
+
+	remaining := maxChars
+	for i, file := range bySize {
+		share := remaining / (len(bySize) - i)
+		if len(file.Content) > share {
+			file.Content = truncateText(file.Content, share)
+			file.Truncated = true
+		}
+		remaining = max(0, remaining-len(file.Content))
 	}
+}
+
+const fileTruncatedNotice = "\n\n[... contenido truncado ...]"
 
-	result.Content = textContent
-	return result, nil
+// truncateText cuts text to about maxChars, at a line break when there is one near the end
+func truncateText(text string, maxChars int) string {
+	if len(text) <= maxChars {
+		return text
+	}
+
+	cut := max(0, maxChars-len(fileTruncatedNotice))
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if nl := strings.LastIndexByte(text[:cut], '\n'); nl > cut*3/4 {
+		cut = nl
+	}
+	return text[:cut] + fileTruncatedNotice
+}
+
+// extractText dispatches to the extractor for the file type. The binary formats are parsed
+// by hand; their parsers bound every offset, length and nesting level read from the file,
+// so a malformed file yields an error or partial text.
+func (fp *FileProcessor) extractText(ext string, content []byte) (text string, pages int, err error) {
+	switch ext {
+	case ".docx":
+		text, err = fp.extractDOCX(content)
+	case ".xlsx":
+		text, pages, err = fp.extractXLSX(content)
+	case ".csv":
+		text, err = fp.extractCSV(content)
+	case ".json":
+		text, err = fp.extractJSON(content)
+	case ".pdf":
+		text, pages, err = fp.extractPDF(content)
+	case ".pptx":
+		text, pages, err = fp.extractPPTX(content)
+	case ".odt":
+		text, pages, err = fp.extractODT(content)
+	case ".ods":
+		text, pages, err = fp.extractODS(content)
+	case ".doc":
+		text, err = fp.extractDOC(content)
+	case ".xls":
+		text, pages, err = fp.extractXLS(content)
+	default:
+		// Plain text files
+		text = string(content)
+	}
+	return text, pages, err
 }
 
 // extractDOCX extracts text from Word documents
@@ -165,69 +335,13 @@ func (fp *FileProcessor) extractDOCX(content []byte) (string, error) {
 	return textBuilder.String(), nil
 }
 
-// extractXLSX extracts text from Excel files
-func (fp *FileProcessor) extractXLSX(content []byte) (string, error) {
-	reader := bytes.NewReader(content)
-	zipReader, err := zip.NewReader(reader, int64(len(content)))
+// extractXLSX extracts the sheets of Excel files, each one preceded by [Hoja nombre]
+func (fp *FileProcessor) extractXLSX(content []byte) (string, int, error) {
+	tables, err := parseXLSXTables(content)
 	if err != nil {
-		return "", fmt.Errorf("invalid XLSX file: %w", err)
+		return "", 0, err
 	}
-
-	// Extract shared strings
-	sharedStrings := make([]string, 0)
-	for _, file := range zipReader.File {
-		if file.Name == "xl/sharedStrings.xml" {
-			rc, err := file.Open()
-			if err != nil {
-				continue
-			}
-			xmlContent, _ := io.ReadAll(rc)
-			rc.Close()
-
-			// Simple extraction of <t> tags content
-			parts := strings.Split(string(xmlContent), "<t")
-			for _, part := range parts[1:] {
-				if idx := strings.Index(part, ">"); idx != -1 {
-					rest := part[idx+1:]
-					if endIdx := strings.Index(rest, "</t>"); endIdx != -1 {
-						sharedStrings = append(sharedStrings, rest[:endIdx])
-					}
-				}
-			}
-			break
-		}
-	}
-
-	// Extract sheet data
-	var textBuilder strings.Builder
-	for _, file := range zipReader.File {
-		if strings.HasPrefix(file.Name, "xl/worksheets/sheet") {
-			rc, err := file.Open()
-			if err != nil {
-				continue
-			}
-			xmlContent, _ := io.ReadAll(rc)
-			rc.Close()
-
-			// Extract cell values
-			text := fp.stripXMLTags(string(xmlContent))
-			textBuilder.WriteString(text)
-			textBuilder.WriteString("\n")
-		}
-	}
-
-	// Combine shared strings and sheet data
-	if len(sharedStrings) > 0 {
-		textBuilder.WriteString("\nDatos encontrados:\n")
-		for _, s := range sharedStrings {
-			if strings.TrimSpace(s) != "" {
-				textBuilder.WriteString(s)
-				textBuilder.WriteString(" | ")
-			}
-		}
-	}
-
-	return textBuilder.String(), nil
+	return formatTablesText(tables), len(tables), nil
 }
 
 // extractCSV formats CSV content for better readability
@@ -362,6 +476,9 @@ func (fp *FileProcessor) FormatFileContext(processed *ProcessedFile) string {
 
 	builder.WriteString(fmt.Sprintf("\n\n--- ARCHIVO ADJUNTO: %s ---\n", processed.FileName))
 	builder.WriteString(fmt.Sprintf("Tipo: %s\n", processed.FileType))
+	if processed.Pages > 0 {
+		builder.WriteString(fmt.Sprintf("%s: %d (cada una inicia con su marca entre corchetes)\n", pageLabels[processed.FileType], processed.Pages))
+	}
 	if processed.Truncated {
 		builder.WriteString(fmt.Sprintf("Nota: Contenido truncado (original: %d caracteres)\n", processed.OriginalLen))
 	}
@@ -371,3 +488,46 @@ func (fp *FileProcessor) FormatFileContext(processed *ProcessedFile) string {
 
 	return builder.String()
 }
+
+// MessageFilesContextPrefix introduces the files attached to the message being answered
+const MessageFilesContextPrefix = "Archivos adjuntos al ultimo mensaje del usuario:\n"
+
+// FormatMessageFilesContext builds the system message with the files of the current turn.
+// They go apart from the user's text so that each one passes through its own security review.
+func (fp *FileProcessor) FormatMessageFilesContext(files []*ProcessedFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	builder.WriteString(MessageFilesContextPrefix)
+	for _, file := range files {
+		builder.WriteString(fp.FormatFileContext(file))
+	}
+	return builder.String()
+}
+
+// AttachmentsContextPrefix introduces the files attached in earlier turns of a conversation
+const AttachmentsContextPrefix = "Archivos que el usuario adjunto antes en esta conversacion (puede seguir preguntando sobre ellos):\n"
+
+// FormatAttachmentsContext builds the system message with the files of earlier turns. The
+// token budget is split evenly; a file that does not fit its share is cut and marked.
+func (fp *FileProcessor) FormatAttachmentsContext(files []*ProcessedFile, maxTokens int) string {
+	if len(files) == 0 || maxTokens <= 0 {
+		return ""
+	}
+
+	share := maxTokens / len(files)
+	var builder strings.Builder
+	builder.WriteString(AttachmentsContextPrefix)
+	for _, file := range files {
+		if EstimateTokens(file.Content) > share {
+			cut := *file
+			cut.Content = truncateToTokens(file.Content, share)
+			cut.Truncated = true
+			file = &cut
+		}
+		builder.WriteString(fp.FormatFileContext(file))
+	}
+	return builder.String()
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestApplyTextBudget(t *testing.T) {
+	fp := NewFileProcessor()
+	small := &ProcessedFile{FileName: "nota.txt", Content: strings.Repeat("a", 100)}
+	medium := &ProcessedFile{FileName: "manual.txt", Content: strings.Repeat("b", 400)}
+	large := &ProcessedFile{FileName: "datos.csv", Content: strings.Repeat("c", 5000)}
+
+	// 1200 / 3 = 400: el chico y el mediano caben completos y el grande toma lo que dejan
+	fp.ApplyTextBudget([]*ProcessedFile{large, small, medium}, 1200)
+
+	if small.Truncated || len(small.Content) != 100 {
+		t.Errorf("archivo chico: truncado = %v, %d bytes", small.Truncated, len(small.Content))
+	}
+	if medium.Truncated || len(medium.Content) != 400 {
+		t.Errorf("archivo mediano: truncado = %v, %d bytes", medium.Truncated, len(medium.Content))
+	}
+	if !large.Truncated || len(large.Content) > 700 || !strings.HasSuffix(large.Content, fileTruncatedNotice) {
+		t.Errorf("archivo grande: truncado = %v, %d bytes", large.Truncated, len(large.Content))
+	}
+	if total := len(small.Content) + len(medium.Content) + len(large.Content); total > 1200 {
+		t.Errorf("total = %d bytes, el presupuesto es 1200", total)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("corto", 100); got != "corto" {
+		t.Errorf("un texto que cabe no se modifica: %q", got)
+	}
+
+	// El corte cae a mitad de una "ñ" (2 bytes): debe retroceder al inicio del caracter
+	text := strings.Repeat("ñ", 200)
+	got := truncateText(text, 101+len(fileTruncatedNotice))
+	body := strings.TrimSuffix(got, fileTruncatedNotice)
+	if !utf8.ValidString(got) || body != strings.Repeat("ñ", 50) {
+		t.Errorf("corte = %q, se esperaban 50 \"ñ\" completas", body)
+	}
+
+	// Con un salto de linea cerca del final se corta ahi
+	text = strings.Repeat("x", 90) + "\n" + strings.Repeat("y", 100)
+	got = truncateText(text, 100+len(fileTruncatedNotice))
+	if got != strings.Repeat("x", 90)+fileTruncatedNotice {
+		t.Errorf("corte = %q, se esperaba en el salto de linea", got)
+	}
+
+	if got := truncateText(text, 5); got != fileTruncatedNotice {
+		t.Errorf("sin espacio para texto = %q", got)
+	}
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrGenerationRunning la conversacion ya tiene una respuesta generandose
+var ErrGenerationRunning = errors.New("ya se esta generando una respuesta en esta conversacion")
+
+const (
+	// generationTimeout tiempo maximo de una respuesta, contando la espera en la cola;
+	// largo para modelos lentos como DeepSeek R1
+	generationTimeout = 10 * time.Minute
+	// generationRetention tiempo que se conservan los eventos de una respuesta terminada,
+	// para el cliente que se reconecta justo despues
+	generationRetention = 2 * time.Minute
+)
+
+// GenerationEvent evento SSE de una respuesta; Seq permite retomar desde el ultimo recibido
+type GenerationEvent struct {
+	Seq  int
+	Name string // vacio para los eventos sin nombre (inicio, fragmentos, errores)
+	Data []byte
+}
+
+// GenerationJob respuesta de IA que se genera en el servidor, sin depender de la conexion
+// del navegador. Guarda sus eventos para que quien se reconecte los reciba desde el
+// ultimo que vio.
+type GenerationJob struct {
+	MessageID      int64
+	ConversationID int64
+	UserID         int64
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	manager  *GenerationManager
+	events   []GenerationEvent
+	changed  chan struct{} // se cierra y reemplaza con cada evento nuevo
+	position int           // lugar en la cola de generacion, 0 si ya no espera
+	stopped  bool
+	done     bool
+	mutex    sync.Mutex
+}
+
+// Context se cancela al detener la respuesta o al vencer generationTimeout
+func (j *GenerationJob) Context() context.Context {
+	return j.ctx
+}
+
+// Emit agrega un evento y avisa a los clientes conectados
+func (j *GenerationJob) Emit(name string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.done {
+		return
+	}
+	j.events = append(j.events, GenerationEvent{Seq: len(j.events) + 1, Name: name, Data: payload})
+	j.notify()
+}
+
+// SetQueuePosition registra el lugar en la cola y lo envia como evento "queue"
+func (j *GenerationJob) SetQueuePosition(position int) {
+	j.mutex.Lock()
+	j.position = position
+	j.mutex.Unlock()
+	j.Emit("queue", map[string]int{"queue_position": position})
+}
+
+// QueuePosition lugar en la cola de generacion, 0 si ya no espera
+func (j *GenerationJob) QueuePosition() int {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.position
+}
+
+// Events devuelve los eventos posteriores a after, un canal que se cierra cuando llega
+// otro y si la respuesta ya termino
+func (j *GenerationJob) Events(after int) ([]GenerationEvent, <-chan struct{}, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	var events []GenerationEvent
+	if after >= 0 && after < len(j.events) {
+		events = append(events, j.events[after:]...)
+	}
+	return events, j.changed, j.done
+}
+
+// Stop detiene la respuesta; lo generado hasta ahora se conserva. Devuelve false si ya
+// habia terminado.
+func (j *GenerationJob) Stop() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.done {
+		return false
+	}
+	j.stopped = true
+	j.cancel()
+	return true
+}
+
+// Stopped indica si la respuesta se detuvo a pedido del usuario
+func (j *GenerationJob) Stopped() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.stopped
+}
+
+// Done indica si la respuesta ya termino
+func (j *GenerationJob) Done() bool {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.done
+}
+
+// Finish marca la respuesta como terminada; sus eventos se conservan generationRetention
+func (j *GenerationJob) Finish() {
+	j.mutex.Lock()
+	if j.done {
+		j.mutex.Unlock()
+		return
+	}
+	j.done = true
+	j.position = 0
+	j.notify()
+	j.mutex.Unlock()
+
+	j.cancel()
+	time.AfterFunc(generationRetention, func() {
+		j.manager.remove(j)
+	})
+}
+
+// notify despierta a los clientes que esperan eventos; requiere el mutex tomado
+func (j *GenerationJob) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// GenerationManager respuestas de IA en curso, por ID del mensaje del asistente. Cada
+// conversacion tiene a lo sumo una respuesta generandose a la vez, sea un job o una
+// reserva de Claim.
+type GenerationManager struct {
+	jobs    map[int64]*GenerationJob
+	claimed map[int64]bool // conversaciones reservadas con Claim
+	mutex   sync.Mutex
+}
+
+func NewGenerationManager() *GenerationManager {
+	return &GenerationManager{
+		jobs:    make(map[int64]*GenerationJob),
+		claimed: make(map[int64]bool),
+	}
+}
+
+// Claim reserva la conversacion para una respuesta que se genera dentro de la peticion
+// (sin job). Devuelve la funcion que la libera, o ErrGenerationRunning si la conversacion
+// ya tiene otra respuesta en curso.
+func (m *GenerationManager) Claim(convID int64) (func(), error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.busy(convID) {
+		return nil, ErrGenerationRunning
+	}
+	m.claimed[convID] = true
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mutex.Lock()
+			delete(m.claimed, convID)
+			m.mutex.Unlock()
+		})
+	}, nil
+}
+
+// Start registra la respuesta del mensaje messageID. Devuelve ErrGenerationRunning si la
+// conversacion ya tiene otra en curso.
+func (m *GenerationManager) Start(messageID, convID, userID int64) (*GenerationJob, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.busy(convID) {
+		return nil, ErrGenerationRunning
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), generationTimeout)
+	job := &GenerationJob{
+		MessageID:      messageID,
+		ConversationID: convID,
+		UserID:         userID,
+		ctx:            ctx,
+		cancel:         cancel,
+		manager:        m,
+		changed:        make(chan struct{}),
+	}
+	m.jobs[messageID] = job
+	return job, nil
+}
+
+// ForConversation devuelve la ultima respuesta de la conversacion que sigue en memoria,
+// en curso o recien terminada
+func (m *GenerationManager) ForConversation(convID int64) *GenerationJob {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var latest *GenerationJob
+	for _, job := range m.jobs {
+		if job.ConversationID == convID && (latest == nil || job.MessageID > latest.MessageID) {
+			latest = job
+		}
+	}
+	return latest
+}
+
+// Running indica si la conversacion tiene una respuesta en curso
+func (m *GenerationManager) Running(convID int64) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.busy(convID)
+}
+
+// busy indica si la conversacion tiene un job sin terminar o una reserva; requiere el
+// mutex tomado
+func (m *GenerationManager) busy(convID int64) bool {
+	if m.claimed[convID] {
+		return true
+	}
+	for _, job := range m.jobs {
+		if job.ConversationID == convID && !job.Done() {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *GenerationManager) remove(job *GenerationJob) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.jobs[job.MessageID] == job {
+		delete(m.jobs, job.MessageID)
+	}
+}
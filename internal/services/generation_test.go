@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGenerationManagerClaim(t *testing.T) {
+	m := NewGenerationManager()
+
+	release, err := m.Claim(1)
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if !m.Running(1) || m.Running(2) {
+		t.Error("solo la conversacion reservada debe figurar en curso")
+	}
+	if _, err := m.Start(10, 1, 1); !errors.Is(err, ErrGenerationRunning) {
+		t.Errorf("Start con la conversacion reservada = %v, se esperaba ErrGenerationRunning", err)
+	}
+	if _, err := m.Claim(1); !errors.Is(err, ErrGenerationRunning) {
+		t.Errorf("segundo Claim = %v, se esperaba ErrGenerationRunning", err)
+	}
+
+	release()
+	release()
+	job, err := m.Start(10, 1, 1)
+	if err != nil {
+		t.Fatalf("Start despues de liberar: %v", err)
+	}
+	if _, err := m.Claim(1); !errors.Is(err, ErrGenerationRunning) {
+		t.Errorf("Claim con un job en curso = %v, se esperaba ErrGenerationRunning", err)
+	}
+
+	job.Finish()
+	if _, err := m.Claim(1); err != nil {
+		t.Errorf("Claim con el job terminado: %v", err)
+	}
+}
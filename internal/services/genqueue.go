@@ -0,0 +1,281 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull la cola de generacion alcanzo ai_queue_size
+var ErrQueueFull = errors.New("cola de IA llena")
+
+// GenerationQueue limita cuantas respuestas de IA se generan a la vez, en total
+// (ai_max_concurrent) y por usuario (ai_max_per_user). Las solicitudes que no caben
+// esperan en cola; los turnos se reparten por usuario en rotacion, de modo que quien
+// envia muchas preguntas no deja esperando a los demas.
+type GenerationQueue struct {
+	runtime  *RuntimeConfig
+	waiting  map[int64][]*GenerationTicket // por usuario, en orden de llegada
+	order    []int64                       // usuarios con solicitudes en espera, en turno rotativo
+	active   map[int64]int
+	names    map[int64]string
+	running  int
+	queued   int
+	served   int64
+	rejected int64
+	waitSum  time.Duration
+	mutex    sync.Mutex
+}
+
+// GenerationTicket lugar de una solicitud en la cola
+type GenerationTicket struct {
+	userID   int64
+	queue    *GenerationQueue
+	ready    chan struct{}
+	position chan int
+	notified int // ultima posicion enviada
+	enqueued time.Time
+	granted  bool
+	done     bool
+}
+
+func NewGenerationQueue(runtime *RuntimeConfig) *GenerationQueue {
+	return &GenerationQueue{
+		runtime: runtime,
+		waiting: make(map[int64][]*GenerationTicket),
+		active:  make(map[int64]int),
+		names:   make(map[int64]string),
+	}
+}
+
+// Enqueue pone en cola una solicitud del usuario. Si hay lugar el ticket queda listo de
+// inmediato; si no, Positions informa su lugar en la fila hasta que Ready se cierra.
+// Devuelve ErrQueueFull si la cola ya tiene ai_queue_size solicitudes esperando.
+func (q *GenerationQueue) Enqueue(userID int64, userName string) (*GenerationTicket, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	ticket := &GenerationTicket{
+		userID:   userID,
+		queue:    q,
+		ready:    make(chan struct{}),
+		position: make(chan int, 1),
+		enqueued: time.Now(),
+	}
+
+	if !q.canRun(userID) && q.queued >= q.runtime.Current().AIQueueSize {
+		q.rejected++
+		return nil, ErrQueueFull
+	}
+
+	if len(q.waiting[userID]) == 0 {
+		q.order = append(q.order, userID)
+	}
+	q.waiting[userID] = append(q.waiting[userID], ticket)
+	q.names[userID] = userName
+	q.queued++
+
+	q.schedule()
+	return ticket, nil
+}
+
+// Ready se cierra cuando la solicitud puede empezar a generar
+func (t *GenerationTicket) Ready() <-chan struct{} {
+	return t.ready
+}
+
+// Positions recibe el lugar en la fila (1 = la siguiente) cada vez que cambia
+func (t *GenerationTicket) Positions() <-chan int {
+	return t.position
+}
+
+// Release libera el lugar al terminar de generar o saca la solicitud de la cola si aun
+// esperaba (el cliente se desconecto). Puede llamarse mas de una vez.
+func (t *GenerationTicket) Release() {
+	q := t.queue
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if t.done {
+		return
+	}
+	t.done = true
+
+	if t.granted {
+		q.running--
+		q.active[t.userID]--
+		if q.active[t.userID] <= 0 {
+			delete(q.active, t.userID)
+		}
+	} else {
+		q.remove(t)
+	}
+	if q.active[t.userID] == 0 && len(q.waiting[t.userID]) == 0 {
+		delete(q.names, t.userID)
+	}
+	q.schedule()
+}
+
+// Reschedule vuelve a repartir los lugares; se llama cuando cambian los limites
+func (q *GenerationQueue) Reschedule() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.schedule()
+}
+
+// canRun indica si el usuario puede empezar a generar ya; requiere el mutex tomado
+func (q *GenerationQueue) canRun(userID int64) bool {
+	cfg := q.runtime.Current()
+	return q.running < cfg.AIMaxConcurrent && q.active[userID] < cfg.AIMaxPerUser
+}
+
+// schedule da lugar a las solicitudes en espera mientras haya capacidad, recorriendo los
+// usuarios en rotacion, y avisa a las demas su nueva posicion. Requiere el mutex tomado.
+func (q *GenerationQueue) schedule() {
+	cfg := q.runtime.Current()
+
+	for q.running < cfg.AIMaxConcurrent {
+		granted := false
+		for i, userID := range q.order {
+			if q.active[userID] >= cfg.AIMaxPerUser {
+				continue
+			}
+
+			ticket := q.waiting[userID][0]
+			q.waiting[userID] = q.waiting[userID][1:]
+			q.queued--
+			q.running++
+			q.active[userID]++
+			q.served++
+			q.waitSum += time.Since(ticket.enqueued)
+			ticket.granted = true
+			close(ticket.ready)
+
+			// El usuario pasa al final del turno, o sale si ya no tiene solicitudes
+			q.order = append(q.order[:i:i], q.order[i+1:]...)
+			if len(q.waiting[userID]) > 0 {
+				q.order = append(q.order, userID)
+			} else {
+				delete(q.waiting, userID)
+			}
+			granted = true
+			break
+		}
+		if !granted {
+			break
+		}
+	}
+
+	for ticket, position := range q.positions() {
+		if position == ticket.notified {
+			continue
+		}
+		ticket.notified = position
+		// Solo interesa la ultima posicion: se descarta la que no se leyo
+		select {
+		case <-ticket.position:
+		default:
+		}
+		ticket.position <- position
+	}
+}
+
+// positions calcula el lugar de cada solicitud en espera siguiendo la rotacion entre
+// usuarios: primero la mas antigua de cada uno, luego la segunda, etc.
+func (q *GenerationQueue) positions() map[*GenerationTicket]int {
+	positions := make(map[*GenerationTicket]int, q.queued)
+	position := 1
+	for round := 0; position <= q.queued; round++ {
+		for _, userID := range q.order {
+			if round < len(q.waiting[userID]) {
+				positions[q.waiting[userID][round]] = position
+				position++
+			}
+		}
+	}
+	return positions
+}
+
+// remove saca de la cola una solicitud que no llego a generar; requiere el mutex tomado
+func (q *GenerationQueue) remove(t *GenerationTicket) {
+	tickets := q.waiting[t.userID]
+	for i, ticket := range tickets {
+		if ticket == t {
+			q.waiting[t.userID] = append(tickets[:i:i], tickets[i+1:]...)
+			q.queued--
+			break
+		}
+	}
+	if len(q.waiting[t.userID]) > 0 {
+		return
+	}
+	delete(q.waiting, t.userID)
+	for i, userID := range q.order {
+		if userID == t.userID {
+			q.order = append(q.order[:i:i], q.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// QueueStatus estado de la cola para el panel de administracion
+type QueueStatus struct {
+	Running       int              `json:"running"`
+	Waiting       int              `json:"waiting"`
+	MaxConcurrent int              `json:"max_concurrent"`
+	MaxPerUser    int              `json:"max_per_user"`
+	QueueSize     int              `json:"queue_size"`
+	Served        int64            `json:"served"`
+	Rejected      int64            `json:"rejected"`
+	AvgWaitMs     int64            `json:"avg_wait_ms"`
+	Users         []QueueUserState `json:"users"`
+}
+
+// QueueUserState solicitudes de un usuario generando y en espera
+type QueueUserState struct {
+	UserID  int64  `json:"user_id"`
+	Name    string `json:"name"`
+	Running int    `json:"running"`
+	Waiting int    `json:"waiting"`
+}
+
+func (q *GenerationQueue) Status() QueueStatus {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	cfg := q.runtime.Current()
+	status := QueueStatus{
+		Running:       q.running,
+		Waiting:       q.queued,
+		MaxConcurrent: cfg.AIMaxConcurrent,
+		MaxPerUser:    cfg.AIMaxPerUser,
+		QueueSize:     cfg.AIQueueSize,
+		Served:        q.served,
+		Rejected:      q.rejected,
+		Users:         []QueueUserState{},
+	}
+	if q.served > 0 {
+		status.AvgWaitMs = (q.waitSum / time.Duration(q.served)).Milliseconds()
+	}
+
+	users := make(map[int64]bool)
+	for userID := range q.active {
+		users[userID] = true
+	}
+	for userID := range q.waiting {
+		users[userID] = true
+	}
+	for userID := range users {
+		status.Users = append(status.Users, QueueUserState{
+			UserID:  userID,
+			Name:    q.names[userID],
+			Running: q.active[userID],
+			Waiting: len(q.waiting[userID]),
+		})
+	}
+	sort.Slice(status.Users, func(i, j int) bool {
+		return status.Users[i].UserID < status.Users[j].UserID
+	})
+	return status
+}
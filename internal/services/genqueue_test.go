@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"chat-empleados/internal/config"
+)
+
+func newTestQueue(maxConcurrent, maxPerUser, queueSize int) *GenerationQueue {
+	return NewGenerationQueue(NewRuntimeConfig(nil, &config.Config{
+		AIMaxConcurrent: maxConcurrent,
+		AIMaxPerUser:    maxPerUser,
+		AIQueueSize:     queueSize,
+	}))
+}
+
+func isReady(ticket *GenerationTicket) bool {
+	select {
+	case <-ticket.Ready():
+		return true
+	default:
+		return false
+	}
+}
+
+// lastPosition devuelve la ultima posicion publicada al ticket, o 0 si no hay nueva
+func lastPosition(ticket *GenerationTicket) int {
+	select {
+	case position := <-ticket.Positions():
+		return position
+	default:
+		return 0
+	}
+}
+
+func TestGenerationQueueRotatesUsers(t *testing.T) {
+	q := newTestQueue(1, 5, 10)
+
+	enqueue := func(userID int64, name string) *GenerationTicket {
+		ticket, err := q.Enqueue(userID, name)
+		if err != nil {
+			t.Fatalf("Enqueue(%d): %v", userID, err)
+		}
+		return ticket
+	}
+
+	// El usuario 1 envia cuatro preguntas antes de que el 2 envie las suyas
+	tickets := map[string]*GenerationTicket{}
+	for _, name := range []string{"a1", "a2", "a3", "a4"} {
+		tickets[name] = enqueue(1, "Ana")
+	}
+	for _, name := range []string{"b1", "b2"} {
+		tickets[name] = enqueue(2, "Beto")
+	}
+
+	wantPositions := map[string]int{"a2": 1, "b1": 2, "a3": 3, "b2": 4, "a4": 5}
+	for name, want := range wantPositions {
+		if got := lastPosition(tickets[name]); got != want {
+			t.Errorf("posicion de %s = %d, se esperaba %d", name, got, want)
+		}
+	}
+
+	// Con un solo lugar, los turnos se alternan entre usuarios
+	order := []string{"a1", "a2", "b1", "a3", "b2", "a4"}
+	for i, name := range order {
+		for _, other := range order[i:] {
+			if ready := isReady(tickets[other]); ready != (other == name) {
+				t.Fatalf("turno %d: %s listo = %v", i+1, other, ready)
+			}
+		}
+		tickets[name].Release()
+	}
+
+	status := q.Status()
+	if status.Running != 0 || status.Waiting != 0 || status.Served != 6 {
+		t.Errorf("estado final = %+v", status)
+	}
+}
+
+func TestGenerationQueueLimits(t *testing.T) {
+	q := newTestQueue(2, 1, 1)
+
+	first, _ := q.Enqueue(1, "Ana")
+	second, err := q.Enqueue(1, "Ana")
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if !isReady(first) || isReady(second) {
+		t.Fatal("el segundo mensaje del usuario debe esperar a ai_max_per_user")
+	}
+
+	// Otro usuario tiene lugar aunque la cola este llena
+	other, err := q.Enqueue(2, "Beto")
+	if err != nil || !isReady(other) {
+		t.Fatalf("Enqueue de otro usuario: %v", err)
+	}
+	if _, err := q.Enqueue(3, "Carla"); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("error = %v, se esperaba ErrQueueFull", err)
+	}
+
+	// Una solicitud que se abandona en la cola libera su lugar
+	second.Release()
+	third, err := q.Enqueue(1, "Ana")
+	if err != nil {
+		t.Fatalf("Enqueue despues de Release: %v", err)
+	}
+	first.Release()
+	first.Release()
+	if !isReady(third) {
+		t.Error("la solicitud en espera debe tomar el lugar liberado")
+	}
+	if status := q.Status(); status.Running != 2 || status.Waiting != 0 || status.Rejected != 1 {
+		t.Errorf("estado = %+v", status)
+	}
+}
@@ -0,0 +1,691 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Extraccion de texto de los formatos binarios de Office 97-2003 (.doc, .xls). Ambos
+// guardan sus datos dentro de un Compound File Binary (CFB): un pequeno sistema de
+// archivos con sectores encadenados por una FAT. Se lee el stream principal y se
+// interpretan solo las estructuras necesarias para obtener el texto.
+
+var ErrOfficeEncrypted = errors.New("el documento esta protegido con contrasena")
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+const (
+	cfbMaxRegSect = 0xFFFFFFFA // los valores mayores son marcas (fin de cadena, libre, etc.)
+	cfbEntrySize  = 128
+)
+
+var littleEndian = binary.LittleEndian
+
+type cfbEntry struct {
+	name  string
+	typ   byte // 2 = stream, 5 = raiz
+	start uint32
+	size  uint64
+}
+
+// cfbFile un Compound File abierto en memoria
+type cfbFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint64
+	fat            []uint32
+	miniFAT        []uint32
+	miniStream     []byte
+	entries        []cfbEntry
+}
+
+func openCFB(data []byte) (*cfbFile, error) {
+	if len(data) < 512 || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, errors.New("no es un documento de Office 97-2003")
+	}
+
+	shift, miniShift := littleEndian.Uint16(data[0x1E:]), littleEndian.Uint16(data[0x20:])
+	if (shift != 9 && shift != 12) || miniShift != 6 {
+		return nil, errors.New("encabezado de documento invalido")
+	}
+	f := &cfbFile{
+		data:           data,
+		sectorSize:     1 << shift,
+		miniSectorSize: 1 << miniShift,
+		miniCutoff:     uint64(littleEndian.Uint32(data[0x38:])),
+	}
+
+	// Sectores de la FAT: 109 en el encabezado y el resto en la cadena DIFAT. Ni la cadena
+	// ni la FAT pueden tener mas sectores que el archivo, aunque el encabezado diga otra
+	// cosa o la cadena tenga un ciclo.
+	maxSectors := len(data) / f.sectorSize
+	var fatSectors []uint32
+	for i := 0; i < 109; i++ {
+		if s := littleEndian.Uint32(data[0x4C+4*i:]); s <= cfbMaxRegSect {
+			fatSectors = append(fatSectors, s)
+		}
+	}
+	difat := littleEndian.Uint32(data[0x44:])
+	perSector := f.sectorSize/4 - 1
+	difatCount := min(int(littleEndian.Uint32(data[0x48:])), maxSectors)
+	for i := 0; i < difatCount && difat <= cfbMaxRegSect && len(fatSectors) < maxSectors; i++ {
+		sector := f.sector(difat)
+		if len(sector) < f.sectorSize {
+			break
+		}
+		for j := 0; j < perSector; j++ {
+			if s := littleEndian.Uint32(sector[4*j:]); s <= cfbMaxRegSect {
+				fatSectors = append(fatSectors, s)
+			}
+		}
+		difat = littleEndian.Uint32(sector[4*perSector:])
+	}
+	if len(fatSectors) > maxSectors {
+		fatSectors = fatSectors[:maxSectors]
+	}
+	for _, s := range fatSectors {
+		f.fat = appendUint32s(f.fat, f.sector(s))
+	}
+	if len(f.fat) == 0 {
+		return nil, errors.New("documento sin tabla de sectores")
+	}
+
+	dir := f.readChain(littleEndian.Uint32(data[0x30:]), f.fat, f.sector)
+	for i := 0; i+cfbEntrySize <= len(dir); i += cfbEntrySize {
+		raw := dir[i : i+cfbEntrySize]
+		nameLen := min(int(littleEndian.Uint16(raw[64:])), 64)
+		units := make([]uint16, 0, nameLen/2)
+		for j := 0; j+1 < nameLen; j += 2 {
+			if u := littleEndian.Uint16(raw[j:]); u != 0 {
+				units = append(units, u)
+			}
+		}
+		size := littleEndian.Uint64(raw[120:])
+		if f.sectorSize == 512 {
+			size &= 0xFFFFFFFF // la version 3 solo usa los 32 bits bajos
+		}
+		f.entries = append(f.entries, cfbEntry{
+			name:  string(utf16.Decode(units)),
+			typ:   raw[66],
+			start: littleEndian.Uint32(raw[116:]),
+			size:  size,
+		})
+	}
+	if len(f.entries) == 0 || f.entries[0].typ != 5 {
+		return nil, errors.New("documento sin directorio raiz")
+	}
+
+	// Los streams chicos viven en el mini stream, que a su vez es el stream de la raiz
+	root := f.entries[0]
+	f.miniStream = f.readChain(root.start, f.fat, f.sector)
+	if uint64(len(f.miniStream)) > root.size {
+		f.miniStream = f.miniStream[:root.size]
+	}
+	f.miniFAT = appendUint32s(nil, f.readChain(littleEndian.Uint32(data[0x3C:]), f.fat, f.sector))
+
+	return f, nil
+}
+
+func appendUint32s(dst []uint32, b []byte) []uint32 {
+	for i := 0; i+4 <= len(b); i += 4 {
+		dst = append(dst, littleEndian.Uint32(b[i:]))
+	}
+	return dst
+}
+
+func (f *cfbFile) sector(n uint32) []byte {
+	offset := (int(n) + 1) * f.sectorSize
+	if offset >= len(f.data) {
+		return nil
+	}
+	return f.data[offset:min(offset+f.sectorSize, len(f.data))]
+}
+
+func (f *cfbFile) miniSector(n uint32) []byte {
+	offset := int(n) * f.miniSectorSize
+	if offset >= len(f.miniStream) {
+		return nil
+	}
+	return f.miniStream[offset:min(offset+f.miniSectorSize, len(f.miniStream))]
+}
+
+// readChain concatena los sectores de una cadena; se corta si la cadena tiene un ciclo o
+// si ya leyo mas que el archivo completo
+func (f *cfbFile) readChain(start uint32, fat []uint32, read func(uint32) []byte) []byte {
+	var out []byte
+	for n, steps := start, 0; n <= cfbMaxRegSect && int(n) < len(fat) && steps <= len(fat) && len(out) < len(f.data); steps++ {
+		sector := read(n)
+		if sector == nil {
+			break
+		}
+		out = append(out, sector...)
+		n = fat[n]
+	}
+	return out
+}
+
+// stream devuelve el contenido de un stream por nombre (los nombres no distinguen mayusculas)
+func (f *cfbFile) stream(name string) ([]byte, bool) {
+	for _, entry := range f.entries[1:] {
+		if entry.typ != 2 || !strings.EqualFold(entry.name, name) {
+			continue
+		}
+		var data []byte
+		if entry.size < f.miniCutoff {
+			data = f.readChain(entry.start, f.miniFAT, f.miniSector)
+		} else {
+			data = f.readChain(entry.start, f.fat, f.sector)
+		}
+		if uint64(len(data)) > entry.size {
+			data = data[:entry.size]
+		}
+		return data, true
+	}
+	return nil, false
+}
+
+// --- Word 97-2003 ---
+
+// extractDOC lee el texto del documento principal usando la tabla de piezas (CLX):
+// el texto puede estar repartido en piezas de 8 bits (cp1252) o UTF-16.
+func (fp *FileProcessor) extractDOC(content []byte) (string, error) {
+	cfb, err := openCFB(content)
+	if err != nil {
+		return "", err
+	}
+
+	word, ok := cfb.stream("WordDocument")
+	if !ok || len(word) < 0x200 || littleEndian.Uint16(word[0:]) != 0xA5EC {
+		return "", errors.New("invalid DOC file")
+	}
+	if littleEndian.Uint16(word[2:]) < 0xC1 {
+		return "", errors.New("formato de Word 95 o anterior no soportado, guardalo como .docx")
+	}
+	flags := littleEndian.Uint16(word[0x0A:])
+	if flags&0x0100 != 0 {
+		return "", ErrOfficeEncrypted
+	}
+	tableName := "0Table"
+	if flags&0x0200 != 0 {
+		tableName = "1Table"
+	}
+	table, ok := cfb.stream(tableName)
+	if !ok {
+		return "", errors.New("invalid DOC file: missing table stream")
+	}
+
+	// FIB: FibBase (32 bytes), FibRgW, FibRgLw (ccpText en el indice 3) y FibRgFcLcb (fcClx en el par 33)
+	invalidFIB := errors.New("invalid DOC file: FIB")
+	pos := 32 + 2 + 2*int(littleEndian.Uint16(word[32:]))
+	if pos+2 > len(word) {
+		return "", invalidFIB
+	}
+	cslw := int(littleEndian.Uint16(word[pos:]))
+	rgLw := pos + 2
+	pos = rgLw + 4*cslw
+	if pos+2 > len(word) {
+		return "", invalidFIB
+	}
+	cbFcLcb := int(littleEndian.Uint16(word[pos:]))
+	rgFcLcb := pos + 2
+	if cslw < 4 || cbFcLcb < 34 || rgFcLcb+34*8 > len(word) {
+		return "", invalidFIB
+	}
+	ccpText := int(littleEndian.Uint32(word[rgLw+12:]))
+	fcClx := int(littleEndian.Uint32(word[rgFcLcb+33*8:]))
+	lcbClx := int(littleEndian.Uint32(word[rgFcLcb+33*8+4:]))
+	if fcClx < 0 || lcbClx <= 0 || fcClx+lcbClx > len(table) {
+		return "", errors.New("invalid DOC file: CLX")
+	}
+	clx := table[fcClx : fcClx+lcbClx]
+
+	// Saltar las propiedades (Prc) hasta la tabla de piezas (Pcdt)
+	i := 0
+	for i+3 <= len(clx) && clx[i] == 0x01 {
+		cbGrpprl := int(int16(littleEndian.Uint16(clx[i+1:])))
+		if cbGrpprl < 0 {
+			return "", errors.New("invalid DOC file: piece table")
+		}
+		i += 3 + cbGrpprl
+	}
+	if i+5 > len(clx) || clx[i] != 0x02 {
+		return "", errors.New("invalid DOC file: piece table")
+	}
+	lcb := int(littleEndian.Uint32(clx[i+1:]))
+	plc := clx[i+5:]
+	if lcb < 4 || lcb > len(plc) {
+		return "", errors.New("invalid DOC file: piece table")
+	}
+	pieces := (lcb - 4) / 12
+
+	var chars []rune
+	for k := 0; k < pieces && len(chars) < ccpText; k++ {
+		cpStart := int(littleEndian.Uint32(plc[4*k:]))
+		cpEnd := int(littleEndian.Uint32(plc[4*(k+1):]))
+		pcd := plc[4*(pieces+1)+8*k:]
+		fc := littleEndian.Uint32(pcd[2:])
+		count := min(cpEnd-cpStart, ccpText-len(chars))
+		if count <= 0 {
+			continue
+		}
+
+		if fc&0x40000000 != 0 {
+			offset := int(fc&^0x40000000) / 2
+			for j := 0; j < count && offset+j < len(word); j++ {
+				chars = append(chars, winAnsiRune(word[offset+j]))
+			}
+		} else {
+			offset := int(fc)
+			units := make([]uint16, 0, count)
+			for j := 0; j < count && offset+2*j+1 < len(word); j++ {
+				units = append(units, littleEndian.Uint16(word[offset+2*j:]))
+			}
+			chars = append(chars, utf16.Decode(units)...)
+		}
+	}
+
+	return docPlainText(chars), nil
+}
+
+// docPlainText convierte los caracteres especiales de Word: fin de parrafo, celdas de tabla
+// (0x07, dos seguidos cierran la fila) y campos (se oculta el codigo, se deja el resultado)
+func docPlainText(chars []rune) string {
+	var out strings.Builder
+	var fields []bool // true mientras se esta dentro del codigo del campo
+	var prev rune
+
+	for _, r := range chars {
+		switch r {
+		case 0x13:
+			fields = append(fields, true)
+		case 0x14:
+			if len(fields) > 0 {
+				fields[len(fields)-1] = false
+			}
+		case 0x15:
+			if len(fields) > 0 {
+				fields = fields[:len(fields)-1]
+			}
+		}
+		hidden := false
+		for _, inCode := range fields {
+			hidden = hidden || inCode
+		}
+		if hidden || r == 0x13 || r == 0x14 || r == 0x15 {
+			prev = r
+			continue
+		}
+
+		switch {
+		case r == 0x0D || r == 0x0B || r == 0x0C:
+			out.WriteByte('\n')
+		case r == 0x07:
+			if prev == 0x07 {
+				out.WriteByte('\n')
+			} else {
+				out.WriteString(" | ")
+			}
+		case r == 0x1E:
+			out.WriteByte('-')
+		case r == 0xA0:
+			out.WriteByte(' ')
+		case r == '\t' || r >= 0x20:
+			out.WriteRune(r)
+		}
+		prev = r
+	}
+	return out.String()
+}
+
+// --- Excel 97-2003 (BIFF8) ---
+
+const (
+	xlsBOF        = 0x0809
+	xlsEOF        = 0x000A
+	xlsFilePass   = 0x002F
+	xlsBoundSheet = 0x0085
+	xlsSST        = 0x00FC
+	xlsContinue   = 0x003C
+	xlsLabelSST   = 0x00FD
+	xlsLabel      = 0x0204
+	xlsNumber     = 0x0203
+	xlsRK         = 0x027E
+	xlsMulRK      = 0x00BD
+	xlsFormula    = 0x0006
+	xlsString     = 0x0207
+	xlsBoolErr    = 0x0205
+)
+
+type xlsRecord struct {
+	typ  uint16
+	data []byte
+}
+
+// xlsRecords lee los registros desde un offset hasta el EOF de esa subseccion
+func xlsRecords(stream []byte, offset int) []xlsRecord {
+	var records []xlsRecord
+	for offset+4 <= len(stream) {
+		typ := littleEndian.Uint16(stream[offset:])
+		size := int(littleEndian.Uint16(stream[offset+2:]))
+		if offset+4+size > len(stream) {
+			break
+		}
+		records = append(records, xlsRecord{typ: typ, data: stream[offset+4 : offset+4+size]})
+		offset += 4 + size
+		if typ == xlsEOF {
+			break
+		}
+	}
+	return records
+}
+
+type xlsSheet struct {
+	name   string
+	offset int
+}
+
+// extractXLS devuelve cada hoja de calculo precedida de [Hoja nombre] y sus filas
+func (fp *FileProcessor) extractXLS(content []byte) (string, int, error) {
+	cfb, err := openCFB(content)
+	if err != nil {
+		return "", 0, err
+	}
+
+	workbook, ok := cfb.stream("Workbook")
+	if !ok {
+		if _, old := cfb.stream("Book"); old {
+			return "", 0, errors.New("formato de Excel 95 o anterior no soportado, guardalo como .xlsx")
+		}
+		return "", 0, errors.New("invalid XLS file")
+	}
+
+	globals := xlsRecords(workbook, 0)
+	if len(globals) == 0 || globals[0].typ != xlsBOF {
+		return "", 0, errors.New("invalid XLS file")
+	}
+
+	var sheets []xlsSheet
+	var sst []string
+	for i, rec := range globals {
+		switch rec.typ {
+		case xlsFilePass:
+			return "", 0, ErrOfficeEncrypted
+		case xlsBoundSheet:
+			// Solo hojas de calculo (dt = 0); se omiten graficos y macros
+			if len(rec.data) >= 8 && rec.data[5] == 0 {
+				name, _ := xlsShortString(rec.data[6:])
+				sheets = append(sheets, xlsSheet{name: name, offset: int(littleEndian.Uint32(rec.data))})
+			}
+		case xlsSST:
+			segments := [][]byte{rec.data}
+			for _, next := range globals[i+1:] {
+				if next.typ != xlsContinue {
+					break
+				}
+				segments = append(segments, next.data)
+			}
+			sst = xlsSharedStrings(segments)
+		}
+	}
+
+	var out strings.Builder
+	for _, sheet := range sheets {
+		out.WriteString(fmt.Sprintf("[Hoja %s]\n", sheet.name))
+		out.WriteString(xlsSheetText(workbook, sheet.offset, sst))
+		out.WriteString("\n")
+	}
+	return out.String(), len(sheets), nil
+}
+
+// xlsSheetText arma las filas de una hoja a partir de sus registros de celdas
+func xlsSheetText(workbook []byte, offset int, sst []string) string {
+	records := xlsRecords(workbook, offset)
+	if len(records) == 0 || records[0].typ != xlsBOF {
+		return ""
+	}
+
+	rows := make(map[int]map[int]string)
+	set := func(row, col int, value string) {
+		if value == "" {
+			return
+		}
+		if rows[row] == nil {
+			rows[row] = make(map[int]string)
+		}
+		rows[row][col] = value
+	}
+	pendingRow, pendingCol := -1, -1
+
+	for _, rec := range records {
+		d := rec.data
+		if len(d) < 6 && rec.typ != xlsString {
+			continue
+		}
+		switch rec.typ {
+		case xlsLabelSST:
+			if len(d) >= 10 {
+				if idx := int(littleEndian.Uint32(d[6:])); idx < len(sst) {
+					set(int(littleEndian.Uint16(d)), int(littleEndian.Uint16(d[2:])), sst[idx])
+				}
+			}
+		case xlsLabel:
+			if len(d) >= 9 {
+				text, _ := xlsUnicodeString(d[6:])
+				set(int(littleEndian.Uint16(d)), int(littleEndian.Uint16(d[2:])), text)
+			}
+		case xlsNumber:
+			if len(d) >= 14 {
+				set(int(littleEndian.Uint16(d)), int(littleEndian.Uint16(d[2:])), formatXLSNumber(math.Float64frombits(littleEndian.Uint64(d[6:]))))
+			}
+		case xlsRK:
+			if len(d) >= 10 {
+				set(int(littleEndian.Uint16(d)), int(littleEndian.Uint16(d[2:])), formatXLSNumber(xlsRKValue(littleEndian.Uint32(d[6:]))))
+			}
+		case xlsMulRK:
+			row, col := int(littleEndian.Uint16(d)), int(littleEndian.Uint16(d[2:]))
+			for p := 4; p+6 <= len(d)-2; p += 6 {
+				set(row, col, formatXLSNumber(xlsRKValue(littleEndian.Uint32(d[p+2:]))))
+				col++
+			}
+		case xlsFormula:
+			if len(d) < 14 {
+				continue
+			}
+			row, col := int(littleEndian.Uint16(d)), int(littleEndian.Uint16(d[2:]))
+			result := d[6:14]
+			if littleEndian.Uint16(result[6:]) != 0xFFFF {
+				set(row, col, formatXLSNumber(math.Float64frombits(littleEndian.Uint64(result))))
+				continue
+			}
+			switch result[0] {
+			case 0: // el texto viene en el registro STRING siguiente
+				pendingRow, pendingCol = row, col
+			case 1:
+				set(row, col, xlsBool(result[2]))
+			}
+		case xlsString:
+			if pendingRow >= 0 {
+				text, _ := xlsUnicodeString(d)
+				set(pendingRow, pendingCol, text)
+				pendingRow, pendingCol = -1, -1
+			}
+		case xlsBoolErr:
+			if len(d) >= 8 && d[7] == 0 {
+				set(int(littleEndian.Uint16(d)), int(littleEndian.Uint16(d[2:])), xlsBool(d[6]))
+			}
+		}
+	}
+
+	rowNums := make([]int, 0, len(rows))
+	for row := range rows {
+		rowNums = append(rowNums, row)
+	}
+	sort.Ints(rowNums)
+
+	var out strings.Builder
+	for i, row := range rowNums {
+		if i == maxSheetRows {
+			out.WriteString(fmt.Sprintf("... y %d filas mas\n", len(rowNums)-maxSheetRows))
+			break
+		}
+		maxCol := 0
+		for col := range rows[row] {
+			maxCol = max(maxCol, col)
+		}
+		cells := make([]string, maxCol+1)
+		for col, value := range rows[row] {
+			cells[col] = value
+		}
+		out.WriteString(fmt.Sprintf("Fila %d: %s\n", row+1, strings.Join(cells, " | ")))
+	}
+	return out.String()
+}
+
+func xlsBool(b byte) string {
+	if b != 0 {
+		return "VERDADERO"
+	}
+	return "FALSO"
+}
+
+// xlsRKValue decodifica un numero RK: entero de 30 bits o los 30 bits altos de un double,
+// opcionalmente multiplicado por 100
+func xlsRKValue(rk uint32) float64 {
+	var v float64
+	if rk&0x02 != 0 {
+		v = float64(int32(rk) >> 2)
+	} else {
+		v = math.Float64frombits(uint64(rk&^0x03) << 32)
+	}
+	if rk&0x01 != 0 {
+		v /= 100
+	}
+	return v
+}
+
+func formatXLSNumber(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// xlsShortString lee un ShortXLUnicodeString (longitud de 1 byte)
+func xlsShortString(d []byte) (string, int) {
+	if len(d) < 2 {
+		return "", len(d)
+	}
+	return xlsChars(d[2:], int(d[0]), d[1]&0x01 != 0)
+}
+
+// xlsUnicodeString lee un XLUnicodeString (longitud de 2 bytes)
+func xlsUnicodeString(d []byte) (string, int) {
+	if len(d) < 3 {
+		return "", len(d)
+	}
+	return xlsChars(d[3:], int(littleEndian.Uint16(d)), d[2]&0x01 != 0)
+}
+
+func xlsChars(d []byte, count int, wide bool) (string, int) {
+	if !wide {
+		count = min(count, len(d))
+		runes := make([]rune, count)
+		for i := 0; i < count; i++ {
+			runes[i] = rune(d[i]) // Latin-1 comprimido
+		}
+		return string(runes), count
+	}
+	count = min(count, len(d)/2)
+	units := make([]uint16, count)
+	for i := 0; i < count; i++ {
+		units[i] = littleEndian.Uint16(d[2*i:])
+	}
+	return string(utf16.Decode(units)), 2 * count
+}
+
+// xlsSegmentReader lee el SST repartido entre el registro SST y sus CONTINUE
+type xlsSegmentReader struct {
+	segments [][]byte
+	seg, pos int
+}
+
+func (r *xlsSegmentReader) byte() (byte, bool) {
+	for r.seg < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+		r.seg++
+		r.pos = 0
+	}
+	if r.seg >= len(r.segments) {
+		return 0, false
+	}
+	b := r.segments[r.seg][r.pos]
+	r.pos++
+	return b, true
+}
+
+func (r *xlsSegmentReader) uint(n int) (uint32, bool) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		b, ok := r.byte()
+		if !ok {
+			return 0, false
+		}
+		v |= uint32(b) << (8 * i)
+	}
+	return v, true
+}
+
+// xlsSharedStrings lee la tabla de cadenas compartidas. Si los caracteres de una cadena
+// cruzan a un registro CONTINUE, este empieza con un byte de opciones nuevo que indica si
+// el resto viene en 8 o 16 bits.
+func xlsSharedStrings(segments [][]byte) []string {
+	r := &xlsSegmentReader{segments: segments, pos: 8} // cstTotal y cstUnique
+	var strs []string
+
+	for {
+		cch, ok1 := r.uint(2)
+		flags, ok2 := r.byte()
+		if !ok1 || !ok2 {
+			return strs
+		}
+		runs, ext := uint32(0), uint32(0)
+		if flags&0x08 != 0 {
+			runs, _ = r.uint(2)
+		}
+		if flags&0x04 != 0 {
+			ext, _ = r.uint(4)
+		}
+
+		wide := flags&0x01 != 0
+		units := make([]uint16, 0, cch)
+		for i := uint32(0); i < cch; i++ {
+			if r.seg+1 < len(r.segments) && r.pos >= len(r.segments[r.seg]) {
+				r.seg++
+				r.pos = 0
+				opts, _ := r.byte()
+				wide = opts&0x01 != 0
+			}
+			size := 1
+			if wide {
+				size = 2
+			}
+			u, ok := r.uint(size)
+			if !ok {
+				return append(strs, string(utf16.Decode(units)))
+			}
+			units = append(units, uint16(u))
+		}
+		strs = append(strs, string(utf16.Decode(units)))
+
+		// Formato enriquecido y datos extendidos: se descartan
+		for i := uint32(0); i < 4*runs+ext; i++ {
+			if _, ok := r.byte(); !ok {
+				return strs
+			}
+		}
+	}
+}
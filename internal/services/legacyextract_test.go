@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExtractLegacyOffice(t *testing.T) {
+	fp := NewFileProcessor()
+	extractDOC := func(data []byte) (string, int, error) {
+		text, err := fp.extractDOC(data)
+		return text, 0, err
+	}
+
+	tests := []struct {
+		file    string
+		extract func([]byte) (string, int, error)
+		pages   int
+		want    []string
+	}{
+		{
+			// Piezas cp1252 y UTF-16, campos (se conserva el resultado) y celdas de tabla
+			file:    "sample.doc",
+			extract: extractDOC,
+			want:    []string{"Hola señor “cita”", "5 fin campo", "Tabla: a | b", "después"},
+		},
+		{
+			// Streams en sectores normales: SST, numeros RK, formulas y booleanos
+			file:    "sample.xls",
+			extract: fp.extractXLS,
+			pages:   1,
+			want:    []string{"[Hoja Hoja1]\nFila 1: Parte | Descripción larga\nFila 2: 3.5 | 42\nFila 3: 12.34 | 2.5\nFila 4: calc | 7\nFila 5: VERDADERO | etiqueta"},
+		},
+		{
+			// El mismo libro en el mini stream (menos de 4096 bytes)
+			file:    "small.xls",
+			extract: fp.extractXLS,
+			pages:   1,
+			want:    []string{"Fila 1: Parte | Descripción larga", "Fila 5: VERDADERO | etiqueta"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, pages, err := tt.extract(data)
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if pages != tt.pages {
+				t.Errorf("hojas = %d, se esperaban %d", pages, tt.pages)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("falta %q en %q", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractDOCEncrypted(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fEncrypted en los flags del FIB, al inicio del stream WordDocument
+	fib := bytes.Index(data, []byte{0xEC, 0xA5})
+	if fib < 0 {
+		t.Fatal("FIB no encontrado")
+	}
+	data[fib+0x0B] |= 0x01
+
+	if _, err := NewFileProcessor().extractDOC(data); !errors.Is(err, ErrOfficeEncrypted) {
+		t.Fatalf("error = %v, se esperaba ErrOfficeEncrypted", err)
+	}
+}
+
+func TestExtractLegacyOfficeMalformed(t *testing.T) {
+	doc, err := os.ReadFile("testdata/sample.doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	xls, err := os.ReadFile("testdata/sample.xls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// patch copia el archivo y escribe valores de 32 bits en las posiciones indicadas
+	patch := func(data []byte, values map[int]uint32) []byte {
+		out := append([]byte{}, data...)
+		for offset, value := range values {
+			binary.LittleEndian.PutUint32(out[offset:], value)
+		}
+		return out
+	}
+
+	type malformed struct {
+		name string
+		ext  string
+		data []byte
+	}
+	tests := []malformed{
+		{"vacio", ".doc", nil},
+		{"no es CFB", ".xls", []byte("esto no es un documento de Office")},
+		{"solo encabezado", ".doc", doc[:512]},
+		// La cadena DIFAT apunta a si misma y declara 2^32-1 sectores
+		{"DIFAT con ciclo", ".doc", patch(doc, map[int]uint32{0x44: 1, 0x48: 0xFFFFFFFF, 2*512 + 508: 1})},
+		// Todos los sectores de la FAT del encabezado son el mismo
+		{"FAT repetida", ".xls", patch(xls, func() map[int]uint32 {
+			values := make(map[int]uint32)
+			for i := 0; i < 109; i++ {
+				values[0x4C+4*i] = 0
+			}
+			return values
+		}())},
+		{"directorio fuera del archivo", ".doc", patch(doc, map[int]uint32{0x30: 0xFFFFFF00})},
+		{"mini FAT fuera del archivo", ".xls", patch(xls, map[int]uint32{0x3C: 0x7FFFFFFF, 0x38: 0xFFFFFFFF})},
+	}
+
+	// Cada truncamiento de los archivos de ejemplo
+	for n := 0; n < len(doc); n += 29 {
+		tests = append(tests, malformed{fmt.Sprintf("doc truncado a %d bytes", n), ".doc", doc[:n]})
+	}
+	for n := 0; n < len(xls); n += 23 {
+		tests = append(tests, malformed{fmt.Sprintf("xls truncado a %d bytes", n), ".xls", xls[:n]})
+	}
+
+	fp := NewFileProcessor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Solo importa que termine sin entrar en panico ni agotar la memoria
+			if tt.ext == ".doc" {
+				fp.extractDOC(tt.data)
+			} else {
+				fp.extractXLS(tt.data)
+			}
+		})
+	}
+}
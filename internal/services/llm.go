@@ -0,0 +1,631 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-empleados/internal/config"
+)
+
+var (
+	ErrLLMUnavailable    = errors.New("servidor de IA no disponible")
+	ErrMaxRetriesReached = errors.New("maximo de reintentos alcanzado")
+)
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// LLMProvider servidor de inferencia que atiende las conversaciones. Los filtros de
+// seguridad, el prompt del sistema y la eleccion del modelo quedan en LLMService; un
+// proveedor solo traduce la peticion a la API de su servidor.
+type LLMProvider interface {
+	// Chat devuelve la respuesta completa
+	Chat(ctx context.Context, req LLMRequest) (string, error)
+	// ChatStream envia a onChunk cada fragmento de la respuesta conforme llega
+	ChatStream(ctx context.Context, req LLMRequest, onChunk func(string) error) error
+	// ListModels devuelve los modelos que ofrece el servidor
+	ListModels(ctx context.Context) ([]LLMModel, error)
+	// Ping verifica que el servidor responde
+	Ping(ctx context.Context) error
+}
+
+// LLMRequest peticion de chat independiente del servidor
+type LLMRequest struct {
+	Model       string
+	Messages    []Message
+	Temperature float64
+	TopP        float64
+	NumCtx      int // ventana de contexto; solo la aplican los servidores que la aceptan por peticion
+	MaxTokens   int // 0 = sin limite
+}
+
+// LLMModel modelo ofrecido por un servidor de inferencia
+type LLMModel struct {
+	Name       string `json:"name"`
+	ModifiedAt string `json:"modified_at"`
+	Size       int64  `json:"size"`
+	Provider   string `json:"provider"`
+}
+
+// ProviderError respuesta de error de un servidor de inferencia
+type ProviderError struct {
+	Provider string
+	Status   int
+	Body     string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s error %d: %s", e.Provider, e.Status, e.Body)
+}
+
+// LLMService envia las conversaciones al servidor de inferencia de cada modelo: el pool
+// del Ollama principal (ollama_url y ollama_pool) o uno de llm_providers segun
+// llm_model_routes. Dentro de un pool cada peticion va al servidor menos ocupado y, si
+// falla, se reintenta en otro.
+type LLMService struct {
+	cfg          *config.Config
+	cfgMutex     sync.RWMutex
+	security     *SecurityService
+	pools        map[string]*llmPool
+	discovered   map[string]string // modelo -> servidor que lo listo, para modelos sin ruta
+	poolMutex    sync.RWMutex
+	checkPeriod  time.Duration
+	currentModel string
+	modelMutex   sync.RWMutex
+}
+
+func NewLLMService(cfg *config.Config, security *SecurityService) *LLMService {
+	svc := &LLMService{
+		cfg:          cfg,
+		security:     security,
+		discovered:   make(map[string]string),
+		checkPeriod:  30 * time.Second,
+		currentModel: cfg.OllamaModel,
+	}
+	svc.buildPools(cfg)
+
+	// Verificar disponibilidad inicial y despues periodicamente
+	go svc.healthLoop()
+
+	return svc
+}
+
+// buildPools crea los clientes de los servidores configurados
+func (s *LLMService) buildPools(cfg *config.Config) {
+	main := newLLMPool(config.LLMProviderConfig{Name: config.DefaultLLMProvider, Kind: "ollama", URL: cfg.OllamaURL})
+	main.add(cfg.OllamaURL, NewOllamaProvider(config.DefaultLLMProvider, cfg.OllamaURL, cfg.OllamaTimeout, ""), cfg.OllamaMaxParallel)
+	for _, endpoint := range cfg.OllamaPool {
+		if endpoint.URL == cfg.OllamaURL {
+			continue
+		}
+		limit := endpoint.MaxParallel
+		if limit == 0 {
+			limit = cfg.OllamaMaxParallel
+		}
+		main.add(endpoint.URL, NewOllamaProvider(config.DefaultLLMProvider, endpoint.URL, cfg.OllamaTimeout, ""), limit)
+	}
+
+	pools := map[string]*llmPool{config.DefaultLLMProvider: main}
+	for _, pc := range cfg.LLMProviders {
+		var provider LLMProvider
+		switch pc.Kind {
+		case "openai":
+			provider = NewOpenAIProvider(pc.Name, pc.URL, cfg.OllamaTimeout, cfg.LLMAPIKeys[pc.Name])
+		default:
+			provider = NewOllamaProvider(pc.Name, pc.URL, cfg.OllamaTimeout, cfg.LLMAPIKeys[pc.Name])
+		}
+		pool := newLLMPool(pc)
+		pool.add(pc.URL, provider, cfg.OllamaMaxParallel)
+		pools[pc.Name] = pool
+	}
+
+	s.poolMutex.Lock()
+	s.pools = pools
+	s.discovered = make(map[string]string)
+	s.poolMutex.Unlock()
+}
+
+// healthLoop revisa los servidores al iniciar y cada checkPeriod
+func (s *LLMService) healthLoop() {
+	s.checkAvailability()
+
+	ticker := time.NewTicker(s.checkPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.checkAvailability()
+	}
+}
+
+// checkAvailability consulta todos los servidores y registra los cambios de estado
+func (s *LLMService) checkAvailability() {
+	for _, pool := range s.poolList() {
+		before := pool.status()
+		pool.refresh(context.Background())
+		for i, st := range pool.status() {
+			if i < len(before) && before[i].Checked && before[i].Available == st.Available {
+				continue
+			}
+			if st.Available {
+				log.Printf("[INFO] Servidor de IA %s disponible en %s (%d modelos)", st.Pool, st.URL, len(st.Models))
+			} else {
+				log.Printf("[WARN] Servidor de IA %s no disponible en %s", st.Pool, st.URL)
+			}
+		}
+	}
+}
+
+// poolList devuelve los pools configurados, el principal primero
+func (s *LLMService) poolList() []*llmPool {
+	s.poolMutex.RLock()
+	defer s.poolMutex.RUnlock()
+
+	list := []*llmPool{s.pools[config.DefaultLLMProvider]}
+	for _, pc := range s.config().LLMProviders {
+		if pool, ok := s.pools[pc.Name]; ok {
+			list = append(list, pool)
+		}
+	}
+	return list
+}
+
+// poolFor elige los servidores de un modelo: la ruta configurada (por nombre o familia),
+// el servidor que lo listo o, si no, el pool de Ollama
+func (s *LLMService) poolFor(model string) *llmPool {
+	routes := s.config().LLMModelRoutes
+
+	s.poolMutex.RLock()
+	defer s.poolMutex.RUnlock()
+
+	name, ok := routes[model]
+	if !ok {
+		if family, _, found := strings.Cut(model, ":"); found {
+			name, ok = routes[family]
+		}
+	}
+	if !ok {
+		name, ok = s.discovered[model]
+	}
+	if pool, found := s.pools[name]; ok && found {
+		return pool
+	}
+	if ok {
+		log.Printf("[WARN] El modelo %s apunta al servidor %s, que no esta configurado; se usa Ollama", model, name)
+	}
+	return s.pools[config.DefaultLLMProvider]
+}
+
+// run ejecuta fn en el servidor menos ocupado del pool. Si falla sin que el servidor
+// responda o con un error 5xx y fn no entrego nada todavia (started), se reintenta en
+// otro servidor del pool; cuando ya se probaron todos, se espera con backoff exponencial
+// y se vuelve a empezar, hasta attempts intentos.
+func (s *LLMService) run(ctx context.Context, pool *llmPool, model string, attempts int, fn func(LLMProvider) (started bool, err error)) error {
+	failed := make(map[*llmMember]bool)
+	var lastErr error
+
+	for attempt := 0; attempt < max(attempts, 1); attempt++ {
+		member, err := pool.acquire(ctx, model, failed)
+		if errors.Is(err, errNoMember) && len(failed) > 0 {
+			// Backoff exponencial: 1s, 2s, 4s...
+			backoff := time.Duration(1<<uint(min(attempt-1, 5))) * time.Second
+			log.Printf("[INFO] Reintentando %s (intento %d/%d) en %v...", pool.Name, attempt+1, attempts, backoff)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			failed = make(map[*llmMember]bool)
+			member, err = pool.acquire(ctx, model, failed)
+		}
+		if err != nil {
+			if lastErr != nil {
+				return lastErr
+			}
+			return err
+		}
+
+		started, err := fn(member.provider)
+		pool.release(member, err)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if started || !retryable(err) {
+			return err
+		}
+
+		failed[member] = true
+		log.Printf("[WARN] Servidor de IA %s (%s) fallo: %v", pool.Name, member.url, err)
+	}
+	return lastErr
+}
+
+// Chat devuelve la respuesta ya redactada, el razonamiento del modelo (<think>) y la
+// revision de los filtros; si la revision trae Blocked, la pregunta o la respuesta se
+// bloquearon. Con model vacio se usa el modelo global.
+func (s *LLMService) Chat(ctx context.Context, messages []Message, userID int64, model string) (string, string, *ContentReview, error) {
+	messages, inputReview := s.reviewLastUserMessage(ctx, messages, userID)
+	if inputReview != nil {
+		return "", "", inputReview, nil
+	}
+
+	if model == "" {
+		model = s.GetModel()
+	}
+	pool := s.poolFor(model)
+	req := LLMRequest{
+		Model:       model,
+		Messages:    s.withSystemPrompt(messages),
+		Temperature: 0.7,
+		TopP:        0.9,
+		NumCtx:      s.ContextWindow(model),
+	}
+
+	var response string
+	err := s.run(ctx, pool, model, max(s.config().OllamaRetries, len(pool.members)), func(provider LLMProvider) (bool, error) {
+		var err error
+		response, err = provider.Chat(ctx, req)
+		return false, err
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	// Los filtros de salida revisan la respuesta y, por separado, el razonamiento
+	reasoning, answer := SplitReasoning(response)
+	review := s.security.ReviewOutput(ctx, answer)
+	if review.Blocked != nil {
+		log.Printf("[SECURITY] Respuesta IA bloqueada por filtro '%s'", review.Blocked.FilterName)
+		return "Lo siento, no puedo proporcionar esa informacion.", "", review, nil
+	}
+	if reasoning != "" {
+		reasoningReview := s.security.ReviewOutput(ctx, reasoning)
+		reasoning = reasoningReview.Content
+		if reasoningReview.Blocked != nil {
+			log.Printf("[SECURITY] Razonamiento IA descartado por filtro '%s'", reasoningReview.Blocked.FilterName)
+			reasoning = ""
+		}
+	}
+
+	return review.Content, reasoning, review, nil
+}
+
+// retryable indica si vale la pena repetir la peticion: el servidor no respondio o
+// fallo con un error 5xx; un error 4xx se repetiria igual
+func retryable(err error) bool {
+	if errors.Is(err, ErrLLMUnavailable) {
+		return true
+	}
+	var providerErr *ProviderError
+	return errors.As(err, &providerErr) && providerErr.Status >= 500
+}
+
+// withSystemPrompt antepone el prompt del sistema vigente a los mensajes
+func (s *LLMService) withSystemPrompt(messages []Message) []Message {
+	messagesWithSystem := make([]Message, 0, len(messages)+1)
+	messagesWithSystem = append(messagesWithSystem, Message{
+		Role:    "system",
+		Content: s.config().SystemPrompt,
+	})
+	return append(messagesWithSystem, messages...)
+}
+
+// reviewLastUserMessage pasa el ultimo mensaje del usuario (con URLs ya agregadas) por los
+// filtros de entrada: lo devuelve redactado, o la revision si hay que bloquearlo. El texto
+// de los archivos adjuntos llega aparte y se revisa al subirlos (ReviewFile).
+func (s *LLMService) reviewLastUserMessage(ctx context.Context, messages []Message, userID int64) ([]Message, *ContentReview) {
+	if len(messages) == 0 || messages[len(messages)-1].Role != "user" {
+		return messages, nil
+	}
+
+	review := s.security.ReviewInput(ctx, messages[len(messages)-1].Content)
+	if review.Blocked != nil {
+		log.Printf("[SECURITY] Usuario %d bloqueado por filtro '%s': %s",
+			userID, review.Blocked.FilterName, review.Blocked.MatchedText)
+		return messages, review
+	}
+
+	redacted := make([]Message, len(messages))
+	copy(redacted, messages)
+	redacted[len(redacted)-1].Content = review.Content
+	return redacted, nil
+}
+
+// Complete ejecuta una peticion sin el prompt del sistema ni filtros de seguridad,
+// para tareas internas como resumir conversaciones
+func (s *LLMService) Complete(ctx context.Context, model string, messages []Message, maxTokens int) (string, error) {
+	if model == "" {
+		model = s.GetModel()
+	}
+
+	pool := s.poolFor(model)
+	req := LLMRequest{
+		Model:       model,
+		Messages:    messages,
+		Temperature: 0.2,
+		NumCtx:      s.ContextWindow(model),
+		MaxTokens:   maxTokens,
+	}
+
+	var response string
+	err := s.run(ctx, pool, model, len(pool.members), func(provider LLMProvider) (bool, error) {
+		var err error
+		response, err = provider.Chat(ctx, req)
+		return false, err
+	})
+	return response, err
+}
+
+func (s *LLMService) ChatStream(ctx context.Context, messages []Message, userID int64, onChunk func(string) error) (*ContentReview, error) {
+	return s.ChatStreamWithModel(ctx, messages, userID, "", onChunk, nil)
+}
+
+// ChatStreamWithModel envia a onChunk la respuesta filtrada conforme llega y devuelve la
+// revision final (respuesta completa redactada y coincidencias); si trae Blocked, la
+// respuesta se aborto. Si se detiene, la revision de lo generado acompana al error.
+// El razonamiento (<think>) no forma parte de la respuesta: pasa por su propio filtro de
+// salida y va a onReasoning, o se descarta si es nil. Si un filtro de bloqueo coincide en
+// el razonamiento solo se deja de enviar el razonamiento.
+func (s *LLMService) ChatStreamWithModel(ctx context.Context, messages []Message, userID int64, model string, onChunk func(string) error, onReasoning func(string) error) (*ContentReview, error) {
+	log.Printf("[DEBUG] ChatStream: iniciando para usuario %d", userID)
+
+	messages, inputReview := s.reviewLastUserMessage(ctx, messages, userID)
+	if inputReview != nil {
+		return inputReview, nil
+	}
+
+	// Usar modelo específico o el global
+	useModel := model
+	if useModel == "" {
+		useModel = s.GetModel()
+	}
+
+	pool := s.poolFor(useModel)
+	log.Printf("[DEBUG] ChatStream: enviando request a %s...", pool.Name)
+
+	// Los fragmentos pasan por el filtro de salida antes de llegar a onChunk: se retiene
+	// el final del texto y se aborta en cuanto un filtro de bloqueo coincide
+	outputFilter := s.security.NewOutputStream(ctx)
+	reasoningFilter := s.security.NewOutputStream(ctx)
+	var splitter ReasoningSplitter
+	var blocked, reasoningBlocked *FilterResult
+
+	sendReasoning := func(text string) error {
+		if onReasoning == nil || reasoningBlocked != nil || text == "" {
+			return nil
+		}
+		safe, filterResult := reasoningFilter.Write(text)
+		if filterResult != nil {
+			reasoningBlocked = filterResult
+			log.Printf("[SECURITY] Razonamiento IA cortado por filtro '%s'", filterResult.FilterName)
+			return nil
+		}
+		if safe != "" {
+			return onReasoning(safe)
+		}
+		return nil
+	}
+	sendAnswer := func(text string) error {
+		if text == "" {
+			return nil
+		}
+		safe, filterResult := outputFilter.Write(text)
+		if filterResult != nil {
+			blocked = filterResult
+			return errStreamBlocked
+		}
+		if safe != "" {
+			return onChunk(safe)
+		}
+		return nil
+	}
+
+	req := LLMRequest{
+		Model:       useModel,
+		Messages:    s.withSystemPrompt(messages),
+		Temperature: 0.7,
+		TopP:        0.9,
+		NumCtx:      s.ContextWindow(useModel),
+	}
+	// Solo se cambia de servidor si el que fallo no llego a enviar nada
+	err := s.run(ctx, pool, useModel, len(pool.members), func(provider LLMProvider) (bool, error) {
+		started := false
+		err := provider.ChatStream(ctx, req, func(content string) error {
+			started = true
+			reasoning, answer := splitter.Write(content)
+			if err := sendReasoning(reasoning); err != nil {
+				return err
+			}
+			return sendAnswer(answer)
+		})
+		if blocked != nil {
+			return true, nil
+		}
+		return started, err
+	})
+	if blocked != nil {
+		log.Printf("[SECURITY] Respuesta IA streaming bloqueada a mitad de la respuesta por filtro '%s'", blocked.FilterName)
+		return &ContentReview{Blocked: blocked}, nil
+	}
+	// finish entrega lo retenido por el separador de razonamiento y los filtros, con la
+	// revision final de la respuesta completa
+	finish := func() (*ContentReview, error) {
+		reasoning, answer := splitter.Flush()
+		if err := sendReasoning(reasoning); err != nil {
+			return nil, err
+		}
+		if onReasoning != nil && reasoningBlocked == nil {
+			if rest, reasoningReview := reasoningFilter.Flush(); reasoningReview.Blocked == nil && rest != "" {
+				if err := onReasoning(rest); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := sendAnswer(answer); err != nil && blocked == nil {
+			return nil, err
+		}
+		if blocked != nil {
+			log.Printf("[SECURITY] Respuesta IA streaming bloqueada a mitad de la respuesta por filtro '%s'", blocked.FilterName)
+			return &ContentReview{Blocked: blocked}, nil
+		}
+
+		rest, review := outputFilter.Flush()
+		if review.Blocked != nil {
+			log.Printf("[SECURITY] Respuesta IA streaming bloqueada por filtro '%s'", review.Blocked.FilterName)
+			return review, nil
+		}
+		if rest != "" {
+			if err := onChunk(rest); err != nil {
+				return nil, err
+			}
+		}
+
+		return review, nil
+	}
+
+	if err != nil {
+		log.Printf("[DEBUG] ChatStream: error en %s: %v", pool.Name, err)
+		if ctx.Err() != nil {
+			// Detenida o vencida: lo retenido tambien se entrega, para que lo generado hasta
+			// ahi quede completo. Si la revision final lo bloquea, prevalece el bloqueo.
+			review, _ := finish()
+			return review, err
+		}
+		return nil, err
+	}
+
+	return finish()
+}
+
+// errStreamBlocked detiene la lectura de la respuesta cuando un filtro de salida la bloquea
+var errStreamBlocked = errors.New("respuesta bloqueada por filtro de salida")
+
+// IsAvailable indica si responde algun servidor del modelo global; usa el ultimo chequeo
+// y solo consulta a los servidores si aun no se hizo ninguno
+func (s *LLMService) IsAvailable(ctx context.Context) bool {
+	pool := s.poolFor(s.GetModel())
+	if !pool.checked() {
+		pool.refresh(ctx)
+	}
+	return pool.available()
+}
+
+// BackendStatus devuelve el estado y la carga de cada servidor de inferencia
+func (s *LLMService) BackendStatus() []BackendStatus {
+	var statuses []BackendStatus
+	for _, pool := range s.poolList() {
+		statuses = append(statuses, pool.status()...)
+	}
+	return statuses
+}
+
+// config devuelve la configuracion vigente
+func (s *LLMService) config() *config.Config {
+	s.cfgMutex.RLock()
+	defer s.cfgMutex.RUnlock()
+	return s.cfg
+}
+
+// ApplyConfig aplica en caliente la configuracion de tiempo de ejecucion
+func (s *LLMService) ApplyConfig(cfg *config.Config) {
+	s.cfgMutex.Lock()
+	previous := s.cfg
+	s.cfg = cfg
+	s.cfgMutex.Unlock()
+
+	if previous.OllamaModel != cfg.OllamaModel {
+		s.SetModel(cfg.OllamaModel)
+	}
+	if previous.OllamaURL != cfg.OllamaURL || config.FormatPool(previous.OllamaPool) != config.FormatPool(cfg.OllamaPool) ||
+		previous.OllamaMaxParallel != cfg.OllamaMaxParallel || config.FormatProviders(previous.LLMProviders) != config.FormatProviders(cfg.LLMProviders) {
+		if previous.OllamaURL != cfg.OllamaURL {
+			log.Printf("[INFO] URL de Ollama cambiada a: %s", cfg.OllamaURL)
+		}
+		s.buildPools(cfg)
+		go s.checkAvailability()
+	}
+}
+
+func (s *LLMService) GetModel() string {
+	s.modelMutex.RLock()
+	defer s.modelMutex.RUnlock()
+	return s.currentModel
+}
+
+func (s *LLMService) SetModel(model string) {
+	s.modelMutex.Lock()
+	defer s.modelMutex.Unlock()
+	s.currentModel = model
+	log.Printf("[INFO] Modelo de IA cambiado a: %s", model)
+}
+
+// ListModels junta los modelos de todos los servidores. Un servidor que no responde no
+// impide listar los demas; solo es error si ninguno respondio.
+func (s *LLMService) ListModels(ctx context.Context) ([]LLMModel, error) {
+	var models []LLMModel
+	var lastErr error
+	discovered := make(map[string]string)
+	responded := 0
+
+	for _, pool := range s.poolList() {
+		list, err := pool.refresh(ctx)
+		if err != nil {
+			log.Printf("[WARN] Error listando modelos de %s: %v", pool.Name, err)
+			lastErr = err
+			continue
+		}
+		responded++
+		for _, model := range list {
+			if _, seen := discovered[model.Name]; seen {
+				continue
+			}
+			discovered[model.Name] = pool.Name
+			model.Provider = pool.Name
+			models = append(models, model)
+		}
+	}
+	if responded == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	s.poolMutex.Lock()
+	s.discovered = discovered
+	s.poolMutex.Unlock()
+
+	return models, nil
+}
+
+// EmbeddingsEnabled indica si hay un modelo de embeddings configurado
+func (s *LLMService) EmbeddingsEnabled() bool {
+	return s.config().OllamaEmbedModel != ""
+}
+
+// Embed obtiene el vector de embeddings de un texto con el pool de Ollama principal
+func (s *LLMService) Embed(ctx context.Context, text string) ([]float64, error) {
+	if !s.EmbeddingsEnabled() {
+		return nil, errors.New("modelo de embeddings no configurado")
+	}
+
+	s.poolMutex.RLock()
+	pool := s.pools[config.DefaultLLMProvider]
+	s.poolMutex.RUnlock()
+
+	model := s.config().OllamaEmbedModel
+	var embedding []float64
+	err := s.run(ctx, pool, model, len(pool.members), func(provider LLMProvider) (bool, error) {
+		ollama, ok := provider.(*OllamaProvider)
+		if !ok {
+			return false, fmt.Errorf("%s no admite embeddings", pool.Name)
+		}
+		var err error
+		embedding, err = ollama.Embed(ctx, model, text)
+		return false, err
+	})
+	return embedding, err
+}
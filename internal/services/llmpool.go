@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-empleados/internal/config"
+)
+
+// llmMember servidor de inferencia dentro de un pool, con su estado y su carga
+type llmMember struct {
+	url       string
+	provider  LLMProvider
+	limit     int // peticiones simultaneas permitidas
+	active    int
+	served    int64
+	failures  int64
+	available bool
+	checked   bool
+	lastCheck time.Time
+	lastError string
+	models    map[string]bool // modelos que lista el servidor; nil si aun no se consultaron
+}
+
+// hasModel indica si el servidor tiene el modelo; si aun no se conoce su lista, se asume
+// que si. Ollama lista "llama3:latest" para el modelo pedido como "llama3".
+func (m *llmMember) hasModel(model string) bool {
+	if m.models == nil || model == "" {
+		return true
+	}
+	if m.models[model] {
+		return true
+	}
+	if !strings.Contains(model, ":") {
+		return m.models[model+":latest"]
+	}
+	return m.models[strings.TrimSuffix(model, ":latest")]
+}
+
+// llmPool servidores intercambiables que atienden los mismos modelos: el Ollama principal
+// con los de ollama_pool, o cada servidor de llm_providers
+type llmPool struct {
+	config.LLMProviderConfig
+	members  []*llmMember
+	mutex    sync.Mutex
+	released chan struct{} // se cierra y reemplaza cada vez que se libera un lugar
+}
+
+func newLLMPool(pc config.LLMProviderConfig) *llmPool {
+	return &llmPool{LLMProviderConfig: pc, released: make(chan struct{})}
+}
+
+func (p *llmPool) add(url string, provider LLMProvider, limit int) {
+	p.members = append(p.members, &llmMember{url: url, provider: provider, limit: max(limit, 1)})
+}
+
+// errNoMember ningun servidor del pool puede atender la peticion
+var errNoMember = fmt.Errorf("%w: ningun servidor disponible", ErrLLMUnavailable)
+
+// acquire reserva un lugar en el servidor menos ocupado que puede atender el modelo, sin
+// los de skip. Prefiere los que respondieron al ultimo chequeo y tienen el modelo; si
+// todos los candidatos estan en su limite, espera a que se libere un lugar.
+func (p *llmPool) acquire(ctx context.Context, model string, skip map[*llmMember]bool) (*llmMember, error) {
+	for {
+		p.mutex.Lock()
+		candidates := p.candidates(model, skip)
+		if len(candidates) == 0 {
+			p.mutex.Unlock()
+			return nil, errNoMember
+		}
+
+		var best *llmMember
+		for _, m := range candidates {
+			if m.active >= m.limit {
+				continue
+			}
+			// Menor ocupacion relativa; a igualdad, el que atendio menos peticiones
+			if best == nil || m.active*best.limit < best.active*m.limit ||
+				(m.active*best.limit == best.active*m.limit && m.served < best.served) {
+				best = m
+			}
+		}
+		if best != nil {
+			best.active++
+			p.mutex.Unlock()
+			return best, nil
+		}
+		released := p.released
+		p.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// candidates servidores que pueden atender el modelo, en el primer nivel que no quede
+// vacio: disponibles con el modelo, con el modelo aunque fallaron, cualquiera. Requiere
+// el mutex tomado.
+func (p *llmPool) candidates(model string, skip map[*llmMember]bool) []*llmMember {
+	tiers := [3][]*llmMember{}
+	for _, m := range p.members {
+		if skip[m] {
+			continue
+		}
+		healthy := m.available || !m.checked
+		switch {
+		case healthy && m.hasModel(model):
+			tiers[0] = append(tiers[0], m)
+		case m.hasModel(model):
+			tiers[1] = append(tiers[1], m)
+		default:
+			tiers[2] = append(tiers[2], m)
+		}
+	}
+	for _, tier := range tiers {
+		if len(tier) > 0 {
+			return tier
+		}
+	}
+	return nil
+}
+
+// release libera el lugar y registra el resultado de la peticion
+func (p *llmPool) release(m *llmMember, err error) {
+	p.mutex.Lock()
+	m.active--
+	switch {
+	case err == nil:
+		m.served++
+		m.markChecked(true, "")
+	case retryable(err):
+		// Queda relegado hasta que el proximo chequeo lo vuelva a encontrar
+		m.failures++
+		m.markChecked(false, err.Error())
+	}
+	close(p.released)
+	p.released = make(chan struct{})
+	p.mutex.Unlock()
+}
+
+// markChecked actualiza el estado de salud; requiere el mutex del pool tomado
+func (m *llmMember) markChecked(available bool, lastError string) {
+	m.available = available
+	m.checked = true
+	m.lastCheck = time.Now()
+	m.lastError = lastError
+}
+
+// refresh consulta los modelos de cada servidor: sirve de chequeo de salud y actualiza
+// la lista de modelos que se usa para elegir servidor. Devuelve los modelos de todos los
+// servidores sin repetir, o el ultimo error si ninguno respondio.
+func (p *llmPool) refresh(ctx context.Context) ([]LLMModel, error) {
+	lists := make([][]LLMModel, len(p.members))
+	errs := make([]error, len(p.members))
+
+	var wg sync.WaitGroup
+	for i, m := range p.members {
+		wg.Add(1)
+		go func(i int, m *llmMember) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+
+			lists[i], errs[i] = m.provider.ListModels(checkCtx)
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			if errs[i] != nil {
+				m.markChecked(false, errs[i].Error())
+				return
+			}
+			m.models = make(map[string]bool, len(lists[i]))
+			for _, model := range lists[i] {
+				m.models[model.Name] = true
+			}
+			m.markChecked(true, "")
+		}(i, m)
+	}
+	wg.Wait()
+
+	var models []LLMModel
+	var lastErr error
+	seen := make(map[string]bool)
+	responded := false
+	for i, list := range lists {
+		if errs[i] != nil {
+			lastErr = errs[i]
+			continue
+		}
+		responded = true
+		for _, model := range list {
+			if !seen[model.Name] {
+				seen[model.Name] = true
+				models = append(models, model)
+			}
+		}
+	}
+	if !responded {
+		return nil, lastErr
+	}
+	return models, nil
+}
+
+// checked indica si ya se consulto algun servidor del pool
+func (p *llmPool) checked() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, m := range p.members {
+		if m.checked {
+			return true
+		}
+	}
+	return false
+}
+
+// available indica si algun servidor del pool respondio al ultimo chequeo
+func (p *llmPool) available() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, m := range p.members {
+		if m.available {
+			return true
+		}
+	}
+	return false
+}
+
+// BackendStatus estado de un servidor de inferencia para el panel de administracion
+type BackendStatus struct {
+	Pool      string    `json:"pool"`
+	Kind      string    `json:"kind"`
+	URL       string    `json:"url"`
+	Available bool      `json:"available"`
+	Checked   bool      `json:"checked"`
+	Active    int       `json:"active"`
+	Limit     int       `json:"limit"`
+	Served    int64     `json:"served"`
+	Failures  int64     `json:"failures"`
+	Models    []string  `json:"models"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+func (p *llmPool) status() []BackendStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	statuses := make([]BackendStatus, 0, len(p.members))
+	for _, m := range p.members {
+		models := make([]string, 0, len(m.models))
+		for model := range m.models {
+			models = append(models, model)
+		}
+		sort.Strings(models)
+		statuses = append(statuses, BackendStatus{
+			Pool:      p.Name,
+			Kind:      p.Kind,
+			URL:       m.url,
+			Available: m.available,
+			Checked:   m.checked,
+			Active:    m.active,
+			Limit:     m.limit,
+			Served:    m.served,
+			Failures:  m.failures,
+			Models:    models,
+			LastCheck: m.lastCheck,
+			LastError: m.lastError,
+		})
+	}
+	return statuses
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"chat-empleados/internal/config"
+)
+
+// fakeProvider servidor de inferencia de prueba: responde err (o "ok") y cuenta las llamadas
+type fakeProvider struct {
+	err   error
+	calls int
+}
+
+func (f *fakeProvider) Chat(ctx context.Context, req LLMRequest) (string, error) {
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	return "ok", nil
+}
+
+func (f *fakeProvider) ChatStream(ctx context.Context, req LLMRequest, onChunk func(string) error) error {
+	_, err := f.Chat(ctx, req)
+	return err
+}
+
+func (f *fakeProvider) ListModels(ctx context.Context) ([]LLMModel, error) { return nil, f.err }
+
+func (f *fakeProvider) Ping(ctx context.Context) error { return f.err }
+
+func newTestPool(providers ...*fakeProvider) *llmPool {
+	pool := newLLMPool(config.LLMProviderConfig{Name: "test", Kind: "ollama"})
+	for i, provider := range providers {
+		pool.add(fmt.Sprintf("http://ollama%d:11434", i+1), provider, 1)
+	}
+	return pool
+}
+
+func TestLLMRunRetries(t *testing.T) {
+	unavailable := &ProviderError{Provider: "test", Status: 503, Body: "overloaded"}
+	badRequest := &ProviderError{Provider: "test", Status: 400, Body: "bad request"}
+
+	tests := []struct {
+		name      string
+		firstErr  error
+		started   bool
+		wantErr   error
+		wantCalls [2]int
+	}{
+		{"un 5xx pasa al siguiente servidor", unavailable, false, nil, [2]int{1, 1}},
+		{"sin respuesta pasa al siguiente servidor", ErrLLMUnavailable, false, nil, [2]int{1, 1}},
+		{"un 4xx no se reintenta", badRequest, false, badRequest, [2]int{1, 0}},
+		{"con la respuesta empezada no se reintenta", unavailable, true, unavailable, [2]int{1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := &fakeProvider{err: tt.firstErr}, &fakeProvider{}
+			pool := newTestPool(first, second)
+
+			err := (&LLMService{}).run(context.Background(), pool, "", 3, func(provider LLMProvider) (bool, error) {
+				_, err := provider.Chat(context.Background(), LLMRequest{})
+				return err != nil && tt.started, err
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, se esperaba %v", err, tt.wantErr)
+			}
+			if got := [2]int{first.calls, second.calls}; got != tt.wantCalls {
+				t.Errorf("llamadas = %v, se esperaban %v", got, tt.wantCalls)
+			}
+			for _, m := range pool.members {
+				if m.active != 0 {
+					t.Errorf("%s quedo con %d peticiones activas", m.url, m.active)
+				}
+			}
+		})
+	}
+}
+
+func TestLLMPoolCandidates(t *testing.T) {
+	pool := newTestPool(&fakeProvider{}, &fakeProvider{}, &fakeProvider{})
+	failing, withoutModel, healthy := pool.members[0], pool.members[1], pool.members[2]
+	failing.markChecked(false, "timeout")
+	withoutModel.models = map[string]bool{"mistral:latest": true}
+	healthy.markChecked(true, "")
+	healthy.models = map[string]bool{"llama3:latest": true}
+
+	if got := pool.candidates("llama3", nil); len(got) != 1 || got[0] != healthy {
+		t.Errorf("candidatos = %v, se esperaba solo el servidor disponible con el modelo", urls(got))
+	}
+	// Sin el disponible, el que fallo pero tiene el modelo va antes que el que no lo tiene
+	skip := map[*llmMember]bool{healthy: true}
+	if got := pool.candidates("llama3", skip); len(got) != 1 || got[0] != failing {
+		t.Errorf("candidatos = %v, se esperaba el servidor que fallo", urls(got))
+	}
+	skip[failing] = true
+	if got := pool.candidates("llama3", skip); len(got) != 1 || got[0] != withoutModel {
+		t.Errorf("candidatos = %v, se esperaba cualquier servidor restante", urls(got))
+	}
+	skip[withoutModel] = true
+	if got := pool.candidates("llama3", skip); len(got) != 0 {
+		t.Errorf("candidatos = %v, se esperaba ninguno", urls(got))
+	}
+}
+
+func TestLLMPoolAcquireWaitsForRelease(t *testing.T) {
+	pool := newTestPool(&fakeProvider{})
+	ctx := context.Background()
+
+	held, err := pool.acquire(ctx, "", nil)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	acquired := make(chan *llmMember)
+	go func() {
+		member, _ := pool.acquire(ctx, "", nil)
+		acquired <- member
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire no debe pasar el limite del servidor")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.release(held, nil)
+	select {
+	case member := <-acquired:
+		if member != held || member.active != 1 || member.served != 1 {
+			t.Errorf("servidor = %+v", member)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire debe continuar al liberarse el lugar")
+	}
+
+	// Si se cancela la espera se devuelve el error del contexto
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := pool.acquire(cancelled, "", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, se esperaba context.Canceled", err)
+	}
+}
+
+func urls(members []*llmMember) []string {
+	result := make([]string, len(members))
+	for i, m := range members {
+		result[i] = m.url
+	}
+	return result
+}
@@ -4,20 +4,66 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 
 	"chat-empleados/db"
 )
 
 type NotificationService struct {
-	queries *db.Queries
+	queries     *db.Queries
+	subscribers map[int64]map[chan db.Notification]struct{}
+	mutex       sync.RWMutex
 }
 
 func NewNotificationService(queries *db.Queries) *NotificationService {
 	return &NotificationService{
-		queries: queries,
+		queries:     queries,
+		subscribers: make(map[int64]map[chan db.Notification]struct{}),
 	}
 }
 
+// Subscribe registra un canal que recibe en vivo las notificaciones nuevas del usuario.
+// La funcion devuelta cancela la suscripcion.
+func (n *NotificationService) Subscribe(userID int64) (<-chan db.Notification, func()) {
+	ch := make(chan db.Notification, 16)
+
+	n.mutex.Lock()
+	if n.subscribers[userID] == nil {
+		n.subscribers[userID] = make(map[chan db.Notification]struct{})
+	}
+	n.subscribers[userID][ch] = struct{}{}
+	n.mutex.Unlock()
+
+	return ch, func() {
+		n.mutex.Lock()
+		delete(n.subscribers[userID], ch)
+		if len(n.subscribers[userID]) == 0 {
+			delete(n.subscribers, userID)
+		}
+		n.mutex.Unlock()
+	}
+}
+
+// create guarda la notificacion y la envia a los suscriptores conectados del usuario
+func (n *NotificationService) create(ctx context.Context, params db.CreateNotificationParams) (db.Notification, error) {
+	notification, err := n.queries.CreateNotification(ctx, params)
+	if err != nil {
+		return notification, err
+	}
+
+	n.mutex.RLock()
+	for ch := range n.subscribers[notification.UserID] {
+		select {
+		case ch <- notification:
+		default:
+			// Suscriptor lento, se omite; la notificacion sigue guardada en BD
+		}
+	}
+	n.mutex.RUnlock()
+
+	return notification, nil
+}
+
 // NotifyAdminsNewUser notifica a todos los admins cuando hay un nuevo usuario pendiente
 func (n *NotificationService) NotifyAdminsNewUser(ctx context.Context, userName, userNomina string) error {
 	adminIDs, err := n.queries.GetAdminUserIDs(ctx)
@@ -26,7 +72,7 @@ func (n *NotificationService) NotifyAdminsNewUser(ctx context.Context, userName,
 	}
 
 	for _, adminID := range adminIDs {
-		_, err := n.queries.CreateNotification(ctx, db.CreateNotificationParams{
+		_, err := n.create(ctx, db.CreateNotificationParams{
 			UserID:  adminID,
 			Type:    "user_pending",
 			Title:   "Nuevo usuario pendiente",
@@ -49,7 +95,7 @@ func (n *NotificationService) NotifyAdminsUrgentApproval(ctx context.Context, us
 	}
 
 	for _, adminID := range adminIDs {
-		_, err := n.queries.CreateNotification(ctx, db.CreateNotificationParams{
+		_, err := n.create(ctx, db.CreateNotificationParams{
 			UserID:  adminID,
 			Type:    "user_pending",
 			Title:   "URGENTE: Usuario solicita aprobacion",
@@ -66,7 +112,7 @@ func (n *NotificationService) NotifyAdminsUrgentApproval(ctx context.Context, us
 
 // NotifyUserApproved notifica al usuario que su cuenta fue aprobada
 func (n *NotificationService) NotifyUserApproved(ctx context.Context, userID int64) error {
-	_, err := n.queries.CreateNotification(ctx, db.CreateNotificationParams{
+	_, err := n.create(ctx, db.CreateNotificationParams{
 		UserID:  userID,
 		Type:    "user_approved",
 		Title:   "Cuenta aprobada",
@@ -82,7 +128,7 @@ func (n *NotificationService) NotifyUserApproved(ctx context.Context, userID int
 
 // NotifyUserRejected notifica al usuario que su cuenta fue rechazada
 func (n *NotificationService) NotifyUserRejected(ctx context.Context, userID int64) error {
-	_, err := n.queries.CreateNotification(ctx, db.CreateNotificationParams{
+	_, err := n.create(ctx, db.CreateNotificationParams{
 		UserID:  userID,
 		Type:    "user_rejected",
 		Title:   "Cuenta rechazada",
@@ -104,7 +150,7 @@ func (n *NotificationService) NotifySecurityAlert(ctx context.Context, userName,
 	}
 
 	for _, adminID := range adminIDs {
-		_, err := n.queries.CreateNotification(ctx, db.CreateNotificationParams{
+		_, err := n.create(ctx, db.CreateNotificationParams{
 			UserID:  adminID,
 			Type:    "security_alert",
 			Title:   "Alerta de seguridad",
@@ -158,7 +204,7 @@ func (n *NotificationService) NotifyAdminsKnowledgeSubmission(ctx context.Contex
 	}
 
 	for _, adminID := range adminIDs {
-		_, err := n.queries.CreateNotification(ctx, db.CreateNotificationParams{
+		_, err := n.create(ctx, db.CreateNotificationParams{
 			UserID:  adminID,
 			Type:    "system",
 			Title:   "Nuevo conocimiento pendiente",
@@ -172,3 +218,30 @@ func (n *NotificationService) NotifyAdminsKnowledgeSubmission(ctx context.Contex
 	log.Printf("[INFO] Notificacion de conocimiento enviada a %d admins", len(adminIDs))
 	return nil
 }
+
+// NotifyAdminsUnansweredQuestion notifica a los admins sobre una pregunta que la IA no pudo responder
+func (n *NotificationService) NotifyAdminsUnansweredQuestion(ctx context.Context, userName, question string) error {
+	adminIDs, err := n.queries.GetAdminUserIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("error obteniendo admins: %w", err)
+	}
+
+	if runes := []rune(question); len(runes) > 120 {
+		question = string(runes[:117]) + "..."
+	}
+
+	for _, adminID := range adminIDs {
+		_, err := n.create(ctx, db.CreateNotificationParams{
+			UserID:  adminID,
+			Type:    "system",
+			Title:   "Pregunta sin respuesta",
+			Message: fmt.Sprintf("La IA no pudo responder a %s: '%s'. Responde en /admin/knowledge", userName, question),
+		})
+		if err != nil {
+			log.Printf("[ERROR] Error creando notificacion de pregunta para admin %d: %v", adminID, err)
+		}
+	}
+
+	log.Printf("[INFO] Notificacion de pregunta sin respuesta enviada a %d admins", len(adminIDs))
+	return nil
+}
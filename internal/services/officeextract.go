@@ -0,0 +1,432 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Extraccion de texto de presentaciones PowerPoint (.pptx) y documentos OpenDocument
+// (.odt, .ods). Ambos son archivos zip con XML; se recorren los tokens con encoding/xml
+// y se conserva la estructura que le sirve a la IA: diapositivas, paginas, hojas y filas.
+
+const (
+	maxSheetRows   = 500 // filas por hoja, igual que en CSV
+	maxRepeatCells = 100 // celdas/filas repetidas que se expanden (ODS repite columnas vacias hasta el final)
+)
+
+// zipFiles abre un zip y devuelve sus archivos por nombre
+func zipFiles(content []byte, kind string) (map[string]*zip.File, error) {
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s file: %w", kind, err)
+	}
+	files := make(map[string]*zip.File, len(zipReader.File))
+	for _, file := range zipReader.File {
+		files[file.Name] = file
+	}
+	return files, nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, pdfMaxStreamSize))
+}
+
+// --- PPTX ---
+
+var slideFileName = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// extractPPTX devuelve el texto de cada diapositiva, con sus notas, precedido de [Diapositiva N]
+func (fp *FileProcessor) extractPPTX(content []byte) (string, int, error) {
+	files, err := zipFiles(content, "PPTX")
+	if err != nil {
+		return "", 0, err
+	}
+
+	slides := pptxSlideOrder(files)
+	if len(slides) == 0 {
+		return "", 0, fmt.Errorf("invalid PPTX file: no slides")
+	}
+
+	var textBuilder strings.Builder
+	for i, name := range slides {
+		textBuilder.WriteString(fmt.Sprintf("[Diapositiva %d]\n", i+1))
+
+		if data, err := readZipFile(files[name]); err == nil {
+			textBuilder.WriteString(drawingMLText(data))
+		}
+
+		// Las notas del orador suelen tener la explicacion de la diapositiva
+		if notes := pptxNotesFile(files, name); notes != nil {
+			if data, err := readZipFile(notes); err == nil {
+				if text := strings.TrimSpace(drawingMLText(data)); text != "" {
+					textBuilder.WriteString("Notas: ")
+					textBuilder.WriteString(text)
+					textBuilder.WriteString("\n")
+				}
+			}
+		}
+		textBuilder.WriteString("\n")
+	}
+
+	return textBuilder.String(), len(slides), nil
+}
+
+// pptxRelationships lee un archivo .rels: Id -> destino resuelto dentro del zip
+type pptxRelationship struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+func pptxRelationships(files map[string]*zip.File, relsName, baseDir string) []pptxRelationship {
+	file, ok := files[relsName]
+	if !ok {
+		return nil
+	}
+	data, err := readZipFile(file)
+	if err != nil {
+		return nil
+	}
+	var rels struct {
+		Items []pptxRelationship `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(data, &rels); err != nil {
+		return nil
+	}
+	for i := range rels.Items {
+		target := rels.Items[i].Target
+		if strings.HasPrefix(target, "/") {
+			// Ruta absoluta dentro del paquete
+			rels.Items[i].Target = path.Clean(strings.TrimPrefix(target, "/"))
+		} else {
+			rels.Items[i].Target = path.Clean(path.Join(baseDir, target))
+		}
+	}
+	return rels.Items
+}
+
+// pptxSlideOrder devuelve las diapositivas en el orden de la presentacion (sldIdLst).
+// Si presentation.xml no se puede leer se ordenan por numero de archivo.
+func pptxSlideOrder(files map[string]*zip.File) []string {
+	targets := make(map[string]string)
+	for _, rel := range pptxRelationships(files, "ppt/_rels/presentation.xml.rels", "ppt") {
+		targets[rel.ID] = rel.Target
+	}
+
+	var slides []string
+	if file, ok := files["ppt/presentation.xml"]; ok {
+		if data, err := readZipFile(file); err == nil {
+			decoder := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				tok, err := decoder.Token()
+				if err != nil {
+					break
+				}
+				start, ok := tok.(xml.StartElement)
+				if !ok || start.Name.Local != "sldId" {
+					continue
+				}
+				for _, attr := range start.Attr {
+					if attr.Name.Local == "id" && attr.Name.Space != "" {
+						if target, ok := files[targets[attr.Value]]; ok {
+							slides = append(slides, target.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(slides) > 0 {
+		return slides
+	}
+
+	type numbered struct {
+		name string
+		num  int
+	}
+	var found []numbered
+	for name := range files {
+		if m := slideFileName.FindStringSubmatch(name); m != nil {
+			num, _ := strconv.Atoi(m[1])
+			found = append(found, numbered{name, num})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].num < found[j].num })
+	for _, f := range found {
+		slides = append(slides, f.name)
+	}
+	return slides
+}
+
+func pptxNotesFile(files map[string]*zip.File, slide string) *zip.File {
+	relsName := path.Join(path.Dir(slide), "_rels", path.Base(slide)+".rels")
+	for _, rel := range pptxRelationships(files, relsName, path.Dir(slide)) {
+		if strings.HasSuffix(rel.Type, "/notesSlide") {
+			return files[rel.Target]
+		}
+	}
+	return nil
+}
+
+// drawingMLText extrae el texto de los parrafos (<a:p>) de una diapositiva; las celdas de
+// tablas se separan con " | ". Se omiten los campos de numero de diapositiva y fecha.
+func drawingMLText(data []byte) string {
+	var out strings.Builder
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	inText, inField, inCell := false, false, false
+
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "fld":
+				inField = true
+			case "br":
+				out.WriteString("\n")
+			case "tc":
+				inCell = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "fld":
+				inField = false
+			case "p":
+				if inCell {
+					out.WriteString(" ")
+				} else {
+					out.WriteString("\n")
+				}
+			case "tc":
+				inCell = false
+				out.WriteString(" | ")
+			case "tr":
+				out.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText && !inField {
+				out.Write(t)
+			}
+		}
+	}
+	return out.String()
+}
+
+// --- OpenDocument ---
+
+// extractODT devuelve el texto de un documento de texto. Si LibreOffice guardo los saltos
+// de pagina calculados (text:soft-page-break) se agregan las marcas [Pagina N].
+func (fp *FileProcessor) extractODT(content []byte) (string, int, error) {
+	data, err := odfContent(content, "ODT")
+	if err != nil {
+		return "", 0, err
+	}
+
+	var out strings.Builder
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	inBody, inCell := false, false
+	page := 1
+
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "text":
+				if t.Name.Space == odfOfficeNS {
+					inBody = true
+				}
+			case "soft-page-break":
+				page++
+				out.WriteString(fmt.Sprintf("\n[Pagina %d]\n", page))
+			case "s":
+				out.WriteString(strings.Repeat(" ", min(odfRepeat(t, "c", 1), maxRepeatCells)))
+			case "tab":
+				out.WriteString("\t")
+			case "line-break":
+				out.WriteString("\n")
+			case "table-cell":
+				inCell = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p", "h":
+				if inCell {
+					out.WriteString(" ")
+				} else {
+					out.WriteString("\n")
+				}
+			case "table-cell":
+				inCell = false
+				out.WriteString("| ")
+			case "table-row":
+				out.WriteString("\n")
+			}
+		case xml.CharData:
+			if inBody {
+				out.Write(t)
+			}
+		}
+	}
+
+	text := out.String()
+	if page == 1 {
+		return text, 0, nil
+	}
+	return "[Pagina 1]\n" + text, page, nil
+}
+
+// extractODS devuelve cada hoja precedida de [Hoja nombre] y sus filas no vacias
+func (fp *FileProcessor) extractODS(content []byte) (string, int, error) {
+	data, err := odfContent(content, "ODS")
+	if err != nil {
+		return "", 0, err
+	}
+
+	var out strings.Builder
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	sheets, row, rowsWritten := 0, 0, 0
+	var cells []string
+	var cell strings.Builder
+	cellRepeat, rowRepeat := 1, 1
+	inCell, inParagraph := false, false
+
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table":
+				if t.Name.Space != odfTableNS {
+					continue
+				}
+				sheets++
+				row, rowsWritten = 0, 0
+				out.WriteString(fmt.Sprintf("[Hoja %s]\n", odfAttr(t, "name")))
+			case "table-row":
+				cells = cells[:0]
+				rowRepeat = odfRepeat(t, "number-rows-repeated", 1)
+			case "table-cell", "covered-table-cell":
+				inCell = true
+				cell.Reset()
+				cellRepeat = odfRepeat(t, "number-columns-repeated", 1)
+			case "p":
+				if inCell {
+					if cell.Len() > 0 {
+						cell.WriteString(" ")
+					}
+					inParagraph = true
+				}
+			case "s":
+				if inParagraph {
+					cell.WriteString(strings.Repeat(" ", min(odfRepeat(t, "c", 1), maxRepeatCells)))
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				inParagraph = false
+			case "table-cell", "covered-table-cell":
+				inCell = false
+				value := strings.TrimSpace(cell.String())
+				// Las columnas vacias repetidas (hasta la ultima columna) no se expanden
+				if value == "" && cellRepeat > maxRepeatCells {
+					cellRepeat = 1
+				}
+				for i := 0; i < min(cellRepeat, maxRepeatCells); i++ {
+					cells = append(cells, value)
+				}
+			case "table-row":
+				for len(cells) > 0 && cells[len(cells)-1] == "" {
+					cells = cells[:len(cells)-1]
+				}
+				if len(cells) == 0 {
+					row += rowRepeat
+					continue
+				}
+				for i := 0; i < min(rowRepeat, maxRepeatCells); i++ {
+					row++
+					if rowsWritten < maxSheetRows {
+						out.WriteString(fmt.Sprintf("Fila %d: %s\n", row, strings.Join(cells, " | ")))
+					} else if rowsWritten == maxSheetRows {
+						out.WriteString("... (mas filas omitidas)\n")
+					}
+					rowsWritten++
+				}
+			case "table":
+				if t.Name.Space == odfTableNS {
+					out.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if inParagraph {
+				cell.Write(t)
+			}
+		}
+	}
+
+	if sheets == 0 {
+		return "", 0, fmt.Errorf("invalid ODS file: no sheets")
+	}
+	return out.String(), sheets, nil
+}
+
+const (
+	odfOfficeNS = "urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+	odfTableNS  = "urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+)
+
+func odfContent(content []byte, kind string) ([]byte, error) {
+	files, err := zipFiles(content, kind)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := files["content.xml"]
+	if !ok {
+		return nil, fmt.Errorf("invalid %s file: missing content.xml", kind)
+	}
+	return readZipFile(file)
+}
+
+func odfAttr(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func odfRepeat(start xml.StartElement, name string, def int) int {
+	n, err := strconv.Atoi(odfAttr(start, name))
+	if err != nil || n < 1 {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testZip arma un zip con los archivos indicados, por nombre
+func testZip(files map[string]string) []byte {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, content := range files {
+		f, _ := w.Create(name)
+		f.Write([]byte(content))
+	}
+	w.Close()
+	return b.Bytes()
+}
+
+func TestExtractOffice(t *testing.T) {
+	fp := NewFileProcessor()
+	extract := map[string]func([]byte) (string, int, error){
+		".pptx": fp.extractPPTX,
+		".odt":  fp.extractODT,
+		".ods":  fp.extractODS,
+	}
+
+	tests := []struct {
+		file    string
+		pages   int
+		want    []string
+		notWant []string
+	}{
+		{
+			// Orden de presentation.xml (no el de los nombres), notas, tablas y sin el
+			// numero de diapositiva de los campos
+			file:    "sample.pptx",
+			pages:   2,
+			want:    []string{"[Diapositiva 1]\nPrimera: Seguridad en planta", "Notas: Explicar el uso de EPP", "[Diapositiva 2]\nSegunda diapositiva\npunto 2", "c1  | c2"},
+			notWant: []string{"7"},
+		},
+		{
+			// Espacios repetidos (text:s), tabuladores, saltos de pagina y tablas
+			file:  "sample.odt",
+			pages: 2,
+			want:  []string{"[Pagina 1]\nInstruccion\nPaso   uno\tx", "[Pagina 2]\nPagina dos\na | b"},
+		},
+		{
+			// Las celdas y filas repetidas se expanden hasta un limite: la hoja declara
+			// mas de un millon de filas vacias
+			file:    "sample.ods",
+			pages:   2,
+			want:    []string{"[Hoja Defectos]\nFila 1: Parte | PPM\nFila 2: X1 | 5 | 5\nFila 3: X1 | 5 | 5", "[Hoja Vacia]"},
+			notWant: []string{"Fila 4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, pages, err := extract[tt.file[strings.LastIndex(tt.file, "."):]](data)
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if pages != tt.pages {
+				t.Errorf("paginas = %d, se esperaban %d", pages, tt.pages)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("falta %q en %q", want, text)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(text, notWant) {
+					t.Errorf("sobra %q en %q", notWant, text)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractOfficeMalformed(t *testing.T) {
+	fp := NewFileProcessor()
+	extract := map[string]func([]byte) (string, int, error){
+		".pptx": fp.extractPPTX,
+		".odt":  fp.extractODT,
+		".ods":  fp.extractODS,
+	}
+
+	type malformed struct {
+		name    string
+		ext     string
+		data    []byte
+		wantErr bool
+	}
+	tests := []malformed{
+		{"pptx vacio", ".pptx", nil, true},
+		{"pptx no es zip", ".pptx", []byte("PK\x03\x04 basura"), true},
+		{"pptx sin diapositivas", ".pptx", testZip(map[string]string{"ppt/presentation.xml": "<p/>"}), true},
+		{"odt sin content.xml", ".odt", testZip(map[string]string{"mimetype": "application/vnd.oasis.opendocument.text"}), true},
+		{"ods sin hojas", ".ods", testZip(map[string]string{"content.xml": "<office:document-content/>"}), true},
+		{
+			name: "pptx con XML truncado",
+			ext:  ".pptx",
+			data: testZip(map[string]string{"ppt/slides/slide1.xml": `<p:sld><p:sp><a:t>Hola`}),
+		},
+		{
+			name: "pptx con relaciones rotas",
+			ext:  ".pptx",
+			data: testZip(map[string]string{
+				"ppt/presentation.xml":             `<p:presentation><p:sldIdLst><p:sldId r:id="rId9"/></p:sldIdLst></p:presentation>`,
+				"ppt/_rels/presentation.xml.rels":  `<Relationships><Relationship Id="rId9" Target="../../../etc/passwd"/>`,
+				"ppt/slides/slide1.xml":            `<p:sld><a:t>Diapositiva</a:t></p:sld>`,
+				"ppt/slides/_rels/slide1.xml.rels": `<Relationships><Relationship Type="notesSlide" Target="../notesSlides/no-existe.xml"/></Relationships>`,
+			}),
+		},
+		{
+			name: "ods con repeticiones enormes",
+			ext:  ".ods",
+			data: testZip(map[string]string{"content.xml": `<office:document-content xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"><table:table table:name="H"><table:table-row table:number-rows-repeated="2147483647"><table:table-cell table:number-columns-repeated="2147483647"><text:p>x</text:p></table:table-cell></table:table-row></table:table></office:document-content>`}),
+		},
+	}
+
+	// Cada truncamiento de los archivos de ejemplo
+	for _, file := range []string{"sample.pptx", "sample.odt", "sample.ods"} {
+		data, err := os.ReadFile("testdata/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < len(data); n += 11 {
+			tests = append(tests, malformed{fmt.Sprintf("%s truncado a %d bytes", file, n), file[strings.LastIndex(file, "."):], data[:n], true})
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := extract[tt.ext](tt.data)
+			if tt.wantErr && err == nil {
+				t.Errorf("se esperaba un error")
+			}
+		})
+	}
+}
@@ -8,429 +8,224 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"strings"
-	"sync"
 	"time"
-
-	"chat-empleados/internal/config"
-)
-
-var (
-	ErrOllamaUnavailable = errors.New("ollama no disponible")
-	ErrMaxRetriesReached = errors.New("maximo de reintentos alcanzado")
 )
 
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type ChatRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
-	Options  *Options  `json:"options,omitempty"`
+type ollamaChatRequest struct {
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  *ollamaOptions `json:"options,omitempty"`
 }
 
-type Options struct {
+type ollamaOptions struct {
 	Temperature float64 `json:"temperature,omitempty"`
 	TopP        float64 `json:"top_p,omitempty"`
 	TopK        int     `json:"top_k,omitempty"`
 	NumCtx      int     `json:"num_ctx,omitempty"`
+	NumPredict  int     `json:"num_predict,omitempty"`
 }
 
-type ChatResponse struct {
+// ollamaChatResponse respuesta de /api/chat; en streaming llega una por linea
+type ollamaChatResponse struct {
 	Model     string  `json:"model"`
 	CreatedAt string  `json:"created_at"`
 	Message   Message `json:"message"`
 	Done      bool    `json:"done"`
 }
 
-type StreamChunk struct {
-	Model     string  `json:"model"`
-	CreatedAt string  `json:"created_at"`
-	Message   Message `json:"message"`
-	Done      bool    `json:"done"`
+type ollamaModelsResponse struct {
+	Models []LLMModel `json:"models"`
 }
 
-type OllamaService struct {
-	cfg          *config.Config
-	client       *http.Client
-	security     *SecurityService
-	available    bool
-	availMutex   sync.RWMutex
-	lastCheck    time.Time
-	checkPeriod  time.Duration
-	currentModel string
-	modelMutex   sync.RWMutex
+type ollamaEmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
 }
 
-type OllamaModel struct {
-	Name       string `json:"name"`
-	ModifiedAt string `json:"modified_at"`
-	Size       int64  `json:"size"`
+type ollamaEmbeddingResponse struct {
+	Embedding []float64 `json:"embedding"`
 }
 
-type OllamaModelsResponse struct {
-	Models []OllamaModel `json:"models"`
+// OllamaProvider cliente de la API nativa de Ollama (/api/chat, /api/tags)
+type OllamaProvider struct {
+	name         string
+	baseURL      string
+	apiKey       string
+	client       *http.Client
+	streamClient *http.Client
 }
 
-func NewOllamaService(cfg *config.Config, security *SecurityService) *OllamaService {
-	svc := &OllamaService{
-		cfg: cfg,
+func NewOllamaProvider(name, baseURL string, timeout time.Duration, apiKey string) *OllamaProvider {
+	transport := &http.Transport{
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+		DisableCompression:  true,
+		MaxIdleConnsPerHost: 10,
+	}
+	return &OllamaProvider{
+		name:    name,
+		baseURL: baseURL,
+		apiKey:  apiKey,
 		client: &http.Client{
-			Timeout: cfg.OllamaTimeout,
-			Transport: &http.Transport{
-				MaxIdleConns:        10,
-				IdleConnTimeout:     90 * time.Second,
-				DisableCompression:  true,
-				MaxIdleConnsPerHost: 10,
-			},
+			Timeout:   timeout,
+			Transport: transport,
 		},
-		security:     security,
-		checkPeriod:  30 * time.Second,
-		currentModel: cfg.OllamaModel,
-	}
-
-	// Verificar disponibilidad inicial
-	go svc.checkAvailability()
-
-	return svc
-}
-
-func (o *OllamaService) checkAvailability() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	available := o.pingOllama(ctx)
-
-	o.availMutex.Lock()
-	o.available = available
-	o.lastCheck = time.Now()
-	o.availMutex.Unlock()
-
-	if available {
-		log.Printf("[INFO] Ollama disponible en %s", o.cfg.OllamaURL)
-	} else {
-		log.Printf("[WARN] Ollama no disponible en %s", o.cfg.OllamaURL)
+		// Cliente especial para streaming sin timeout global
+		streamClient: &http.Client{Transport: transport},
 	}
 }
 
-func (o *OllamaService) pingOllama(ctx context.Context) bool {
-	req, err := http.NewRequestWithContext(ctx, "GET", o.cfg.OllamaURL+"/api/tags", nil)
-	if err != nil {
-		return false
-	}
-
-	resp, err := o.client.Do(req)
+func (p *OllamaProvider) Chat(ctx context.Context, req LLMRequest) (string, error) {
+	resp, err := p.post(ctx, p.client, "/api/chat", p.chatRequest(req, false))
 	if err != nil {
-		return false
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	return resp.StatusCode == http.StatusOK
-}
-
-func (o *OllamaService) Chat(ctx context.Context, messages []Message, userID int64) (string, *FilterResult, error) {
-	if len(messages) > 0 {
-		lastMsg := messages[len(messages)-1]
-		if lastMsg.Role == "user" {
-			if filterResult := o.security.CheckInput(ctx, lastMsg.Content); filterResult != nil {
-				if filterResult.Blocked {
-					log.Printf("[SECURITY] Usuario %d bloqueado por filtro '%s': %s",
-						userID, filterResult.FilterName, filterResult.MatchedText)
-					return "", filterResult, nil
-				}
-			}
-		}
-	}
-
-	messagesWithSystem := make([]Message, 0, len(messages)+1)
-	messagesWithSystem = append(messagesWithSystem, Message{
-		Role:    "system",
-		Content: o.cfg.SystemPrompt,
-	})
-	messagesWithSystem = append(messagesWithSystem, messages...)
-
-	reqBody := ChatRequest{
-		Model:    o.GetModel(),
-		Messages: messagesWithSystem,
-		Stream:   false,
-		Options: &Options{
-			Temperature: 0.7,
-			TopP:        0.9,
-			NumCtx:      4096,
-		},
+	var chatResp ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return "", fmt.Errorf("error decodificando respuesta: %w", err)
 	}
+	return chatResp.Message.Content, nil
+}
 
-	jsonBody, err := json.Marshal(reqBody)
+func (p *OllamaProvider) ChatStream(ctx context.Context, req LLMRequest, onChunk func(string) error) error {
+	resp, err := p.post(ctx, p.streamClient, "/api/chat", p.chatRequest(req, true))
 	if err != nil {
-		return "", nil, fmt.Errorf("error serializando request: %w", err)
+		return err
 	}
+	defer resp.Body.Close()
 
-	// Implementar retry con backoff exponencial
-	var resp *http.Response
-	var lastErr error
-
-	for attempt := 0; attempt < o.cfg.OllamaRetries; attempt++ {
-		if attempt > 0 {
-			// Backoff exponencial: 1s, 2s, 4s...
-			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
-			log.Printf("[INFO] Reintentando conexion a Ollama (intento %d/%d) en %v...",
-				attempt+1, o.cfg.OllamaRetries, backoff)
-			select {
-			case <-ctx.Done():
-				return "", nil, ctx.Err()
-			case <-time.After(backoff):
-			}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
 		}
 
-		req, err := http.NewRequestWithContext(ctx, "POST", o.cfg.OllamaURL+"/api/chat", bytes.NewReader(jsonBody))
-		if err != nil {
-			lastErr = fmt.Errorf("error creando request: %w", err)
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
 			continue
 		}
-		req.Header.Set("Content-Type", "application/json")
 
-		resp, err = o.client.Do(req)
-		if err != nil {
-			lastErr = fmt.Errorf("error conectando con Ollama: %w", err)
-			o.markUnavailable()
-			continue
+		if chunk.Message.Content != "" {
+			if err := onChunk(chunk.Message.Content); err != nil {
+				return err
+			}
 		}
 
-		if resp.StatusCode == http.StatusOK {
-			lastErr = nil
+		if chunk.Done {
 			break
 		}
+	}
 
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		lastErr = fmt.Errorf("ollama error %d: %s", resp.StatusCode, string(body))
+	return scanner.Err()
+}
 
-		// Si es un error de servidor (5xx), reintentar
-		if resp.StatusCode >= 500 {
-			continue
-		}
-		// Si es error de cliente (4xx), no reintentar
-		break
+func (p *OllamaProvider) chatRequest(req LLMRequest, stream bool) ollamaChatRequest {
+	return ollamaChatRequest{
+		Model:    req.Model,
+		Messages: req.Messages,
+		Stream:   stream,
+		Options: &ollamaOptions{
+			Temperature: req.Temperature,
+			TopP:        req.TopP,
+			NumCtx:      req.NumCtx,
+			NumPredict:  req.MaxTokens,
+		},
 	}
+}
 
-	if lastErr != nil {
-		return "", nil, lastErr
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]LLMModel, error) {
+	resp, err := p.get(ctx, "/api/tags")
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	var chatResp ChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		return "", nil, fmt.Errorf("error decodificando respuesta: %w", err)
-	}
-
-	response := chatResp.Message.Content
-	o.markAvailable()
-
-	if filterResult := o.security.CheckOutput(ctx, response); filterResult != nil {
-		if filterResult.Blocked {
-			log.Printf("[SECURITY] Respuesta IA bloqueada por filtro '%s'", filterResult.FilterName)
-			return "Lo siento, no puedo proporcionar esa informacion.", filterResult, nil
-		}
+	var result ollamaModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
 	}
 
-	return response, nil, nil
-}
-
-func (o *OllamaService) markAvailable() {
-	o.availMutex.Lock()
-	o.available = true
-	o.lastCheck = time.Now()
-	o.availMutex.Unlock()
-}
-
-func (o *OllamaService) markUnavailable() {
-	o.availMutex.Lock()
-	o.available = false
-	o.lastCheck = time.Now()
-	o.availMutex.Unlock()
+	return result.Models, nil
 }
 
-func (o *OllamaService) ChatStream(ctx context.Context, messages []Message, userID int64, onChunk func(string) error) (*FilterResult, error) {
-	return o.ChatStreamWithModel(ctx, messages, userID, "", onChunk)
+func (p *OllamaProvider) Ping(ctx context.Context) error {
+	resp, err := p.get(ctx, "/api/tags")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
 }
 
-func (o *OllamaService) ChatStreamWithModel(ctx context.Context, messages []Message, userID int64, model string, onChunk func(string) error) (*FilterResult, error) {
-	log.Printf("[DEBUG] ChatStream: iniciando para usuario %d", userID)
-
-	if len(messages) > 0 {
-		lastMsg := messages[len(messages)-1]
-		if lastMsg.Role == "user" {
-			if filterResult := o.security.CheckInput(ctx, lastMsg.Content); filterResult != nil {
-				if filterResult.Blocked {
-					log.Printf("[SECURITY] Usuario %d bloqueado por filtro '%s': %s",
-						userID, filterResult.FilterName, filterResult.MatchedText)
-					return filterResult, nil
-				}
-			}
-		}
+// Embed obtiene el vector de embeddings de un texto usando /api/embeddings
+func (p *OllamaProvider) Embed(ctx context.Context, model, text string) ([]float64, error) {
+	resp, err := p.post(ctx, p.client, "/api/embeddings", ollamaEmbeddingRequest{
+		Model:  model,
+		Prompt: text,
+	})
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	// Usar modelo específico o el global
-	useModel := model
-	if useModel == "" {
-		useModel = o.GetModel()
+	var result ollamaEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decodificando embeddings: %w", err)
 	}
-
-	messagesWithSystem := make([]Message, 0, len(messages)+1)
-	messagesWithSystem = append(messagesWithSystem, Message{
-		Role:    "system",
-		Content: o.cfg.SystemPrompt,
-	})
-	messagesWithSystem = append(messagesWithSystem, messages...)
-
-	reqBody := ChatRequest{
-		Model:    useModel,
-		Messages: messagesWithSystem,
-		Stream:   true,
-		Options: &Options{
-			Temperature: 0.7,
-			TopP:        0.9,
-			NumCtx:      4096,
-		},
+	if len(result.Embedding) == 0 {
+		return nil, errors.New("respuesta de embeddings vacia")
 	}
 
-	jsonBody, err := json.Marshal(reqBody)
+	return result.Embedding, nil
+}
+
+// post envia body como JSON; devuelve la respuesta solo si el status es 200
+func (p *OllamaProvider) post(ctx context.Context, client *http.Client, path string, body any) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("error serializando request: %w", err)
 	}
 
-	log.Printf("[DEBUG] ChatStream: enviando request a Ollama...")
-
-	// Cliente especial para streaming sin timeout global
-	streamClient := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:        10,
-			IdleConnTimeout:     90 * time.Second,
-			DisableCompression:  true,
-			MaxIdleConnsPerHost: 10,
-		},
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", o.cfg.OllamaURL+"/api/chat", bytes.NewReader(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+path, bytes.NewReader(jsonBody))
 	if err != nil {
 		return nil, fmt.Errorf("error creando request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := streamClient.Do(req)
-	if err != nil {
-		log.Printf("[DEBUG] ChatStream: error conectando: %v", err)
-		return nil, fmt.Errorf("error conectando con Ollama: %w", err)
-	}
-	defer resp.Body.Close()
-
-	log.Printf("[DEBUG] ChatStream: respuesta recibida, status=%d", resp.StatusCode)
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("ollama error %d: %s", resp.StatusCode, string(body))
-	}
-
-	scanner := bufio.NewScanner(resp.Body)
-	var fullResponse strings.Builder
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-
-		var chunk StreamChunk
-		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
-			continue
-		}
-
-		content := chunk.Message.Content
-		fullResponse.WriteString(content)
-
-		if err := onChunk(content); err != nil {
-			return nil, err
-		}
-
-		if chunk.Done {
-			break
-		}
-	}
-
-	finalResponse := fullResponse.String()
-	if filterResult := o.security.CheckOutput(ctx, finalResponse); filterResult != nil {
-		if filterResult.Blocked {
-			log.Printf("[SECURITY] Respuesta IA streaming bloqueada por filtro '%s'", filterResult.FilterName)
-			return filterResult, nil
-		}
-	}
-
-	return nil, scanner.Err()
+	return doProviderRequest(ctx, client, req, p.name, p.apiKey)
 }
 
-func (o *OllamaService) IsAvailable(ctx context.Context) bool {
-	o.availMutex.RLock()
-	lastCheck := o.lastCheck
-	available := o.available
-	o.availMutex.RUnlock()
-
-	// Si la última verificación fue hace menos del período de check, usar el valor cacheado
-	if time.Since(lastCheck) < o.checkPeriod {
-		return available
+func (p *OllamaProvider) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creando request: %w", err)
 	}
-
-	// Verificar de nuevo
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	available = o.pingOllama(ctx)
-
-	o.availMutex.Lock()
-	o.available = available
-	o.lastCheck = time.Now()
-	o.availMutex.Unlock()
-
-	return available
-}
-
-func (o *OllamaService) GetModel() string {
-	o.modelMutex.RLock()
-	defer o.modelMutex.RUnlock()
-	return o.currentModel
-}
-
-func (o *OllamaService) SetModel(model string) {
-	o.modelMutex.Lock()
-	defer o.modelMutex.Unlock()
-	o.currentModel = model
-	log.Printf("[INFO] Modelo de IA cambiado a: %s", model)
+	return doProviderRequest(ctx, p.client, req, p.name, p.apiKey)
 }
 
-func (o *OllamaService) ListModels(ctx context.Context) ([]OllamaModel, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", o.cfg.OllamaURL+"/api/tags", nil)
-	if err != nil {
-		return nil, err
+// doProviderRequest ejecuta la peticion a un servidor de inferencia. Si no responde el
+// error envuelve ErrLLMUnavailable; si responde con otro status que 200, es un ProviderError.
+func doProviderRequest(ctx context.Context, client *http.Client, req *http.Request, provider, apiKey string) (*http.Response, error) {
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
 	}
 
-	resp, err := o.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: error conectando con %s: %v", ErrLLMUnavailable, provider, err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error listing models: %d", resp.StatusCode)
-	}
-
-	var result OllamaModelsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, &ProviderError{Provider: provider, Status: resp.StatusCode, Body: string(body)}
 	}
-
-	return result.Models, nil
+	return resp, nil
 }
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type openAIChatRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream"`
+	Temperature float64   `json:"temperature,omitempty"`
+	TopP        float64   `json:"top_p,omitempty"`
+	MaxTokens   int       `json:"max_tokens,omitempty"`
+}
+
+// openAIChatResponse respuesta de /v1/chat/completions; en streaming cada evento trae
+// el fragmento en delta en lugar de message
+type openAIChatResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+		Delta   Message `json:"delta"`
+	} `json:"choices"`
+}
+
+type openAIModelsResponse struct {
+	Data []struct {
+		ID      string `json:"id"`
+		Created int64  `json:"created"`
+	} `json:"data"`
+}
+
+// OpenAIProvider cliente de servidores con la API compatible con OpenAI
+// (/v1/chat/completions, /v1/models): llama.cpp server, vLLM, LocalAI. La ventana de
+// contexto la fija el servidor al cargar el modelo, no se envia por peticion.
+type OpenAIProvider struct {
+	name         string
+	baseURL      string
+	apiKey       string
+	client       *http.Client
+	streamClient *http.Client
+}
+
+func NewOpenAIProvider(name, baseURL string, timeout time.Duration, apiKey string) *OpenAIProvider {
+	transport := &http.Transport{
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConnsPerHost: 10,
+	}
+	return &OpenAIProvider{
+		name: name,
+		// Se acepta la URL con o sin /v1 al final
+		baseURL: strings.TrimSuffix(strings.TrimRight(baseURL, "/"), "/v1"),
+		apiKey:  apiKey,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		streamClient: &http.Client{Transport: transport},
+	}
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, req LLMRequest) (string, error) {
+	resp, err := p.post(ctx, p.client, p.chatRequest(req, false))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var chatResp openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+		return "", fmt.Errorf("error decodificando respuesta: %w", err)
+	}
+	if len(chatResp.Choices) == 0 {
+		return "", fmt.Errorf("respuesta de %s sin choices", p.name)
+	}
+	return chatResp.Choices[0].Message.Content, nil
+}
+
+// ChatStream lee los eventos SSE "data: {...}" hasta "data: [DONE]"
+func (p *OpenAIProvider) ChatStream(ctx context.Context, req LLMRequest, onChunk func(string) error) error {
+	resp, err := p.post(ctx, p.streamClient, p.chatRequest(req, true))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil || len(chunk.Choices) == 0 {
+			continue
+		}
+
+		if content := chunk.Choices[0].Delta.Content; content != "" {
+			if err := onChunk(content); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (p *OpenAIProvider) chatRequest(req LLMRequest, stream bool) openAIChatRequest {
+	return openAIChatRequest{
+		Model:       req.Model,
+		Messages:    req.Messages,
+		Stream:      stream,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   req.MaxTokens,
+	}
+}
+
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]LLMModel, error) {
+	resp, err := p.get(ctx, "/v1/models")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result openAIModelsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	models := make([]LLMModel, 0, len(result.Data))
+	for _, m := range result.Data {
+		model := LLMModel{Name: m.ID}
+		if m.Created > 0 {
+			model.ModifiedAt = time.Unix(m.Created, 0).UTC().Format(time.RFC3339)
+		}
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+func (p *OpenAIProvider) Ping(ctx context.Context) error {
+	resp, err := p.get(ctx, "/v1/models")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *OpenAIProvider) post(ctx context.Context, client *http.Client, body openAIChatRequest) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error serializando request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/v1/chat/completions", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if body.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	return doProviderRequest(ctx, client, req, p.name, p.apiKey)
+}
+
+func (p *OpenAIProvider) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creando request: %w", err)
+	}
+	return doProviderRequest(ctx, p.client, req, p.name, p.apiKey)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// minStreamHoldback bytes minimos retenidos mientras llega la respuesta; cubre patrones
+// regex tipicos (tarjetas, cuentas, montos) cuya longitud no se conoce de antemano
+const minStreamHoldback = 64
+
+// streamLookback bytes ya enviados que se vuelven a revisar con cada fragmento, para
+// detectar coincidencias que empiezan antes de lo retenido
+const streamLookback = 256
+
+// OutputStream aplica los filtros de salida a una respuesta que llega por fragmentos.
+// Retiene el final del texto hasta que ningun patron pueda completarse con lo que falta,
+// de modo que lo bloqueado no llega al navegador antes de detectarse y lo que se redacta
+// sale ya reemplazado.
+type OutputStream struct {
+	security *SecurityService
+	ctx      context.Context
+	buf      []byte
+	sent     int
+	out      strings.Builder
+	holdback int
+}
+
+// NewOutputStream crea el filtro incremental para una respuesta de la IA
+func (s *SecurityService) NewOutputStream(ctx context.Context) *OutputStream {
+	return &OutputStream{
+		security: s,
+		ctx:      ctx,
+		holdback: s.streamHoldback(),
+	}
+}
+
+// Write agrega un fragmento y devuelve el texto (ya redactado) que puede enviarse al cliente.
+// Si un filtro de bloqueo coincide devuelve su resultado y la respuesta debe abortarse.
+func (o *OutputStream) Write(chunk string) (string, *FilterResult) {
+	o.buf = append(o.buf, chunk...)
+
+	start := max(0, o.sent-streamLookback)
+	// La revision empieza en un caracter completo, o los filtros verian bytes sueltos
+	for start > 0 && !utf8.RuneStart(o.buf[start]) {
+		start--
+	}
+	window := o.security.redact(string(o.buf[start:]), "output")
+	if result := o.security.checkBlocking(window, "output"); result != nil {
+		return "", result
+	}
+
+	release := len(o.buf) - o.holdback
+	// No cortar un caracter UTF-8 a la mitad
+	for release > o.sent && !utf8.RuneStart(o.buf[release]) {
+		release--
+	}
+	if release <= o.sent {
+		return "", nil
+	}
+
+	pending := string(o.buf[o.sent:])
+	release = o.sent + o.security.redactionBoundary(pending, release-o.sent, "output")
+
+	return o.release(release), nil
+}
+
+// Flush revisa la respuesta completa, libera el texto retenido y devuelve la revision con
+// las coincidencias. review.Content es la respuesta completa redactada: una coincidencia
+// mas larga que la ventana pudo enviarse sin redactar, asi que puede diferir de Sent.
+func (o *OutputStream) Flush() (string, *ContentReview) {
+	review := o.security.ReviewOutput(o.ctx, string(o.buf))
+	if review.Blocked != nil {
+		return "", review
+	}
+
+	rest := o.release(len(o.buf))
+	return rest, review
+}
+
+// Sent devuelve todo el texto enviado hasta ahora
+func (o *OutputStream) Sent() string {
+	return o.out.String()
+}
+
+// release redacta y marca como enviado el texto hasta la posicion indicada
+func (o *OutputStream) release(until int) string {
+	out := o.security.redact(string(o.buf[o.sent:until]), "output")
+	o.sent = until
+	o.out.WriteString(out)
+	return out
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// newTestSecurity arma un SecurityService con filtros en memoria, preparados igual que en
+// ReloadFilters
+func newTestSecurity(filters ...SecurityFilter) *SecurityService {
+	for i := range filters {
+		f := &filters[i]
+		switch f.FilterType {
+		case "regex":
+			f.compiled = regexp.MustCompile(f.Pattern)
+		case "keyword":
+			f.keywords = strings.Split(strings.ToLower(f.Pattern), ",")
+			for j := range f.keywords {
+				f.keywords[j] = strings.TrimSpace(f.keywords[j])
+			}
+		}
+		f.matcher = f.buildMatcher()
+	}
+	return &SecurityService{filters: filters, enabled: true}
+}
+
+func TestOutputStreamBlocksKeywordSplitAcrossChunks(t *testing.T) {
+	security := newTestSecurity(SecurityFilter{
+		ID: 1, Name: "proyecto", FilterType: "keyword", Pattern: "proyecto halcon",
+		Action: "block", AppliesTo: "output",
+	})
+	text := strings.Repeat("Texto de relleno sin nada sensible. ", 4) + "El proyecto halcon arranca en marzo."
+	keywordAt := strings.Index(text, "proyecto halcon")
+
+	// El corte entre fragmentos cae en cada posicion posible, incluida dentro de la palabra
+	for cut := 1; cut < len(text); cut++ {
+		stream := security.NewOutputStream(context.Background())
+
+		sent, result := stream.Write(text[:cut])
+		if result == nil {
+			more, second := stream.Write(text[cut:])
+			sent += more
+			result = second
+		}
+		if result == nil || !result.Blocked {
+			t.Fatalf("corte %d: la respuesta no se bloqueo", cut)
+		}
+		if len(sent) > keywordAt {
+			t.Fatalf("corte %d: se envio %q, que llega hasta la palabra bloqueada", cut, sent)
+		}
+	}
+}
+
+func TestOutputStreamHoldsBackUntilFlush(t *testing.T) {
+	security := newTestSecurity(SecurityFilter{
+		ID: 1, Name: "clave", FilterType: "keyword", Pattern: "clave de acceso maestra del sistema de nominas",
+		Action: "block", AppliesTo: "output",
+	})
+	stream := security.NewOutputStream(context.Background())
+	holdback := security.streamHoldback()
+	if holdback != minStreamHoldback {
+		t.Fatalf("holdback = %d, se esperaba el minimo %d", holdback, minStreamHoldback)
+	}
+
+	// Mientras no se supere lo retenido no sale nada
+	short := strings.Repeat("a", holdback)
+	if sent, result := stream.Write(short); sent != "" || result != nil {
+		t.Fatalf("Write(%d bytes) = %q, %v; se esperaba retenerlo todo", len(short), sent, result)
+	}
+
+	// Lo que excede lo retenido se libera, sin partir caracteres UTF-8
+	sent, result := stream.Write("ñññ")
+	if result != nil {
+		t.Fatalf("bloqueo inesperado: %v", result)
+	}
+	if sent != strings.Repeat("a", 6) {
+		t.Fatalf("Write libero %q, se esperaban los 6 bytes que exceden lo retenido", sent)
+	}
+
+	rest, review := stream.Flush()
+	if review.Blocked != nil {
+		t.Fatalf("Flush bloqueo: %v", review.Blocked)
+	}
+	if sent+rest != short+"ñññ" {
+		t.Fatalf("texto enviado %q, se esperaba %q", sent+rest, short+"ñññ")
+	}
+	if review.Content != sent+rest {
+		t.Fatalf("review.Content = %q, se esperaba lo enviado", review.Content)
+	}
+}
+
+func TestStreamHoldbackCoversLongKeywords(t *testing.T) {
+	long := strings.Repeat("x", 2*minStreamHoldback)
+	security := newTestSecurity(
+		SecurityFilter{ID: 1, Name: "corta", FilterType: "keyword", Pattern: "abc", Action: "block", AppliesTo: "output"},
+		SecurityFilter{ID: 2, Name: "larga", FilterType: "keyword", Pattern: "abc, " + long, Action: "warn", AppliesTo: "output"},
+	)
+	if got := security.streamHoldback(); got != len(long) {
+		t.Fatalf("streamHoldback() = %d, se esperaba %d", got, len(long))
+	}
+}
+
+func TestOutputStreamMasksMatchSplitAcrossChunks(t *testing.T) {
+	security := newTestSecurity(SecurityFilter{
+		ID: 1, Name: "tarjeta", FilterType: "regex", Pattern: `\b(?:\d{4}[-\s]?){3}\d{4}\b`,
+		Action: "mask", AppliesTo: "output",
+	})
+	text := "Tu tarjeta 4111 1111 1111 1111 quedo registrada. " + strings.Repeat("Gracias. ", 10)
+
+	for cut := 1; cut < len(text); cut++ {
+		stream := security.NewOutputStream(context.Background())
+		sent, result := stream.Write(text[:cut])
+		more, second := stream.Write(text[cut:])
+		rest, review := stream.Flush()
+		if result != nil || second != nil || review.Blocked != nil {
+			t.Fatalf("corte %d: bloqueo inesperado", cut)
+		}
+
+		sent += more + rest
+		if strings.Contains(sent, "4111 1111") || !strings.Contains(sent, "**** **** **** 1111") {
+			t.Fatalf("corte %d: se envio %q", cut, sent)
+		}
+		if review.Content != sent {
+			t.Fatalf("corte %d: review.Content = %q, se esperaba lo enviado %q", cut, review.Content, sent)
+		}
+	}
+}
+
+func TestOutputStreamFlushRedactsMatchLongerThanLookback(t *testing.T) {
+	security := newTestSecurity(SecurityFilter{
+		ID: 1, Name: "llave", FilterType: "regex", Pattern: `BEGIN KEY [A-Za-z0-9]+ END KEY`,
+		Action: "redact", AppliesTo: "output",
+	})
+	key := "BEGIN KEY " + strings.Repeat("A1b2", streamLookback/2) + " END KEY"
+	text := "Aqui esta la llave: " + key + " y nada mas."
+
+	// La coincidencia es mas larga que la ventana: su inicio ya salio cuando se completa
+	stream := security.NewOutputStream(context.Background())
+	var sent strings.Builder
+	for start := 0; start < len(text); start += 16 {
+		out, result := stream.Write(text[start:min(start+16, len(text))])
+		if result != nil {
+			t.Fatalf("bloqueo inesperado: %v", result)
+		}
+		sent.WriteString(out)
+	}
+	rest, review := stream.Flush()
+	sent.WriteString(rest)
+
+	if sent.String() != stream.Sent() {
+		t.Fatalf("Sent() = %q, se esperaba %q", stream.Sent(), sent.String())
+	}
+	want := "Aqui esta la llave: [REDACTADO:llave] y nada mas."
+	if review.Content != want {
+		t.Fatalf("review.Content = %q, se esperaba %q", review.Content, want)
+	}
+	if len(review.Hits) != 1 || review.Hits[0].Count != 1 {
+		t.Fatalf("review.Hits = %+v, se esperaba una coincidencia", review.Hits)
+	}
+}
+
+func TestOutputStreamLookbackStartsOnRune(t *testing.T) {
+	security := newTestSecurity(SecurityFilter{
+		ID: 1, Name: "clave", FilterType: "regex", Pattern: `ñ[a-z]{300,}!`,
+		Action: "block", AppliesTo: "output",
+	})
+	stream := security.NewOutputStream(context.Background())
+
+	// Con 319 letras despues de la ñ, lo enviado deja a la ñ justo un byte antes de la
+	// ventana de revision: la ventana empezaria en su segundo byte
+	first := "Hola. ñ" + strings.Repeat("a", 319)
+	if _, result := stream.Write(first); result != nil {
+		t.Fatalf("bloqueado antes de completar el patron")
+	}
+	if start := stream.sent - streamLookback; first[start-1:start+1] != "ñ" {
+		t.Fatalf("la ventana empieza en %d, fuera del caso que se prueba", start)
+	}
+	if _, result := stream.Write("!"); result == nil {
+		t.Fatal("la coincidencia que empieza en un caracter de varios bytes no se bloqueo")
+	}
+}
@@ -0,0 +1,1176 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Extraccion de texto de PDF sin dependencias externas. No es un lector completo:
+// indexa los objetos recorriendo el archivo (no depende de la tabla xref, asi tolera
+// archivos danados o con actualizaciones incrementales), descomprime los streams
+// FlateDecode, recorre el arbol de paginas en orden e interpreta los operadores de
+// texto del contenido. Los PDF escaneados (solo imagenes) no tienen texto que extraer.
+
+var (
+	ErrPDFEncrypted = errors.New("el PDF esta protegido con contrasena")
+	ErrPDFNoText    = errors.New("el PDF no contiene texto extraible (posiblemente escaneado)")
+	ErrPDFTooLarge  = errors.New("el PDF excede el limite de datos descomprimidos")
+)
+
+const (
+	pdfMaxStreamSize = 32 * 1024 * 1024 // limite al descomprimir un stream
+	pdfMaxDepth      = 32               // profundidad maxima del arbol de paginas y XObjects
+	pdfMaxNesting    = 64               // anidamiento maximo de arreglos y diccionarios
+	// pdfMaxDocumentSize limite de bytes descomprimidos e interpretados en todo el documento;
+	// cubre los streams repetidos en /Contents, las cadenas de filtros y los XObjects que
+	// se reutilizan en cada pagina
+	pdfMaxDocumentSize = 128 * 1024 * 1024
+)
+
+type (
+	pdfName    string
+	pdfString  []byte
+	pdfKeyword string
+	pdfArray   []any
+	pdfDict    map[string]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		num  int // numero de objeto, para no descomprimirlo dos veces
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+// pdfObjHeader encuentra el inicio de cada objeto indirecto ("12 0 obj")
+var pdfObjHeader = regexp.MustCompile(`(?:^|[^0-9])(\d{1,10})\s+(\d{1,5})\s+obj\b`)
+
+// pdfDocument objetos indexados de un PDF
+type pdfDocument struct {
+	objects   map[int]any
+	fonts     map[pdfRef]*pdfFont
+	decoded   map[int][]byte // streams ya descomprimidos, por numero de objeto
+	budget    int            // bytes que aun pueden descomprimirse o interpretarse
+	encrypted bool
+}
+
+// extractPDF devuelve el texto de cada pagina precedido de su marca [Pagina N] y el numero de paginas
+func (fp *FileProcessor) extractPDF(content []byte) (string, int, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(content, "\x00\t\r\n "), []byte("%PDF")) {
+		return "", 0, errors.New("invalid PDF file")
+	}
+
+	doc := parsePDF(content)
+	if doc.encrypted {
+		return "", 0, ErrPDFEncrypted
+	}
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return "", 0, errors.New("el PDF no tiene paginas")
+	}
+
+	var textBuilder strings.Builder
+	hasText := false
+	for i, page := range pages {
+		textBuilder.WriteString(fmt.Sprintf("[Pagina %d]\n", i+1))
+
+		// El texto se trunca despues; no vale la pena interpretar el resto de paginas
+		if textBuilder.Len() > MaxTextLength*2 {
+			continue
+		}
+
+		resources, _ := doc.resolve(page["Resources"]).(pdfDict)
+		text := doc.pageText(doc.contents(page["Contents"]), resources, 0)
+		if strings.TrimSpace(text) != "" {
+			hasText = true
+		}
+		textBuilder.WriteString(text)
+		textBuilder.WriteString("\n\n")
+	}
+
+	if !hasText {
+		if doc.budget == 0 {
+			return "", len(pages), ErrPDFTooLarge
+		}
+		return "", len(pages), ErrPDFNoText
+	}
+	return textBuilder.String(), len(pages), nil
+}
+
+// parsePDF indexa todos los objetos del archivo, incluidos los de object streams
+func parsePDF(data []byte) *pdfDocument {
+	doc := &pdfDocument{
+		objects: make(map[int]any),
+		fonts:   make(map[pdfRef]*pdfFont),
+		decoded: make(map[int][]byte),
+		budget:  pdfMaxDocumentSize,
+	}
+
+	// Los objetos posteriores reemplazan a los anteriores (actualizaciones incrementales).
+	// Cada objeto se lee solo hasta la siguiente cabecera, y las cabeceras que aparecen
+	// dentro de los datos de un stream se ignoran: un objeto sin cerrar no obliga a
+	// recorrer el resto del archivo por cada cabecera que le sigue.
+	headers := pdfObjHeader.FindAllSubmatchIndex(data, -1)
+	lastEndstream := bytes.LastIndex(data, []byte("endstream"))
+	streamEnd := 0
+	for i, m := range headers {
+		if m[0] < streamEnd {
+			continue
+		}
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		end := len(data)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		lex := &pdfLexer{data: data[:end], pos: m[1]}
+		obj, ok := lex.parseObject()
+		if !ok {
+			continue
+		}
+		if dict, isDict := obj.(pdfDict); isDict && lex.pos < lastEndstream {
+			// Los datos del stream si pueden contener algo parecido a una cabecera
+			stream := &pdfLexer{data: data, pos: lex.pos}
+			if raw, found := stream.streamData(dict); found {
+				obj = &pdfStream{num: num, dict: dict, raw: raw}
+				streamEnd = stream.pos
+			}
+		}
+		doc.objects[num] = obj
+	}
+
+	// Objetos comprimidos dentro de object streams (PDF 1.5+); el trailer de los PDF
+	// con xref stream esta en el diccionario del stream /XRef
+	for _, obj := range doc.objects {
+		stream, ok := obj.(*pdfStream)
+		if !ok {
+			continue
+		}
+		switch stream.dict["Type"] {
+		case pdfName("ObjStm"):
+			doc.loadObjectStream(stream)
+		case pdfName("XRef"):
+			if _, found := stream.dict["Encrypt"]; found {
+				doc.encrypted = true
+			}
+		}
+	}
+
+	// Trailers clasicos; cada uno se lee solo hasta el siguiente
+	keyword := []byte("trailer")
+	for start := bytes.Index(data, keyword); start >= 0; {
+		start += len(keyword)
+		end := len(data)
+		next := bytes.Index(data[start:], keyword)
+		if next >= 0 {
+			end = start + next
+		}
+		lex := &pdfLexer{data: data[:end], pos: start}
+		if trailer, ok := lex.parseObject(); ok {
+			if dict, isDict := trailer.(pdfDict); isDict && dict["Encrypt"] != nil {
+				doc.encrypted = true
+			}
+		}
+		if next < 0 {
+			break
+		}
+		start = end
+	}
+
+	return doc
+}
+
+func (doc *pdfDocument) loadObjectStream(stream *pdfStream) {
+	data, err := doc.decode(stream)
+	if err != nil {
+		return
+	}
+	n := pdfInt(doc.resolve(stream.dict["N"]))
+	first := pdfInt(doc.resolve(stream.dict["First"]))
+	if n <= 0 || first <= 0 || first > len(data) {
+		return
+	}
+
+	type entry struct{ num, offset int }
+	var entries []entry
+	header := &pdfLexer{data: data[:first]}
+	for i := 0; i < n; i++ {
+		num, ok1 := header.next()
+		offset, ok2 := header.next()
+		objNum, isInt1 := num.(int)
+		objOffset, isInt2 := offset.(int)
+		if !ok1 || !ok2 || !isInt1 || !isInt2 {
+			break
+		}
+		if objOffset >= 0 && first+objOffset < len(data) {
+			entries = append(entries, entry{objNum, first + objOffset})
+		}
+	}
+
+	// Como en el archivo, cada objeto se lee solo hasta donde empieza el siguiente
+	sort.Slice(entries, func(i, j int) bool { return entries[i].offset < entries[j].offset })
+	for i, e := range entries {
+		if _, exists := doc.objects[e.num]; exists {
+			continue
+		}
+		end := len(data)
+		if i+1 < len(entries) {
+			end = max(entries[i+1].offset, e.offset)
+		}
+		lex := &pdfLexer{data: data[:end], pos: e.offset}
+		if obj, ok := lex.parseObject(); ok {
+			doc.objects[e.num] = obj
+		}
+	}
+}
+
+// resolve sigue referencias indirectas hasta un objeto directo
+func (doc *pdfDocument) resolve(obj any) any {
+	for i := 0; i < pdfMaxDepth; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = doc.objects[ref.num]
+	}
+	return nil
+}
+
+// pages recorre el arbol de paginas desde el catalogo; las paginas heredan /Resources.
+// Si el catalogo no se encuentra se usan los objetos /Page en orden de numero.
+func (doc *pdfDocument) pages() []pdfDict {
+	var root any
+	for _, num := range doc.sortedObjectNumbers() {
+		if dict, ok := doc.objects[num].(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			root = dict["Pages"]
+		}
+	}
+
+	var pages []pdfDict
+	visited := make(map[int]bool)
+	var walk func(node any, inherited any, depth int)
+	walk = func(node any, inherited any, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		dict, ok := doc.resolve(node).(pdfDict)
+		if !ok || depth > pdfMaxDepth {
+			return
+		}
+		if res, found := dict["Resources"]; found {
+			inherited = res
+		}
+		kids, isTree := doc.resolve(dict["Kids"]).(pdfArray)
+		if !isTree || dict["Type"] == pdfName("Page") {
+			page := make(pdfDict, len(dict)+1)
+			for k, v := range dict {
+				page[k] = v
+			}
+			page["Resources"] = inherited
+			pages = append(pages, page)
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, inherited, depth+1)
+		}
+	}
+	if root != nil {
+		walk(root, nil, 0)
+	}
+
+	if len(pages) == 0 {
+		for _, num := range doc.sortedObjectNumbers() {
+			if dict, ok := doc.objects[num].(pdfDict); ok && dict["Type"] == pdfName("Page") {
+				pages = append(pages, dict)
+			}
+		}
+	}
+	return pages
+}
+
+func (doc *pdfDocument) sortedObjectNumbers() []int {
+	nums := make([]int, 0, len(doc.objects))
+	for num := range doc.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// contents concatena los streams de contenido de una pagina (/Contents puede ser un arreglo)
+func (doc *pdfDocument) contents(obj any) []byte {
+	var parts []any
+	switch v := doc.resolve(obj).(type) {
+	case pdfArray:
+		parts = v
+	case *pdfStream:
+		parts = []any{v}
+	}
+
+	var buf bytes.Buffer
+	for _, part := range parts {
+		stream, ok := doc.resolve(part).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := doc.decode(stream)
+		if err != nil {
+			continue
+		}
+		// Un mismo stream puede repetirse en el arreglo: cada copia cuenta
+		if !doc.spend(len(data)) {
+			break
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// decode aplica los filtros del stream. Solo se soportan los que aparecen en texto y
+// object streams (Flate, ASCIIHex, ASCII85); los de imagenes se rechazan. Cada stream se
+// descomprime una sola vez y el resultado de cada filtro se descuenta del presupuesto.
+func (doc *pdfDocument) decode(stream *pdfStream) ([]byte, error) {
+	if data, ok := doc.decoded[stream.num]; ok {
+		return data, nil
+	}
+
+	var filters []any
+	switch f := doc.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+
+	data := stream.raw
+	for _, filter := range filters {
+		if doc.budget == 0 {
+			return nil, ErrPDFTooLarge
+		}
+		name, _ := doc.resolve(filter).(pdfName)
+		var err error
+		switch name {
+		case "FlateDecode", "Fl":
+			// Un byte de mas para distinguir el stream que agota el presupuesto del que
+			// justo cabe; los que pasan de pdfMaxStreamSize se truncan
+			data, err = inflatePDF(data, min(pdfMaxStreamSize, doc.budget+1))
+		case "ASCIIHexDecode", "AHx":
+			data, err = decodeASCIIHex(data)
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		default:
+			return nil, fmt.Errorf("filtro no soportado: %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !doc.spend(len(data)) {
+			return nil, ErrPDFTooLarge
+		}
+	}
+
+	if stream.num > 0 {
+		doc.decoded[stream.num] = data
+	}
+	return data, nil
+}
+
+// spend descuenta n bytes del presupuesto del documento; devuelve false (y lo agota) si
+// no alcanza
+func (doc *pdfDocument) spend(n int) bool {
+	if n > doc.budget {
+		doc.budget = 0
+		return false
+	}
+	doc.budget -= n
+	return true
+}
+
+// inflatePDF descomprime un stream Flate hasta limit bytes; si esta truncado devuelve lo
+// que se pudo leer
+func inflatePDF(data []byte, limit int) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	out, err := io.ReadAll(io.LimitReader(reader, int64(limit)))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	var clean []byte
+	for _, b := range data {
+		if b == '>' {
+			break
+		}
+		if isHexDigit(b) {
+			clean = append(clean, b)
+		}
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	out := make([]byte, len(clean)/2)
+	_, err := hex.Decode(out, clean)
+	return out, err
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+	out := make([]byte, len(data)*4/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// --- Fuentes y codificacion del texto ---
+
+// pdfFont traduce los codigos de caracteres de un string a Unicode
+type pdfFont struct {
+	codeLen int               // bytes por codigo (2 en fuentes Type0/CID)
+	toUni   map[uint32]string // de /ToUnicode
+	diffs   map[byte]string   // de /Encoding /Differences
+}
+
+func (doc *pdfDocument) font(resources pdfDict, name pdfName) *pdfFont {
+	fonts, _ := doc.resolve(resources["Font"]).(pdfDict)
+	ref, isRef := fonts[string(name)].(pdfRef)
+	if isRef {
+		if cached, ok := doc.fonts[ref]; ok {
+			return cached
+		}
+	}
+
+	font := &pdfFont{codeLen: 1}
+	dict, _ := doc.resolve(fonts[string(name)]).(pdfDict)
+	if dict["Subtype"] == pdfName("Type0") {
+		font.codeLen = 2
+	}
+	if stream, ok := doc.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := doc.decode(stream); err == nil {
+			font.parseCMap(data)
+		}
+	}
+	if enc, ok := doc.resolve(dict["Encoding"]).(pdfDict); ok {
+		if diffs, ok := doc.resolve(enc["Differences"]).(pdfArray); ok {
+			font.diffs = parseDifferences(diffs)
+		}
+	}
+
+	if isRef {
+		doc.fonts[ref] = font
+	}
+	return font
+}
+
+// parseCMap lee los rangos bfchar/bfrange de un CMap ToUnicode
+func (f *pdfFont) parseCMap(data []byte) {
+	f.toUni = make(map[uint32]string)
+	lex := &pdfLexer{data: data}
+	var operands []any
+
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return
+		}
+		kw, isKeyword := tok.(pdfKeyword)
+		if !isKeyword {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch kw {
+		case "[":
+			arr, _ := lex.parseArray()
+			operands = append(operands, arr)
+			continue
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].(pdfString); ok && len(lo) > 0 {
+					f.codeLen = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					f.toUni[bytesToCode(src)] = decodeUTF16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := bytesToCode(lo), bytesToCode(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					base := []rune(decodeUTF16BE(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for code := start; code <= end; code++ {
+						r := append([]rune{}, base...)
+						r[len(r)-1] += rune(code - start)
+						f.toUni[code] = string(r)
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && start+uint32(j) <= end {
+							f.toUni[start+uint32(j)] = decodeUTF16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// decode convierte los bytes de un string mostrado con esta fuente a texto
+func (f *pdfFont) decode(s pdfString) string {
+	var out strings.Builder
+	if f.toUni != nil && len(f.toUni) > 0 {
+		step := max(f.codeLen, 1)
+		for i := 0; i+step <= len(s); i += step {
+			if text, ok := f.toUni[bytesToCode(s[i:i+step])]; ok {
+				out.WriteString(text)
+			} else if step == 1 {
+				out.WriteRune(winAnsiRune(s[i]))
+			}
+		}
+		return out.String()
+	}
+
+	// Fuentes CID sin ToUnicode: los codigos son indices de glifos, no hay texto recuperable
+	if f.codeLen == 2 {
+		return ""
+	}
+	for _, b := range s {
+		if text, ok := f.diffs[b]; ok {
+			out.WriteString(text)
+		} else {
+			out.WriteRune(winAnsiRune(b))
+		}
+	}
+	return out.String()
+}
+
+func bytesToCode(b []byte) uint32 {
+	var code uint32
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func decodeUTF16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// winAnsiHigh caracteres de WinAnsiEncoding (cp1252) en 0x80-0x9F; el resto coincide con Latin-1
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+func winAnsiRune(b byte) rune {
+	if b >= 0x80 && b <= 0x9F {
+		if r := winAnsiHigh[b-0x80]; r != 0 {
+			return r
+		}
+		return ' '
+	}
+	return rune(b)
+}
+
+// glyphNames nombres de glifo comunes en /Differences (sin ToUnicode)
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "quoteright": '’', "quoteleft": '‘', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "period": '.',
+	"slash": '/', "colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "bracketleft": '[', "backslash": '\\', "bracketright": ']',
+	"underscore": '_', "braceleft": '{', "bar": '|', "braceright": '}', "endash": '–', "emdash": '—',
+	"bullet": '•', "degree": '°', "quotedblleft": '“', "quotedblright": '”', "ellipsis": '…',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5', "six": '6',
+	"seven": '7', "eight": '8', "nine": '9', "exclamdown": '¡', "questiondown": '¿',
+	"ordfeminine": 'ª', "ordmasculine": 'º', "Euro": '€',
+	"aacute": 'á', "eacute": 'é', "iacute": 'í', "oacute": 'ó', "uacute": 'ú', "ntilde": 'ñ',
+	"Aacute": 'Á', "Eacute": 'É', "Iacute": 'Í', "Oacute": 'Ó', "Uacute": 'Ú', "Ntilde": 'Ñ',
+	"udieresis": 'ü', "Udieresis": 'Ü', "agrave": 'à', "egrave": 'è', "ccedilla": 'ç',
+}
+
+func parseDifferences(diffs pdfArray) map[byte]string {
+	result := make(map[byte]string)
+	code := 0
+	for _, item := range diffs {
+		switch v := item.(type) {
+		case int:
+			code = v
+		case pdfName:
+			if text, ok := glyphText(string(v)); ok && code >= 0 && code < 256 {
+				result[byte(code)] = text
+			}
+			code++
+		}
+	}
+	return result
+}
+
+func glyphText(name string) (string, bool) {
+	switch {
+	case len(name) == 1:
+		return name, true
+	case name == "fi" || name == "fl" || name == "ff":
+		return name, true
+	}
+	if r, ok := glyphNames[name]; ok {
+		return string(r), true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) == 7 {
+		if v, err := strconv.ParseUint(name[3:], 16, 32); err == nil {
+			return string(rune(v)), true
+		}
+	}
+	return "", false
+}
+
+// --- Interprete de contenido ---
+
+// pageText interpreta los operadores de texto de un stream de contenido. Los saltos de
+// linea se deducen de los desplazamientos verticales; los XObjects de formulario
+// (encabezados, pies de pagina) se interpretan con sus propios recursos.
+func (doc *pdfDocument) pageText(content []byte, resources pdfDict, depth int) string {
+	var out strings.Builder
+	lex := &pdfLexer{data: content}
+	var operands []any
+	font := &pdfFont{codeLen: 1}
+	// Posicion vertical del texto en coordenadas de pagina; scale es la escala vertical de
+	// la matriz de texto (Tm), que multiplica los desplazamientos de Td
+	lineY, shownY := 0.0, math.NaN()
+	leading, scale := 0.0, 1.0
+
+	newline := func() {
+		if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+			out.WriteByte('\n')
+		}
+	}
+	space := func() {
+		s := out.String()
+		if len(s) > 0 && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			out.WriteByte(' ')
+		}
+	}
+	show := func(s pdfString) {
+		if !math.IsNaN(shownY) && math.Abs(lineY-shownY) > 1 {
+			newline()
+		}
+		shownY = lineY
+		out.WriteString(font.decode(s))
+	}
+	number := func(i int) float64 {
+		if i < len(operands) {
+			return pdfFloat(operands[i])
+		}
+		return 0
+	}
+
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+		kw, isKeyword := tok.(pdfKeyword)
+		if !isKeyword {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch kw {
+		case "[":
+			arr, _ := lex.parseArray()
+			operands = append(operands, arr)
+			continue
+		case "<<":
+			dict, _ := lex.parseDict()
+			operands = append(operands, dict)
+			continue
+		case "ID":
+			lex.skipInlineImage()
+		case "BT":
+			lineY, scale = 0, 1
+		case "ET":
+			space()
+		case "Tf":
+			if len(operands) >= 1 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = doc.font(resources, name)
+				}
+			}
+		case "TL":
+			leading = number(0)
+		case "Td", "TD":
+			ty := number(1) * scale
+			lineY += ty
+			if kw == "TD" {
+				leading = -number(1)
+			}
+			if math.Abs(ty) <= 1 && number(0) != 0 {
+				space()
+			}
+		case "Tm":
+			y := number(5)
+			if !math.IsNaN(shownY) && math.Abs(y-shownY) <= 1 {
+				space()
+			}
+			lineY = y
+			if d := math.Abs(number(3)); d > 0 {
+				scale = d
+			}
+		case "T*":
+			lineY -= max(leading*scale, 2)
+		case "Tj":
+			if len(operands) >= 1 {
+				if s, ok := operands[0].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "'", "\"":
+			lineY -= max(leading*scale, 2)
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[0].(pdfArray)
+				for _, item := range arr {
+					switch v := item.(type) {
+					case pdfString:
+						show(v)
+					default:
+						// Un desplazamiento grande entre fragmentos equivale a un espacio
+						if pdfFloat(v) < -200 {
+							space()
+						}
+					}
+				}
+			}
+		case "Do":
+			if depth < 5 && len(operands) >= 1 {
+				if name, ok := operands[0].(pdfName); ok {
+					out.WriteString(doc.formText(resources, name, depth))
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return out.String()
+}
+
+// formText extrae el texto de un XObject de formulario
+func (doc *pdfDocument) formText(resources pdfDict, name pdfName, depth int) string {
+	xobjects, _ := doc.resolve(resources["XObject"]).(pdfDict)
+	stream, ok := doc.resolve(xobjects[string(name)]).(*pdfStream)
+	if !ok || stream.dict["Subtype"] != pdfName("Form") {
+		return ""
+	}
+	data, err := doc.decode(stream)
+	// El mismo formulario puede aparecer en todas las paginas: cada uso cuenta
+	if err != nil || !doc.spend(len(data)) {
+		return ""
+	}
+	formResources, ok := doc.resolve(stream.dict["Resources"]).(pdfDict)
+	if !ok {
+		formResources = resources
+	}
+	text := doc.pageText(data, formResources, depth+1)
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return "\n" + text + "\n"
+}
+
+func pdfInt(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+func pdfFloat(v any) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// --- Lexer ---
+
+// pdfLexer tokeniza la sintaxis de PDF. next devuelve int, float64, pdfName, pdfString,
+// bool, nil o pdfKeyword (operadores y los delimitadores "[", "]", "<<", ">>").
+type pdfLexer struct {
+	data    []byte
+	pos     int
+	nesting int // arreglos y diccionarios abiertos; limitado para no agotar la pila
+}
+
+func isPDFSpace(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\r' || b == '\t' || b == '\f' || b == 0
+}
+
+func isPDFDelimiter(b byte) bool {
+	return strings.IndexByte("()<>[]{}/%", b) >= 0
+}
+
+func isHexDigit(b byte) bool {
+	return (b >= '0' && b <= '9') || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		if isPDFSpace(b) {
+			l.pos++
+		} else if b == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+func (l *pdfLexer) next() (any, bool) {
+	var b byte
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, false
+		}
+		b = l.data[l.pos]
+		// Un ">" o ")" sueltos no forman ningun token y se saltan
+		if b == ')' || (b == '>' && (l.pos+1 >= len(l.data) || l.data[l.pos+1] != '>')) {
+			l.pos++
+			continue
+		}
+		break
+	}
+
+	switch {
+	case b == '(':
+		return l.literalString(), true
+	case b == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), true
+		}
+		return l.hexString(), true
+	case b == '>':
+		l.pos += 2
+		return pdfKeyword(">>"), true
+	case b == '[' || b == ']' || b == '{' || b == '}':
+		l.pos++
+		return pdfKeyword(string(b)), true
+	case b == '/':
+		return l.name(), true
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+
+	if c := word[0]; (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.' {
+		if !strings.ContainsAny(word, ".") {
+			if n, err := strconv.Atoi(word); err == nil {
+				return n, true
+			}
+		}
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, true
+		}
+		return 0.0, true
+	}
+
+	switch word {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	case "null":
+		return nil, true
+	}
+	return pdfKeyword(word), true
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++ // '/'
+	var name []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		b := l.data[l.pos]
+		if b == '#' && l.pos+2 < len(l.data) && isHexDigit(l.data[l.pos+1]) && isHexDigit(l.data[l.pos+2]) {
+			v, _ := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8)
+			name = append(name, byte(v))
+			l.pos += 3
+			continue
+		}
+		name = append(name, b)
+		l.pos++
+	}
+	return pdfName(name)
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // '('
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // '<'
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+	out, _ := decodeASCIIHex(l.data[l.pos : l.pos+end])
+	l.pos += end + 1
+	return out
+}
+
+// parseObject lee un objeto completo; reconoce referencias "12 0 R"
+func (l *pdfLexer) parseObject() (any, bool) {
+	tok, ok := l.next()
+	if !ok {
+		return nil, false
+	}
+	switch v := tok.(type) {
+	case pdfKeyword:
+		switch v {
+		case "[":
+			return l.parseArray()
+		case "<<":
+			return l.parseDict()
+		}
+		return v, true
+	case int:
+		save := l.pos
+		if gen, ok := l.next(); ok {
+			if g, isInt := gen.(int); isInt {
+				if r, ok := l.next(); ok && r == pdfKeyword("R") {
+					return pdfRef{num: v, gen: g}, true
+				}
+			}
+		}
+		l.pos = save
+		return v, true
+	}
+	return tok, true
+}
+
+func (l *pdfLexer) parseArray() (pdfArray, bool) {
+	if !l.enter() {
+		return nil, false
+	}
+	defer l.leave()
+
+	var arr pdfArray
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return arr, false
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return arr, true
+		}
+		obj, ok := l.parseObject()
+		if !ok {
+			return arr, false
+		}
+		arr = append(arr, obj)
+	}
+}
+
+func (l *pdfLexer) parseDict() (pdfDict, bool) {
+	if !l.enter() {
+		return nil, false
+	}
+	defer l.leave()
+
+	dict := make(pdfDict)
+	for {
+		key, ok := l.parseObject()
+		if !ok {
+			return dict, false
+		}
+		if key == pdfKeyword(">>") {
+			return dict, true
+		}
+		name, isName := key.(pdfName)
+		if !isName {
+			continue
+		}
+		value, ok := l.parseObject()
+		if !ok {
+			return dict, false
+		}
+		if value == pdfKeyword(">>") {
+			return dict, true
+		}
+		dict[string(name)] = value
+	}
+}
+
+// enter abre un arreglo o diccionario; devuelve false si excede pdfMaxNesting
+func (l *pdfLexer) enter() bool {
+	if l.nesting >= pdfMaxNesting {
+		return false
+	}
+	l.nesting++
+	return true
+}
+
+func (l *pdfLexer) leave() {
+	l.nesting--
+}
+
+// streamData lee los datos del stream que sigue al diccionario, si lo hay. Usa /Length
+// cuando es directo y coincide con "endstream"; si no, busca la palabra clave.
+func (l *pdfLexer) streamData(dict pdfDict) ([]byte, bool) {
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		return nil, false
+	}
+	start := l.pos + len("stream")
+	if start < len(l.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+
+	if length, ok := dict["Length"].(int); ok && length >= 0 && start+length <= len(l.data) {
+		rest := bytes.TrimLeft(l.data[start+length:], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = start + length
+			return l.data[start : start+length], true
+		}
+	}
+
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, false
+	}
+	raw := bytes.TrimRight(l.data[start:start+end], "\r\n")
+	l.pos = start + end
+	return raw, true
+}
+
+// skipInlineImage salta los datos binarios de una imagen en linea (BI ... ID datos EI)
+func (l *pdfLexer) skipInlineImage() {
+	for i := l.pos; i+2 < len(l.data); i++ {
+		if isPDFSpace(l.data[i]) && l.data[i+1] == 'E' && l.data[i+2] == 'I' &&
+			(i+3 == len(l.data) || isPDFSpace(l.data[i+3])) {
+			l.pos = i + 3
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
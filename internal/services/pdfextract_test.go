@@ -0,0 +1,304 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testPDF arma un PDF minimo con los objetos indicados (numerados desde 1); el parser
+// no usa la tabla xref, asi que no se genera
+func testPDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+// testPDFStream objeto stream con el diccionario y los datos indicados
+func testPDFStream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// deflate comprime los datos como un stream FlateDecode
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+// testPDFPages catalogo y arbol de paginas; cada pagina usa la fuente /F1 del objeto 3
+// y el contenido indicado en su /Contents
+func testPDFPages(contents ...string) []string {
+	kids := make([]string, len(contents))
+	for i := range contents {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+i)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(contents)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	for _, c := range contents {
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R >> >> /Contents %s >>", c))
+	}
+	return objects
+}
+
+func TestPDFDecodeCachesStreams(t *testing.T) {
+	content := []byte("BT /F1 12 Tf (Hola) Tj ET")
+	objects := append(testPDFPages("[5 0 R 5 0 R]"), testPDFStream("/Filter /FlateDecode", deflate(content)))
+	doc := parsePDF(testPDF(objects...))
+	stream := doc.objects[5].(*pdfStream)
+
+	first, err := doc.decode(stream)
+	if err != nil || !bytes.Equal(first, content) {
+		t.Fatalf("decode = %q, %v", first, err)
+	}
+	budget := doc.budget
+	if _, err := doc.decode(stream); err != nil || doc.budget != budget {
+		t.Fatalf("la segunda lectura volvio a descomprimir: presupuesto %d -> %d, err %v", budget, doc.budget, err)
+	}
+}
+
+func TestPDFDocumentBudget(t *testing.T) {
+	chunk := bytes.Repeat([]byte(" "), 400*1024)
+	nested := deflate(deflate(deflate(bytes.Repeat([]byte(" "), 4*1024*1024))))
+
+	tests := []struct {
+		name    string
+		objects []string
+		check   func(t *testing.T, doc *pdfDocument)
+	}{
+		{
+			name: "stream repetido en /Contents",
+			objects: append(testPDFPages("[5 0 R 5 0 R 5 0 R 5 0 R 5 0 R 5 0 R 5 0 R 5 0 R]"),
+				testPDFStream("/Filter /FlateDecode", deflate(chunk))),
+			check: func(t *testing.T, doc *pdfDocument) {
+				page := doc.pages()[0]
+				if got := doc.contents(page["Contents"]); len(got) > 1024*1024 {
+					t.Errorf("contents = %d bytes, supera el presupuesto", len(got))
+				}
+			},
+		},
+		{
+			name:    "cadena de filtros",
+			objects: append(testPDFPages("5 0 R"), testPDFStream("/Filter [/Fl /Fl /Fl]", nested)),
+			check: func(t *testing.T, doc *pdfDocument) {
+				if _, err := doc.decode(doc.objects[5].(*pdfStream)); !errors.Is(err, ErrPDFTooLarge) {
+					t.Errorf("decode = %v, se esperaba ErrPDFTooLarge", err)
+				}
+			},
+		},
+		{
+			name: "XObject reutilizado en cada pagina",
+			objects: append(testPDFPages("9 0 R", "9 0 R", "9 0 R", "9 0 R"),
+				testPDFStream("/Type /XObject /Subtype /Form /Filter /FlateDecode", deflate(append(chunk, "BT /F1 12 Tf (Pie) Tj ET"...))),
+				testPDFStream("", []byte("/X1 Do"))),
+			check: func(t *testing.T, doc *pdfDocument) {
+				forms := 0
+				for _, page := range doc.pages() {
+					resources := pdfDict{"XObject": pdfDict{"X1": pdfRef{num: 8}}}
+					if strings.Contains(doc.pageText(doc.contents(page["Contents"]), resources, 0), "Pie") {
+						forms++
+					}
+				}
+				if forms == 0 || forms == 4 {
+					t.Errorf("el formulario se interpreto en %d de 4 paginas; se esperaba cortar al agotar el presupuesto", forms)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parsePDF(testPDF(tt.objects...))
+			doc.budget = 1024 * 1024
+			tt.check(t, doc)
+		})
+	}
+}
+
+func TestExtractPDF(t *testing.T) {
+	tests := []struct {
+		file  string
+		pages int
+		want  []string
+		err   error
+	}{
+		{
+			// Flate, object stream, XObject de formulario, TJ con espacios y una fuente
+			// Type0 con CMap ToUnicode
+			file:  "sample.pdf",
+			pages: 2,
+			want:  []string{"[Pagina 1]\nHola mundo\nSegunda línea (ok)", "Palabra separada", "Pie de pagina", "[Pagina 2]\nA ñ\nAA"},
+		},
+		{file: "encrypted.pdf", err: ErrPDFEncrypted},
+		{file: "scanned.pdf", pages: 1, err: ErrPDFNoText},
+	}
+
+	fp := NewFileProcessor()
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, pages, err := fp.extractPDF(data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, se esperaba %v", err, tt.err)
+			}
+			if pages != tt.pages {
+				t.Errorf("paginas = %d, se esperaban %d", pages, tt.pages)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("falta %q en %q", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestPDFToUnicodeCMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmap    string
+		codeLen int
+		input   string
+		want    string
+	}{
+		{
+			name:    "bfchar de dos bytes",
+			cmap:    "1 begincodespacerange <0000> <FFFF> endcodespacerange 2 beginbfchar <0001> <0048> <0002> <006F> endbfchar",
+			codeLen: 2,
+			input:   "\x00\x01\x00\x02",
+			want:    "Ho",
+		},
+		{
+			name:    "bfrange con destino inicial",
+			cmap:    "1 begincodespacerange <00> <FF> endcodespacerange 1 beginbfrange <41> <43> <00E1> endbfrange",
+			codeLen: 1,
+			input:   "ACB",
+			want:    "áãâ",
+		},
+		{
+			name:    "bfrange con arreglo",
+			cmap:    "1 begincodespacerange <0000> <FFFF> endcodespacerange 1 beginbfrange <0010> <0011> [<00F1> <0066006C>] endbfrange",
+			codeLen: 2,
+			input:   "\x00\x11\x00\x10",
+			want:    "flñ",
+		},
+		{
+			name:    "bfrange invertido se ignora",
+			cmap:    "1 begincodespacerange <00> <FF> endcodespacerange 1 beginbfrange <43> <41> <0061> endbfrange 1 beginbfchar <41> <005A> endbfchar",
+			codeLen: 1,
+			input:   "AB",
+			want:    "ZB",
+		},
+		{
+			name:    "CMap truncado",
+			cmap:    "1 begincodespacerange <0000> <FFFF> endcodespacerange 2 beginbfchar <0001> <0041> <0002",
+			codeLen: 2,
+			input:   "\x00\x01",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			font := &pdfFont{codeLen: 1}
+			font.parseCMap([]byte(tt.cmap))
+			if font.codeLen != tt.codeLen {
+				t.Errorf("codeLen = %d, se esperaba %d", font.codeLen, tt.codeLen)
+			}
+			if got := font.decode(pdfString(tt.input)); got != tt.want {
+				t.Errorf("decode(%q) = %q, se esperaba %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractPDFMalformed(t *testing.T) {
+	sample, err := os.ReadFile("testdata/sample.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := "%PDF-1.4\n1 0 obj\n"
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"vacio", nil},
+		{"no es PDF", []byte("hola, esto no es un PDF")},
+		{"solo encabezado", []byte("%PDF-1.7\n")},
+		{"basura binaria", append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte{0xFF, 0x00, '<', '(', '['}, 4096)...)},
+		{"arreglos anidados", append([]byte(header), bytes.Repeat([]byte("["), 1<<23)...)},
+		{"diccionarios anidados", append([]byte(header), bytes.Repeat([]byte("<< /A "), 1<<21)...)},
+		{"delimitadores sueltos", append([]byte(header), bytes.Repeat([]byte(")>"), 1<<23)...)},
+		{"objetos sin cerrar", append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("1 0 obj ("), 1<<16)...)},
+		{"streams sin endstream", append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("1 0 obj << >> stream\n"), 1<<15)...)},
+		{"trailers sin cerrar", append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("trailer ["), 1<<16)...)},
+		{
+			name: "arbol de paginas con ciclo",
+			data: testPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [2 0 R 3 0 R] >>",
+				"<< /Type /Pages /Kids [2 0 R 3 0 R] >>",
+			),
+		},
+		{
+			name: "formulario que se dibuja a si mismo",
+			data: testPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] >>",
+				"<< /Type /Page /Resources << /XObject << /X 4 0 R >> >> /Contents 4 0 R >>",
+				testPDFStream("/Subtype /Form /Resources << /XObject << /X 4 0 R >> >>", []byte("/X Do")),
+			),
+		},
+	}
+
+	// Cada truncamiento del PDF de ejemplo
+	for n := 0; n < len(sample); n += 7 {
+		tests = append(tests, struct {
+			name string
+			data []byte
+		}{fmt.Sprintf("truncado a %d bytes", n), sample[:n]})
+	}
+
+	fp := NewFileProcessor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Solo importa que termine sin entrar en panico ni agotar la pila
+			text, _, err := fp.extractPDF(tt.data)
+			if err == nil && strings.TrimSpace(text) == "" {
+				t.Errorf("sin error ni texto")
+			}
+		})
+	}
+}
+
+func TestPDFPageTreeDepth(t *testing.T) {
+	// Una cadena de nodos /Pages mas profunda que pdfMaxDepth
+	objects := []string{"<< /Type /Catalog /Pages 2 0 R >>"}
+	for i := 2; i < pdfMaxDepth+10; i++ {
+		objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%d 0 R] >>", i+1))
+	}
+	objects = append(objects, "<< /Type /Page /Contents 99 0 R >>")
+
+	doc := parsePDF(testPDF(objects...))
+	// El arbol se corta; a falta de paginas alcanzables se usan los objetos /Page sueltos
+	if pages := doc.pages(); len(pages) != 1 {
+		t.Fatalf("paginas = %d, se esperaba 1", len(pages))
+	}
+}
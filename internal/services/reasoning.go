@@ -0,0 +1,99 @@
+package services
+
+import (
+	"strings"
+)
+
+const (
+	reasoningOpenTag  = "<think>"
+	reasoningCloseTag = "</think>"
+)
+
+// ReasoningSplitter separa, conforme llegan los fragmentos, el razonamiento que modelos
+// como DeepSeek R1 escriben entre <think> y </think> de la respuesta final. Las etiquetas
+// pueden llegar partidas entre fragmentos: se retiene el final que podria ser el inicio
+// de una etiqueta hasta el siguiente fragmento.
+type ReasoningSplitter struct {
+	pending          string
+	inReasoning      bool
+	reasoningStarted bool
+	answerStarted    bool
+}
+
+// Write agrega un fragmento y devuelve el razonamiento y la respuesta que ya pueden enviarse
+func (r *ReasoningSplitter) Write(chunk string) (reasoning, answer string) {
+	r.pending += chunk
+	var reasoningOut, answerOut strings.Builder
+
+	for {
+		tag := reasoningOpenTag
+		if r.inReasoning {
+			tag = reasoningCloseTag
+		}
+
+		if i := strings.Index(r.pending, tag); i >= 0 {
+			r.emit(r.pending[:i], &reasoningOut, &answerOut)
+			r.pending = r.pending[i+len(tag):]
+			r.inReasoning = !r.inReasoning
+			continue
+		}
+
+		// Retener el final que podria ser el comienzo de la etiqueta
+		keep := partialTagSuffix(r.pending, tag)
+		r.emit(r.pending[:len(r.pending)-keep], &reasoningOut, &answerOut)
+		r.pending = r.pending[len(r.pending)-keep:]
+		break
+	}
+
+	return reasoningOut.String(), answerOut.String()
+}
+
+// Flush devuelve lo retenido al terminar la respuesta
+func (r *ReasoningSplitter) Flush() (reasoning, answer string) {
+	var reasoningOut, answerOut strings.Builder
+	r.emit(r.pending, &reasoningOut, &answerOut)
+	r.pending = ""
+	return reasoningOut.String(), answerOut.String()
+}
+
+// emit asigna el texto al razonamiento o a la respuesta; los saltos de linea que separan
+// el razonamiento de la respuesta no se envian como parte de ella
+func (r *ReasoningSplitter) emit(text string, reasoning, answer *strings.Builder) {
+	if r.inReasoning {
+		if !r.reasoningStarted {
+			text = strings.TrimLeft(text, " \t\r\n")
+			if text == "" {
+				return
+			}
+			r.reasoningStarted = true
+		}
+		reasoning.WriteString(text)
+		return
+	}
+	if !r.answerStarted {
+		text = strings.TrimLeft(text, " \t\r\n")
+		if text == "" {
+			return
+		}
+		r.answerStarted = true
+	}
+	answer.WriteString(text)
+}
+
+// partialTagSuffix largo del final de s que coincide con el comienzo de tag
+func partialTagSuffix(s, tag string) int {
+	for n := min(len(s), len(tag)-1); n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// SplitReasoning separa el razonamiento de una respuesta completa
+func SplitReasoning(text string) (reasoning, answer string) {
+	var splitter ReasoningSplitter
+	reasoning, answer = splitter.Write(text)
+	restReasoning, restAnswer := splitter.Flush()
+	return strings.TrimSpace(reasoning + restReasoning), answer + restAnswer
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"testing"
+)
+
+// splitChunks pasa los fragmentos por un ReasoningSplitter y junta lo que devuelve
+func splitChunks(chunks ...string) (reasoning, answer string) {
+	var splitter ReasoningSplitter
+	for _, chunk := range chunks {
+		r, a := splitter.Write(chunk)
+		reasoning += r
+		answer += a
+	}
+	r, a := splitter.Flush()
+	return reasoning + r, answer + a
+}
+
+func TestReasoningSplitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		reasoning string
+		answer    string
+	}{
+		{
+			name:      "razonamiento y respuesta",
+			text:      "<think>\nPienso en la <b> respuesta</think>\n\nLa respuesta es 4 < 5.",
+			reasoning: "Pienso en la <b> respuesta",
+			answer:    "La respuesta es 4 < 5.",
+		},
+		{
+			name:   "sin razonamiento",
+			text:   "Hola, <thinking> no es la etiqueta",
+			answer: "Hola, <thinking> no es la etiqueta",
+		},
+		{
+			name:      "razonamiento sin cerrar",
+			text:      "<think>sigo pensando </thi",
+			reasoning: "sigo pensando </thi",
+		},
+		{
+			name:   "final parecido a la etiqueta",
+			text:   "usa la etiqueta <thi",
+			answer: "usa la etiqueta <thi",
+		},
+		{
+			name:      "razonamiento vacio",
+			text:      "<think>\n\n</think>\nRespuesta",
+			reasoning: "",
+			answer:    "Respuesta",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Cada corte en dos y en tres fragmentos, incluidos los que parten las etiquetas
+			for i := 0; i <= len(tt.text); i++ {
+				for j := i; j <= len(tt.text); j++ {
+					reasoning, answer := splitChunks(tt.text[:i], tt.text[i:j], tt.text[j:])
+					if reasoning != tt.reasoning || answer != tt.answer {
+						t.Fatalf("cortes %d y %d: razonamiento = %q, respuesta = %q; se esperaban %q, %q", i, j, reasoning, answer, tt.reasoning, tt.answer)
+					}
+				}
+			}
+
+			// Byte por byte
+			chunks := make([]string, len(tt.text))
+			for i := range tt.text {
+				chunks[i] = tt.text[i : i+1]
+			}
+			if reasoning, answer := splitChunks(chunks...); reasoning != tt.reasoning || answer != tt.answer {
+				t.Errorf("byte por byte: razonamiento = %q, respuesta = %q", reasoning, answer)
+			}
+		})
+	}
+}
+
+func TestReasoningSplitterHoldsPartialTag(t *testing.T) {
+	var splitter ReasoningSplitter
+	if reasoning, answer := splitter.Write("Hola <thi"); reasoning != "" || answer != "Hola " {
+		t.Fatalf("Write = %q, %q; se esperaba que retuviera el posible inicio de etiqueta", reasoning, answer)
+	}
+	if reasoning, answer := splitter.Write("nk>paso 1</"); reasoning != "paso 1" || answer != "" {
+		t.Fatalf("Write = %q, %q; se esperaba el razonamiento sin el posible cierre", reasoning, answer)
+	}
+	if reasoning, answer := splitter.Write("think> fin"); reasoning != "" || answer != " fin" {
+		t.Fatalf("Write = %q, %q", reasoning, answer)
+	}
+}
+
+func TestPartialTagSuffix(t *testing.T) {
+	tests := []struct {
+		s    string
+		tag  string
+		want int
+	}{
+		{"", reasoningOpenTag, 0},
+		{"hola", reasoningOpenTag, 0},
+		{"hola <", reasoningOpenTag, 1},
+		{"hola <thin", reasoningOpenTag, 5},
+		{"<think", reasoningOpenTag, 6},
+		// La etiqueta completa no es un final parcial
+		{"<think>", reasoningOpenTag, 0},
+		{"a </think", reasoningCloseTag, 7},
+		{"a <", reasoningCloseTag, 1},
+		{"a </b", reasoningCloseTag, 0},
+		{"<<", reasoningOpenTag, 1},
+	}
+	for _, tt := range tests {
+		if got := partialTagSuffix(tt.s, tt.tag); got != tt.want {
+			t.Errorf("partialTagSuffix(%q, %q) = %d, se esperaba %d", tt.s, tt.tag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"chat-empleados/db"
+	"chat-empleados/internal/config"
+)
+
+// KnowledgeSource identifica una entrada de conocimiento usada como contexto
+type KnowledgeSource struct {
+	KnowledgeID int64   `json:"knowledge_id"`
+	Title       string  `json:"title"`
+	Category    string  `json:"category"`
+	Score       float64 `json:"score"`
+}
+
+// RetrievedChunk fragmento de conocimiento relevante para una pregunta
+type RetrievedChunk struct {
+	KnowledgeSource
+	ChunkIndex int64
+	Content    string
+}
+
+type indexedChunk struct {
+	id          int64
+	knowledgeID int64
+	chunkIndex  int64
+	title       string
+	category    string
+	content     string
+	terms       map[string]int
+	length      int
+	embedding   []float64
+}
+
+// KnowledgeRetriever indexa la base de conocimiento en fragmentos y
+// recupera solo los mas relevantes para cada pregunta (BM25 + embeddings opcionales)
+type KnowledgeRetriever struct {
+	queries *db.Queries
+	llm     *LLMService
+	cfg     *config.Config
+
+	chunks  []indexedChunk
+	docFreq map[string]int
+	avgLen  float64
+	loaded  bool
+	version uint64 // aumenta con cada Invalidate
+	mutex   sync.RWMutex
+}
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	// Peso del score semantico cuando hay embeddings disponibles
+	semanticWeight = 0.6
+	// Score minimo combinado para considerar un fragmento relevante
+	minHybridScore = 0.35
+)
+
+var stopwords = map[string]bool{
+	"que": true, "del": true, "los": true, "las": true, "una": true, "uno": true,
+	"por": true, "para": true, "con": true, "como": true, "mas": true, "pero": true,
+	"sus": true, "este": true, "esta": true, "esto": true, "son": true, "hay": true,
+	"cual": true, "cuando": true, "donde": true, "sobre": true, "entre": true,
+	"the": true, "and": true, "for": true, "are": true, "with": true, "what": true,
+	"how": true, "this": true, "that": true, "from": true, "have": true, "does": true,
+}
+
+var accentReplacer = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+)
+
+func NewKnowledgeRetriever(queries *db.Queries, llm *LLMService, cfg *config.Config) *KnowledgeRetriever {
+	return &KnowledgeRetriever{
+		queries: queries,
+		llm:     llm,
+		cfg:     cfg,
+	}
+}
+
+// SyncIndex indexa las entradas activas que aun no tienen fragmentos
+func (r *KnowledgeRetriever) SyncIndex(ctx context.Context) error {
+	ids, err := r.queries.GetUnindexedKnowledgeIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("error obteniendo conocimiento sin indexar: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := r.IndexKnowledge(ctx, id); err != nil {
+			log.Printf("[WARN] Error indexando conocimiento %d: %v", id, err)
+		}
+	}
+
+	if len(ids) > 0 {
+		log.Printf("[INFO] Indexadas %d entradas de conocimiento", len(ids))
+	}
+	return nil
+}
+
+// IndexKnowledge (re)genera los fragmentos de una entrada de conocimiento
+func (r *KnowledgeRetriever) IndexKnowledge(ctx context.Context, knowledgeID int64) error {
+	kb, err := r.queries.GetKnowledgeByID(ctx, knowledgeID)
+	if err != nil {
+		return fmt.Errorf("error obteniendo conocimiento: %w", err)
+	}
+
+	if _, err := r.queries.DeleteKnowledgeChunks(ctx, knowledgeID); err != nil {
+		return fmt.Errorf("error eliminando fragmentos: %w", err)
+	}
+
+	for i, chunk := range chunkText(kb.Content, r.cfg.KnowledgeChunkLen) {
+		var embedding sql.NullString
+		if r.llm.EmbeddingsEnabled() {
+			vector, err := r.llm.Embed(ctx, kb.Title+"\n"+chunk)
+			if err != nil {
+				log.Printf("[WARN] Error generando embedding para conocimiento %d: %v", knowledgeID, err)
+			} else if data, err := json.Marshal(vector); err == nil {
+				embedding = sql.NullString{String: string(data), Valid: true}
+			}
+		}
+
+		_, err := r.queries.CreateKnowledgeChunk(ctx, db.CreateKnowledgeChunkParams{
+			KnowledgeID: knowledgeID,
+			ChunkIndex:  int64(i),
+			Content:     chunk,
+			Embedding:   embedding,
+		})
+		if err != nil {
+			return fmt.Errorf("error guardando fragmento: %w", err)
+		}
+	}
+
+	r.Invalidate()
+	return nil
+}
+
+// Invalidate fuerza a recargar el indice en la siguiente busqueda
+func (r *KnowledgeRetriever) Invalidate() {
+	r.mutex.Lock()
+	r.loaded = false
+	r.version++
+	r.mutex.Unlock()
+}
+
+func (r *KnowledgeRetriever) load(ctx context.Context) error {
+	r.mutex.RLock()
+	loaded, version := r.loaded, r.version
+	r.mutex.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	rows, err := r.queries.GetActiveKnowledgeChunks(ctx)
+	if err != nil {
+		return fmt.Errorf("error cargando fragmentos: %w", err)
+	}
+
+	chunks := make([]indexedChunk, 0, len(rows))
+	docFreq := make(map[string]int)
+	totalLen := 0
+
+	for _, row := range rows {
+		// El titulo se indexa junto al contenido para que pese en la busqueda
+		terms := termFrequencies(row.Title + " " + row.Content)
+		length := 0
+		for term, count := range terms {
+			docFreq[term]++
+			length += count
+		}
+		totalLen += length
+
+		ic := indexedChunk{
+			id:          row.ID,
+			knowledgeID: row.KnowledgeID,
+			chunkIndex:  row.ChunkIndex,
+			title:       row.Title,
+			category:    stringValue(row.Category),
+			content:     row.Content,
+			terms:       terms,
+			length:      length,
+		}
+		if row.Embedding.Valid && row.Embedding.String != "" {
+			json.Unmarshal([]byte(row.Embedding.String), &ic.embedding)
+		}
+		chunks = append(chunks, ic)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	// Si el indice se invalido durante la consulta, lo leido puede no incluir el cambio:
+	// no se publica y la siguiente busqueda vuelve a cargar. Tampoco se pisa lo que haya
+	// cargado mientras tanto una consulta mas reciente.
+	if r.version != version {
+		return nil
+	}
+	r.chunks = chunks
+	r.docFreq = docFreq
+	r.avgLen = 0
+	if len(chunks) > 0 {
+		r.avgLen = float64(totalLen) / float64(len(chunks))
+	}
+	r.loaded = true
+
+	return nil
+}
+
+// Search devuelve los k fragmentos mas relevantes para la consulta
+func (r *KnowledgeRetriever) Search(ctx context.Context, query string, k int) ([]RetrievedChunk, error) {
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+
+	queryTerms := termFrequencies(query)
+
+	var queryEmbedding []float64
+	if r.llm.EmbeddingsEnabled() {
+		vector, err := r.llm.Embed(ctx, query)
+		if err != nil {
+			log.Printf("[WARN] Error generando embedding de consulta, usando solo busqueda lexica: %v", err)
+		} else {
+			queryEmbedding = vector
+		}
+	}
+
+	if len(queryTerms) == 0 && queryEmbedding == nil {
+		return nil, nil
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	n := float64(len(r.chunks))
+	lexical := make([]float64, len(r.chunks))
+	maxLexical := 0.0
+
+	for i, chunk := range r.chunks {
+		score := 0.0
+		for term := range queryTerms {
+			tf := float64(chunk.terms[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(r.docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(chunk.length)/r.avgLen)
+			score += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+		lexical[i] = score
+		if score > maxLexical {
+			maxLexical = score
+		}
+	}
+
+	results := make([]RetrievedChunk, 0)
+	for i, chunk := range r.chunks {
+		score := 0.0
+		if maxLexical > 0 {
+			score = lexical[i] / maxLexical
+		}
+
+		if queryEmbedding != nil && chunk.embedding != nil {
+			score = (1-semanticWeight)*score + semanticWeight*cosineSimilarity(queryEmbedding, chunk.embedding)
+			if score < minHybridScore {
+				continue
+			}
+		} else if lexical[i] == 0 {
+			continue
+		}
+
+		results = append(results, RetrievedChunk{
+			KnowledgeSource: KnowledgeSource{
+				KnowledgeID: chunk.knowledgeID,
+				Title:       chunk.title,
+				Category:    chunk.category,
+				Score:       math.Round(score*1000) / 1000,
+			},
+			ChunkIndex: chunk.chunkIndex,
+			Content:    chunk.content,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if k > 0 && len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// FormatKnowledgeContext arma el mensaje de sistema con los fragmentos recuperados
+func FormatKnowledgeContext(chunks []RetrievedChunk) string {
+	if len(chunks) == 0 {
+		return ""
+	}
+
+	var contextBuilder strings.Builder
+	contextBuilder.WriteString("\n\n--- CONOCIMIENTO EMPRESARIAL ---\n")
+	contextBuilder.WriteString("Usa la siguiente informacion para responder preguntas sobre la empresa:\n\n")
+
+	for _, c := range chunks {
+		contextBuilder.WriteString(fmt.Sprintf("## %s [%s]\n%s\n\n", c.Title, c.Category, c.Content))
+	}
+
+	contextBuilder.WriteString("--- FIN CONOCIMIENTO ---\n")
+	return contextBuilder.String()
+}
+
+// UniqueSources devuelve las entradas de conocimiento usadas, sin repetir
+func UniqueSources(chunks []RetrievedChunk) []KnowledgeSource {
+	seen := make(map[int64]bool)
+	sources := make([]KnowledgeSource, 0, len(chunks))
+	for _, c := range chunks {
+		if seen[c.KnowledgeID] {
+			continue
+		}
+		seen[c.KnowledgeID] = true
+		sources = append(sources, c.KnowledgeSource)
+	}
+	return sources
+}
+
+// chunkText divide el texto en fragmentos de hasta maxLen caracteres respetando parrafos
+func chunkText(text string, maxLen int) []string {
+	if maxLen <= 0 {
+		maxLen = 800
+	}
+
+	var chunks []string
+	var current strings.Builder
+
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		current.Reset()
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		if current.Len() > 0 && current.Len()+len(paragraph)+2 > maxLen {
+			flush()
+		}
+
+		// Parrafos mas largos que el limite se cortan por palabras
+		for len(paragraph) > maxLen {
+			// El limite se ajusta al inicio de un caracter para no partir un UTF-8 multibyte
+			limit := maxLen
+			for limit > 0 && !utf8.RuneStart(paragraph[limit]) {
+				limit--
+			}
+			cut := strings.LastIndex(paragraph[:limit], " ")
+			if cut <= 0 {
+				cut = limit
+			}
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(paragraph)
+			}
+			if current.Len() > 0 {
+				flush()
+			}
+			chunks = append(chunks, strings.TrimSpace(paragraph[:cut]))
+			paragraph = strings.TrimSpace(paragraph[cut:])
+		}
+
+		if current.Len() > 0 {
+			current.WriteString("\n\n")
+		}
+		current.WriteString(paragraph)
+	}
+	flush()
+
+	return chunks
+}
+
+// termFrequencies normaliza y cuenta los terminos relevantes de un texto
+func termFrequencies(text string) map[string]int {
+	text = accentReplacer.Replace(strings.ToLower(text))
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make(map[string]int)
+	for _, w := range words {
+		if len([]rune(w)) < 3 || stopwords[w] {
+			continue
+		}
+		terms[w]++
+	}
+	return terms
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunkTextKeepsRunesWhole(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		maxLen int
+	}{
+		{"acentos sin espacios", strings.Repeat("ñá", 500), 801},
+		{"cjk sin espacios", strings.Repeat("知识库", 300), 100},
+		{"emoji sin espacios", strings.Repeat("😀", 50), 7},
+		{"limite menor que un caracter", strings.Repeat("😀", 5), 2},
+		{"palabras con acentos", strings.Repeat("camión rápido ", 200), 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkText(tt.text, tt.maxLen)
+			if len(chunks) == 0 {
+				t.Fatal("sin fragmentos")
+			}
+			var joined strings.Builder
+			for _, chunk := range chunks {
+				if !utf8.ValidString(chunk) {
+					t.Fatalf("fragmento con UTF-8 invalido: %q", chunk)
+				}
+				joined.WriteString(chunk)
+			}
+			want := strings.ReplaceAll(tt.text, " ", "")
+			if got := strings.ReplaceAll(joined.String(), " ", ""); got != want {
+				t.Errorf("se perdio texto al dividir: %d bytes, se esperaban %d", len(got), len(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+
+	"chat-empleados/db"
+	"chat-empleados/internal/config"
+)
+
+// RuntimeConfig combina la configuracion de entorno (defaults) con los
+// valores guardados en system_config y aplica los cambios sin reiniciar
+type RuntimeConfig struct {
+	queries   *db.Queries
+	base      *config.Config
+	current   *config.Config
+	overrides map[string]string
+	listeners []func(*config.Config)
+	mutex     sync.RWMutex
+}
+
+func NewRuntimeConfig(queries *db.Queries, base *config.Config) *RuntimeConfig {
+	return &RuntimeConfig{
+		queries:   queries,
+		base:      base,
+		current:   base.Clone(),
+		overrides: make(map[string]string),
+	}
+}
+
+// Load lee los valores de system_config y los aplica sobre los defaults
+func (rc *RuntimeConfig) Load(ctx context.Context) error {
+	rows, err := rc.queries.GetAllConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("error leyendo system_config: %w", err)
+	}
+
+	overrides := make(map[string]string)
+	for _, row := range rows {
+		if _, ok := config.FindSetting(row.Key); !ok {
+			continue
+		}
+		overrides[row.Key] = row.Value
+	}
+
+	rc.mutex.Lock()
+	rc.overrides = overrides
+	rc.mutex.Unlock()
+
+	rc.rebuild()
+	return nil
+}
+
+// Current devuelve la configuracion vigente. No debe modificarse.
+func (rc *RuntimeConfig) Current() *config.Config {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	return rc.current
+}
+
+// Default devuelve el valor de entorno de una clave
+func (rc *RuntimeConfig) Default(key string) string {
+	return rc.base.Get(key)
+}
+
+// Override devuelve el valor guardado en BD para una clave, si existe
+func (rc *RuntimeConfig) Override(key string) (string, bool) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	value, ok := rc.overrides[key]
+	return value, ok
+}
+
+// OnChange registra una funcion que recibe la configuracion cada vez que cambia
+func (rc *RuntimeConfig) OnChange(fn func(*config.Config)) {
+	rc.mutex.Lock()
+	rc.listeners = append(rc.listeners, fn)
+	current := rc.current
+	rc.mutex.Unlock()
+
+	fn(current)
+}
+
+// Set valida, guarda y aplica un valor
+func (rc *RuntimeConfig) Set(ctx context.Context, key, value string) error {
+	setting, ok := config.FindSetting(key)
+	if !ok {
+		return fmt.Errorf("clave de configuracion desconocida: %s", key)
+	}
+
+	// Validar sobre una copia antes de persistir
+	probe := rc.Current().Clone()
+	if err := probe.Set(key, value); err != nil {
+		return err
+	}
+	value = probe.Get(key)
+
+	_, err := rc.queries.SetConfig(ctx, db.SetConfigParams{
+		Key:         key,
+		Value:       value,
+		Description: sql.NullString{String: setting.Description, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error guardando configuracion: %w", err)
+	}
+
+	rc.mutex.Lock()
+	rc.overrides[key] = value
+	rc.mutex.Unlock()
+
+	rc.rebuild()
+	log.Printf("[INFO] Configuracion actualizada: %s", key)
+	return nil
+}
+
+// Reset elimina el valor guardado y vuelve al default de entorno
+func (rc *RuntimeConfig) Reset(ctx context.Context, key string) error {
+	if _, ok := config.FindSetting(key); !ok {
+		return fmt.Errorf("clave de configuracion desconocida: %s", key)
+	}
+
+	if _, err := rc.queries.DeleteConfig(ctx, key); err != nil {
+		return fmt.Errorf("error eliminando configuracion: %w", err)
+	}
+
+	rc.mutex.Lock()
+	delete(rc.overrides, key)
+	rc.mutex.Unlock()
+
+	rc.rebuild()
+	log.Printf("[INFO] Configuracion restablecida al default: %s", key)
+	return nil
+}
+
+// rebuild recalcula la configuracion vigente y notifica a los listeners
+func (rc *RuntimeConfig) rebuild() {
+	rc.mutex.Lock()
+	cfg := rc.base.Clone()
+	// En el orden de config.Settings: algunas claves se validan contra otras anteriores
+	for _, setting := range config.Settings {
+		value, ok := rc.overrides[setting.Key]
+		if !ok {
+			continue
+		}
+		if err := cfg.Set(setting.Key, value); err != nil {
+			log.Printf("[WARN] Valor invalido en system_config, se usa el default: %v", err)
+		}
+	}
+	rc.current = cfg
+	listeners := append([]func(*config.Config){}, rc.listeners...)
+	rc.mutex.Unlock()
+
+	for _, fn := range listeners {
+		fn(cfg)
+	}
+}
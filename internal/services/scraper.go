@@ -3,9 +3,13 @@ package services
 import (
 	"context"
 	"crypto/sha256"
+	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -13,6 +17,8 @@ import (
 	"sync"
 	"time"
 
+	"chat-empleados/db"
+
 	"golang.org/x/net/html"
 )
 
@@ -26,6 +32,7 @@ type ScrapedContent struct {
 	Method      string    `json:"method"` // "http" o "browser"
 	Success     bool      `json:"success"`
 	Error       string    `json:"error,omitempty"`
+	Cached      bool      `json:"cached"`
 }
 
 // ScraperConfig configuración del scraper
@@ -35,8 +42,9 @@ type ScraperConfig struct {
 	MaxRetries      int
 	MaxContentSize  int64 // bytes
 	UserAgent       string
-	AllowedDomains  []string // vacío = todos permitidos
+	AllowedDomains  []string // vacío = todos permitidos (exacto o subdominio)
 	BlockedDomains  []string
+	InternalHosts   []string // pueden resolver a IPs privadas de la intranet
 
 	// Rate limiting
 	RequestsPerSecond float64
@@ -63,6 +71,7 @@ func DefaultScraperConfig() *ScraperConfig {
 		UserAgent:         "GIAChat-Bot/1.0 (Internal Enterprise Assistant)",
 		AllowedDomains:    []string{},
 		BlockedDomains:    []string{},
+		InternalHosts:     []string{},
 		RequestsPerSecond: 2.0,
 		BurstSize:         5,
 		CacheTTL:          15 * time.Minute,
@@ -79,12 +88,14 @@ func DefaultScraperConfig() *ScraperConfig {
 type Scraper struct {
 	config     *ScraperConfig
 	httpClient *http.Client
+	policy     *FetchPolicy
+	queries    *db.Queries // cache persistente y auditoria; nil = cache en memoria
 
 	// Rate limiting por dominio
 	rateLimiters map[string]*rateLimiter
 	rlMutex      sync.RWMutex
 
-	// Cache
+	// Cache en memoria (solo sin base de datos)
 	cache      map[string]*cacheEntry
 	cacheMutex sync.RWMutex
 
@@ -104,17 +115,25 @@ type cacheEntry struct {
 	expiresAt time.Time
 }
 
-// NewScraper crea un nuevo servicio de scraping
-func NewScraper(config *ScraperConfig) *Scraper {
+// NewScraper crea un nuevo servicio de scraping. Con queries el cache se guarda en
+// scraped_pages y sobrevive reinicios; sin el queda en memoria.
+func NewScraper(config *ScraperConfig, queries *db.Queries) *Scraper {
 	if config == nil {
 		config = DefaultScraperConfig()
 	}
 
+	policy := NewFetchPolicy(config.AllowedDomains, config.BlockedDomains, config.InternalHosts)
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+
 	return &Scraper{
-		config: config,
+		config:  config,
+		policy:  policy,
+		queries: queries,
 		httpClient: &http.Client{
 			Timeout: config.HTTPTimeout,
 			Transport: &http.Transport{
+				// Sin proxy: la validacion de IPs se hace al conectar
+				DialContext:         policy.DialContext(dialer),
 				MaxIdleConns:        20,
 				MaxIdleConnsPerHost: 5,
 				IdleConnTimeout:     90 * time.Second,
@@ -124,7 +143,8 @@ func NewScraper(config *ScraperConfig) *Scraper {
 				if len(via) >= 10 {
 					return fmt.Errorf("demasiados redirects (max 10)")
 				}
-				return nil
+				// Cada salto se valida igual que la URL original
+				return policy.CheckURL(req.URL)
 			},
 		},
 		rateLimiters: make(map[string]*rateLimiter),
@@ -132,8 +152,23 @@ func NewScraper(config *ScraperConfig) *Scraper {
 	}
 }
 
+// SetPolicy actualiza las listas de dominios sin reiniciar. Lo que ya esta en cache
+// se vuelve a validar contra la politica vigente antes de servirse.
+func (s *Scraper) SetPolicy(allowed, blocked, internal []string) {
+	s.policy.Set(allowed, blocked, internal)
+}
+
 // Scrape extrae contenido de una URL usando el método más apropiado
 func (s *Scraper) Scrape(ctx context.Context, targetURL string) (*ScrapedContent, error) {
+	return s.scrape(ctx, targetURL, true)
+}
+
+// Refresh descarga de nuevo una URL sin leer el cache (el resultado lo reemplaza)
+func (s *Scraper) Refresh(ctx context.Context, targetURL string) (*ScrapedContent, error) {
+	return s.scrape(ctx, targetURL, false)
+}
+
+func (s *Scraper) scrape(ctx context.Context, targetURL string, useCache bool) (*ScrapedContent, error) {
 	// Validar URL
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
@@ -145,8 +180,8 @@ func (s *Scraper) Scrape(ctx context.Context, targetURL string) (*ScrapedContent
 		}, err
 	}
 
-	// Verificar dominio permitido
-	if err := s.checkDomain(parsedURL.Host); err != nil {
+	// Verificar esquema y dominio permitidos
+	if err := s.policy.CheckURL(parsedURL); err != nil {
 		return &ScrapedContent{
 			URL:       targetURL,
 			Success:   false,
@@ -155,9 +190,17 @@ func (s *Scraper) Scrape(ctx context.Context, targetURL string) (*ScrapedContent
 		}, err
 	}
 
-	// Verificar cache
-	if s.config.EnableCache {
-		if cached := s.getFromCache(targetURL); cached != nil {
+	// Verificar cache (las IPs del host se validan de nuevo: la politica pudo cambiar)
+	if s.config.EnableCache && useCache {
+		if cached := s.getFromCache(ctx, targetURL); cached != nil {
+			if err := s.policy.Resolve(ctx, parsedURL.Hostname()); err != nil {
+				return &ScrapedContent{
+					URL:       targetURL,
+					Success:   false,
+					Error:     err.Error(),
+					ScrapedAt: time.Now(),
+				}, err
+			}
 			return cached, nil
 		}
 	}
@@ -175,20 +218,31 @@ func (s *Scraper) Scrape(ctx context.Context, targetURL string) (*ScrapedContent
 	// Intentar primero con HTTP simple
 	content, err := s.scrapeHTTP(ctx, targetURL)
 	if err == nil && s.contentLooksComplete(content) {
-		s.saveToCache(targetURL, content)
+		s.saveToCache(ctx, targetURL, content)
 		return content, nil
 	}
 
+	// Nunca pasar al browser una URL que la politica rechazo
+	if errors.Is(err, ErrFetchBlocked) {
+		return &ScrapedContent{
+			URL:       targetURL,
+			Success:   false,
+			Error:     err.Error(),
+			ScrapedAt: time.Now(),
+			Method:    "http",
+		}, err
+	}
+
 	// Si HTTP falló o el contenido parece incompleto, usar browser
 	if s.config.EnableBrowser {
 		browserContent, browserErr := s.scrapeBrowser(ctx, targetURL)
 		if browserErr == nil {
-			s.saveToCache(targetURL, browserContent)
+			s.saveToCache(ctx, targetURL, browserContent)
 			return browserContent, nil
 		}
 		// Si browser también falla, devolver el error de HTTP si teníamos contenido parcial
 		if content != nil && content.Content != "" {
-			s.saveToCache(targetURL, content)
+			s.saveToCache(ctx, targetURL, content)
 			return content, nil
 		}
 		return browserContent, browserErr
@@ -196,7 +250,7 @@ func (s *Scraper) Scrape(ctx context.Context, targetURL string) (*ScrapedContent
 
 	// Solo HTTP disponible
 	if content != nil {
-		s.saveToCache(targetURL, content)
+		s.saveToCache(ctx, targetURL, content)
 		return content, nil
 	}
 
@@ -220,7 +274,11 @@ func (s *Scraper) ScrapeForAI(ctx context.Context, targetURL string, maxChars in
 		return "", fmt.Errorf("scraping falló: %s", content.Error)
 	}
 
-	// Formatear para IA
+	return FormatForAI(content, maxChars), nil
+}
+
+// FormatForAI da formato de contexto para la IA a una pagina extraida
+func FormatForAI(content *ScrapedContent, maxChars int) string {
 	result := fmt.Sprintf("=== Contenido de: %s ===\n", content.URL)
 	if content.Title != "" {
 		result += fmt.Sprintf("Título: %s\n", content.Title)
@@ -233,7 +291,47 @@ func (s *Scraper) ScrapeForAI(ctx context.Context, targetURL string, maxChars in
 	}
 	result += text
 
-	return result, nil
+	return result
+}
+
+// RecordFetch guarda en url_fetches quien pidio una URL y con que resultado.
+// userID 0 indica una descarga del sistema (sin usuario).
+func (s *Scraper) RecordFetch(ctx context.Context, userID int64, targetURL string, content *ScrapedContent, fetchErr error) {
+	if s.queries == nil {
+		return
+	}
+
+	status := "fetched"
+	var errText, hash string
+	switch {
+	case errors.Is(fetchErr, ErrFetchBlocked):
+		status = "blocked"
+		errText = fetchErr.Error()
+	case fetchErr != nil:
+		status = "error"
+		errText = fetchErr.Error()
+	case content == nil || !content.Success:
+		status = "error"
+		if content != nil {
+			errText = content.Error
+		}
+	case content.Cached:
+		status = "cached"
+	}
+	if content != nil {
+		hash = content.ContentHash
+	}
+
+	err := s.queries.CreateURLFetch(ctx, db.CreateURLFetchParams{
+		UserID:      sql.NullInt64{Int64: userID, Valid: userID != 0},
+		Url:         targetURL,
+		Status:      status,
+		ContentHash: sql.NullString{String: hash, Valid: hash != ""},
+		Error:       sql.NullString{String: errText, Valid: errText != ""},
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error registrando descarga de %s: %v", targetURL, err)
+	}
 }
 
 // scrapeHTTP extrae contenido usando HTTP simple
@@ -264,6 +362,9 @@ func (s *Scraper) scrapeHTTP(ctx context.Context, targetURL string) (*ScrapedCon
 		resp, err := s.httpClient.Do(req)
 		if err != nil {
 			lastErr = err
+			if errors.Is(err, ErrFetchBlocked) {
+				return nil, err
+			}
 			continue
 		}
 
@@ -305,7 +406,7 @@ func (s *Scraper) scrapeHTTP(ctx context.Context, targetURL string) (*ScrapedCon
 		}, nil
 	}
 
-	return nil, fmt.Errorf("después de %d intentos: %v", s.config.MaxRetries+1, lastErr)
+	return nil, fmt.Errorf("después de %d intentos: %w", s.config.MaxRetries+1, lastErr)
 }
 
 // parseHTML extrae título y contenido de texto del HTML
@@ -437,30 +538,6 @@ func (s *Scraper) contentLooksComplete(content *ScrapedContent) bool {
 	return true
 }
 
-// checkDomain verifica si el dominio está permitido
-func (s *Scraper) checkDomain(domain string) error {
-	domain = strings.ToLower(domain)
-
-	// Verificar blocklist
-	for _, blocked := range s.config.BlockedDomains {
-		if strings.Contains(domain, strings.ToLower(blocked)) {
-			return fmt.Errorf("dominio bloqueado: %s", domain)
-		}
-	}
-
-	// Verificar allowlist (si está configurada)
-	if len(s.config.AllowedDomains) > 0 {
-		for _, allowed := range s.config.AllowedDomains {
-			if strings.Contains(domain, strings.ToLower(allowed)) {
-				return nil
-			}
-		}
-		return fmt.Errorf("dominio no permitido: %s", domain)
-	}
-
-	return nil
-}
-
 // waitForRateLimit espera si es necesario por rate limiting
 func (s *Scraper) waitForRateLimit(ctx context.Context, domain string) error {
 	s.rlMutex.Lock()
@@ -502,8 +579,28 @@ func (s *Scraper) waitForRateLimit(ctx context.Context, domain string) error {
 	return nil
 }
 
-// getFromCache obtiene contenido del cache
-func (s *Scraper) getFromCache(url string) *ScrapedContent {
+// getFromCache obtiene contenido del cache si no ha vencido
+func (s *Scraper) getFromCache(ctx context.Context, url string) *ScrapedContent {
+	if s.queries != nil {
+		page, err := s.queries.GetFreshScrapedPage(ctx, url)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("[WARN] Error leyendo cache de %s: %v", url, err)
+			}
+			return nil
+		}
+		return &ScrapedContent{
+			URL:         page.Url,
+			Title:       page.Title.String,
+			Content:     page.Content,
+			ContentHash: page.ContentHash,
+			ScrapedAt:   page.ScrapedAt.Time,
+			Method:      page.Method.String,
+			Success:     true,
+			Cached:      true,
+		}
+	}
+
 	s.cacheMutex.RLock()
 	defer s.cacheMutex.RUnlock()
 
@@ -516,11 +613,32 @@ func (s *Scraper) getFromCache(url string) *ScrapedContent {
 		return nil
 	}
 
-	return entry.content
+	cached := *entry.content
+	cached.Cached = true
+	return &cached
 }
 
 // saveToCache guarda contenido en cache
-func (s *Scraper) saveToCache(url string, content *ScrapedContent) {
+func (s *Scraper) saveToCache(ctx context.Context, url string, content *ScrapedContent) {
+	if !s.config.EnableCache || !content.Success {
+		return
+	}
+
+	if s.queries != nil {
+		_, err := s.queries.UpsertScrapedPage(ctx, db.UpsertScrapedPageParams{
+			Url:         url,
+			Title:       sql.NullString{String: content.Title, Valid: true},
+			Content:     content.Content,
+			ContentHash: content.ContentHash,
+			Method:      sql.NullString{String: content.Method, Valid: true},
+			Ttl:         fmt.Sprintf("+%d seconds", int(s.config.CacheTTL.Seconds())),
+		})
+		if err != nil {
+			log.Printf("[WARN] Error guardando cache de %s: %v", url, err)
+		}
+		return
+	}
+
 	s.cacheMutex.Lock()
 	defer s.cacheMutex.Unlock()
 
@@ -532,6 +650,13 @@ func (s *Scraper) saveToCache(url string, content *ScrapedContent) {
 
 // ClearCache limpia el cache
 func (s *Scraper) ClearCache() {
+	if s.queries != nil {
+		if _, err := s.queries.DeleteAllScrapedPages(context.Background()); err != nil {
+			log.Printf("[ERROR] Error limpiando cache de paginas: %v", err)
+		}
+		return
+	}
+
 	s.cacheMutex.Lock()
 	defer s.cacheMutex.Unlock()
 	s.cache = make(map[string]*cacheEntry)
@@ -539,10 +664,18 @@ func (s *Scraper) ClearCache() {
 
 // scrapeBrowser extrae contenido usando browser headless
 func (s *Scraper) scrapeBrowser(ctx context.Context, targetURL string) (*ScrapedContent, error) {
+	// Las peticiones del browser pasan por la politica (BrowserScraper.guard); validar
+	// antes las IPs del host evita lanzar el browser para una URL que se va a rechazar
+	if parsedURL, err := url.Parse(targetURL); err == nil {
+		if err := s.policy.Resolve(ctx, parsedURL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+
 	s.browserMutex.Lock()
 	if s.browserScraper == nil {
 		var err error
-		s.browserScraper, err = NewBrowserScraper(s.config)
+		s.browserScraper, err = NewBrowserScraper(s.config, s.httpClient, s.policy)
 		if err != nil {
 			s.browserMutex.Unlock()
 			return nil, fmt.Errorf("error inicializando browser: %w", err)
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"chat-empleados/db"
+)
+
+func TestRecordFetch(t *testing.T) {
+	queries, _ := newTestQueries(t)
+	ctx := context.Background()
+	user := createTestUser(t, queries)
+	scraper := NewScraper(DefaultScraperConfig(), queries)
+
+	blocked := fmt.Errorf("%w: dominio bloqueado: evil.com", ErrFetchBlocked)
+	tests := []struct {
+		url     string
+		userID  int64
+		content *ScrapedContent
+		err     error
+		status  string
+		hash    string
+		errText string
+	}{
+		{"https://a.com", user.ID, &ScrapedContent{Success: true, ContentHash: "h1"}, nil, "fetched", "h1", ""},
+		{"https://b.com", user.ID, &ScrapedContent{Success: true, Cached: true, ContentHash: "h2"}, nil, "cached", "h2", ""},
+		{"https://evil.com", user.ID, &ScrapedContent{Success: false, Error: blocked.Error()}, blocked, "blocked", "", blocked.Error()},
+		{"https://c.com", 0, nil, errors.New("timeout"), "error", "", "timeout"},
+		{"https://d.com", 0, &ScrapedContent{Success: false, Error: "HTTP 404"}, nil, "error", "", "HTTP 404"},
+	}
+	for _, tt := range tests {
+		scraper.RecordFetch(ctx, tt.userID, tt.url, tt.content, tt.err)
+	}
+
+	fetches, err := queries.GetRecentURLFetches(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetches) != len(tests) {
+		t.Fatalf("se registraron %d descargas, se esperaban %d", len(fetches), len(tests))
+	}
+	for i, tt := range tests {
+		// Las descargas vienen de la mas reciente a la mas antigua
+		got := fetches[len(fetches)-1-i]
+		if got.Url != tt.url || got.Status != tt.status || got.ContentHash.String != tt.hash || got.Error.String != tt.errText {
+			t.Errorf("descarga de %s = %s %q %q, se esperaba %s %q %q", tt.url, got.Status, got.ContentHash.String, got.Error.String, tt.status, tt.hash, tt.errText)
+		}
+		if got.UserID.Valid != (tt.userID != 0) {
+			t.Errorf("descarga de %s: usuario = %+v", tt.url, got.UserID)
+		}
+	}
+}
+
+func createTestUser(t *testing.T, queries *db.Queries) db.User {
+	t.Helper()
+	user, err := queries.CreateUser(context.Background(), db.CreateUserParams{
+		Nomina:       "1001",
+		PasswordHash: "x",
+		Nombre:       "Ana",
+	})
+	if err != nil {
+		t.Fatalf("error creando usuario: %v", err)
+	}
+	return user
+}
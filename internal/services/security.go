@@ -3,11 +3,13 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"log"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"chat-empleados/db"
 )
@@ -33,6 +35,45 @@ type SecurityFilter struct {
 	Severity    string
 	compiled    *regexp.Regexp
 	keywords    []string
+	matcher     *regexp.Regexp // encuentra todas las coincidencias (conteo y redaccion)
+}
+
+// FilterHit coincidencias de un filtro en un mensaje; se guarda como JSON en filter_hits
+type FilterHit struct {
+	FilterID   int64  `json:"filter_id"`
+	FilterName string `json:"filter_name"`
+	Action     string `json:"action"`
+	Count      int    `json:"count"`
+}
+
+// ContentReview resultado de evaluar todos los filtros sobre un contenido
+type ContentReview struct {
+	Content string        // contenido con las coincidencias de redact/mask reemplazadas
+	Hits    []FilterHit   // todos los filtros que coincidieron
+	Blocked *FilterResult // primer filtro de bloqueo que coincidio, si alguno
+}
+
+// HitsJSON serializa las coincidencias para guardarlas junto al mensaje
+func (r *ContentReview) HitsJSON() sql.NullString {
+	if r == nil || len(r.Hits) == 0 {
+		return sql.NullString{String: "", Valid: true}
+	}
+	data, _ := json.Marshal(r.Hits)
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// Redactions cuenta los datos sensibles reemplazados en el contenido
+func (r *ContentReview) Redactions() int {
+	if r == nil {
+		return 0
+	}
+	count := 0
+	for _, hit := range r.Hits {
+		if hit.Action == "redact" || hit.Action == "mask" {
+			count += hit.Count
+		}
+	}
+	return count
 }
 
 type SecurityService struct {
@@ -40,11 +81,13 @@ type SecurityService struct {
 	filters      []SecurityFilter
 	filtersMutex sync.RWMutex
 	lastUpdate   time.Time
+	enabled      bool
 }
 
 func NewSecurityService(queries *db.Queries) *SecurityService {
 	s := &SecurityService{
 		queries: queries,
+		enabled: true,
 	}
 	s.ReloadFilters(context.Background())
 	return s
@@ -88,6 +131,7 @@ func (s *SecurityService) ReloadFilters(ctx context.Context) error {
 				sf.keywords[i] = strings.TrimSpace(sf.keywords[i])
 			}
 		}
+		sf.matcher = sf.buildMatcher()
 
 		s.filters = append(s.filters, sf)
 	}
@@ -105,69 +149,321 @@ func (s *SecurityService) CheckOutput(ctx context.Context, content string) *Filt
 	return s.checkContent(ctx, content, "output")
 }
 
+// ReviewInput evalua todos los filtros de entrada: redacta los datos sensibles y reporta
+// cada coincidencia, en lugar de detenerse en la primera como CheckInput
+func (s *SecurityService) ReviewInput(ctx context.Context, content string) *ContentReview {
+	return s.review(content, "input")
+}
+
+// ReviewOutput evalua todos los filtros de salida sobre una respuesta completa de la IA
+func (s *SecurityService) ReviewOutput(ctx context.Context, content string) *ContentReview {
+	return s.review(content, "output")
+}
+
+// ReviewFile evalua el texto extraido de un archivo adjunto con los filtros de entrada y
+// los que aplican solo a archivos
+func (s *SecurityService) ReviewFile(ctx context.Context, content string) *ContentReview {
+	return s.review(content, "file")
+}
+
+// SetEnabled habilita o deshabilita la aplicacion de filtros de contenido
+func (s *SecurityService) SetEnabled(enabled bool) {
+	s.filtersMutex.Lock()
+	defer s.filtersMutex.Unlock()
+	if s.enabled != enabled {
+		log.Printf("[INFO] Filtros de seguridad habilitados: %v", enabled)
+	}
+	s.enabled = enabled
+}
+
 func (s *SecurityService) checkContent(ctx context.Context, content string, direction string) *FilterResult {
 	s.filtersMutex.RLock()
 	defer s.filtersMutex.RUnlock()
 
+	if !s.enabled {
+		return nil
+	}
+
 	contentLower := strings.ToLower(content)
 
 	for _, filter := range s.filters {
-		if filter.AppliesTo != "both" && filter.AppliesTo != direction {
+		if !filter.appliesTo(direction) {
 			continue
 		}
 
-		var matched bool
-		var matchedText string
+		if matchedText, matched := filter.match(content, contentLower); matched {
+			return filter.result(matchedText)
+		}
+	}
 
-		switch filter.FilterType {
-		case "regex":
-			if filter.compiled != nil {
-				if match := filter.compiled.FindString(content); match != "" {
-					matched = true
-					matchedText = match
-				}
-			}
-		case "keyword":
-			for _, keyword := range filter.keywords {
-				if strings.Contains(contentLower, keyword) {
-					matched = true
-					matchedText = keyword
-					break
-				}
-			}
-		case "category":
-			if strings.Contains(contentLower, strings.ToLower(filter.Pattern)) {
-				matched = true
-				matchedText = filter.Pattern
+	return nil
+}
+
+func (s *SecurityService) review(content string, direction string) *ContentReview {
+	s.filtersMutex.RLock()
+	defer s.filtersMutex.RUnlock()
+
+	review := &ContentReview{Content: content}
+	if !s.enabled {
+		return review
+	}
+
+	// Primero se reemplazan los datos sensibles; el resto de filtros revisa el texto ya redactado
+	review.Content, review.Hits = s.redactContent(content, direction)
+
+	contentLower := strings.ToLower(review.Content)
+	for _, filter := range s.filters {
+		if !filter.appliesTo(direction) || filter.redacts() {
+			continue
+		}
+
+		matchedText, matched := filter.match(review.Content, contentLower)
+		if !matched {
+			continue
+		}
+
+		count := 1
+		if filter.matcher != nil {
+			count = max(1, len(filter.matcher.FindAllStringIndex(review.Content, -1)))
+		}
+		review.Hits = append(review.Hits, FilterHit{
+			FilterID:   filter.ID,
+			FilterName: filter.Name,
+			Action:     filter.Action,
+			Count:      count,
+		})
+
+		if filter.Action == "block" && review.Blocked == nil {
+			review.Blocked = filter.result(matchedText)
+		}
+	}
+
+	return review
+}
+
+// redactContent reemplaza las coincidencias de los filtros redact/mask; requiere el mutex tomado
+func (s *SecurityService) redactContent(content string, direction string) (string, []FilterHit) {
+	var hits []FilterHit
+	for _, filter := range s.filters {
+		if !filter.appliesTo(direction) || !filter.redacts() || filter.matcher == nil {
+			continue
+		}
+
+		count := 0
+		content = filter.matcher.ReplaceAllStringFunc(content, func(match string) string {
+			count++
+			return filter.replacement(match)
+		})
+		if count > 0 {
+			hits = append(hits, FilterHit{
+				FilterID:   filter.ID,
+				FilterName: filter.Name,
+				Action:     filter.Action,
+				Count:      count,
+			})
+		}
+	}
+	return content, hits
+}
+
+// redact aplica solo los filtros redact/mask
+func (s *SecurityService) redact(content string, direction string) string {
+	s.filtersMutex.RLock()
+	defer s.filtersMutex.RUnlock()
+
+	if !s.enabled {
+		return content
+	}
+	redacted, _ := s.redactContent(content, direction)
+	return redacted
+}
+
+// redactionBoundary mueve cut al final de cualquier coincidencia de redact/mask que lo cruce,
+// para no partir un dato sensible entre dos fragmentos enviados
+func (s *SecurityService) redactionBoundary(content string, cut int, direction string) int {
+	s.filtersMutex.RLock()
+	defer s.filtersMutex.RUnlock()
+
+	if !s.enabled {
+		return cut
+	}
+
+	for _, filter := range s.filters {
+		if !filter.appliesTo(direction) || !filter.redacts() || filter.matcher == nil {
+			continue
+		}
+		for _, loc := range filter.matcher.FindAllStringIndex(content, -1) {
+			if loc[0] < cut && loc[1] > cut {
+				cut = loc[1]
 			}
 		}
+	}
+	return cut
+}
+
+// checkBlocking devuelve la primera coincidencia de un filtro que bloquea; a diferencia de
+// checkContent no se detiene en un filtro de advertencia o registro que coincida antes
+func (s *SecurityService) checkBlocking(content string, direction string) *FilterResult {
+	s.filtersMutex.RLock()
+	defer s.filtersMutex.RUnlock()
+
+	if !s.enabled {
+		return nil
+	}
+
+	contentLower := strings.ToLower(content)
+
+	for _, filter := range s.filters {
+		if filter.Action != "block" || !filter.appliesTo(direction) {
+			continue
+		}
+
+		if matchedText, matched := filter.match(content, contentLower); matched {
+			return filter.result(matchedText)
+		}
+	}
 
-		if matched {
-			result := &FilterResult{
-				FilterID:    filter.ID,
-				FilterName:  filter.Name,
-				Action:      filter.Action,
-				Severity:    filter.Severity,
-				MatchedText: matchedText,
+	return nil
+}
+
+// appliesTo indica si el filtro revisa esa direccion; los archivos adjuntos son entrada
+// del usuario, asi que tambien los revisan los filtros de entrada
+func (f SecurityFilter) appliesTo(direction string) bool {
+	if direction == "file" && f.AppliesTo == "input" {
+		return true
+	}
+	return f.AppliesTo == "both" || f.AppliesTo == direction
+}
+
+// redacts indica si el filtro reemplaza las coincidencias en lugar de solo detectarlas
+func (f SecurityFilter) redacts() bool {
+	return f.Action == "redact" || f.Action == "mask"
+}
+
+// buildMatcher arma la expresion que encuentra todas las coincidencias del filtro
+func (f SecurityFilter) buildMatcher() *regexp.Regexp {
+	switch f.FilterType {
+	case "regex":
+		return f.compiled
+	case "keyword":
+		quoted := make([]string, 0, len(f.keywords))
+		for _, keyword := range f.keywords {
+			if keyword != "" {
+				quoted = append(quoted, regexp.QuoteMeta(keyword))
 			}
+		}
+		if len(quoted) == 0 {
+			return nil
+		}
+		return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	case "category":
+		if f.Pattern == "" {
+			return nil
+		}
+		return regexp.MustCompile("(?i)" + regexp.QuoteMeta(f.Pattern))
+	}
+	return nil
+}
+
+// replacement texto que sustituye una coincidencia: redact la cambia por una etiqueta con el
+// nombre del filtro y mask oculta letras y digitos salvo los ultimos 4 (ej: ************1111)
+func (f SecurityFilter) replacement(match string) string {
+	if f.Action == "redact" {
+		return "[REDACTADO:" + f.Name + "]"
+	}
+
+	total := 0
+	for _, r := range match {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			total++
+		}
+	}
 
-			switch filter.Action {
-			case "block":
-				result.Blocked = true
-				result.Reason = "Contenido bloqueado por politica de seguridad: " + filter.Name
-			case "warn":
-				result.Blocked = false
-				result.Reason = "Advertencia de seguridad: " + filter.Name
-			case "log":
-				result.Blocked = false
-				result.Reason = "Contenido registrado: " + filter.Name
+	var b strings.Builder
+	seen := 0
+	for _, r := range match {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			seen++
+			if total > 4 && seen > total-4 {
+				b.WriteRune(r)
+			} else {
+				b.WriteRune('*')
 			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
 
-			return result
+// match indica si el filtro coincide con el contenido y con que texto
+func (f SecurityFilter) match(content, contentLower string) (string, bool) {
+	switch f.FilterType {
+	case "regex":
+		if f.compiled != nil {
+			if match := f.compiled.FindString(content); match != "" {
+				return match, true
+			}
+		}
+	case "keyword":
+		for _, keyword := range f.keywords {
+			if strings.Contains(contentLower, keyword) {
+				return keyword, true
+			}
+		}
+	case "category":
+		if strings.Contains(contentLower, strings.ToLower(f.Pattern)) {
+			return f.Pattern, true
 		}
 	}
+	return "", false
+}
 
-	return nil
+func (f SecurityFilter) result(matchedText string) *FilterResult {
+	result := &FilterResult{
+		FilterID:    f.ID,
+		FilterName:  f.Name,
+		Action:      f.Action,
+		Severity:    f.Severity,
+		MatchedText: matchedText,
+	}
+
+	switch f.Action {
+	case "block":
+		result.Blocked = true
+		result.Reason = "Contenido bloqueado por politica de seguridad: " + f.Name
+	case "warn":
+		result.Blocked = false
+		result.Reason = "Advertencia de seguridad: " + f.Name
+	case "log":
+		result.Blocked = false
+		result.Reason = "Contenido registrado: " + f.Name
+	case "redact", "mask":
+		result.Blocked = false
+		result.Reason = "Contenido redactado: " + f.Name
+	}
+
+	return result
+}
+
+// streamHoldback cuantos bytes de la respuesta se retienen mientras llega: lo suficiente
+// para que una coincidencia se complete antes de que su inicio llegue al navegador
+func (s *SecurityService) streamHoldback() int {
+	s.filtersMutex.RLock()
+	defer s.filtersMutex.RUnlock()
+
+	holdback := minStreamHoldback
+	for _, filter := range s.filters {
+		switch filter.FilterType {
+		case "keyword":
+			for _, keyword := range filter.keywords {
+				holdback = max(holdback, len(keyword))
+			}
+		case "category":
+			holdback = max(holdback, len(filter.Pattern))
+		}
+	}
+	return holdback
 }
 
 func (s *SecurityService) LogViolation(ctx context.Context, userID int64, filterID sql.NullInt64, content, action, ip, userAgent string) error {
@@ -245,6 +541,21 @@ func (s *SecurityService) ValidateConversationAccess(ctx context.Context, conver
 	return conv.UserID == userID, nil
 }
 
+// ValidateDMThreadAccess verifica que el usuario participe en el hilo de mensajes directos
+func (s *SecurityService) ValidateDMThreadAccess(ctx context.Context, threadID, userID int64) (bool, error) {
+	_, err := s.queries.GetDMParticipant(ctx, db.GetDMParticipantParams{
+		ThreadID: threadID,
+		UserID:   userID,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func stringValue(ns sql.NullString) string {
 	if ns.Valid {
 		return ns.String
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hojas de calculo como tablas: los CSV y XLSX adjuntos, ademas de aplanarse a texto, se
+// cargan por filas y columnas para que los totales, promedios y agrupaciones se calculen
+// sobre todas las filas y no sobre lo que el modelo alcanza a leer (ver tablequery.go).
+
+const (
+	maxTableRows    = 50000 // filas por hoja que se cargan para calcular
+	maxTableColumns = 200
+)
+
+// Table una hoja de un archivo adjunto. La primera fila con datos son los encabezados.
+type Table struct {
+	File    string     `json:"-"`
+	Name    string     `json:"name"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// extractTables carga las hojas de un CSV o XLSX; otros tipos no tienen tablas
+func (fp *FileProcessor) extractTables(fileName, ext string, content []byte) (tables []*Table, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tables, err = nil, fmt.Errorf("malformed file: %v", r)
+		}
+	}()
+
+	switch ext {
+	case ".csv":
+		table, err := parseCSVTable(strings.TrimSuffix(fileName, path.Ext(fileName)), content)
+		if err != nil {
+			return nil, err
+		}
+		tables = []*Table{table}
+	case ".xlsx":
+		tables, err = parseXLSXTables(content)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	for _, table := range tables {
+		table.File = fileName
+	}
+	return tables, nil
+}
+
+// newTable arma la tabla a partir de las filas leidas: quita filas vacias y los titulos
+// de una sola celda que suelen ir arriba de los encabezados, toma la primera fila restante
+// como encabezados (sin repetidos ni vacios) y completa las filas cortas
+func newTable(name string, records [][]string) *Table {
+	table := &Table{Name: name}
+
+	var nonEmpty [][]string
+	for _, record := range records {
+		for len(record) > 0 && strings.TrimSpace(record[len(record)-1]) == "" {
+			record = record[:len(record)-1]
+		}
+		if len(record) > maxTableColumns {
+			record = record[:maxTableColumns]
+		}
+		if len(record) > 0 {
+			nonEmpty = append(nonEmpty, record)
+		}
+	}
+	for i := 0; i < len(nonEmpty) && i < 10; i++ {
+		if filledCells(nonEmpty[i]) > 1 {
+			nonEmpty = nonEmpty[i:]
+			break
+		}
+	}
+
+	width := 0
+	for _, record := range nonEmpty {
+		if table.Columns == nil {
+			table.Columns = record
+			width = len(record)
+			continue
+		}
+		if len(table.Rows) >= maxTableRows {
+			break
+		}
+		width = max(width, len(record))
+		table.Rows = append(table.Rows, record)
+	}
+
+	seen := make(map[string]int)
+	columns := make([]string, width)
+	for i := range columns {
+		name := ""
+		if i < len(table.Columns) {
+			name = strings.TrimSpace(table.Columns[i])
+		}
+		if name == "" {
+			name = fmt.Sprintf("Columna %d", i+1)
+		}
+		key := strings.ToLower(name)
+		seen[key]++
+		if seen[key] > 1 {
+			name = fmt.Sprintf("%s (%d)", name, seen[key])
+		}
+		columns[i] = name
+	}
+	table.Columns = columns
+
+	for i, row := range table.Rows {
+		for j := range row {
+			row[j] = strings.TrimSpace(row[j])
+		}
+		if len(row) < width {
+			table.Rows[i] = append(row, make([]string, width-len(row))...)
+		}
+	}
+	return table
+}
+
+func filledCells(record []string) int {
+	count := 0
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// --- CSV ---
+
+// parseCSVTable lee un CSV detectando el separador: Excel en espanol exporta con ";"
+func parseCSVTable(name string, content []byte) (*Table, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = csvDelimiter(content)
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	var records [][]string
+	for len(records) <= maxTableRows {
+		record, err := reader.Read()
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				continue
+			}
+			break
+		}
+		records = append(records, record)
+	}
+
+	table := newTable(name, records)
+	if len(table.Columns) == 0 {
+		return nil, fmt.Errorf("invalid CSV file: no rows")
+	}
+	return table, nil
+}
+
+func csvDelimiter(content []byte) rune {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	best, bestCount := ',', 0
+	for _, sep := range []rune{',', ';', '\t', '|'} {
+		if count := bytes.Count(line, []byte(string(sep))); count > bestCount {
+			best, bestCount = sep, count
+		}
+	}
+	return best
+}
+
+// --- XLSX ---
+
+var worksheetFileName = regexp.MustCompile(`^xl/worksheets/sheet(\d+)\.xml$`)
+
+// parseXLSXTables lee las hojas en el orden del libro. Las celdas con formato de fecha se
+// convierten a AAAA-MM-DD para poder filtrar y agrupar por fecha.
+func parseXLSXTables(content []byte) ([]*Table, error) {
+	files, err := zipFiles(content, "XLSX")
+	if err != nil {
+		return nil, err
+	}
+
+	shared := xlsxSharedStrings(files)
+	dateStyles := xlsxDateStyles(files)
+
+	var tables []*Table
+	for _, sheet := range xlsxSheets(files) {
+		data, err := readZipFile(sheet.file)
+		if err != nil {
+			continue
+		}
+		tables = append(tables, newTable(sheet.name, xlsxSheetRows(data, shared, dateStyles)))
+	}
+	if len(tables) == 0 {
+		return nil, fmt.Errorf("invalid XLSX file: no sheets")
+	}
+	return tables, nil
+}
+
+type xlsxSheet struct {
+	name string
+	file *zip.File
+}
+
+// xlsxSheets devuelve las hojas de workbook.xml; si no se puede leer, por numero de archivo
+func xlsxSheets(files map[string]*zip.File) []xlsxSheet {
+	targets := make(map[string]string)
+	for _, rel := range pptxRelationships(files, "xl/_rels/workbook.xml.rels", "xl") {
+		targets[rel.ID] = rel.Target
+	}
+
+	var sheets []xlsxSheet
+	if file, ok := files["xl/workbook.xml"]; ok {
+		if data, err := readZipFile(file); err == nil {
+			decoder := xml.NewDecoder(bytes.NewReader(data))
+			for {
+				tok, err := decoder.Token()
+				if err != nil {
+					break
+				}
+				start, ok := tok.(xml.StartElement)
+				if !ok || start.Name.Local != "sheet" {
+					continue
+				}
+				for _, attr := range start.Attr {
+					if attr.Name.Local == "id" && attr.Name.Space != "" {
+						if target, ok := files[targets[attr.Value]]; ok {
+							sheets = append(sheets, xlsxSheet{name: odfAttr(start, "name"), file: target})
+						}
+					}
+				}
+			}
+		}
+	}
+	if len(sheets) > 0 {
+		return sheets
+	}
+
+	var names []string
+	for name := range files {
+		if worksheetFileName.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, _ := strconv.Atoi(worksheetFileName.FindStringSubmatch(names[i])[1])
+		b, _ := strconv.Atoi(worksheetFileName.FindStringSubmatch(names[j])[1])
+		return a < b
+	})
+	for i, name := range names {
+		sheets = append(sheets, xlsxSheet{name: fmt.Sprintf("Hoja%d", i+1), file: files[name]})
+	}
+	return sheets
+}
+
+// xlsxSharedStrings lee la tabla de textos compartidos; cada <si> puede tener varios
+// fragmentos con formato (<r><t>) y guias foneticas (<rPh>) que no son parte del texto
+func xlsxSharedStrings(files map[string]*zip.File) []string {
+	file, ok := files["xl/sharedStrings.xml"]
+	if !ok {
+		return nil
+	}
+	data, err := readZipFile(file)
+	if err != nil {
+		return nil
+	}
+
+	var strs []string
+	var current strings.Builder
+	inText, inPhonetic := false, false
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				strs = append(strs, current.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				current.Write(t)
+			}
+		}
+	}
+	return strs
+}
+
+// xlsxDateStyles indica que estilos de celda (atributo s) tienen formato de fecha
+func xlsxDateStyles(files map[string]*zip.File) map[int]bool {
+	file, ok := files["xl/styles.xml"]
+	if !ok {
+		return nil
+	}
+	data, err := readZipFile(file)
+	if err != nil {
+		return nil
+	}
+
+	customDate := make(map[int]bool)
+	dateStyles := make(map[int]bool)
+	inCellXfs, xf := false, 0
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "numFmt":
+				id, _ := strconv.Atoi(odfAttr(t, "numFmtId"))
+				customDate[id] = isDateFormatCode(odfAttr(t, "formatCode"))
+			case "cellXfs":
+				inCellXfs = true
+			case "xf":
+				if inCellXfs {
+					id, _ := strconv.Atoi(odfAttr(t, "numFmtId"))
+					if (id >= 14 && id <= 22) || (id >= 45 && id <= 47) || customDate[id] {
+						dateStyles[xf] = true
+					}
+					xf++
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "cellXfs" {
+				inCellXfs = false
+			}
+		}
+	}
+	return dateStyles
+}
+
+var formatLiterals = regexp.MustCompile(`"[^"]*"|\[[^\]]*\]|\\.`)
+
+func isDateFormatCode(code string) bool {
+	code = strings.ToLower(formatLiterals.ReplaceAllString(code, ""))
+	return strings.ContainsAny(code, "dy") || (strings.Contains(code, "m") && strings.Contains(code, "h"))
+}
+
+// xlsxSheetRows lee las celdas de una hoja; la referencia (ej. "C5") ubica cada valor
+// porque las celdas vacias no se escriben
+func xlsxSheetRows(data []byte, shared []string, dateStyles map[int]bool) [][]string {
+	var rows [][]string
+	var row []string
+	var value strings.Builder
+	cellType, cellStyle, col := "", 0, 0
+	inValue := false
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = nil
+			case "c":
+				cellType = odfAttr(t, "t")
+				cellStyle, _ = strconv.Atoi(odfAttr(t, "s"))
+				col = xlsxColumnIndex(odfAttr(t, "r"))
+				if col < 0 {
+					col = len(row)
+				}
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				if col >= maxTableColumns {
+					continue
+				}
+				for len(row) <= col {
+					row = append(row, "")
+				}
+				row[col] = xlsxCellValue(value.String(), cellType, dateStyles[cellStyle], shared)
+			case "row":
+				rows = append(rows, row)
+				if len(rows) > maxTableRows {
+					return rows
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	}
+	return rows
+}
+
+func xlsxCellValue(raw, cellType string, isDate bool, shared []string) string {
+	switch cellType {
+	case "s":
+		idx, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || idx < 0 || idx >= len(shared) {
+			return ""
+		}
+		return shared[idx]
+	case "b":
+		if strings.TrimSpace(raw) == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "str", "inlineStr", "e":
+		return raw
+	}
+
+	if isDate {
+		if serial, err := strconv.ParseFloat(raw, 64); err == nil {
+			return excelDate(serial)
+		}
+	}
+	return raw
+}
+
+// excelDate convierte el numero de serie de Excel (dias desde 1899-12-30) a fecha
+func excelDate(serial float64) string {
+	days := math.Floor(serial)
+	date := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(days))
+	if seconds := math.Round((serial - days) * 86400); seconds > 0 {
+		return date.Add(time.Duration(seconds) * time.Second).Format("2006-01-02 15:04")
+	}
+	return date.Format("2006-01-02")
+}
+
+// xlsxColumnIndex convierte la letra de la referencia de celda ("C5", "AA10") a indice;
+// -1 si la celda no trae referencia
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		if col > maxTableColumns {
+			return maxTableColumns
+		}
+	}
+	return col - 1
+}
+
+// formatTablesText aplana las hojas a texto para el contexto del modelo
+func formatTablesText(tables []*Table) string {
+	var out strings.Builder
+	for _, table := range tables {
+		out.WriteString(fmt.Sprintf("[Hoja %s]\n", table.Name))
+		if len(table.Columns) == 0 {
+			out.WriteString("\n")
+			continue
+		}
+		out.WriteString("Encabezados: ")
+		out.WriteString(strings.Join(table.Columns, " | "))
+		out.WriteString("\n")
+		for i, row := range table.Rows {
+			if i == maxSheetRows {
+				out.WriteString(fmt.Sprintf("... y %d filas mas\n", len(table.Rows)-maxSheetRows))
+				break
+			}
+			out.WriteString(fmt.Sprintf("Fila %d: %s\n", i+1, strings.Join(row, " | ")))
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		records [][]string
+		columns []string
+		rows    [][]string
+	}{
+		{
+			name: "titulos de una celda arriba de los encabezados",
+			records: [][]string{
+				{"Reporte de scrap"},
+				{"", "", ""},
+				{"Planta Norte", ""},
+				{"Línea", "Scrap"},
+				{"L1", "10"},
+			},
+			columns: []string{"Línea", "Scrap"},
+			rows:    [][]string{{"L1", "10"}},
+		},
+		{
+			name: "encabezados vacios y repetidos",
+			records: [][]string{
+				{"Parte", "", "parte", " Parte ", "PPM"},
+				{"X1", "a", "b", "c", "5"},
+			},
+			columns: []string{"Parte", "Columna 2", "parte (2)", "Parte (3)", "PPM"},
+			rows:    [][]string{{"X1", "a", "b", "c", "5"}},
+		},
+		{
+			name: "filas cortas se completan y las largas agregan columnas",
+			records: [][]string{
+				{"A", "B"},
+				{" 1 "},
+				{"2", "3", "4"},
+				{"5", "", "", ""},
+			},
+			columns: []string{"A", "B", "Columna 3"},
+			rows:    [][]string{{"1", "", ""}, {"2", "3", "4"}, {"5", "", ""}},
+		},
+		{
+			name: "solo se buscan titulos en las primeras 10 filas",
+			records: [][]string{
+				{"t1"}, {"t2"}, {"t3"}, {"t4"}, {"t5"}, {"t6"}, {"t7"}, {"t8"}, {"t9"}, {"t10"},
+				{"A", "B"},
+				{"1", "2"},
+			},
+			columns: []string{"t1", "Columna 2"},
+			rows:    [][]string{{"t2", ""}, {"t3", ""}, {"t4", ""}, {"t5", ""}, {"t6", ""}, {"t7", ""}, {"t8", ""}, {"t9", ""}, {"t10", ""}, {"A", "B"}, {"1", "2"}},
+		},
+		{
+			name: "tabla de una sola columna",
+			records: [][]string{
+				{"Parte"},
+				{"X1"},
+			},
+			columns: []string{"Parte"},
+			rows:    [][]string{{"X1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newTable("Hoja1", tt.records)
+			if !reflect.DeepEqual(table.Columns, tt.columns) {
+				t.Errorf("columnas = %q, se esperaban %q", table.Columns, tt.columns)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) {
+				t.Errorf("filas = %q, se esperaban %q", table.Rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestCSVDelimiter(t *testing.T) {
+	tests := []struct {
+		content string
+		want    rune
+	}{
+		{"Parte;Descripcion;PPM\nX1;\"a, b\";5", ';'},
+		{"Parte,Descripcion,PPM\nX1;a;b;c;d", ','},
+		{"Parte\tDescripcion\tPPM", '\t'},
+		{"Parte|Descripcion|PPM", '|'},
+		{"Parte", ','},
+		{"", ','},
+	}
+	for _, tt := range tests {
+		if got := csvDelimiter([]byte(tt.content)); got != tt.want {
+			t.Errorf("csvDelimiter(%q) = %q, se esperaba %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSVTable(t *testing.T) {
+	table, err := parseCSVTable("scrap.csv", []byte("\xef\xbb\xbfLínea;Scrap\r\nL1;\"1.234,5\"\r\nL2;5\r\n"))
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if want := []string{"Línea", "Scrap"}; !reflect.DeepEqual(table.Columns, want) {
+		t.Errorf("columnas = %q, se esperaban %q", table.Columns, want)
+	}
+	if want := [][]string{{"L1", "1.234,5"}, {"L2", "5"}}; !reflect.DeepEqual(table.Rows, want) {
+		t.Errorf("filas = %q, se esperaban %q", table.Rows, want)
+	}
+
+	if _, err := parseCSVTable("vacio.csv", []byte("\xef\xbb\xbf\n\n")); err == nil {
+		t.Errorf("se esperaba un error con un CSV vacio")
+	}
+}
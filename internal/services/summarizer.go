@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"chat-empleados/db"
+)
+
+const (
+	// Mensajes mas recientes que nunca se resumen para conservar el hilo literal
+	summaryKeepRecent = 6
+	// Tokens maximos por mensaje al armar el texto a resumir
+	summaryMessageTokens = 600
+	// Tokens maximos del resumen generado
+	summaryMaxTokens = 700
+	summaryTimeout   = 3 * time.Minute
+)
+
+// SummaryInstruction se envia como prompt del sistema al generar el resumen
+const SummaryInstruction = `Eres un asistente que mantiene el resumen de una conversacion entre un empleado y un asistente de IA.
+Actualiza el resumen previo incorporando los mensajes nuevos. Conserva datos concretos (nombres, fechas, cifras, decisiones, preferencias y preguntas pendientes) y descarta saludos o relleno.
+Escribe en el mismo idioma de la conversacion, en tercera persona, con frases breves o vinetas. Responde solo con el resumen, sin introducciones.`
+
+// SummaryContextPrefix encabeza el resumen cuando se incluye en el contexto del modelo
+const SummaryContextPrefix = "Resumen de la parte anterior de esta conversacion (los mensajes originales ya no se incluyen):\n"
+
+var thinkBlockRegex = regexp.MustCompile(`(?s)<think>.*?</think>`)
+
+// ConversationSummarizer mantiene en segundo plano un resumen acumulado de las
+// conversaciones largas, que reemplaza a los mensajes antiguos en el contexto. Cada resumen
+// espera turno en la cola de generacion como una solicitud mas del dueno de la conversacion.
+type ConversationSummarizer struct {
+	queries *db.Queries
+	llm     *LLMService
+	runtime *RuntimeConfig
+	queue   *GenerationQueue
+	running map[int64]bool
+	mutex   sync.Mutex
+}
+
+func NewConversationSummarizer(queries *db.Queries, llm *LLMService, runtime *RuntimeConfig, queue *GenerationQueue) *ConversationSummarizer {
+	return &ConversationSummarizer{
+		queries: queries,
+		llm:     llm,
+		runtime: runtime,
+		queue:   queue,
+		running: make(map[int64]bool),
+	}
+}
+
+// Schedule actualiza el resumen en segundo plano si la conversacion supera el umbral.
+// Solo corre un resumen a la vez por conversacion.
+func (s *ConversationSummarizer) Schedule(convID int64, model string) {
+	if s.runtime.Current().SummaryThreshold <= 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	if s.running[convID] {
+		s.mutex.Unlock()
+		return
+	}
+	s.running[convID] = true
+	s.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			s.mutex.Lock()
+			delete(s.running, convID)
+			s.mutex.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+		defer cancel()
+
+		if err := s.summarize(ctx, convID, model); err != nil {
+			log.Printf("[ERROR] Error resumiendo conversacion %d: %v", convID, err)
+		}
+	}()
+}
+
+func (s *ConversationSummarizer) summarize(ctx context.Context, convID int64, model string) error {
+	threshold := s.runtime.Current().SummaryThreshold
+
+	conv, err := s.queries.GetConversationByID(ctx, convID)
+	if err != nil {
+		return fmt.Errorf("error obteniendo conversacion: %w", err)
+	}
+	previous := conv.Summary.String
+	after := conv.SummaryMessageID.Int64
+
+	pending, err := s.queries.GetConversationMessagesAfter(ctx, db.GetConversationMessagesAfterParams{
+		ConversationID: convID,
+		ID:             after,
+	})
+	if err != nil {
+		return fmt.Errorf("error obteniendo mensajes: %w", err)
+	}
+	if len(pending) <= threshold || len(pending) <= summaryKeepRecent {
+		return nil
+	}
+	pending = pending[:len(pending)-summaryKeepRecent]
+
+	// Armar la transcripcion hasta donde quepa en la ventana; lo que sobre
+	// se resume en la siguiente pasada
+	window := s.llm.ContextWindow(model)
+	budget := window - summaryMaxTokens - EstimateTokens(SummaryInstruction) - EstimateTokens(previous) - 2*tokensPerMessage
+
+	var transcript strings.Builder
+	var lastID int64
+	for _, msg := range pending {
+		if msg.Filtered.Valid && msg.Filtered.Int64 == 1 {
+			// Los mensajes bloqueados no se resumen
+			lastID = msg.ID
+			continue
+		}
+
+		role := "Empleado"
+		if msg.Role == "assistant" {
+			role = "Asistente"
+		}
+		line := fmt.Sprintf("%s: %s\n\n", role, truncateToTokens(strings.TrimSpace(thinkBlockRegex.ReplaceAllString(msg.Content, "")), summaryMessageTokens))
+
+		cost := EstimateTokens(line)
+		if cost > budget && lastID != 0 {
+			break
+		}
+		budget -= cost
+		transcript.WriteString(line)
+		lastID = msg.ID
+	}
+
+	if transcript.Len() == 0 {
+		return s.save(ctx, convID, previous, previous, lastID)
+	}
+
+	var prompt strings.Builder
+	if previous != "" {
+		prompt.WriteString("Resumen previo:\n")
+		prompt.WriteString(previous)
+		prompt.WriteString("\n\n")
+	}
+	prompt.WriteString("Mensajes nuevos:\n")
+	prompt.WriteString(transcript.String())
+
+	// Si la cola esta llena se omite; el siguiente mensaje vuelve a intentarlo
+	userName := ""
+	if user, err := s.queries.GetUserByID(ctx, conv.UserID); err == nil {
+		userName = user.Nombre
+	}
+	ticket, err := s.queue.Enqueue(conv.UserID, userName)
+	if err != nil {
+		return err
+	}
+	defer ticket.Release()
+	select {
+	case <-ticket.Ready():
+	case <-ctx.Done():
+		return fmt.Errorf("sin turno en la cola de IA: %w", ctx.Err())
+	}
+
+	summary, err := s.llm.Complete(ctx, model, []Message{
+		{Role: "system", Content: SummaryInstruction},
+		{Role: "user", Content: prompt.String()},
+	}, summaryMaxTokens)
+	if err != nil {
+		return err
+	}
+
+	summary = strings.TrimSpace(thinkBlockRegex.ReplaceAllString(summary, ""))
+	if summary == "" {
+		return fmt.Errorf("el modelo devolvio un resumen vacio")
+	}
+
+	return s.save(ctx, convID, previous, summary, lastID)
+}
+
+// save guarda el resumen solo si nadie lo modifico mientras se generaba
+func (s *ConversationSummarizer) save(ctx context.Context, convID int64, previous, summary string, lastID int64) error {
+	result, err := s.queries.SaveConversationSummary(ctx, db.SaveConversationSummaryParams{
+		Summary:          sql.NullString{String: summary, Valid: true},
+		SummaryMessageID: sql.NullInt64{Int64: lastID, Valid: true},
+		ID:               convID,
+		PreviousSummary:  sql.NullString{String: previous, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("error guardando resumen: %w", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		log.Printf("[WARN] Resumen de conversacion %d descartado: fue editado mientras se generaba", convID)
+		return nil
+	}
+
+	log.Printf("[INFO] Resumen de conversacion %d actualizado hasta el mensaje %d", convID, lastID)
+	return nil
+}
@@ -0,0 +1,663 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"chat-empleados/db"
+)
+
+// Preguntas sobre hojas de calculo: el modelo no calcula, solo traduce la pregunta a
+// consultas (filtros, agrupacion y funciones) que se ejecutan aqui sobre todas las filas.
+// Los resultados exactos se agregan al contexto de la respuesta y se muestran al usuario.
+
+const (
+	maxTableQueries     = 3
+	maxResultRows       = 50
+	tablePlanMaxTokens  = 1024
+	tablePlanTimeout    = 2 * time.Minute
+	maxColumnValuesList = 12 // valores distintos que se listan al describir una columna de texto
+)
+
+// TablePlanInstruction se envia como prompt del sistema al pedir las consultas
+const TablePlanInstruction = `Traduces preguntas sobre hojas de calculo a consultas. Recibes la descripcion de las tablas disponibles y la pregunta del usuario.
+Responde SOLO con JSON, sin explicaciones, con esta forma:
+{"queries":[{"table":"t1","filters":[{"column":"Turno","op":"=","value":"1"}],"group_by":["Linea"],"aggregates":[{"func":"sum","column":"Scrap"}],"order":"desc","limit":20}]}
+- func: sum, avg, count, count_distinct, min, max. Para contar filas usa count sin column.
+- op: =, !=, >, >=, <, <=, contains. Las fechas se comparan como AAAA-MM-DD.
+- order ("asc" o "desc") ordena por el primer aggregate. Omitelo para conservar el orden de la hoja.
+- Usa los nombres de tabla y columna exactamente como aparecen en la descripcion.
+- Maximo 3 consultas. Si la pregunta no requiere calcular nada sobre las tablas responde {"queries":[]}.`
+
+// TableResultsPrefix encabeza los resultados cuando se incluyen en el contexto del modelo
+const TableResultsPrefix = "Resultados calculados por el sistema sobre TODAS las filas de las hojas adjuntas. Son exactos: usalos tal cual en tu respuesta, no los recalcules ni los estimes.\n"
+
+// TableQuery calculo sobre una tabla, tal como lo pide el modelo
+type TableQuery struct {
+	Table      string           `json:"table"`
+	Filters    []TableFilter    `json:"filters,omitempty"`
+	GroupBy    []string         `json:"group_by,omitempty"`
+	Aggregates []TableAggregate `json:"aggregates"`
+	Order      string           `json:"order,omitempty"`
+	Limit      int              `json:"limit,omitempty"`
+}
+
+type TableFilter struct {
+	Column string `json:"column"`
+	Op     string `json:"op"`
+	Value  any    `json:"value"`
+}
+
+type TableAggregate struct {
+	Func   string `json:"func"`
+	Column string `json:"column,omitempty"`
+}
+
+// TableResult resultado de una consulta; se guarda como JSON junto a la respuesta
+type TableResult struct {
+	Title   string     `json:"title"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+	Matched int        `json:"matched"`           // filas que cumplen los filtros
+	Omitted int        `json:"omitted,omitempty"` // grupos que no se muestran por el limite
+}
+
+var aggregateLabels = map[string]string{
+	"sum":            "Suma",
+	"avg":            "Promedio",
+	"count":          "Conteo",
+	"count_distinct": "Distintos",
+	"min":            "Minimo",
+	"max":            "Maximo",
+}
+
+// TableAnalyst guarda las hojas adjuntas de cada conversacion y responde con calculos
+// exactos las preguntas que se hacen sobre ellas
+type TableAnalyst struct {
+	queries *db.Queries
+	llm     *LLMService
+}
+
+func NewTableAnalyst(queries *db.Queries, llm *LLMService) *TableAnalyst {
+	return &TableAnalyst{queries: queries, llm: llm}
+}
+
+// SaveTables guarda las hojas de un archivo adjunto para consultarlas en turnos siguientes
+func (a *TableAnalyst) SaveTables(ctx context.Context, attachmentID, convID int64, tables []*Table) {
+	for _, table := range tables {
+		if len(table.Rows) == 0 {
+			continue
+		}
+		columns, _ := json.Marshal(table.Columns)
+		rows, _ := json.Marshal(table.Rows)
+		err := a.queries.CreateAITable(ctx, db.CreateAITableParams{
+			AttachmentID:   attachmentID,
+			ConversationID: convID,
+			Name:           table.Name,
+			ColumnNames:    string(columns),
+			RowCount:       int64(len(table.Rows)),
+			RowData:        string(rows),
+		})
+		if err != nil {
+			log.Printf("[ERROR] Error guardando tabla %s de %s: %v", table.Name, table.File, err)
+		}
+	}
+}
+
+// Analyze pide al modelo las consultas que responden la pregunta y las ejecuta sobre las
+// hojas de la conversacion. Sin hojas, o si el modelo no pide calculos, no devuelve nada.
+func (a *TableAnalyst) Analyze(ctx context.Context, convID int64, model, question string) []TableResult {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil
+	}
+
+	rows, err := a.queries.GetConversationTables(ctx, convID)
+	if err != nil {
+		log.Printf("[WARN] Error obteniendo tablas de conversacion %d: %v", convID, err)
+		return nil
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tables := make(map[string]*Table, len(rows))
+	var description strings.Builder
+	for i, row := range rows {
+		table := &Table{File: row.FileName, Name: row.Name}
+		if json.Unmarshal([]byte(row.ColumnNames), &table.Columns) != nil || json.Unmarshal([]byte(row.RowData), &table.Rows) != nil {
+			continue
+		}
+		id := fmt.Sprintf("t%d", i+1)
+		tables[id] = table
+		description.WriteString(table.Describe(id))
+		description.WriteString("\n")
+	}
+
+	planCtx, cancel := context.WithTimeout(ctx, tablePlanTimeout)
+	defer cancel()
+	answer, err := a.llm.Complete(planCtx, model, []Message{
+		{Role: "system", Content: TablePlanInstruction},
+		{Role: "user", Content: "Tablas:\n" + description.String() + "\nPregunta: " + question},
+	}, tablePlanMaxTokens)
+	if err != nil {
+		log.Printf("[WARN] Error pidiendo consultas de tablas: %v", err)
+		return nil
+	}
+
+	queries, err := parseTablePlan(answer)
+	if err != nil {
+		log.Printf("[WARN] Consultas de tablas invalidas: %v", err)
+		return nil
+	}
+
+	var results []TableResult
+	for _, query := range queries {
+		table, ok := tables[query.Table]
+		if !ok {
+			log.Printf("[WARN] Consulta sobre tabla inexistente %q", query.Table)
+			continue
+		}
+		result, err := table.Run(query)
+		if err != nil {
+			log.Printf("[WARN] Consulta invalida sobre %s: %v", query.Table, err)
+			continue
+		}
+		results = append(results, *result)
+	}
+	return results
+}
+
+// parseTablePlan extrae el JSON de consultas de la respuesta del modelo, que puede traer
+// razonamiento (<think>) o texto alrededor
+func parseTablePlan(answer string) ([]TableQuery, error) {
+	answer = thinkBlockRegex.ReplaceAllString(answer, "")
+	start, end := strings.Index(answer, "{"), strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("la respuesta no contiene JSON")
+	}
+
+	var plan struct {
+		Queries []TableQuery `json:"queries"`
+	}
+	if err := json.Unmarshal([]byte(answer[start:end+1]), &plan); err != nil {
+		return nil, err
+	}
+	if len(plan.Queries) > maxTableQueries {
+		plan.Queries = plan.Queries[:maxTableQueries]
+	}
+	return plan.Queries, nil
+}
+
+// FormatTableResults arma el mensaje con los resultados para el contexto del modelo
+func FormatTableResults(results []TableResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	out.WriteString(TableResultsPrefix)
+	for _, result := range results {
+		out.WriteString(fmt.Sprintf("\n%s (%d filas cumplen los filtros)\n", result.Title, result.Matched))
+		out.WriteString("| " + strings.Join(result.Columns, " | ") + " |\n")
+		out.WriteString(strings.Repeat("|---", len(result.Columns)) + "|\n")
+		for _, row := range result.Rows {
+			out.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		}
+		if result.Omitted > 0 {
+			out.WriteString(fmt.Sprintf("(%d grupos mas no se muestran)\n", result.Omitted))
+		}
+	}
+	return out.String()
+}
+
+// Describe resume la tabla para el modelo: columnas con su tipo y, en las de texto con
+// pocos valores, los valores posibles para que los filtros coincidan
+func (t *Table) Describe(id string) string {
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%s: archivo %s, hoja %s (%d filas)\n", id, t.File, t.Name, len(t.Rows)))
+	for col, name := range t.Columns {
+		numbers, dates, filled := 0, 0, 0
+		distinct := make(map[string]bool)
+		var values []string
+		minValue, maxValue := "", ""
+		for _, row := range t.Rows {
+			value := row[col]
+			if value == "" {
+				continue
+			}
+			filled++
+			if _, ok := parseNumber(value); ok {
+				numbers++
+			} else if isISODate(value) {
+				dates++
+				if minValue == "" || value < minValue {
+					minValue = value
+				}
+				if value > maxValue {
+					maxValue = value
+				}
+			}
+			if !distinct[value] && len(distinct) <= maxColumnValuesList {
+				distinct[value] = true
+				values = append(values, value)
+			}
+		}
+
+		switch {
+		case filled == 0:
+			out.WriteString(fmt.Sprintf("- %s (vacia)\n", name))
+		case numbers*10 >= filled*8:
+			out.WriteString(fmt.Sprintf("- %s (numero)\n", name))
+		case dates*10 >= filled*8:
+			out.WriteString(fmt.Sprintf("- %s (fecha, de %s a %s)\n", name, minValue, maxValue))
+		case len(distinct) <= maxColumnValuesList:
+			out.WriteString(fmt.Sprintf("- %s (texto, valores: %s)\n", name, strings.Join(values, ", ")))
+		default:
+			out.WriteString(fmt.Sprintf("- %s (texto, ej. %s)\n", name, strings.Join(values[:3], ", ")))
+		}
+	}
+	return out.String()
+}
+
+// Run ejecuta la consulta sobre todas las filas de la tabla
+func (t *Table) Run(query TableQuery) (*TableResult, error) {
+	if len(query.Aggregates) == 0 {
+		query.Aggregates = []TableAggregate{{Func: "count"}}
+	}
+
+	groupCols := make([]int, len(query.GroupBy))
+	for i, name := range query.GroupBy {
+		col, err := t.column(name)
+		if err != nil {
+			return nil, err
+		}
+		groupCols[i] = col
+	}
+
+	aggCols := make([]int, len(query.Aggregates))
+	for i, agg := range query.Aggregates {
+		if _, ok := aggregateLabels[agg.Func]; !ok {
+			return nil, fmt.Errorf("funcion %q no soportada", agg.Func)
+		}
+		aggCols[i] = -1
+		if agg.Column != "" && agg.Column != "*" {
+			col, err := t.column(agg.Column)
+			if err != nil {
+				return nil, err
+			}
+			aggCols[i] = col
+		} else if agg.Func != "count" {
+			return nil, fmt.Errorf("%s requiere una columna", agg.Func)
+		}
+	}
+
+	filters := make([]func(row []string) bool, len(query.Filters))
+	for i, filter := range query.Filters {
+		match, err := t.filter(filter)
+		if err != nil {
+			return nil, err
+		}
+		filters[i] = match
+	}
+
+	type group struct {
+		key  []string
+		aggs []*aggregator
+	}
+	newAggs := func() []*aggregator {
+		aggs := make([]*aggregator, len(query.Aggregates))
+		for i, agg := range query.Aggregates {
+			aggs[i] = &aggregator{fn: agg.Func, distinct: make(map[string]bool)}
+		}
+		return aggs
+	}
+
+	groups := make(map[string]*group)
+	var order []*group
+	total := newAggs()
+	matched := 0
+
+rows:
+	for _, row := range t.Rows {
+		for _, match := range filters {
+			if !match(row) {
+				continue rows
+			}
+		}
+		matched++
+
+		key := make([]string, len(groupCols))
+		for i, col := range groupCols {
+			key[i] = row[col]
+		}
+		id := strings.Join(key, "\x00")
+		g, ok := groups[id]
+		if !ok {
+			g = &group{key: key, aggs: newAggs()}
+			groups[id] = g
+			order = append(order, g)
+		}
+		for i, col := range aggCols {
+			value := ""
+			if col >= 0 {
+				value = row[col]
+			}
+			g.aggs[i].add(value, col < 0)
+			total[i].add(value, col < 0)
+		}
+	}
+
+	switch strings.ToLower(query.Order) {
+	case "desc":
+		sort.SliceStable(order, func(i, j int) bool { return order[i].aggs[0].value() > order[j].aggs[0].value() })
+	case "asc":
+		sort.SliceStable(order, func(i, j int) bool { return order[i].aggs[0].value() < order[j].aggs[0].value() })
+	}
+
+	limit := query.Limit
+	if limit <= 0 || limit > maxResultRows {
+		limit = maxResultRows
+	}
+
+	result := &TableResult{
+		Title:   t.describeQuery(query),
+		Matched: matched,
+	}
+	for _, col := range groupCols {
+		result.Columns = append(result.Columns, t.Columns[col])
+	}
+	for i, agg := range query.Aggregates {
+		label := aggregateLabels[agg.Func]
+		if aggCols[i] >= 0 {
+			label += " " + t.Columns[aggCols[i]]
+		}
+		result.Columns = append(result.Columns, label)
+	}
+
+	for i, g := range order {
+		if i == limit {
+			result.Omitted = len(order) - limit
+			break
+		}
+		row := append([]string{}, g.key...)
+		for _, agg := range g.aggs {
+			row = append(row, agg.format())
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	// Con varios grupos se agrega el total sobre todas las filas que cumplen los filtros
+	if len(groupCols) > 0 && len(order) > 1 {
+		row := make([]string, len(groupCols))
+		row[0] = "Total"
+		for _, agg := range total {
+			row = append(row, agg.format())
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, nil
+}
+
+// column busca la columna por nombre sin distinguir mayusculas, acentos ni espacios
+func (t *Table) column(name string) (int, error) {
+	want := normalizeColumnName(name)
+	for i, column := range t.Columns {
+		if normalizeColumnName(column) == want {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("la columna %q no existe en la hoja %s", name, t.Name)
+}
+
+func normalizeColumnName(name string) string {
+	var out strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch r {
+		case 'á', 'à', 'ä':
+			r = 'a'
+		case 'é', 'è', 'ë':
+			r = 'e'
+		case 'í', 'ì', 'ï':
+			r = 'i'
+		case 'ó', 'ò', 'ö':
+			r = 'o'
+		case 'ú', 'ù', 'ü':
+			r = 'u'
+		}
+		if !unicode.IsSpace(r) && r != '_' {
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// filter arma la comparacion de un filtro: numerica si ambos lados son numeros, de texto
+// (sin distinguir mayusculas) en otro caso
+func (t *Table) filter(filter TableFilter) (func(row []string) bool, error) {
+	col, err := t.column(filter.Column)
+	if err != nil {
+		return nil, err
+	}
+
+	want := strings.TrimSpace(fmt.Sprint(filter.Value))
+	if filter.Value == nil {
+		want = ""
+	}
+	wantLower := strings.ToLower(want)
+	wantNumber, wantIsNumber := parseNumber(want)
+
+	compare := func(value string) int {
+		if number, ok := parseNumber(value); ok && wantIsNumber {
+			switch {
+			case number < wantNumber:
+				return -1
+			case number > wantNumber:
+				return 1
+			}
+			return 0
+		}
+		return strings.Compare(strings.ToLower(value), wantLower)
+	}
+
+	// Las comparaciones de orden no incluyen celdas vacias, ni celdas de texto (ej: "n/a")
+	// cuando se comparan contra un numero
+	ordered := func(value string) bool {
+		if value == "" {
+			return false
+		}
+		if wantIsNumber {
+			_, ok := parseNumber(value)
+			return ok
+		}
+		return true
+	}
+
+	switch filter.Op {
+	case "=", "==":
+		return func(row []string) bool { return compare(row[col]) == 0 }, nil
+	case "!=", "<>":
+		return func(row []string) bool { return compare(row[col]) != 0 }, nil
+	case ">":
+		return func(row []string) bool { return ordered(row[col]) && compare(row[col]) > 0 }, nil
+	case ">=":
+		return func(row []string) bool { return ordered(row[col]) && compare(row[col]) >= 0 }, nil
+	case "<":
+		return func(row []string) bool { return ordered(row[col]) && compare(row[col]) < 0 }, nil
+	case "<=":
+		return func(row []string) bool { return ordered(row[col]) && compare(row[col]) <= 0 }, nil
+	case "contains":
+		return func(row []string) bool { return strings.Contains(strings.ToLower(row[col]), wantLower) }, nil
+	}
+	return nil, fmt.Errorf("operador %q no soportado", filter.Op)
+}
+
+// describeQuery describe la consulta en palabras, para el titulo del resultado
+func (t *Table) describeQuery(query TableQuery) string {
+	var out strings.Builder
+	out.WriteString(t.File)
+	if t.Name != "" && !strings.HasPrefix(t.File, t.Name) {
+		out.WriteString(" / " + t.Name)
+	}
+	if len(query.GroupBy) > 0 {
+		out.WriteString(", por " + strings.Join(query.GroupBy, ", "))
+	}
+	if len(query.Filters) > 0 {
+		conditions := make([]string, len(query.Filters))
+		for i, filter := range query.Filters {
+			conditions[i] = fmt.Sprintf("%s %s %v", filter.Column, filter.Op, filter.Value)
+		}
+		out.WriteString(", donde " + strings.Join(conditions, " y "))
+	}
+	return out.String()
+}
+
+// aggregator acumula una funcion sobre los valores de un grupo
+type aggregator struct {
+	fn       string
+	sum      float64
+	count    int
+	min, max float64
+	distinct map[string]bool
+}
+
+func (a *aggregator) add(value string, countRows bool) {
+	switch a.fn {
+	case "count":
+		if countRows || value != "" {
+			a.count++
+		}
+	case "count_distinct":
+		if value != "" {
+			a.distinct[strings.ToLower(value)] = true
+		}
+	default:
+		number, ok := parseNumber(value)
+		if !ok {
+			return
+		}
+		if a.count == 0 || number < a.min {
+			a.min = number
+		}
+		if a.count == 0 || number > a.max {
+			a.max = number
+		}
+		a.sum += number
+		a.count++
+	}
+}
+
+func (a *aggregator) value() float64 {
+	switch a.fn {
+	case "count":
+		return float64(a.count)
+	case "count_distinct":
+		return float64(len(a.distinct))
+	case "avg":
+		if a.count == 0 {
+			return 0
+		}
+		return a.sum / float64(a.count)
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	}
+	return a.sum
+}
+
+func (a *aggregator) format() string {
+	if a.count == 0 && a.fn != "count" && a.fn != "count_distinct" && a.fn != "sum" {
+		return "-"
+	}
+	return formatNumber(a.value())
+}
+
+func formatNumber(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return strconv.FormatInt(int64(value), 10)
+	}
+	return strconv.FormatFloat(math.Round(value*10000)/10000, 'f', -1, 64)
+}
+
+// parseNumber interpreta numeros como los escribe una hoja: "1,234.50", "1.234,50",
+// "$ 1,200", "15%", "(300)" para negativos
+func parseNumber(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	}
+	value = strings.TrimSuffix(value, "%")
+	value = strings.TrimLeft(value, "$€ ")
+	value = strings.ReplaceAll(value, " ", "")
+	if value == "" {
+		return 0, false
+	}
+
+	comma, dot := strings.LastIndex(value, ","), strings.LastIndex(value, ".")
+	switch {
+	case comma >= 0 && dot >= 0:
+		if comma > dot {
+			value = strings.ReplaceAll(value, ".", "")
+			value = strings.Replace(value, ",", ".", 1)
+		} else {
+			value = strings.ReplaceAll(value, ",", "")
+		}
+	case comma >= 0:
+		if thousandsGrouped(value, ',') {
+			value = strings.ReplaceAll(value, ",", "")
+		} else {
+			value = strings.Replace(value, ",", ".", 1)
+		}
+	case dot >= 0 && strings.Count(value, ".") > 1:
+		if !thousandsGrouped(value, '.') {
+			return 0, false
+		}
+		value = strings.ReplaceAll(value, ".", "")
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+		return 0, false
+	}
+	if negative {
+		number = -number
+	}
+	return number, true
+}
+
+// thousandsGrouped indica si el separador agrupa miles ("1,234,567"): grupos de tres digitos
+func thousandsGrouped(value string, sep byte) bool {
+	parts := strings.Split(strings.TrimPrefix(value, "-"), string(sep))
+	if len(parts) < 2 || len(parts[0]) == 0 || len(parts[0]) > 3 {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if len(part) != 3 {
+			return false
+		}
+	}
+	return true
+}
+
+func isISODate(value string) bool {
+	if len(value) < 10 {
+		return false
+	}
+	_, err := time.Parse("2006-01-02", value[:10])
+	return err == nil
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testScrapTable hoja de ejemplo con numeros en formato mexicano y europeo mezclados
+func testScrapTable() *Table {
+	return &Table{
+		File:    "scrap.xlsx",
+		Name:    "Marzo",
+		Columns: []string{"Línea", "Turno", "Scrap", "Fecha"},
+		Rows: [][]string{
+			{"L1", "1", "10", "2024-03-01"},
+			{"L1", "2", "1,234.5", "2024-03-02"},
+			{"L2", "1", "5", "2024-03-02"},
+			{"L2", "1", "", "2024-03-03"},
+			{"L3", "2", "2,5", "2024-03-04"},
+			{"l1", "1", "n/a", "2024-03-05"},
+		},
+	}
+}
+
+func TestTableRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   TableQuery
+		columns []string
+		rows    [][]string
+		matched int
+	}{
+		{
+			name:    "conteo de filas por defecto",
+			query:   TableQuery{},
+			columns: []string{"Conteo"},
+			rows:    [][]string{{"6"}},
+			matched: 6,
+		},
+		{
+			name:    "suma, promedio, minimo y maximo ignoran lo que no es numero",
+			query:   TableQuery{Aggregates: []TableAggregate{{Func: "sum", Column: "Scrap"}, {Func: "avg", Column: "scrap"}, {Func: "min", Column: "Scrap"}, {Func: "max", Column: "Scrap"}}},
+			columns: []string{"Suma Scrap", "Promedio Scrap", "Minimo Scrap", "Maximo Scrap"},
+			rows:    [][]string{{"1252", "313", "2.5", "1234.5"}},
+			matched: 6,
+		},
+		{
+			name:    "count con columna cuenta celdas llenas",
+			query:   TableQuery{Aggregates: []TableAggregate{{Func: "count", Column: "Scrap"}, {Func: "count_distinct", Column: "Linea"}}},
+			columns: []string{"Conteo Scrap", "Distintos Línea"},
+			rows:    [][]string{{"5", "3"}},
+			matched: 6,
+		},
+		{
+			name: "agrupacion con total, en orden de la hoja",
+			query: TableQuery{
+				GroupBy:    []string{"linea"},
+				Aggregates: []TableAggregate{{Func: "sum", Column: "Scrap"}},
+			},
+			columns: []string{"Línea", "Suma Scrap"},
+			rows:    [][]string{{"L1", "1244.5"}, {"L2", "5"}, {"L3", "2.5"}, {"l1", "0"}, {"Total", "1252"}},
+			matched: 6,
+		},
+		{
+			name: "agrupacion ordenada y limitada",
+			query: TableQuery{
+				GroupBy:    []string{"Línea"},
+				Aggregates: []TableAggregate{{Func: "count"}},
+				Order:      "desc",
+				Limit:      2,
+			},
+			columns: []string{"Línea", "Conteo"},
+			rows:    [][]string{{"L1", "2"}, {"L2", "2"}, {"Total", "6"}},
+			matched: 6,
+		},
+		{
+			name: "filtros numericos, de texto y de fecha",
+			query: TableQuery{
+				Filters: []TableFilter{
+					{Column: "Turno", Op: "=", Value: 1.0},
+					{Column: "Línea", Op: "=", Value: "l2"},
+					{Column: "Fecha", Op: ">=", Value: "2024-03-02"},
+				},
+				Aggregates: []TableAggregate{{Func: "count"}, {Func: "sum", Column: "Scrap"}},
+			},
+			columns: []string{"Conteo", "Suma Scrap"},
+			rows:    [][]string{{"2", "5"}},
+			matched: 2,
+		},
+		{
+			name: "mayor que excluye celdas vacias y de texto",
+			query: TableQuery{
+				Filters:    []TableFilter{{Column: "Scrap", Op: ">", Value: "4"}},
+				Aggregates: []TableAggregate{{Func: "count"}},
+			},
+			columns: []string{"Conteo"},
+			rows:    [][]string{{"3"}},
+			matched: 3,
+		},
+		{
+			name: "contains y distinto",
+			query: TableQuery{
+				Filters: []TableFilter{
+					{Column: "Línea", Op: "contains", Value: "l"},
+					{Column: "Turno", Op: "!=", Value: "2"},
+				},
+				GroupBy: []string{"Turno"},
+			},
+			columns: []string{"Turno", "Conteo"},
+			rows:    [][]string{{"1", "4"}},
+			matched: 4,
+		},
+		{
+			name:    "promedio sin numeros",
+			query:   TableQuery{Filters: []TableFilter{{Column: "Scrap", Op: "=", Value: "n/a"}}, Aggregates: []TableAggregate{{Func: "avg", Column: "Scrap"}}},
+			columns: []string{"Promedio Scrap"},
+			rows:    [][]string{{"-"}},
+			matched: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := testScrapTable().Run(tt.query)
+			if err != nil {
+				t.Fatalf("error: %v", err)
+			}
+			if !reflect.DeepEqual(result.Columns, tt.columns) {
+				t.Errorf("columnas = %q, se esperaban %q", result.Columns, tt.columns)
+			}
+			if !reflect.DeepEqual(result.Rows, tt.rows) {
+				t.Errorf("filas = %q, se esperaban %q", result.Rows, tt.rows)
+			}
+			if result.Matched != tt.matched {
+				t.Errorf("matched = %d, se esperaba %d", result.Matched, tt.matched)
+			}
+		})
+	}
+}
+
+func TestTableRunErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query TableQuery
+	}{
+		{"columna inexistente", TableQuery{GroupBy: []string{"Planta"}}},
+		{"funcion no soportada", TableQuery{Aggregates: []TableAggregate{{Func: "median", Column: "Scrap"}}}},
+		{"suma sin columna", TableQuery{Aggregates: []TableAggregate{{Func: "sum"}}}},
+		{"operador no soportado", TableQuery{Filters: []TableFilter{{Column: "Scrap", Op: "~", Value: "1"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := testScrapTable().Run(tt.query); err == nil {
+				t.Errorf("se esperaba un error")
+			}
+		})
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+		ok    bool
+	}{
+		{"1.234,56", 1234.56, true},
+		{"1,234.56", 1234.56, true},
+		{"1,234", 1234, true},
+		{"1,5", 1.5, true},
+		{"1.234.567", 1234567, true},
+		{"1.234.567,8", 1234567.8, true},
+		{"-1.234,5", -1234.5, true},
+		{"$ 1,200", 1200, true},
+		{"€1.200,50", 1200.5, true},
+		{"15%", 15, true},
+		{"(300)", -300, true},
+		{" 42 ", 42, true},
+		{"1 234", 1234, true},
+		{"1.2.3", 0, false},
+		{"", 0, false},
+		{"$", 0, false},
+		{"abc", 0, false},
+		{"2024-03-01", 0, false},
+		{"1e400", 0, false},
+		{"NaN", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseNumber(tt.input)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("parseNumber(%q) = %v, %v; se esperaba %v, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+)
+
+// UnansweredMarker marca que el modelo reporta no tener la respuesta
+const UnansweredMarker = "[SIN_RESPUESTA]"
+
+// UnansweredInstruction indica al modelo como reportar preguntas sin respuesta
+const UnansweredInstruction = "If the user asks about the company (policies, procedures, people, internal systems) and the answer is not in the provided company knowledge, say so honestly and end your reply with the exact marker " + UnansweredMarker + ". Never use the marker for general questions you can answer."
+
+// unansweredOpening bytes del inicio de la respuesta en los que se buscan las frases: quien
+// no sabe la respuesta lo dice al principio; mas adelante suelen ser aclaraciones de una
+// respuesta util ("no tengo datos de 2023, pero en 2024...")
+const unansweredOpening = 200
+
+// Frases (normalizadas, sin acentos) con las que el modelo admite no saber la respuesta.
+// Solo frases en primera persona: "no information about" o "i'm not aware of" aparecen
+// tambien en respuestas correctas ("i'm not aware of any restriction, you can...").
+var unansweredPatterns = []string{
+	"no tengo informacion",
+	"no cuento con informacion",
+	"no dispongo de informacion",
+	"no tengo acceso a informacion",
+	"no tengo datos",
+	"no encuentro informacion",
+	"no se la respuesta",
+	"no conozco la respuesta",
+	"no tengo esa informacion",
+	"i don't know",
+	"i do not know",
+	"i don't have information",
+	"i do not have information",
+	"i don't have access to",
+	"i don't have specific information",
+}
+
+// UnansweredResult resultado de analizar una respuesta del modelo
+type UnansweredResult struct {
+	Unanswered bool
+	Reason     string
+	// Response es la respuesta sin el marcador
+	Response string
+}
+
+// DetectUnanswered determina si la respuesta indica que la IA no supo contestar.
+// hasSources indica si se recupero conocimiento relevante para la pregunta.
+func DetectUnanswered(response string, hasSources bool) UnansweredResult {
+	result := UnansweredResult{Response: response}
+
+	if strings.Contains(response, UnansweredMarker) {
+		result.Unanswered = true
+		result.Reason = "marcador del modelo"
+		result.Response = strings.TrimSpace(strings.ReplaceAll(response, UnansweredMarker, ""))
+		return result
+	}
+
+	normalized := accentReplacer.Replace(strings.ToLower(response))
+	normalized = strings.ReplaceAll(normalized, "’", "'")
+	if len(normalized) > unansweredOpening {
+		normalized = normalized[:unansweredOpening]
+	}
+	for _, pattern := range unansweredPatterns {
+		if strings.Contains(normalized, pattern) {
+			result.Unanswered = true
+			result.Reason = "patron: " + pattern
+			if !hasSources {
+				result.Reason += " (sin conocimiento relevante)"
+			}
+			return result
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectUnanswered(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		hasSources bool
+		unanswered bool
+		reason     string
+		output     string
+	}{
+		{
+			name:       "marcador del modelo",
+			response:   "No encontre la politica de viaticos en la documentacion. " + UnansweredMarker,
+			hasSources: true,
+			unanswered: true,
+			reason:     "marcador del modelo",
+			output:     "No encontre la politica de viaticos en la documentacion.",
+		},
+		{
+			name:       "frase con acentos",
+			response:   "Lo siento, no tengo información sobre el horario del comedor.",
+			hasSources: true,
+			unanswered: true,
+			reason:     "patron: no tengo informacion",
+		},
+		{
+			name:       "sin conocimiento relevante",
+			response:   "I don’t know who approves overtime in plant 2.",
+			unanswered: true,
+			reason:     "patron: i don't know (sin conocimiento relevante)",
+		},
+		{
+			name:     "respuesta normal",
+			response: "El horario del comedor es de 12:00 a 15:00 de lunes a viernes.",
+		},
+		{
+			name:     "no information about en una respuesta correcta",
+			response: "The job log shows no information about errors, so the backup finished correctly.",
+		},
+		{
+			name:     "not aware of en una respuesta correcta",
+			response: "I'm not aware of any restriction: you can park in lot B after 6 pm.",
+		},
+		{
+			name:       "aclaracion al final de una respuesta larga",
+			response:   "El proceso de alta de proveedores tiene tres pasos: " + strings.Repeat("se llena el formato y se envia a compras. ", 6) + "No tengo datos del ano pasado, pero el tiempo promedio actual es de 5 dias.",
+			hasSources: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := DetectUnanswered(tt.response, tt.hasSources)
+			if result.Unanswered != tt.unanswered || result.Reason != tt.reason {
+				t.Errorf("DetectUnanswered = %v, %q; se esperaba %v, %q", result.Unanswered, result.Reason, tt.unanswered, tt.reason)
+			}
+			output := tt.output
+			if output == "" {
+				output = tt.response
+			}
+			if result.Response != output {
+				t.Errorf("respuesta = %q, se esperaba %q", result.Response, output)
+			}
+		})
+	}
+}
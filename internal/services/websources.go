@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"chat-empleados/db"
+)
+
+// Limites del intervalo de revision de una fuente web
+const (
+	MinWebSourceInterval = 15        // minutos (igual al TTL del cache del scraper)
+	MaxWebSourceInterval = 30 * 1440 // 30 dias
+)
+
+// webSourceTick cada cuanto se buscan fuentes pendientes de revisar
+const webSourceTick = time.Minute
+
+// webSourceTimeout tiempo maximo para revisar una fuente
+const webSourceTimeout = 2 * time.Minute
+
+// WebSourceService vuelve a extraer periodicamente las fuentes web registradas y, cuando
+// cambia su contenido (ContentHash), crea un envio de conocimiento pendiente o actualiza
+// directamente la entrada vinculada si la fuente tiene auto_update.
+type WebSourceService struct {
+	queries       *db.Queries
+	scraper       *Scraper
+	retriever     *KnowledgeRetriever
+	notifications *NotificationService
+}
+
+func NewWebSourceService(queries *db.Queries, scraper *Scraper, retriever *KnowledgeRetriever, notifications *NotificationService) *WebSourceService {
+	return &WebSourceService{
+		queries:       queries,
+		scraper:       scraper,
+		retriever:     retriever,
+		notifications: notifications,
+	}
+}
+
+// Start revisa en segundo plano las fuentes que ya cumplieron su intervalo
+func (s *WebSourceService) Start() {
+	go func() {
+		ticker := time.NewTicker(webSourceTick)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.checkDue()
+		}
+	}()
+}
+
+// Create registra una fuente nueva; se revisa en el siguiente ciclo del job
+func (s *WebSourceService) Create(ctx context.Context, rawURL, title, category string, intervalMinutes int, autoUpdate bool, createdBy int64) (db.WebSource, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return db.WebSource{}, fmt.Errorf("la URL debe ser http(s) valida")
+	}
+
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return db.WebSource{}, fmt.Errorf("el titulo es requerido")
+	}
+
+	category = strings.TrimSpace(category)
+	if category == "" {
+		category = "general"
+	}
+
+	if intervalMinutes < MinWebSourceInterval || intervalMinutes > MaxWebSourceInterval {
+		return db.WebSource{}, fmt.Errorf("el intervalo debe estar entre %d minutos y %d dias", MinWebSourceInterval, MaxWebSourceInterval/1440)
+	}
+
+	auto := int64(0)
+	if autoUpdate {
+		auto = 1
+	}
+
+	source, err := s.queries.CreateWebSource(ctx, db.CreateWebSourceParams{
+		Url:             rawURL,
+		Title:           title,
+		Category:        sql.NullString{String: category, Valid: true},
+		IntervalMinutes: int64(intervalMinutes),
+		AutoUpdate:      sql.NullInt64{Int64: auto, Valid: true},
+		CreatedBy:       createdBy,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return db.WebSource{}, fmt.Errorf("la URL ya esta registrada como fuente")
+		}
+		return db.WebSource{}, fmt.Errorf("error guardando fuente: %w", err)
+	}
+	return source, nil
+}
+
+// checkDue revisa las fuentes vencidas. Cada fuente se reclama con un UPDATE condicional,
+// asi con varias instancias compartiendo la base de datos solo una la revisa.
+func (s *WebSourceService) checkDue() {
+	sources, err := s.queries.GetDueWebSources(context.Background())
+	if err != nil {
+		log.Printf("[ERROR] Error obteniendo fuentes web pendientes: %v", err)
+		return
+	}
+
+	for _, source := range sources {
+		result, err := s.queries.ClaimWebSource(context.Background(), source.ID)
+		if err != nil {
+			log.Printf("[ERROR] Error reclamando fuente web %d: %v", source.ID, err)
+			continue
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), webSourceTimeout)
+		if _, err := s.Check(ctx, source, false); err != nil {
+			log.Printf("[WARN] Error revisando fuente web %s: %v", source.Url, err)
+		}
+		cancel()
+	}
+}
+
+// Check extrae la fuente y aplica el cambio si el contenido es distinto al ultimo visto.
+// Con force se ignora el cache del scraper. Devuelve true si el contenido cambio.
+func (s *WebSourceService) Check(ctx context.Context, source db.WebSource, force bool) (bool, error) {
+	var content *ScrapedContent
+	var err error
+	if force {
+		content, err = s.scraper.Refresh(ctx, source.Url)
+	} else {
+		content, err = s.scraper.Scrape(ctx, source.Url)
+	}
+	s.scraper.RecordFetch(ctx, 0, source.Url, content, err)
+	if err == nil && !content.Success {
+		err = errors.New(content.Error)
+	}
+	if err == nil && strings.TrimSpace(content.Content) == "" {
+		err = errors.New("la pagina no tiene contenido de texto")
+	}
+	if err != nil {
+		s.markChecked(ctx, source.ID, err.Error())
+		return false, err
+	}
+
+	if content.ContentHash == source.LastHash.String {
+		s.markChecked(ctx, source.ID, "")
+		return false, nil
+	}
+
+	knowledgeID := source.KnowledgeID
+	text := content.Content + "\n\nFuente: " + source.Url
+
+	if source.AutoUpdate.Int64 == 1 {
+		id, err := s.updateKnowledge(ctx, source, text)
+		if err != nil {
+			s.markChecked(ctx, source.ID, err.Error())
+			return false, err
+		}
+		knowledgeID = sql.NullInt64{Int64: id, Valid: true}
+		log.Printf("[INFO] Fuente web %s actualizo el conocimiento %d", source.Url, id)
+	} else {
+		_, err := s.queries.CreateKnowledgeSubmission(ctx, db.CreateKnowledgeSubmissionParams{
+			Title:       source.Title,
+			Content:     text,
+			Category:    source.Category,
+			SubmittedBy: source.CreatedBy,
+		})
+		if err != nil {
+			s.markChecked(ctx, source.ID, err.Error())
+			return false, fmt.Errorf("error creando envio de conocimiento: %w", err)
+		}
+		go s.notifications.NotifyAdminsKnowledgeSubmission(context.Background(), "Fuente web", source.Title)
+		log.Printf("[INFO] Fuente web %s cambio, envio de conocimiento creado", source.Url)
+	}
+
+	err = s.queries.UpdateWebSourceChanged(ctx, db.UpdateWebSourceChangedParams{
+		LastHash:    sql.NullString{String: content.ContentHash, Valid: true},
+		KnowledgeID: knowledgeID,
+		ID:          source.ID,
+	})
+	if err != nil {
+		return true, fmt.Errorf("error actualizando fuente: %w", err)
+	}
+	return true, nil
+}
+
+// updateKnowledge actualiza la entrada vinculada (o la crea si no existe) y la reindexa
+func (s *WebSourceService) updateKnowledge(ctx context.Context, source db.WebSource, text string) (int64, error) {
+	knowledgeID, err := s.saveKnowledge(ctx, source, text)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.retriever.IndexKnowledge(ctx, knowledgeID); err != nil {
+		log.Printf("[ERROR] Error indexando conocimiento %d: %v", knowledgeID, err)
+	}
+	return knowledgeID, nil
+}
+
+func (s *WebSourceService) saveKnowledge(ctx context.Context, source db.WebSource, text string) (int64, error) {
+	if source.KnowledgeID.Valid {
+		kb, err := s.queries.GetKnowledgeByID(ctx, source.KnowledgeID.Int64)
+		if err == nil {
+			_, err = s.queries.UpdateKnowledge(ctx, db.UpdateKnowledgeParams{
+				Title:    source.Title,
+				Content:  text,
+				Category: source.Category,
+				IsActive: kb.IsActive,
+				ID:       kb.ID,
+			})
+			if err != nil {
+				return 0, fmt.Errorf("error actualizando conocimiento: %w", err)
+			}
+			return kb.ID, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("error obteniendo conocimiento: %w", err)
+		}
+	}
+
+	// Sin entrada vinculada (o fue eliminada): crearla ya aprobada por quien registro la fuente
+	kb, err := s.queries.CreateKnowledge(ctx, db.CreateKnowledgeParams{
+		Title:       source.Title,
+		Content:     text,
+		Category:    source.Category,
+		SubmittedBy: source.CreatedBy,
+		ApprovedBy:  sql.NullInt64{Int64: source.CreatedBy, Valid: true},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error creando conocimiento: %w", err)
+	}
+	return kb.ID, nil
+}
+
+func (s *WebSourceService) markChecked(ctx context.Context, sourceID int64, errText string) {
+	err := s.queries.UpdateWebSourceChecked(ctx, db.UpdateWebSourceCheckedParams{
+		LastError: sql.NullString{String: errText, Valid: true},
+		ID:        sourceID,
+	})
+	if err != nil {
+		log.Printf("[ERROR] Error actualizando fuente web %d: %v", sourceID, err)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"chat-empleados/db"
+	"chat-empleados/internal/config"
+)
+
+// webSourceURL usa una IP publica literal: la revalidacion del cache no necesita DNS
+const webSourceURL = "http://93.184.216.34/politicas"
+
+func newTestWebSources(t *testing.T) (*WebSourceService, *db.Queries) {
+	t.Helper()
+	queries, _ := newTestQueries(t)
+	cfg := &config.Config{KnowledgeChunkLen: 800}
+	retriever := NewKnowledgeRetriever(queries, NewLLMService(cfg, nil), cfg)
+	service := NewWebSourceService(queries, NewScraper(DefaultScraperConfig(), queries), retriever, NewNotificationService(queries))
+	return service, queries
+}
+
+// cachePage deja la pagina en el cache del scraper, de modo que Check no sale a la red
+func cachePage(s *WebSourceService, content, hash string) {
+	s.scraper.saveToCache(context.Background(), webSourceURL, &ScrapedContent{
+		URL:         webSourceURL,
+		Content:     content,
+		ContentHash: hash,
+		Method:      "http",
+		Success:     true,
+	})
+}
+
+func createTestSource(t *testing.T, s *WebSourceService, autoUpdate bool) db.WebSource {
+	t.Helper()
+	user := createTestUser(t, s.queries)
+	source, err := s.Create(context.Background(), webSourceURL, "Politicas", "rh", 60, autoUpdate, user.ID)
+	if err != nil {
+		t.Fatalf("error creando fuente: %v", err)
+	}
+	return source
+}
+
+func TestWebSourceCheckUnchanged(t *testing.T) {
+	s, queries := newTestWebSources(t)
+	ctx := context.Background()
+	source := createTestSource(t, s, false)
+	cachePage(s, "Vacaciones: 12 dias", "h1")
+	source.LastHash = sql.NullString{String: "h1", Valid: true}
+
+	changed, err := s.Check(ctx, source, false)
+	if err != nil || changed {
+		t.Fatalf("Check = %v, %v; se esperaba sin cambios", changed, err)
+	}
+
+	submissions, _ := queries.GetPendingSubmissions(ctx)
+	if len(submissions) != 0 {
+		t.Errorf("se crearon %d envios con el mismo contenido", len(submissions))
+	}
+	source, _ = queries.GetWebSourceByID(ctx, source.ID)
+	if !source.LastCheckedAt.Valid || source.LastError.String != "" {
+		t.Errorf("fuente revisada = %+v", source)
+	}
+
+	fetches, _ := queries.GetRecentURLFetches(ctx, 10)
+	if len(fetches) != 1 || fetches[0].Status != "cached" || fetches[0].UserID.Valid {
+		t.Errorf("descargas registradas = %+v", fetches)
+	}
+}
+
+func TestWebSourceCheckCreatesSubmission(t *testing.T) {
+	s, queries := newTestWebSources(t)
+	ctx := context.Background()
+	source := createTestSource(t, s, false)
+	cachePage(s, "Vacaciones: 12 dias", "h1")
+
+	changed, err := s.Check(ctx, source, false)
+	if err != nil || !changed {
+		t.Fatalf("Check = %v, %v; se esperaba un cambio", changed, err)
+	}
+
+	submissions, _ := queries.GetPendingSubmissions(ctx)
+	if len(submissions) != 1 || submissions[0].Title != "Politicas" || submissions[0].Content != "Vacaciones: 12 dias\n\nFuente: "+webSourceURL {
+		t.Fatalf("envios pendientes = %+v", submissions)
+	}
+
+	source, _ = queries.GetWebSourceByID(ctx, source.ID)
+	if source.LastHash.String != "h1" || source.KnowledgeID.Valid {
+		t.Errorf("fuente = %+v; sin auto_update no debe vincular conocimiento", source)
+	}
+}
+
+func TestWebSourceCheckAutoUpdate(t *testing.T) {
+	s, queries := newTestWebSources(t)
+	ctx := context.Background()
+	source := createTestSource(t, s, true)
+
+	cachePage(s, "Vacaciones: 12 dias", "h1")
+	if changed, err := s.Check(ctx, source, false); err != nil || !changed {
+		t.Fatalf("Check = %v, %v; se esperaba un cambio", changed, err)
+	}
+	source, _ = queries.GetWebSourceByID(ctx, source.ID)
+	if !source.KnowledgeID.Valid {
+		t.Fatal("la fuente debe quedar vinculada a la entrada de conocimiento creada")
+	}
+	knowledgeID := source.KnowledgeID.Int64
+
+	// Un cambio posterior actualiza la misma entrada en vez de crear otra
+	cachePage(s, "Vacaciones: 15 dias", "h2")
+	if changed, err := s.Check(ctx, source, false); err != nil || !changed {
+		t.Fatalf("segundo Check = %v, %v; se esperaba un cambio", changed, err)
+	}
+	source, _ = queries.GetWebSourceByID(ctx, source.ID)
+	if source.KnowledgeID.Int64 != knowledgeID || source.LastHash.String != "h2" {
+		t.Errorf("fuente = %+v, se esperaba la entrada %d con hash h2", source, knowledgeID)
+	}
+
+	kb, err := queries.GetKnowledgeByID(ctx, knowledgeID)
+	if err != nil || kb.Content != "Vacaciones: 15 dias\n\nFuente: "+webSourceURL {
+		t.Errorf("conocimiento = %+v, %v", kb, err)
+	}
+	chunks, _ := queries.GetActiveKnowledgeChunks(ctx)
+	if len(chunks) != 1 || chunks[0].Content != kb.Content {
+		t.Errorf("fragmentos indexados = %+v", chunks)
+	}
+	if submissions, _ := queries.GetPendingSubmissions(ctx); len(submissions) != 0 {
+		t.Errorf("con auto_update no deben crearse envios: %+v", submissions)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"encoding/json"
+	"fmt"
 	"html/template"
 	"io/fs"
 	"log"
@@ -45,17 +47,72 @@ func main() {
 		log.Fatalf("[FATAL] Error cargando templates: %v", err)
 	}
 
+	// Configuracion de entorno con valores de system_config encima
+	runtimeConfig := services.NewRuntimeConfig(queries, cfg)
+	if err := runtimeConfig.Load(context.Background()); err != nil {
+		log.Printf("[WARN] Error cargando configuracion de BD, usando entorno: %v", err)
+	}
+
 	securityService := services.NewSecurityService(queries)
-	ollamaService := services.NewOllamaService(cfg, securityService)
+	llmService := services.NewLLMService(runtimeConfig.Current(), securityService)
+
+	// Scraper de enlaces del chat IA, sin browser (más rápido y confiable)
+	scraper := services.NewScraper(&services.ScraperConfig{
+		HTTPTimeout:       15 * time.Second,
+		MaxRetries:        2,
+		MaxContentSize:    5 * 1024 * 1024, // 5MB
+		UserAgent:         "AQUILA-Bot/1.0 (Enterprise Assistant)",
+		AllowedDomains:    runtimeConfig.Current().URLAllowedDomains,
+		BlockedDomains:    runtimeConfig.Current().URLBlockedDomains,
+		InternalHosts:     runtimeConfig.Current().URLInternalHosts,
+		RequestsPerSecond: 2.0,
+		BurstSize:         5,
+		CacheTTL:          15 * time.Minute,
+		EnableCache:       true,
+		EnableBrowser:     false,
+	}, queries)
+
+	generationQueue := services.NewGenerationQueue(runtimeConfig)
+	generationManager := services.NewGenerationManager()
+
+	// Aplicar cambios de configuracion en caliente
+	runtimeConfig.OnChange(func(c *config.Config) {
+		llmService.ApplyConfig(c)
+		securityService.SetEnabled(c.EnableFilters)
+		scraper.SetPolicy(c.URLAllowedDomains, c.URLBlockedDomains, c.URLInternalHosts)
+		generationQueue.Reschedule()
+	})
 	notificationService := services.NewNotificationService(queries)
+	knowledgeRetriever := services.NewKnowledgeRetriever(queries, llmService, cfg)
+	summarizer := services.NewConversationSummarizer(queries, llmService, runtimeConfig, generationQueue)
+	chatRoomService := services.NewChatRoomService(queries)
+	directMessageService := services.NewDirectMessageService(queries)
+	webSourceService := services.NewWebSourceService(queries, scraper, knowledgeRetriever, notificationService)
+	chatBroadcaster, err := services.NewBroadcaster(cfg.ChatBroadcaster, queries)
+	if err != nil {
+		log.Fatalf("[FATAL] Error iniciando broadcaster del chat: %v", err)
+	}
+
+	// Indexar en segundo plano el conocimiento existente que aun no tiene fragmentos
+	go func() {
+		if err := knowledgeRetriever.SyncIndex(context.Background()); err != nil {
+			log.Printf("[WARN] Error sincronizando indice de conocimiento: %v", err)
+		}
+	}()
+
+	// Revisar periodicamente las fuentes web de conocimiento
+	webSourceService.Start()
 
 	authMiddleware := middleware.NewAuthMiddleware(queries)
-	authHandler := handlers.NewAuthHandler(queries, cfg, templates, notificationService)
-	// chatHandler deshabilitado temporalmente
-	// chatHandler := handlers.NewChatHandler(queries, templates, securityService)
-	aiHandler := handlers.NewAIHandler(queries, templates, ollamaService, securityService)
+	authHandler := handlers.NewAuthHandler(queries, runtimeConfig, templates, notificationService)
+	chatHandler := handlers.NewChatHandler(queries, templates, securityService, chatRoomService, directMessageService, chatBroadcaster)
+	tableAnalyst := services.NewTableAnalyst(queries, llmService)
+	aiHandler := handlers.NewAIHandler(queries, templates, llmService, securityService, scraper, knowledgeRetriever, notificationService, runtimeConfig, summarizer, tableAnalyst, generationQueue, generationManager)
 	adminHandler := handlers.NewAdminHandler(queries, templates, securityService, notificationService)
-	knowledgeHandler := handlers.NewKnowledgeHandler(queries, templates, notificationService)
+	knowledgeHandler := handlers.NewKnowledgeHandler(queries, templates, notificationService, knowledgeRetriever)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	configHandler := handlers.NewConfigHandler(templates, runtimeConfig)
+	webHandler := handlers.NewWebHandler(queries, templates, scraper, webSourceService)
 
 	mux := http.NewServeMux()
 
@@ -108,10 +165,15 @@ func main() {
 		http.Redirect(w, r, "/ai", http.StatusSeeOther)
 	})))
 
-	// Chat grupal deshabilitado temporalmente - redirigir a IA
-	mux.Handle("GET /chat", authMiddleware.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/ai", http.StatusSeeOther)
-	})))
+	// Chat grupal por salas
+	mux.Handle("GET /chat", authMiddleware.RequireAuth(http.HandlerFunc(chatHandler.ChatPage)))
+	mux.Handle("GET /chat/ws", authMiddleware.RequireAuth(http.HandlerFunc(chatHandler.WebSocket)))
+	mux.Handle("POST /chat/rooms", authMiddleware.RequireAuth(http.HandlerFunc(chatHandler.CreateRoom)))
+	mux.Handle("POST /chat/rooms/{id}/join", authMiddleware.RequireAuth(http.HandlerFunc(chatHandler.JoinRoom)))
+	mux.Handle("POST /chat/rooms/{id}/leave", authMiddleware.RequireAuth(http.HandlerFunc(chatHandler.LeaveRoom)))
+	mux.Handle("POST /chat/dm", authMiddleware.RequireAuth(http.HandlerFunc(chatHandler.StartDirectMessage)))
+	mux.Handle("GET /chat/dm/unread", authMiddleware.RequireAuth(http.HandlerFunc(chatHandler.DirectMessagesUnread)))
+	mux.Handle("POST /chat/dm/{id}/read", authMiddleware.RequireAuth(http.HandlerFunc(chatHandler.MarkDirectMessagesRead)))
 
 	mux.Handle("GET /ai", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.AIPage)))
 	mux.Handle("GET /ai/new", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.NewConversation)))
@@ -119,13 +181,26 @@ func main() {
 	mux.Handle("POST /ai/stream", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.SendMessageStream)))
 	mux.Handle("DELETE /ai/conversation/{id}", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.DeleteConversation)))
 	mux.Handle("GET /ai/conversation/{id}/messages", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.GetConversationMessages)))
+	mux.Handle("GET /ai/conversation/{id}/stream", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.ResumeGeneration)))
+	mux.Handle("POST /ai/conversation/{id}/stop", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.StopGeneration)))
+	mux.Handle("POST /ai/conversation/{id}/summary", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.UpdateSummary)))
+	mux.Handle("GET /ai/attachments/{id}", authMiddleware.RequireAuth(http.HandlerFunc(aiHandler.DownloadAttachment)))
 	mux.Handle("GET /ai/health", http.HandlerFunc(aiHandler.HealthCheck))
 	mux.Handle("GET /ai/models", authMiddleware.RequireAdmin(http.HandlerFunc(aiHandler.ListModels)))
 	mux.Handle("POST /ai/model", authMiddleware.RequireAdmin(http.HandlerFunc(aiHandler.SetModel)))
+	mux.Handle("GET /ai/backends", authMiddleware.RequireAdmin(http.HandlerFunc(aiHandler.Backends)))
+	mux.Handle("GET /ai/queue", authMiddleware.RequireAdmin(http.HandlerFunc(aiHandler.QueueStatus)))
 
 	mux.Handle("GET /profile", authMiddleware.RequireAuth(http.HandlerFunc(authHandler.Profile)))
 	mux.Handle("POST /profile/password", authMiddleware.RequireAuth(http.HandlerFunc(authHandler.ChangePassword)))
 
+	// Centro de notificaciones
+	mux.Handle("GET /notifications", authMiddleware.RequireAuth(http.HandlerFunc(notificationHandler.List)))
+	mux.Handle("GET /notifications/count", authMiddleware.RequireAuth(http.HandlerFunc(notificationHandler.UnreadCount)))
+	mux.Handle("GET /notifications/stream", authMiddleware.RequireAuth(http.HandlerFunc(notificationHandler.Stream)))
+	mux.Handle("POST /notifications/{id}/read", authMiddleware.RequireAuth(http.HandlerFunc(notificationHandler.MarkRead)))
+	mux.Handle("POST /notifications/read-all", authMiddleware.RequireAuth(http.HandlerFunc(notificationHandler.MarkAllRead)))
+
 	mux.Handle("GET /admin", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.Dashboard)))
 	mux.Handle("GET /admin/users", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.Users)))
 	mux.Handle("POST /admin/approve/{id}", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.ApproveUser)))
@@ -136,6 +211,25 @@ func main() {
 	mux.Handle("DELETE /admin/filters/delete/{id}", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.DeleteFilter)))
 	mux.Handle("GET /admin/logs", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.SecurityLogs)))
 	mux.Handle("GET /admin/stats", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.GetStats)))
+	mux.Handle("GET /admin/config", authMiddleware.RequireAdmin(http.HandlerFunc(configHandler.ConfigPage)))
+	mux.Handle("GET /admin/config/values", authMiddleware.RequireAdmin(http.HandlerFunc(configHandler.GetConfig)))
+	mux.Handle("POST /admin/config", authMiddleware.RequireAdmin(http.HandlerFunc(configHandler.UpdateConfig)))
+	mux.Handle("POST /admin/config/reset", authMiddleware.RequireAdmin(http.HandlerFunc(configHandler.ResetConfig)))
+	mux.Handle("GET /admin/rooms", authMiddleware.RequireAdmin(http.HandlerFunc(chatHandler.AdminRoomsPage)))
+	mux.Handle("POST /admin/rooms/create", authMiddleware.RequireAdmin(http.HandlerFunc(chatHandler.AdminCreateRoom)))
+	mux.Handle("POST /admin/rooms/{id}/members", authMiddleware.RequireAdmin(http.HandlerFunc(chatHandler.AdminAddMember)))
+	mux.Handle("DELETE /admin/rooms/{id}/members/{userID}", authMiddleware.RequireAdmin(http.HandlerFunc(chatHandler.AdminRemoveMember)))
+	mux.Handle("POST /admin/rooms/{id}/privacy", authMiddleware.RequireAdmin(http.HandlerFunc(chatHandler.AdminToggleRoomPrivacy)))
+	mux.Handle("DELETE /admin/rooms/{id}", authMiddleware.RequireAdmin(http.HandlerFunc(chatHandler.AdminDeleteRoom)))
+	mux.Handle("GET /admin/web", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.AdminWebPage)))
+	mux.Handle("POST /admin/web/purge", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.PurgeCache)))
+	mux.Handle("POST /admin/web/pages/{id}/refresh", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.RefreshPage)))
+	mux.Handle("POST /admin/web/pages/{id}/promote", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.PromotePage)))
+	mux.Handle("DELETE /admin/web/pages/{id}", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.DeletePage)))
+	mux.Handle("POST /admin/web/sources", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.CreateSource)))
+	mux.Handle("POST /admin/web/sources/{id}/check", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.CheckSource)))
+	mux.Handle("POST /admin/web/sources/{id}/toggle", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.ToggleSource)))
+	mux.Handle("DELETE /admin/web/sources/{id}", authMiddleware.RequireAdmin(http.HandlerFunc(webHandler.DeleteSource)))
 	mux.Handle("POST /admin/user/{id}/password", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.AdminChangePassword)))
 	mux.Handle("POST /admin/user/{id}/toggle-admin", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.ToggleUserAdmin)))
 	mux.Handle("DELETE /admin/user/{id}", authMiddleware.RequireAdmin(http.HandlerFunc(adminHandler.DeleteUser)))
@@ -158,19 +252,31 @@ func main() {
 	log.Printf("[INFO] ========================================")
 	log.Printf("[INFO] Servidor iniciando en puerto %s", cfg.Port)
 	log.Printf("[INFO] Base de datos: %s", cfg.DBPath)
-	log.Printf("[INFO] Ollama URL: %s", cfg.OllamaURL)
-	log.Printf("[INFO] Modelo IA: %s", cfg.OllamaModel)
-	log.Printf("[INFO] Filtros de seguridad: %v", cfg.EnableFilters)
+	log.Printf("[INFO] Ollama URL: %s", runtimeConfig.Current().OllamaURL)
+	log.Printf("[INFO] Modelo IA: %s", runtimeConfig.Current().OllamaModel)
+	for _, endpoint := range runtimeConfig.Current().OllamaPool {
+		log.Printf("[INFO] Servidor Ollama del pool: %s", endpoint.URL)
+	}
+	for _, p := range runtimeConfig.Current().LLMProviders {
+		log.Printf("[INFO] Servidor de IA adicional: %s (%s) %s", p.Name, p.Kind, p.URL)
+	}
+	if cfg.OllamaEmbedModel != "" {
+		log.Printf("[INFO] Modelo de embeddings: %s", cfg.OllamaEmbedModel)
+	} else {
+		log.Printf("[INFO] Modelo de embeddings: (ninguno, busqueda lexica)")
+	}
+	log.Printf("[INFO] Filtros de seguridad: %v", runtimeConfig.Current().EnableFilters)
+	log.Printf("[INFO] Broadcaster del chat: %s", cfg.ChatBroadcaster)
 	log.Printf("[INFO] ========================================")
 	log.Printf("[INFO] Usuario admin por defecto:")
 	log.Printf("[INFO]   Nomina: admin")
 	log.Printf("[INFO]   Password: admin123")
 	log.Printf("[INFO] ========================================")
 
-	if ollamaService.IsAvailable(context.Background()) {
-		log.Printf("[INFO] Ollama disponible y funcionando")
+	if llmService.IsAvailable(context.Background()) {
+		log.Printf("[INFO] Servidor de IA del modelo %s disponible y funcionando", llmService.GetModel())
 	} else {
-		log.Printf("[WARN] Ollama no disponible. Ejecuta: ollama run %s", cfg.OllamaModel)
+		log.Printf("[WARN] Servidor de IA del modelo %s no disponible. Con Ollama ejecuta: ollama run %s", llmService.GetModel(), llmService.GetModel())
 	}
 
 	if err := http.ListenAndServe(addr, handler); err != nil {
@@ -226,8 +332,7 @@ func initDB(dbPath string) (*sql.DB, error) {
 
 // ensureTablesExist ejecuta solo las sentencias CREATE TABLE e INDEX del schema
 func ensureTablesExist(database *sql.DB, schema string) error {
-	lines := strings.Split(schema, ";")
-	for _, line := range lines {
+	for _, line := range splitSchema(schema) {
 		line = strings.TrimSpace(line)
 		upperLine := strings.ToUpper(line)
 		// Solo ejecutar CREATE TABLE y CREATE INDEX
@@ -244,13 +349,67 @@ func ensureTablesExist(database *sql.DB, schema string) error {
 	// Migraciones de columnas nuevas
 	runMigrations(database)
 
+	recoverInterruptedGenerations(database)
+
 	return nil
 }
 
+// splitSchema separa el schema en sentencias por ";" sin contar los que van dentro de
+// comentarios ("-- ..." y "/* ... */") o de textos entre comillas, y quita los comentarios
+func splitSchema(schema string) []string {
+	var statements []string
+	var current strings.Builder
+	for i := 0; i < len(schema); i++ {
+		c := schema[i]
+		switch {
+		case c == '-' && strings.HasPrefix(schema[i:], "--"):
+			end := strings.IndexByte(schema[i:], '\n')
+			if end < 0 {
+				i = len(schema)
+			} else {
+				i += end - 1
+			}
+		case c == '/' && strings.HasPrefix(schema[i:], "/*"):
+			end := strings.Index(schema[i+2:], "*/")
+			if end < 0 {
+				i = len(schema)
+			} else {
+				i += end + 3
+			}
+			current.WriteByte(' ')
+		case c == '\'' || c == '"':
+			// Las comillas repetidas ('') son parte del texto: se leen como dos textos seguidos
+			end := strings.IndexByte(schema[i+1:], c)
+			if end < 0 {
+				end = len(schema) - i - 1
+			}
+			current.WriteString(schema[i:min(len(schema), i+end+2)])
+			i += end + 1
+		case c == ';':
+			statements = append(statements, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	return append(statements, current.String())
+}
+
 // runMigrations agrega columnas nuevas a tablas existentes
 func runMigrations(database *sql.DB) {
 	migrations := []string{
 		"ALTER TABLE ai_conversations ADD COLUMN model TEXT DEFAULT ''",
+		"ALTER TABLE ai_messages ADD COLUMN sources TEXT DEFAULT ''",
+		"ALTER TABLE ai_messages ADD COLUMN context_dropped INTEGER DEFAULT 0",
+		"ALTER TABLE ai_conversations ADD COLUMN summary TEXT DEFAULT ''",
+		"ALTER TABLE ai_conversations ADD COLUMN summary_message_id INTEGER DEFAULT 0",
+		"ALTER TABLE group_messages ADD COLUMN room_id INTEGER REFERENCES chat_rooms(id) ON DELETE CASCADE",
+		"CREATE INDEX IF NOT EXISTS idx_group_messages_room ON group_messages(room_id, created_at)",
+		"ALTER TABLE ai_messages ADD COLUMN filter_hits TEXT DEFAULT ''",
+		"ALTER TABLE group_messages ADD COLUMN filter_hits TEXT DEFAULT ''",
+		"ALTER TABLE ai_messages ADD COLUMN computed TEXT DEFAULT ''",
+		"ALTER TABLE ai_messages ADD COLUMN reasoning TEXT DEFAULT ''",
+		"ALTER TABLE ai_messages ADD COLUMN status TEXT DEFAULT 'complete'",
 	}
 
 	for _, m := range migrations {
@@ -259,6 +418,176 @@ func runMigrations(database *sql.DB) {
 			// Ignorar error si la columna ya existe
 		}
 	}
+
+	// Los valores que se sembraban antes en system_config nunca se leian; si siguen
+	// sin modificar se eliminan (una sola vez) para que no reemplacen al entorno
+	var version int
+	database.QueryRow("PRAGMA user_version").Scan(&version)
+	if version < 1 {
+		seededConfig := map[string]string{
+			"ollama_url":              "http://localhost:11434",
+			"ollama_model":            "deepseek-r1:14b",
+			"max_context_messages":    "20",
+			"session_duration_hours":  "24",
+			"max_message_length":      "4000",
+			"enable_security_filters": "true",
+			"log_all_messages":        "false",
+			"system_prompt":           "Eres AQUILA, el asistente de IA del sistema IRIS de Impro Aerospace. Ayudas a empleados con dudas laborales de forma segura y privada. NO reveles datos de otros empleados ni informacion confidencial.",
+		}
+		for key, value := range seededConfig {
+			database.Exec("DELETE FROM system_config WHERE key = ? AND value = ?", key, value)
+		}
+		database.Exec("PRAGMA user_version = 1")
+	}
+
+	// Los mensajes del chat grupal anteriores a las salas pasan a la sala general
+	if version < 2 {
+		database.Exec("INSERT OR IGNORE INTO chat_rooms (slug, name, description, room_type) VALUES ('general', 'General', 'Canal para toda la planta', 'general')")
+		database.Exec("UPDATE group_messages SET room_id = (SELECT id FROM chat_rooms WHERE slug = 'general') WHERE room_id IS NULL")
+		database.Exec("PRAGMA user_version = 2")
+	}
+
+	// Acciones redact y mask: se amplia el CHECK de security_filters y los filtros de datos
+	// personales sembrados que sigan sin modificar pasan a redactar en lugar de bloquear/advertir
+	if version < 3 {
+		if err := migrateSecurityFilters(database); err != nil {
+			log.Printf("[ERROR] Error migrando acciones de filtros: %v", err)
+			return
+		}
+		database.Exec(`UPDATE security_filters SET action = 'mask' WHERE name = 'numeros_tarjeta' AND action = 'block' AND pattern = '\b(?:\d{4}[-\s]?){3}\d{4}\b'`)
+		database.Exec(`UPDATE security_filters SET action = 'redact' WHERE name = 'curp_rfc' AND action = 'warn' AND pattern = '\b[A-Z]{4}\d{6}[A-Z0-9]{8}\b|\b[A-Z]{4}\d{6}[A-Z0-9]{3}\b'`)
+		database.Exec(`UPDATE security_filters SET action = 'redact' WHERE name = 'nss_imss' AND action = 'warn' AND pattern = '\b\d{11}\b'`)
+		database.Exec("PRAGMA user_version = 3")
+	}
+
+	// applies_to 'file': filtros que solo revisan el texto extraido de los archivos adjuntos
+	if version < 4 {
+		if err := migrateSecurityFilters(database); err != nil {
+			log.Printf("[ERROR] Error migrando alcance de filtros: %v", err)
+			return
+		}
+		database.Exec("PRAGMA user_version = 4")
+	}
+
+	// Las respuestas guardadas con el razonamiento <think> dentro del texto lo pasan a
+	// su propia columna
+	if version < 5 {
+		if err := migrateReasoning(database); err != nil {
+			log.Printf("[ERROR] Error separando razonamiento de respuestas: %v", err)
+			return
+		}
+		database.Exec("PRAGMA user_version = 5")
+	}
+}
+
+// migrateReasoning separa el razonamiento de las respuestas guardadas antes de la columna
+// reasoning
+func migrateReasoning(database *sql.DB) error {
+	rows, err := database.Query("SELECT id, content FROM ai_messages WHERE role = 'assistant' AND content LIKE '%<think>%'")
+	if err != nil {
+		return err
+	}
+	type legacyMessage struct {
+		id      int64
+		content string
+	}
+	var legacy []legacyMessage
+	for rows.Next() {
+		var m legacyMessage
+		if err := rows.Scan(&m.id, &m.content); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range legacy {
+		reasoning, answer := services.SplitReasoning(m.content)
+		if _, err := database.Exec("UPDATE ai_messages SET content = ?, reasoning = ? WHERE id = ?", answer, reasoning, m.id); err != nil {
+			return err
+		}
+	}
+	if len(legacy) > 0 {
+		log.Printf("[INFO] Razonamiento separado en %d respuestas guardadas", len(legacy))
+	}
+	return nil
+}
+
+// recoverInterruptedGenerations cierra las respuestas que se estaban generando cuando se
+// detuvo el servidor: se conserva lo que alcanzo a guardarse y se descartan las vacias
+func recoverInterruptedGenerations(database *sql.DB) {
+	database.Exec("DELETE FROM ai_messages WHERE status = 'generating' AND content = ''")
+	result, err := database.Exec("UPDATE ai_messages SET status = 'stopped' WHERE status = 'generating'")
+	if err != nil {
+		log.Printf("[ERROR] Error cerrando respuestas interrumpidas: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("[INFO] %d respuestas interrumpidas por el reinicio quedaron como detenidas", n)
+	}
+}
+
+// migrateSecurityFilters reconstruye security_filters con los CHECK de acciones y alcance
+// actuales; SQLite no permite modificar un CHECK existente
+func migrateSecurityFilters(database *sql.DB) error {
+	var tableSQL string
+	if err := database.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'security_filters'").Scan(&tableSQL); err != nil {
+		return err
+	}
+	if strings.Contains(tableSQL, "'file'") {
+		return nil
+	}
+
+	ctx := context.Background()
+	// PRAGMA foreign_keys aplica por conexion, por eso la reconstruccion usa una sola
+	conn, err := database.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`CREATE TABLE security_filters_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT DEFAULT '',
+    filter_type TEXT NOT NULL CHECK (filter_type IN ('keyword', 'regex', 'category')),
+    pattern TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('block', 'warn', 'log', 'redact', 'mask')),
+    is_active INTEGER DEFAULT 1,
+    applies_to TEXT DEFAULT 'both' CHECK (applies_to IN ('input', 'output', 'both', 'file')),
+    severity TEXT DEFAULT 'medium' CHECK (severity IN ('low', 'medium', 'high', 'critical')),
+    created_by INTEGER,
+    created_at DATETIME DEFAULT (datetime('now')),
+    updated_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (created_by) REFERENCES users(id)
+)`,
+		"INSERT INTO security_filters_new SELECT * FROM security_filters",
+		"DROP TABLE security_filters",
+		"ALTER TABLE security_filters_new RENAME TO security_filters",
+		"CREATE INDEX IF NOT EXISTS idx_security_filters_active ON security_filters(is_active)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // ensureAdminUser se asegura de que exista un usuario admin con las credenciales predeterminadas
@@ -307,6 +636,30 @@ func loadTemplates() (*template.Template, error) {
 				return ""
 			}
 		},
+		"knowledgeSources": func(s sql.NullString) []services.KnowledgeSource {
+			var sources []services.KnowledgeSource
+			if s.Valid && s.String != "" {
+				json.Unmarshal([]byte(s.String), &sources)
+			}
+			return sources
+		},
+		"computedResults": func(s sql.NullString) []services.TableResult {
+			var results []services.TableResult
+			if s.Valid && s.String != "" {
+				json.Unmarshal([]byte(s.String), &results)
+			}
+			return results
+		},
+		"formatSize": func(bytes int64) string {
+			switch {
+			case bytes < 1024:
+				return fmt.Sprintf("%d B", bytes)
+			case bytes < 1024*1024:
+				return fmt.Sprintf("%.1f KB", float64(bytes)/1024)
+			default:
+				return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+			}
+		},
 		"formatDateShort": func(t interface{}) string {
 			switch v := t.(type) {
 			case sql.NullTime:
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSchema(t *testing.T) {
+	schema := `-- Salas de chat; una por area
+CREATE TABLE a (id INTEGER); -- comentario; con punto y coma
+/* bloque; de comentario */
+CREATE TABLE b (name TEXT DEFAULT 'x;y', note TEXT DEFAULT 'it''s; ok');
+CREATE INDEX idx_b ON b(name)`
+
+	var got []string
+	for _, statement := range splitSchema(schema) {
+		if statement = strings.Join(strings.Fields(statement), " "); statement != "" {
+			got = append(got, statement)
+		}
+	}
+	want := []string{
+		"CREATE TABLE a (id INTEGER)",
+		"CREATE TABLE b (name TEXT DEFAULT 'x;y', note TEXT DEFAULT 'it''s; ok')",
+		"CREATE INDEX idx_b ON b(name)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sentencias = %q, se esperaban %q", got, want)
+	}
+}
@@ -74,8 +74,8 @@ SELECT COUNT(*) as count FROM sessions WHERE expires_at > datetime('now');
 -- ============ GROUP CHAT ============
 
 -- name: CreateGroupMessage :one
-INSERT INTO group_messages (user_id, content)
-VALUES (?, ?)
+INSERT INTO group_messages (user_id, content, room_id, filter_hits)
+VALUES (?, ?, ?, ?)
 RETURNING *;
 
 -- name: GetRecentGroupMessages :many
@@ -84,7 +84,8 @@ SELECT
     u.id as user_id, u.nombre, u.nomina
 FROM group_messages gm
 JOIN users u ON gm.user_id = u.id
-ORDER BY gm.created_at DESC
+WHERE gm.room_id = ?
+ORDER BY gm.created_at DESC, gm.id DESC
 LIMIT ?;
 
 -- name: GetGroupMessagesSince :many
@@ -93,12 +94,161 @@ SELECT
     u.id as user_id, u.nombre, u.nomina
 FROM group_messages gm
 JOIN users u ON gm.user_id = u.id
-WHERE gm.id > ?
-ORDER BY gm.created_at ASC;
+WHERE gm.room_id = ? AND gm.id > ?
+ORDER BY gm.id ASC;
 
 -- name: CountGroupMessages :one
 SELECT COUNT(*) as count FROM group_messages;
 
+-- ============ CHAT ROOMS ============
+
+-- name: CreateChatRoom :one
+INSERT INTO chat_rooms (slug, name, description, room_type, departamento, is_private, created_by)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetChatRoomByID :one
+SELECT * FROM chat_rooms WHERE id = ?;
+
+-- name: GetChatRoomBySlug :one
+SELECT * FROM chat_rooms WHERE slug = ?;
+
+-- name: GetAllChatRooms :many
+SELECT
+    r.id, r.slug, r.name, r.description, r.room_type, r.departamento, r.is_private, r.created_at,
+    (SELECT COUNT(*) FROM chat_room_members m WHERE m.room_id = r.id) as member_count
+FROM chat_rooms r
+ORDER BY CASE r.room_type WHEN 'general' THEN 0 WHEN 'department' THEN 1 WHEN 'project' THEN 2 ELSE 3 END, r.name;
+
+-- name: GetUserChatRooms :many
+SELECT r.id, r.slug, r.name, r.description, r.room_type, r.is_private, m.role
+FROM chat_rooms r
+JOIN chat_room_members m ON m.room_id = r.id
+WHERE m.user_id = ?
+ORDER BY CASE r.room_type WHEN 'general' THEN 0 WHEN 'department' THEN 1 WHEN 'project' THEN 2 ELSE 3 END, r.name;
+
+-- name: GetJoinableChatRooms :many
+SELECT id, slug, name, description, room_type
+FROM chat_rooms
+WHERE is_private = 0
+  AND id NOT IN (SELECT room_id FROM chat_room_members WHERE user_id = ?)
+ORDER BY name;
+
+-- name: UpdateChatRoomPrivacy :execresult
+UPDATE chat_rooms SET is_private = ? WHERE id = ?;
+
+-- name: DeleteChatRoom :execresult
+DELETE FROM chat_rooms WHERE id = ? AND room_type != 'general';
+
+-- name: AddChatRoomMember :execresult
+INSERT OR IGNORE INTO chat_room_members (room_id, user_id, role)
+VALUES (?, ?, ?);
+
+-- name: RemoveChatRoomMember :execresult
+DELETE FROM chat_room_members WHERE room_id = ? AND user_id = ?;
+
+-- name: GetChatRoomMember :one
+SELECT room_id, user_id, role, joined_at
+FROM chat_room_members
+WHERE room_id = ? AND user_id = ?;
+
+-- name: GetChatRoomMembers :many
+SELECT u.id, u.nomina, u.nombre, u.departamento, m.role, m.joined_at
+FROM chat_room_members m
+JOIN users u ON m.user_id = u.id
+WHERE m.room_id = ?
+ORDER BY u.nombre;
+
+-- ============ DIRECT MESSAGES ============
+
+-- name: CreateDMThread :one
+INSERT INTO dm_threads (title, is_group, created_by)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: AddDMParticipant :execresult
+INSERT OR IGNORE INTO dm_participants (thread_id, user_id)
+VALUES (?, ?);
+
+-- name: GetDirectThreadBetween :one
+SELECT t.id FROM dm_threads t
+JOIN dm_participants a ON a.thread_id = t.id AND a.user_id = ?
+JOIN dm_participants b ON b.thread_id = t.id AND b.user_id = ?
+WHERE t.is_group = 0
+LIMIT 1;
+
+-- name: GetDMThreadByID :one
+SELECT * FROM dm_threads WHERE id = ?;
+
+-- name: GetDMParticipant :one
+SELECT thread_id, user_id, last_read_message_id, joined_at
+FROM dm_participants
+WHERE thread_id = ? AND user_id = ?;
+
+-- name: GetDMParticipantIDs :many
+SELECT user_id FROM dm_participants WHERE thread_id = ?;
+
+-- name: GetUserDMThreads :many
+SELECT
+    t.id, t.title, t.is_group, t.updated_at,
+    (SELECT GROUP_CONCAT(u.nombre, ', ') FROM dm_participants p2 JOIN users u ON p2.user_id = u.id
+     WHERE p2.thread_id = t.id AND p2.user_id != p.user_id) as participant_names,
+    (SELECT COUNT(*) FROM direct_messages m
+     WHERE m.thread_id = t.id AND m.id > p.last_read_message_id AND m.user_id != p.user_id) as unread_count
+FROM dm_threads t
+JOIN dm_participants p ON p.thread_id = t.id
+WHERE p.user_id = ?
+ORDER BY t.updated_at DESC
+LIMIT 50;
+
+-- name: CountUnreadDirectMessages :one
+SELECT COUNT(*) as count
+FROM direct_messages m
+JOIN dm_participants p ON p.thread_id = m.thread_id
+WHERE p.user_id = ? AND m.id > p.last_read_message_id AND m.user_id != p.user_id;
+
+-- name: CreateDirectMessage :one
+INSERT INTO direct_messages (thread_id, user_id, content)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: TouchDMThread :execresult
+UPDATE dm_threads SET updated_at = datetime('now') WHERE id = ?;
+
+-- name: GetRecentDirectMessages :many
+SELECT
+    dm.id, dm.content, dm.created_at,
+    u.id as user_id, u.nombre, u.nomina
+FROM direct_messages dm
+JOIN users u ON dm.user_id = u.id
+WHERE dm.thread_id = ?
+ORDER BY dm.id DESC
+LIMIT ?;
+
+-- name: MarkDMThreadRead :execresult
+UPDATE dm_participants
+SET last_read_message_id = (SELECT COALESCE(MAX(id), 0) FROM direct_messages WHERE direct_messages.thread_id = dm_participants.thread_id)
+WHERE thread_id = ? AND user_id = ?;
+
+-- ============ CHAT EVENTS ============
+
+-- name: CreateChatEvent :one
+INSERT INTO chat_events (kind, room_id, user_ids, payload)
+VALUES (?, ?, ?, ?)
+RETURNING id;
+
+-- name: GetChatEventsAfter :many
+SELECT id, kind, room_id, user_ids, payload FROM chat_events
+WHERE id > ?
+ORDER BY id ASC
+LIMIT ?;
+
+-- name: GetLatestChatEventID :one
+SELECT CAST(COALESCE(MAX(id), 0) AS INTEGER) as id FROM chat_events;
+
+-- name: DeleteOldChatEvents :execresult
+DELETE FROM chat_events WHERE created_at < datetime('now', '-10 minutes');
+
 -- ============ AI CONVERSATIONS ============
 
 -- name: CreateAIConversation :one
@@ -130,6 +280,16 @@ UPDATE ai_conversations
 SET updated_at = datetime('now')
 WHERE id = ?;
 
+-- name: UpdateConversationSummary :execresult
+UPDATE ai_conversations
+SET summary = ?
+WHERE id = ? AND user_id = ?;
+
+-- name: SaveConversationSummary :execresult
+UPDATE ai_conversations
+SET summary = sqlc.arg(summary), summary_message_id = sqlc.arg(summary_message_id)
+WHERE id = sqlc.arg(id) AND summary = sqlc.arg(previous_summary);
+
 -- name: DeleteConversation :execresult
 DELETE FROM ai_conversations WHERE id = ? AND user_id = ?;
 
@@ -139,12 +299,18 @@ SELECT COUNT(*) as count FROM ai_conversations WHERE user_id = ?;
 -- ============ AI MESSAGES ============
 
 -- name: CreateAIMessage :one
-INSERT INTO ai_messages (conversation_id, role, content, filtered, filter_reason)
-VALUES (?, ?, ?, ?, ?)
+INSERT INTO ai_messages (conversation_id, role, content, filtered, filter_reason, filter_hits)
+VALUES (?, ?, ?, ?, ?, ?)
 RETURNING *;
 
+-- name: SetAIMessageSources :execresult
+UPDATE ai_messages SET sources = ? WHERE id = ?;
+
+-- name: SetAIMessageContextDropped :execresult
+UPDATE ai_messages SET context_dropped = ? WHERE id = ?;
+
 -- name: GetConversationMessages :many
-SELECT id, role, content, filtered, filter_reason, created_at
+SELECT id, role, content, filtered, filter_reason, created_at, sources, context_dropped
 FROM ai_messages
 WHERE conversation_id = ?
 ORDER BY created_at ASC;
@@ -152,13 +318,22 @@ ORDER BY created_at ASC;
 -- name: GetRecentConversationMessages :many
 SELECT id, role, content, filtered, filter_reason, created_at
 FROM ai_messages
-WHERE conversation_id = ?
-ORDER BY created_at DESC
+WHERE conversation_id = ? AND id > ?
+ORDER BY created_at DESC, id DESC
 LIMIT ?;
 
+-- name: GetConversationMessagesAfter :many
+SELECT id, role, content, filtered
+FROM ai_messages
+WHERE conversation_id = ? AND id > ?
+ORDER BY id ASC;
+
 -- name: CountConversationMessages :one
 SELECT COUNT(*) as count FROM ai_messages WHERE conversation_id = ?;
 
+-- name: CountConversationMessagesAfter :one
+SELECT COUNT(*) as count FROM ai_messages WHERE conversation_id = ? AND id > ? AND status != 'generating';
+
 -- name: GetFilteredMessages :many
 SELECT
     m.id, m.role, m.content, m.filter_reason, m.created_at,
@@ -506,7 +681,34 @@ WHERE id = ? AND status = 'pending';
 -- name: CountPendingQuestions :one
 SELECT COUNT(*) as count FROM unanswered_questions WHERE status = 'pending';
 
+-- name: CountPendingQuestionsByText :one
+SELECT COUNT(*) as count FROM unanswered_questions WHERE status = 'pending' AND question = ?;
+
 -- name: GetKnowledgeContext :many
 SELECT title, content, category FROM knowledge_base
 WHERE is_active = 1
 ORDER BY category, created_at DESC;
+
+-- ============ KNOWLEDGE CHUNKS ============
+
+-- name: CreateKnowledgeChunk :one
+INSERT INTO knowledge_chunks (knowledge_id, chunk_index, content, embedding)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: DeleteKnowledgeChunks :execresult
+DELETE FROM knowledge_chunks WHERE knowledge_id = ?;
+
+-- name: GetActiveKnowledgeChunks :many
+SELECT
+    kc.id, kc.knowledge_id, kc.chunk_index, kc.content, kc.embedding,
+    kb.title, kb.category
+FROM knowledge_chunks kc
+JOIN knowledge_base kb ON kc.knowledge_id = kb.id
+WHERE kb.is_active = 1
+ORDER BY kc.knowledge_id, kc.chunk_index;
+
+-- name: GetUnindexedKnowledgeIDs :many
+SELECT kb.id FROM knowledge_base kb
+WHERE kb.is_active = 1
+  AND NOT EXISTS (SELECT 1 FROM knowledge_chunks kc WHERE kc.knowledge_id = kb.id);
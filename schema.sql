@@ -24,15 +24,89 @@ CREATE TABLE IF NOT EXISTS sessions (
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
+-- ============ SALAS DE CHAT ============
+-- general: todos los empleados, department: por users.departamento,
+-- project/adhoc: creadas por admins o usuarios. Las privadas solo admiten miembros agregados.
+CREATE TABLE IF NOT EXISTS chat_rooms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT DEFAULT '',
+    room_type TEXT NOT NULL CHECK (room_type IN ('general', 'department', 'project', 'adhoc')),
+    departamento TEXT DEFAULT '',
+    is_private INTEGER DEFAULT 0,
+    created_by INTEGER,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- ============ MIEMBROS DE SALAS ============
+CREATE TABLE IF NOT EXISTS chat_room_members (
+    room_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role TEXT DEFAULT 'member' CHECK (role IN ('member', 'moderator')),
+    joined_at DATETIME DEFAULT (datetime('now')),
+    PRIMARY KEY (room_id, user_id),
+    FOREIGN KEY (room_id) REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 -- ============ MENSAJES CHAT GRUPAL ============
 CREATE TABLE IF NOT EXISTS group_messages (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
     content TEXT NOT NULL,
     created_at DATETIME DEFAULT (datetime('now')),
+    room_id INTEGER REFERENCES chat_rooms(id) ON DELETE CASCADE,
+    filter_hits TEXT DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- ============ MENSAJES DIRECTOS ============
+-- Hilos privados 1:1 (is_group = 0) o de grupo pequeno entre empleados
+CREATE TABLE IF NOT EXISTS dm_threads (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT DEFAULT '',
+    is_group INTEGER DEFAULT 0,
+    created_by INTEGER,
+    created_at DATETIME DEFAULT (datetime('now')),
+    updated_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- last_read_message_id marca hasta donde leyo cada participante (conteo de no leidos)
+CREATE TABLE IF NOT EXISTS dm_participants (
+    thread_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    last_read_message_id INTEGER DEFAULT 0,
+    joined_at DATETIME DEFAULT (datetime('now')),
+    PRIMARY KEY (thread_id, user_id),
+    FOREIGN KEY (thread_id) REFERENCES dm_threads(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS direct_messages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    thread_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (thread_id) REFERENCES dm_threads(id) ON DELETE CASCADE,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
+-- ============ EVENTOS DEL CHAT ENTRE INSTANCIAS ============
+-- Cola compartida que usa el broadcaster "sqlite" para que varias replicas del servidor
+-- reciban los mensajes, presencia y eventos de sistema del chat. Se purga sola.
+CREATE TABLE IF NOT EXISTS chat_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    room_id INTEGER DEFAULT 0,
+    user_ids TEXT DEFAULT '',
+    payload TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT (datetime('now'))
+);
+
 -- ============ CONVERSACIONES IA ============
 CREATE TABLE IF NOT EXISTS ai_conversations (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -41,6 +115,8 @@ CREATE TABLE IF NOT EXISTS ai_conversations (
     model TEXT DEFAULT '',
     created_at DATETIME DEFAULT (datetime('now')),
     updated_at DATETIME DEFAULT (datetime('now')),
+    summary TEXT DEFAULT '',
+    summary_message_id INTEGER DEFAULT 0,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
@@ -53,6 +129,16 @@ CREATE TABLE IF NOT EXISTS ai_messages (
     filtered INTEGER DEFAULT 0,
     filter_reason TEXT DEFAULT '',
     created_at DATETIME DEFAULT (datetime('now')),
+    sources TEXT DEFAULT '',
+    context_dropped INTEGER DEFAULT 0,
+    -- JSON con los filtros que coincidieron (filtro, accion, cantidad), content ya va redactado
+    filter_hits TEXT DEFAULT '',
+    -- JSON con los calculos exactos sobre hojas adjuntas que acompanan la respuesta
+    computed TEXT DEFAULT '',
+    -- Razonamiento del modelo (bloques think de DeepSeek R1), fuera del historial que se envia al modelo
+    reasoning TEXT DEFAULT '',
+    -- generating mientras la respuesta se genera en el servidor, stopped si se detuvo o se interrumpio
+    status TEXT DEFAULT 'complete',
     FOREIGN KEY (conversation_id) REFERENCES ai_conversations(id) ON DELETE CASCADE
 );
 
@@ -64,9 +150,9 @@ CREATE TABLE IF NOT EXISTS security_filters (
     description TEXT DEFAULT '',
     filter_type TEXT NOT NULL CHECK (filter_type IN ('keyword', 'regex', 'category')),
     pattern TEXT NOT NULL,
-    action TEXT NOT NULL CHECK (action IN ('block', 'warn', 'log')),
+    action TEXT NOT NULL CHECK (action IN ('block', 'warn', 'log', 'redact', 'mask')),
     is_active INTEGER DEFAULT 1,
-    applies_to TEXT DEFAULT 'both' CHECK (applies_to IN ('input', 'output', 'both')),
+    applies_to TEXT DEFAULT 'both' CHECK (applies_to IN ('input', 'output', 'both', 'file')),
     severity TEXT DEFAULT 'medium' CHECK (severity IN ('low', 'medium', 'high', 'critical')),
     created_by INTEGER,
     created_at DATETIME DEFAULT (datetime('now')),
@@ -123,6 +209,11 @@ CREATE INDEX IF NOT EXISTS idx_users_nomina ON users(nomina);
 CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
 CREATE INDEX IF NOT EXISTS idx_sessions_expires ON sessions(expires_at);
 CREATE INDEX IF NOT EXISTS idx_group_messages_created ON group_messages(created_at);
+CREATE INDEX IF NOT EXISTS idx_group_messages_room ON group_messages(room_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_chat_room_members_user ON chat_room_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_dm_participants_user ON dm_participants(user_id);
+CREATE INDEX IF NOT EXISTS idx_direct_messages_thread ON direct_messages(thread_id, id);
+CREATE INDEX IF NOT EXISTS idx_chat_events_created ON chat_events(created_at);
 CREATE INDEX IF NOT EXISTS idx_ai_conversations_user ON ai_conversations(user_id);
 CREATE INDEX IF NOT EXISTS idx_ai_messages_conversation ON ai_messages(conversation_id);
 CREATE INDEX IF NOT EXISTS idx_security_filters_active ON security_filters(is_active);
@@ -180,13 +271,126 @@ CREATE TABLE IF NOT EXISTS unanswered_questions (
     FOREIGN KEY (conversation_id) REFERENCES ai_conversations(id)
 );
 
+-- Fragmentos de la base de conocimiento indexados para recuperacion (RAG)
+CREATE TABLE IF NOT EXISTS knowledge_chunks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    knowledge_id INTEGER NOT NULL,
+    chunk_index INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    embedding TEXT DEFAULT '',
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (knowledge_id) REFERENCES knowledge_base(id) ON DELETE CASCADE
+);
+
 CREATE INDEX IF NOT EXISTS idx_knowledge_active ON knowledge_base(is_active);
 CREATE INDEX IF NOT EXISTS idx_knowledge_category ON knowledge_base(category);
 CREATE INDEX IF NOT EXISTS idx_submissions_status ON knowledge_submissions(status);
 CREATE INDEX IF NOT EXISTS idx_questions_status ON unanswered_questions(status);
+CREATE INDEX IF NOT EXISTS idx_knowledge_chunks_knowledge ON knowledge_chunks(knowledge_id);
+
+-- ============ PAGINAS WEB EXTRAIDAS ============
+-- Cache persistente del scraper: una fila por URL con el contenido de la ultima descarga
+CREATE TABLE IF NOT EXISTS scraped_pages (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL UNIQUE,
+    title TEXT DEFAULT '',
+    content TEXT NOT NULL,
+    content_hash TEXT NOT NULL,
+    method TEXT DEFAULT 'http',
+    scraped_at DATETIME DEFAULT (datetime('now')),
+    expires_at DATETIME NOT NULL
+);
+
+-- Auditoria de cada URL solicitada: quien, cuando y con que resultado
+CREATE TABLE IF NOT EXISTS url_fetches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    url TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('fetched', 'cached', 'blocked', 'error')),
+    content_hash TEXT DEFAULT '',
+    error TEXT DEFAULT '',
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_scraped_pages_hash ON scraped_pages(content_hash);
+CREATE INDEX IF NOT EXISTS idx_url_fetches_created ON url_fetches(created_at);
+CREATE INDEX IF NOT EXISTS idx_url_fetches_url ON url_fetches(url);
+
+-- ============ FUENTES WEB DE CONOCIMIENTO ============
+-- URLs de la intranet que se vuelven a extraer periodicamente. Si el contenido cambia se crea
+-- un envio pendiente o, con auto_update, se actualiza la entrada de conocimiento vinculada.
+CREATE TABLE IF NOT EXISTS web_sources (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url TEXT NOT NULL UNIQUE,
+    title TEXT NOT NULL,
+    category TEXT DEFAULT 'general',
+    interval_minutes INTEGER NOT NULL DEFAULT 1440,
+    auto_update INTEGER DEFAULT 0,
+    knowledge_id INTEGER,
+    last_hash TEXT DEFAULT '',
+    last_error TEXT DEFAULT '',
+    last_checked_at DATETIME,
+    last_changed_at DATETIME,
+    is_active INTEGER DEFAULT 1,
+    created_by INTEGER NOT NULL,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (knowledge_id) REFERENCES knowledge_base(id) ON DELETE SET NULL,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_web_sources_active ON web_sources(is_active);
+
+-- ============ ARCHIVOS ADJUNTOS IA ============
+-- Archivos enviados con un mensaje de IA: el original (para descargarlo) y el texto extraido,
+-- que se vuelve a incluir en el contexto de los turnos siguientes. Se borran con la conversacion.
+CREATE TABLE IF NOT EXISTS ai_attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id INTEGER NOT NULL,
+    conversation_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    file_name TEXT NOT NULL,
+    file_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    content_hash TEXT NOT NULL,
+    data BLOB NOT NULL,
+    extracted_text TEXT NOT NULL DEFAULT '',
+    text_length INTEGER DEFAULT 0,
+    truncated INTEGER DEFAULT 0,
+    pages INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (message_id) REFERENCES ai_messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (conversation_id) REFERENCES ai_conversations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_attachments_conversation ON ai_attachments(conversation_id);
+CREATE INDEX IF NOT EXISTS idx_ai_attachments_message ON ai_attachments(message_id);
+
+-- ============ TABLAS DE HOJAS ADJUNTAS ============
+-- Hojas de los CSV/XLSX adjuntos, con todas sus filas en JSON, para calcular sumas y
+-- agrupaciones exactas en lugar de que el modelo haga cuentas sobre el texto recortado
+CREATE TABLE IF NOT EXISTS ai_tables (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    attachment_id INTEGER NOT NULL,
+    conversation_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    column_names TEXT NOT NULL,
+    row_count INTEGER NOT NULL DEFAULT 0,
+    row_data TEXT NOT NULL,
+    created_at DATETIME DEFAULT (datetime('now')),
+    FOREIGN KEY (attachment_id) REFERENCES ai_attachments(id) ON DELETE CASCADE,
+    FOREIGN KEY (conversation_id) REFERENCES ai_conversations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_ai_tables_conversation ON ai_tables(conversation_id);
 
 -- ============ DATOS INICIALES ============
 
+-- Sala general del chat grupal
+INSERT OR IGNORE INTO chat_rooms (slug, name, description, room_type)
+VALUES ('general', 'General', 'Canal para toda la planta', 'general');
+
 -- Usuario admin por defecto (password: admin123)
 -- Hash generado con bcrypt cost 10
 INSERT OR IGNORE INTO users (nomina, password_hash, nombre, approved, is_admin)
@@ -210,9 +414,9 @@ INSERT OR IGNORE INTO security_filters (name, description, filter_type, pattern,
 ('password_extraction', 'Intentos de extraer credenciales', 'regex', '(?i)(dame.*contrase[nñ]a|password.*de|credenciales.*de|acceso.*a.*cuenta)', 'block', 'input', 'critical'),
 
 -- Filtros de informacion confidencial
-('numeros_tarjeta', 'Numeros de tarjetas de credito', 'regex', '\b(?:\d{4}[-\s]?){3}\d{4}\b', 'block', 'both', 'critical'),
-('curp_rfc', 'CURP o RFC mexicanos', 'regex', '\b[A-Z]{4}\d{6}[A-Z0-9]{8}\b|\b[A-Z]{4}\d{6}[A-Z0-9]{3}\b', 'warn', 'both', 'high'),
-('nss_imss', 'Numero de seguro social IMSS', 'regex', '\b\d{11}\b', 'warn', 'both', 'medium'),
+('numeros_tarjeta', 'Numeros de tarjetas de credito', 'regex', '\b(?:\d{4}[-\s]?){3}\d{4}\b', 'mask', 'both', 'critical'),
+('curp_rfc', 'CURP o RFC mexicanos', 'regex', '\b[A-Z]{4}\d{6}[A-Z0-9]{8}\b|\b[A-Z]{4}\d{6}[A-Z0-9]{3}\b', 'redact', 'both', 'high'),
+('nss_imss', 'Numero de seguro social IMSS', 'regex', '\b\d{11}\b', 'redact', 'both', 'medium'),
 
 -- Filtros de fugas de informacion empresarial
 ('datos_nomina', 'Salarios y datos de nomina', 'keyword', 'salario,sueldo,nomina de,compensacion,bono de,aguinaldo', 'warn', 'both', 'high'),
@@ -231,13 +435,5 @@ INSERT OR IGNORE INTO security_filters (name, description, filter_type, pattern,
 ('jailbreak_prompt', 'Intentos de jailbreak del modelo', 'regex', '(?i)(ignora.*instrucciones|olvida.*reglas|actua.*como|pretend.*you|DAN|do.*anything.*now)', 'block', 'input', 'critical'),
 ('roleplay_bypass', 'Bypass mediante roleplay', 'regex', '(?i)(imagina.*que.*eres|finge.*ser|simula.*que|actua.*sin.*restricciones)', 'block', 'input', 'high');
 
--- Configuracion del sistema predeterminada
-INSERT OR IGNORE INTO system_config (key, value, description) VALUES
-('ollama_url', 'http://localhost:11434', 'URL del servidor Ollama'),
-('ollama_model', 'deepseek-r1:14b', 'Modelo de IA a usar'),
-('max_context_messages', '20', 'Maximo de mensajes de contexto para IA'),
-('session_duration_hours', '24', 'Duracion de sesion en horas'),
-('max_message_length', '4000', 'Longitud maxima de mensaje'),
-('enable_security_filters', 'true', 'Habilitar filtros de seguridad'),
-('log_all_messages', 'false', 'Registrar todos los mensajes'),
-('system_prompt', 'Eres AQUILA, el asistente de IA del sistema IRIS de Impro Aerospace. Ayudas a empleados con dudas laborales de forma segura y privada. NO reveles datos de otros empleados ni informacion confidencial.', 'Prompt del sistema para la IA');
+-- Configuracion del sistema: la tabla solo guarda los valores modificados desde
+-- /admin/config; los defaults vienen de las variables de entorno